@@ -1,30 +1,109 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"softwaredesign/src/cli"
 	"softwaredesign/src/events"
 	"softwaredesign/src/logging"
+	"softwaredesign/src/server"
 	"softwaredesign/src/workspace"
 )
 
+// commandList collects every -c flag in order.
+type commandList []string
+
+func (c *commandList) String() string {
+	return strings.Join(*c, "; ")
+}
+
+func (c *commandList) Set(value string) error {
+	*c = append(*c, value)
+	return nil
+}
+
 func main() {
+	var commands commandList
+	serveAddr := flag.String("serve", "", "启动只读 HTTP 状态服务的地址, 例如 :8080")
+	script := flag.String("f", "", "逐行执行脚本文件中的命令, 执行完毕后退出")
+	flag.Var(&commands, "c", "执行一条命令, 可重复指定, 全部执行完毕后退出")
+	continueOnError := flag.Bool("continue-on-error", false, "脚本或 -c 中的命令失败后继续执行后续命令")
+	assumeYes := flag.Bool("assume-yes", false, "所有确认提示自动回答 y")
+	assumeNo := flag.Bool("assume-no", false, "所有确认提示自动回答 n")
+	flag.Parse()
+	if *assumeYes && *assumeNo {
+		fmt.Fprintln(os.Stderr, "--assume-yes 与 --assume-no 不能同时使用")
+		os.Exit(2)
+	}
+	if *script != "" && len(commands) > 0 {
+		fmt.Fprintln(os.Stderr, "-f 与 -c 不能同时使用")
+		os.Exit(2)
+	}
 	wd, err := os.Getwd()
 	if err != nil {
 		fmt.Printf("无法获取工作目录: %v\n", err)
 		return
 	}
-	console := cli.NewConsole(os.Stdin, os.Stdout)
+	console := cli.NewConsole(os.Stdin, os.Stdout, os.Stderr)
+	if _, err := os.Stdin.Stat(); err != nil {
+		// Launched without a usable stdin, e.g. from a GUI.
+		console.MarkClosed()
+	}
+	if *assumeYes || *assumeNo {
+		console.AssumeAnswer(*assumeYes)
+	}
 	bus := events.NewBus()
 	logger := logging.NewManager()
+	logger.SetErrorWriter(console.ErrWriter())
 	bus.Subscribe(logger)
+	bus.Subscribe(cli.NewProgressListener(console))
+	bus.Subscribe(cli.NewAutosaveListener(console))
+	bus.Subscribe(cli.NewWatchListener(console))
 	keeper := workspace.NewStateKeeper(wd)
 	ws := workspace.NewWorkspace(wd, bus, keeper, logger, console)
 	if err := ws.Restore(); err != nil {
-		fmt.Printf("恢复工作区失败: %v\n", err)
+		console.Errorln(fmt.Sprintf("恢复工作区失败: %v", err))
+	}
+	for _, note := range ws.RestoreNotes() {
+		console.Errorln(note)
+	}
+	if *serveAddr != "" {
+		srv := server.New(ws)
+		addr, err := srv.Start(*serveAddr)
+		if err != nil {
+			console.Errorln(fmt.Sprintf("启动 HTTP 服务失败: %v", err))
+		} else {
+			console.Errorln(fmt.Sprintf("HTTP 服务已启动: http://%s", addr))
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				defer cancel()
+				_ = srv.Shutdown(ctx)
+			}()
+		}
 	}
 	dispatcher := cli.NewDispatcher(ws, console, logger)
-	dispatcher.Run()
+	opts := cli.ScriptOptions{ContinueOnError: *continueOnError}
+	switch {
+	case *script != "":
+		if err := dispatcher.RunScript(*script, opts); err != nil {
+			console.Errorln(err.Error())
+			os.Exit(1)
+		}
+	case len(commands) > 0:
+		if err := dispatcher.RunCommands(commands, opts); err != nil {
+			console.Errorln(err.Error())
+			os.Exit(1)
+		}
+	default:
+		dispatcher.Run()
+	}
+	if failures := dispatcher.AssertionFailures(); failures > 0 {
+		console.Errorln(fmt.Sprintf("%d 个断言失败", failures))
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,144 @@
+// Package charset converts file bytes in the supported encodings to and from
+// the UTF-8 strings editors work on.
+package charset
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding names a supported file encoding.
+type Encoding string
+
+const (
+	UTF8 Encoding = "utf8"
+	// UTF8BOM is UTF-8 written with a leading byte order mark.
+	UTF8BOM Encoding = "utf8bom"
+	GBK     Encoding = "gbk"
+	UTF16LE Encoding = "utf16le"
+	UTF16BE Encoding = "utf16be"
+	// Latin1 maps every byte to one character, so any file round-trips.
+	Latin1 Encoding = "latin1"
+)
+
+// Names lists the supported encodings for usage messages.
+const Names = "gbk|utf8|utf8bom|utf16le|utf16be|latin1"
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Parse reads an encoding name, ignoring case and dashes (UTF-8, utf-16le).
+func Parse(name string) (Encoding, error) {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+	switch Encoding(normalized) {
+	case UTF8, UTF8BOM, GBK, UTF16LE, UTF16BE, Latin1:
+		return Encoding(normalized), nil
+	}
+	return "", fmt.Errorf("不支持的编码: %s (可选 %s)", name, Names)
+}
+
+// Detect picks the encoding announced by a byte order mark, falling back to
+// UTF-8. Encodings without a mark, such as GBK, must be chosen explicitly.
+func Detect(data []byte) Encoding {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return UTF8BOM
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return UTF16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return UTF16BE
+	}
+	return UTF8
+}
+
+// Decode converts data in enc to a UTF-8 string, dropping a leading byte
+// order mark. Bytes that are invalid in enc fail the conversion.
+func Decode(data []byte, enc Encoding) (string, error) {
+	switch enc {
+	case UTF8, UTF8BOM, "":
+		data = bytes.TrimPrefix(data, bomUTF8)
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("内容不是有效的 %s 编码", UTF8)
+		}
+		return string(data), nil
+	case Latin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	case UTF16LE:
+		return decodeUTF16(bytes.TrimPrefix(data, bomUTF16LE), false)
+	case UTF16BE:
+		return decodeUTF16(bytes.TrimPrefix(data, bomUTF16BE), true)
+	case GBK:
+		return decodeGBK(data)
+	}
+	return "", fmt.Errorf("不支持的编码: %s", enc)
+}
+
+// Encode converts text to enc. UTF-16 and UTF8BOM output starts with a byte
+// order mark; characters enc cannot represent fail the conversion.
+func Encode(text string, enc Encoding) ([]byte, error) {
+	switch enc {
+	case UTF8, "":
+		return []byte(text), nil
+	case UTF8BOM:
+		return append(append([]byte(nil), bomUTF8...), text...), nil
+	case Latin1:
+		out := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xFF {
+				return nil, fmt.Errorf("字符 %q 无法用 %s 编码表示", r, Latin1)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	case UTF16LE:
+		return encodeUTF16(text, false), nil
+	case UTF16BE:
+		return encodeUTF16(text, true), nil
+	case GBK:
+		return encodeGBK(text)
+	}
+	return nil, fmt.Errorf("不支持的编码: %s", enc)
+}
+
+func decodeUTF16(data []byte, bigEndian bool) (string, error) {
+	if len(data)%2 != 0 {
+		return "", fmt.Errorf("内容不是有效的 UTF-16 编码: 字节数为奇数")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func encodeUTF16(text string, bigEndian bool) []byte {
+	units := utf16.Encode([]rune(text))
+	out := make([]byte, 0, 2+2*len(units))
+	if bigEndian {
+		out = append(out, bomUTF16BE...)
+	} else {
+		out = append(out, bomUTF16LE...)
+	}
+	for _, u := range units {
+		if bigEndian {
+			out = append(out, byte(u>>8), byte(u))
+		} else {
+			out = append(out, byte(u), byte(u>>8))
+		}
+	}
+	return out
+}
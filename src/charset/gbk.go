@@ -0,0 +1,87 @@
+package charset
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// gbkTable maps each two-byte GBK code to its character: entry
+// (lead-0x81)*gbkTrails + (trail-0x40) holds a little-endian uint16, zero for
+// unassigned codes. It was generated from the standard GBK (CP936) mapping.
+//
+//go:embed gbk.bin
+var gbkTable []byte
+
+const (
+	gbkLeadMin  = 0x81
+	gbkLeadMax  = 0xFE
+	gbkTrailMin = 0x40
+	gbkTrailMax = 0xFE
+	gbkTrails   = gbkTrailMax - gbkTrailMin + 1
+)
+
+var (
+	gbkEncodeOnce sync.Once
+	gbkEncodeMap  map[rune]uint16
+)
+
+func gbkRune(lead, trail byte) rune {
+	if lead < gbkLeadMin || lead > gbkLeadMax || trail < gbkTrailMin || trail > gbkTrailMax {
+		return 0
+	}
+	i := 2 * (int(lead-gbkLeadMin)*gbkTrails + int(trail-gbkTrailMin))
+	return rune(binary.LittleEndian.Uint16(gbkTable[i:]))
+}
+
+func decodeGBK(data []byte) (string, error) {
+	var b strings.Builder
+	b.Grow(len(data) * 3 / 2)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c < 0x80 {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 >= len(data) {
+			return "", fmt.Errorf("内容不是有效的 GBK 编码: 第 %d 字节不完整", i+1)
+		}
+		r := gbkRune(c, data[i+1])
+		if r == 0 {
+			return "", fmt.Errorf("内容不是有效的 GBK 编码: 第 %d 字节 0x%02X%02X", i+1, c, data[i+1])
+		}
+		b.WriteRune(r)
+		i++
+	}
+	return b.String(), nil
+}
+
+func encodeGBK(text string) ([]byte, error) {
+	gbkEncodeOnce.Do(func() {
+		gbkEncodeMap = make(map[rune]uint16, len(gbkTable)/2)
+		for lead := gbkLeadMin; lead <= gbkLeadMax; lead++ {
+			for trail := gbkTrailMin; trail <= gbkTrailMax; trail++ {
+				if r := gbkRune(byte(lead), byte(trail)); r != 0 {
+					if _, taken := gbkEncodeMap[r]; !taken {
+						gbkEncodeMap[r] = uint16(lead)<<8 | uint16(trail)
+					}
+				}
+			}
+		}
+	})
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r < 0x80 {
+			out = append(out, byte(r))
+			continue
+		}
+		code, ok := gbkEncodeMap[r]
+		if !ok {
+			return nil, fmt.Errorf("字符 %q 无法用 GBK 编码保存", r)
+		}
+		out = append(out, byte(code>>8), byte(code))
+	}
+	return out, nil
+}
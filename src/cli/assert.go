@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// AssertionError reports a failed assert command with the expected and actual values.
+type AssertionError struct {
+	Subject  string
+	Expected string
+	Actual   string
+}
+
+func (e *AssertionError) Error() string {
+	return fmt.Sprintf("断言失败: %s: 期望 %q, 实际 %q", e.Subject, e.Expected, e.Actual)
+}
+
+// AssertionFailures counts the assert commands that have failed so far.
+func (d *Dispatcher) AssertionFailures() int {
+	return d.assertFailures
+}
+
+// runAssert checks one assertion against the workspace without changing it.
+func (d *Dispatcher) runAssert(args []string) error {
+	err := d.checkAssertion(args)
+	var failed *AssertionError
+	if errors.As(err, &failed) {
+		d.assertFailures++
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if level, _ := d.ws.Settings().Get("output-level"); level != "quiet" {
+		d.console.Println("断言通过")
+	}
+	return nil
+}
+
+func (d *Dispatcher) checkAssertion(args []string) error {
+	usage := errors.New(`用法: assert line <n> "text" | assert element-text <id> "text" | assert modified <true|false> | assert open <file>`)
+	if len(args) < 2 {
+		return usage
+	}
+	switch args[0] {
+	case "line":
+		if len(args) != 3 {
+			return usage
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("行号无效: %s", args[1])
+		}
+		doc, _, err := d.requireTextDocument()
+		if err != nil {
+			return err
+		}
+		lines := doc.Lines()
+		if n > len(lines) {
+			return &AssertionError{Subject: fmt.Sprintf("第 %d 行", n), Expected: args[2], Actual: fmt.Sprintf("<不存在, 共 %d 行>", len(lines))}
+		}
+		return expectEqual(fmt.Sprintf("第 %d 行", n), args[2], lines[n-1])
+	case "element-text":
+		if len(args) != 3 {
+			return usage
+		}
+		doc, _, err := d.requireXMLDocument("")
+		if err != nil {
+			return err
+		}
+		text, err := doc.ElementText(args[1])
+		if err != nil {
+			return &AssertionError{Subject: "元素 " + args[1] + " 的文本", Expected: args[2], Actual: "<元素不存在>"}
+		}
+		return expectEqual("元素 "+args[1]+" 的文本", args[2], text)
+	case "modified":
+		if len(args) != 2 || (args[1] != "true" && args[1] != "false") {
+			return usage
+		}
+		ed, err := d.ws.ActiveEditor()
+		if err != nil {
+			return err
+		}
+		return expectEqual("修改状态", args[1], strconv.FormatBool(ed.IsModified()))
+	case "open":
+		if len(args) != 2 {
+			return usage
+		}
+		if _, err := d.ws.ResolveOpen(args[1]); err != nil {
+			return &AssertionError{Subject: "文件 " + args[1], Expected: "已打开", Actual: "未打开"}
+		}
+		return nil
+	default:
+		return usage
+	}
+}
+
+// expectEqual compares exactly; no trimming or case folding.
+func expectEqual(subject, expected, actual string) error {
+	if expected != actual {
+		return &AssertionError{Subject: subject, Expected: expected, Actual: actual}
+	}
+	return nil
+}
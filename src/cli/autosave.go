@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"fmt"
+
+	"softwaredesign/src/events"
+)
+
+// AutosaveListener warns on the console when a background autosave fails.
+type AutosaveListener struct {
+	console *Console
+}
+
+// NewAutosaveListener builds a listener writing to console.
+func NewAutosaveListener(console *Console) *AutosaveListener {
+	return &AutosaveListener{console: console}
+}
+
+// Handle prints a warning for each failed autosave.
+func (a *AutosaveListener) Handle(evt events.Event) {
+	if evt.Type != events.EventAutosaved {
+		return
+	}
+	if reason := evt.Metadata["error"]; reason != "" {
+		a.console.Errorln(fmt.Sprintf("[autosave] 警告: 自动保存 %s 失败: %s", evt.File, reason))
+	}
+}
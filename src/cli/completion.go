@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"softwaredesign/src/editor"
+)
+
+// commandNames lists every command understood by the dispatcher.
+var commandNames = []string{
+	"append", "append-child", "assert", "autosave", "check-external", "clean", "close",
+	"compress-spaces", "copy", "copy-lines", "cut-lines", "delete", "delete-element", "delete-line",
+	"delete-lines", "diff", "dir-tree", "doctor", "dup-line", "dup-lines", "edit", "edit-id",
+	"edit-text", "editor-list", "exit", "expand-tabs", "files", "find", "find-regex", "goto",
+	"goto-mark", "history", "info", "init", "insert", "insert-before", "insert-line", "join-lines",
+	"line-endings", "load", "load-glob", "load-readonly", "log-off", "log-on", "log-show", "lower",
+	"macro", "mark", "marks", "memory", "move-line", "open-dir", "paste", "peek", "promote", "readonly",
+	"recent", "redo", "redo-list", "reload", "rename", "rename-ids", "reopen", "replace", "replace-all",
+	"report", "restore-backup", "revert", "save", "save-as", "selftest", "set", "set-encoding",
+	"set-line-endings", "settings", "show", "show-head", "show-tail", "sort-lines", "spell-check",
+	"split-line", "stats", "status", "swap-lines", "title-case", "tutorial", "undo", "undo-list",
+	"undo-status", "upper", "version", "watch", "workspace-undo", "wrap", "xml-doctor", "xml-grep",
+	"xml-ids", "xml-path", "xml-tree",
+}
+
+// pathCommands accept a file or directory as their first argument.
+var pathCommands = map[string]bool{
+	"load": true, "load-readonly": true, "load-glob": true, "save": true, "close": true, "edit": true, "dir-tree": true, "info": true,
+	"xml-tree": true, "xml-ids": true, "spell-check": true, "log-on": true, "log-off": true, "log-show": true,
+	"diff": true, "revert": true, "save-as": true, "rename": true, "open-dir": true,
+	"restore-backup": true,
+}
+
+// xmlIDArgs maps XML commands to the argument positions holding element IDs.
+var xmlIDArgs = map[string][]int{
+	"insert-before":  {2},
+	"append-child":   {2},
+	"edit-id":        {0},
+	"edit-text":      {0},
+	"delete-element": {0},
+	"xml-path":       {0},
+}
+
+// Complete returns completion candidates for the token under the cursor.
+func (d *Dispatcher) Complete(line string, cursor int) []string {
+	if cursor < 0 || cursor > len(line) {
+		cursor = len(line)
+	}
+	prefix := line[:cursor]
+	fields := strings.Fields(prefix)
+	if len(fields) == 0 || !endsWithSpace(prefix) && len(fields) == 1 {
+		partial := ""
+		if len(fields) == 1 {
+			partial = fields[0]
+		}
+		return filterPrefix(commandNames, strings.ToLower(partial))
+	}
+	cmd := strings.ToLower(fields[0])
+	args := fields[1:]
+	partial := ""
+	if !endsWithSpace(prefix) {
+		partial = args[len(args)-1]
+		args = args[:len(args)-1]
+	}
+	partial = strings.TrimPrefix(partial, "\"")
+	pos := len(args)
+
+	var candidates []string
+	switch {
+	case cmd == "init":
+		switch pos {
+		case 0:
+			candidates = []string{"text", "xml"}
+		case 1:
+			candidates = d.pathCandidates(partial)
+		case 2:
+			candidates = []string{"with-log"}
+		}
+	case cmd == "assert" && pos == 0:
+		candidates = []string{"element-text", "line", "modified", "open"}
+	case cmd == "macro" && pos == 0:
+		candidates = []string{"list", "play", "record", "stop"}
+	case cmd == "macro" && pos == 1 && args[0] == "play":
+		candidates = d.ws.MacroNames()
+	case pathCommands[cmd] && pos == 0:
+		candidates = d.pathCandidates(partial)
+		if cmd == "save" || cmd == "close" || cmd == "spell-check" {
+			candidates = append(candidates, "all")
+		}
+		if cmd == "close" {
+			candidates = append(candidates, "others")
+		}
+	case isXMLIDArg(cmd, pos):
+		candidates = d.elementIDs()
+	}
+	return filterPrefix(candidates, partial)
+}
+
+func (d *Dispatcher) pathCandidates(partial string) []string {
+	base := d.ws.ProjectRoot()
+	var result []string
+	for _, info := range d.ws.List() {
+		result = append(result, info.Path)
+		if rel, err := filepath.Rel(base, info.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			result = append(result, rel)
+		}
+	}
+	dirPart, _ := filepath.Split(partial)
+	lookup := dirPart
+	if !filepath.IsAbs(lookup) {
+		lookup = filepath.Join(base, dirPart)
+	}
+	entries, err := os.ReadDir(lookup)
+	if err != nil {
+		return result
+	}
+	for _, entry := range entries {
+		name := dirPart + entry.Name()
+		if entry.IsDir() {
+			name += string(filepath.Separator)
+		}
+		result = append(result, name)
+	}
+	return result
+}
+
+func (d *Dispatcher) elementIDs() []string {
+	ed, err := d.ws.ActiveEditor()
+	if err != nil {
+		return nil
+	}
+	doc, ok := ed.(editor.XMLTreeEditor)
+	if !ok {
+		return nil
+	}
+	var ids []string
+	doc.Walk(func(view editor.ElementView) bool {
+		ids = append(ids, view.ID)
+		return true
+	})
+	return ids
+}
+
+func isXMLIDArg(cmd string, pos int) bool {
+	for _, idx := range xmlIDArgs[cmd] {
+		if idx == pos {
+			return true
+		}
+	}
+	return false
+}
+
+func endsWithSpace(text string) bool {
+	if text == "" {
+		return false
+	}
+	return unicode.IsSpace(rune(text[len(text)-1]))
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, candidate := range candidates {
+		if !strings.HasPrefix(candidate, prefix) || seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		result = append(result, candidate)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -2,27 +2,84 @@ package cli
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
+	"time"
+
+	"softwaredesign/src/workspace"
 )
 
 // Console wraps standard IO for prompting.
 type Console struct {
-	reader *bufio.Reader
-	writer io.Writer
+	reader    *bufio.Reader
+	writer    io.Writer
+	errWriter io.Writer
+
+	// pending holds a read started by a timed prompt that gave up waiting;
+	// the next read takes its line instead of starting another one.
+	pending       chan lineResult
+	promptTimeout time.Duration
+	promptDefault bool
+	// assumed, when set, answers every confirmation without reading input.
+	assumed *bool
+	// closed records that input has ended or was never available, so
+	// prompts fail at once instead of waiting for answers.
+	closed bool
+
+	// notices queues messages from background work until the next prompt.
+	noticeMu sync.Mutex
+	notices  []string
 }
 
-// NewConsole constructs a console facade.
-func NewConsole(in io.Reader, out io.Writer) *Console {
+type lineResult struct {
+	line string
+	err  error
+}
+
+// NewConsole constructs a console facade with separate data and error streams.
+func NewConsole(in io.Reader, out, errOut io.Writer) *Console {
 	return &Console{
-		reader: bufio.NewReader(in),
-		writer: out,
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		errWriter: errOut,
 	}
 }
 
-// ReadLine reads a line without newline characters.
+// ReadLine reads a line without newline characters. Once input has ended it
+// returns io.EOF without reading.
 func (c *Console) ReadLine() (string, error) {
+	if c.closed {
+		return "", io.EOF
+	}
+	var line string
+	var err error
+	if c.pending != nil {
+		result := <-c.pending
+		c.pending = nil
+		line, err = result.line, result.err
+	} else {
+		line, err = c.readLine()
+	}
+	if errors.Is(err, io.EOF) {
+		c.closed = true
+	}
+	return line, err
+}
+
+// MarkClosed treats input as unavailable, e.g. when stdin cannot be used.
+func (c *Console) MarkClosed() {
+	c.closed = true
+}
+
+// Closed reports whether input has ended, so prompts cannot be answered.
+func (c *Console) Closed() bool {
+	return c.closed
+}
+
+func (c *Console) readLine() (string, error) {
 	line, err := c.reader.ReadString('\n')
 	if err != nil && len(line) == 0 {
 		return "", err
@@ -30,6 +87,49 @@ func (c *Console) ReadLine() (string, error) {
 	return strings.TrimRight(line, "\r\n"), nil
 }
 
+// readLineBefore reads a line unless deadline passes first. A read that times
+// out keeps running in the background and its line goes to the next ReadLine.
+func (c *Console) readLineBefore(deadline time.Time) (string, bool, error) {
+	if c.pending == nil {
+		pending := make(chan lineResult, 1)
+		go func() {
+			line, err := c.readLine()
+			pending <- lineResult{line, err}
+		}()
+		c.pending = pending
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case result := <-c.pending:
+		c.pending = nil
+		return result.line, true, result.err
+	case <-timer.C:
+		return "", false, nil
+	}
+}
+
+// SetPromptTimeout makes Confirm give up after timeout and answer with
+// defaultAnswer; a zero timeout waits indefinitely.
+func (c *Console) SetPromptTimeout(timeout time.Duration, defaultAnswer bool) {
+	c.promptTimeout = timeout
+	c.promptDefault = defaultAnswer
+}
+
+// AssumeAnswer makes Confirm answer every question with answer, for runs
+// without anyone to ask.
+func (c *Console) AssumeAnswer(answer bool) {
+	c.assumed = &answer
+}
+
+// PresetSave answers save prompts unasked once AssumeAnswer is set.
+func (c *Console) PresetSave() (bool, bool) {
+	if c.assumed == nil {
+		return false, false
+	}
+	return *c.assumed, true
+}
+
 // Print writes raw text.
 func (c *Console) Print(text string) {
 	fmt.Fprint(c.writer, text)
@@ -40,13 +140,92 @@ func (c *Console) Println(text string) {
 	fmt.Fprintln(c.writer, text)
 }
 
-// ConfirmSave prompts user for saving decision.
+// Notify queues a message to show before the next command prompt. It is
+// safe to call from background goroutines.
+func (c *Console) Notify(text string) {
+	c.noticeMu.Lock()
+	defer c.noticeMu.Unlock()
+	c.notices = append(c.notices, text)
+}
+
+// FlushNotices writes the queued messages to the error stream.
+func (c *Console) FlushNotices() {
+	c.noticeMu.Lock()
+	notices := c.notices
+	c.notices = nil
+	c.noticeMu.Unlock()
+	for _, text := range notices {
+		c.Errorln(text)
+	}
+}
+
+// Prompt writes interactive prompt text to the error stream so piped output stays clean.
+func (c *Console) Prompt(text string) {
+	fmt.Fprint(c.errWriter, text)
+}
+
+// Errorln writes a diagnostic line to the error stream.
+func (c *Console) Errorln(text string) {
+	fmt.Fprintln(c.errWriter, text)
+}
+
+// ErrWriter exposes the error stream for collaborators such as the logger.
+func (c *Console) ErrWriter() io.Writer {
+	return c.errWriter
+}
+
+// ConfirmSave prompts user for saving decision. Answering c returns
+// workspace.ErrCloseCancelled so the file stays open.
 func (c *Console) ConfirmSave(path string) (bool, error) {
+	return c.confirm(fmt.Sprintf("文件已修改，是否保存? (y/n/c 取消) [%s]: ", path), true)
+}
+
+// ConfirmOverwrite asks whether to save over a file changed or deleted on disk.
+func (c *Console) ConfirmOverwrite(path string) (bool, error) {
+	return c.Confirm(fmt.Sprintf("磁盘上的文件已在打开后变化, 仍要保存并覆盖? (y/n) [%s]: ", path))
+}
+
+// Confirm asks a yes/no question until the user answers or the prompt timeout
+// expires.
+func (c *Console) Confirm(question string) (bool, error) {
+	return c.confirm(question, false)
+}
+
+func (c *Console) confirm(question string, cancellable bool) (bool, error) {
+	if c.assumed != nil {
+		c.Prompt(question)
+		c.Errorln(answerLabel(*c.assumed))
+		return *c.assumed, nil
+	}
+	if c.closed {
+		return false, io.EOF
+	}
+	var deadline time.Time
+	if c.promptTimeout > 0 {
+		deadline = time.Now().Add(c.promptTimeout)
+	}
 	for {
-		c.Print(fmt.Sprintf("文件已修改，是否保存? (y/n) [%s]: ", path))
-		answer, err := c.ReadLine()
+		c.Prompt(question)
+		var answer string
+		var err error
+		if deadline.IsZero() {
+			answer, err = c.ReadLine()
+		} else {
+			var answered bool
+			answer, answered, err = c.readLineBefore(deadline)
+			if !answered {
+				c.Errorln("")
+				c.Errorln(fmt.Sprintf("等待超时 (%s), 已自动选择: %s", c.promptTimeout, answerLabel(c.promptDefault)))
+				return c.promptDefault, nil
+			}
+		}
 		if err != nil {
-			return false, err
+			if errors.Is(err, io.EOF) {
+				c.closed = true
+				c.Errorln("")
+				return false, io.EOF
+			}
+			return false, fmt.Errorf("读取输入失败: %w", err)
 		}
 		answer = strings.TrimSpace(strings.ToLower(answer))
 		switch answer {
@@ -54,8 +233,24 @@ func (c *Console) ConfirmSave(path string) (bool, error) {
 			return true, nil
 		case "n", "no":
 			return false, nil
+		case "c", "cancel":
+			if cancellable {
+				return false, workspace.ErrCloseCancelled
+			}
+			c.Errorln("请输入 y 或 n")
 		default:
-			c.Println("请输入 y 或 n")
+			if cancellable {
+				c.Errorln("请输入 y、n 或 c")
+			} else {
+				c.Errorln("请输入 y 或 n")
+			}
 		}
 	}
 }
+
+func answerLabel(answer bool) string {
+	if answer {
+		return "y"
+	}
+	return "n"
+}
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/spellcheck"
+	"softwaredesign/src/workspace"
+)
+
+// SelfTestResult records the outcome of one self-test step.
+type SelfTestResult struct {
+	Step string
+	Err  error
+}
+
+// Passed reports whether the step succeeded.
+func (r SelfTestResult) Passed() bool {
+	return r.Err == nil
+}
+
+// RunSelfTest exercises a scratch workspace end to end without touching the user's files.
+func RunSelfTest() []SelfTestResult {
+	dir, err := os.MkdirTemp("", "editor-selftest-")
+	if err != nil {
+		return []SelfTestResult{{Step: "create scratch dir", Err: err}}
+	}
+	defer os.RemoveAll(dir)
+
+	bus := events.NewBus()
+	logger := logging.NewManager()
+	bus.Subscribe(logger)
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, bus, keeper, logger, nil)
+	ws.SetSpellService(spellcheck.NewService(spellcheck.NewSimpleChecker()))
+
+	textPath := filepath.Join(dir, "notes.txt")
+	xmlPath := filepath.Join(dir, "doc.xml")
+	var textDoc editor.TextDocument
+	var xmlDoc editor.XMLTreeEditor
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"init text", func() error {
+			ed, err := ws.Init("text", textPath, false)
+			if err != nil {
+				return err
+			}
+			textDoc = ed.(editor.TextDocument)
+			return nil
+		}},
+		{"append", func() error {
+			if err := textDoc.Append("hello world"); err != nil {
+				return err
+			}
+			return expectLines(textDoc, "hello world")
+		}},
+		{"insert", func() error {
+			if err := textDoc.Insert(1, 6, ","); err != nil {
+				return err
+			}
+			return expectLines(textDoc, "hello, world")
+		}},
+		{"undo", func() error {
+			if err := ws.Undo(); err != nil {
+				return err
+			}
+			return expectLines(textDoc, "hello world")
+		}},
+		{"save", func() error {
+			if err := ws.Save(""); err != nil {
+				return err
+			}
+			data, err := os.ReadFile(textPath)
+			if err != nil {
+				return err
+			}
+			if string(data) != "hello world" {
+				return fmt.Errorf("磁盘内容不符: %q", string(data))
+			}
+			return nil
+		}},
+		{"init xml", func() error {
+			ed, err := ws.Init("xml", xmlPath, false)
+			if err != nil {
+				return err
+			}
+			xmlDoc = ed.(editor.XMLTreeEditor)
+			return nil
+		}},
+		{"append-child", func() error {
+			text := "Helo world"
+			return xmlDoc.AppendChild("title", "t1", "root", &text)
+		}},
+		{"xml-tree", func() error {
+			if tree := xmlDoc.TreeString(); !strings.Contains(tree, "title [id=\"t1\"]") {
+				return fmt.Errorf("树中缺少新元素: %s", tree)
+			}
+			return nil
+		}},
+		{"spell-check", func() error {
+			report, err := ws.SpellCheck(xmlPath)
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(report, "\"Helo\"") {
+				return fmt.Errorf("未报告拼写错误: %s", report)
+			}
+			return nil
+		}},
+		{"log-on", func() error {
+			return logger.Enable(textPath)
+		}},
+		{"logged command", func() error {
+			if err := ws.Edit(textPath); err != nil {
+				return err
+			}
+			if err := textDoc.Append("logged"); err != nil {
+				return err
+			}
+			ws.PublishCommand("append", "append \"logged\"", textPath)
+			return nil
+		}},
+		{"log-show", func() error {
+			content, err := logger.Show(textPath)
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(content, "append \"logged\"") {
+				return fmt.Errorf("日志缺少命令记录: %s", content)
+			}
+			return nil
+		}},
+		{"exit persistence", func() error {
+			if err := ws.Persist(); err != nil {
+				return err
+			}
+			state, err := keeper.Load()
+			if err != nil {
+				return err
+			}
+			if len(state.Editors) != 2 || state.Active != textPath {
+				return fmt.Errorf("工作区状态不完整: %+v", state)
+			}
+			return nil
+		}},
+	}
+
+	results := make([]SelfTestResult, 0, len(steps))
+	for _, step := range steps {
+		err := runStep(step.run)
+		results = append(results, SelfTestResult{Step: step.name, Err: err})
+	}
+	return results
+}
+
+func runStep(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("步骤异常: %v", r)
+		}
+	}()
+	return run()
+}
+
+func expectLines(doc editor.TextDocument, want ...string) error {
+	got := doc.Lines()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		return errors.New("内容不符: " + strings.Join(got, "\\n"))
+	}
+	return nil
+}
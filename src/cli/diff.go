@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"errors"
+
+	"softwaredesign/src/diff"
+	"softwaredesign/src/editor"
+	"softwaredesign/src/workspace"
+)
+
+// diffContext is the number of unchanged lines diff shows around a change.
+const diffContext = 3
+
+// diffSide is one version being compared.
+type diffSide struct {
+	label string
+	lines []string
+}
+
+// runDiff compares an open file with its saved version, or two files of
+// which at least one is open. It returns the file the command targeted.
+func (d *Dispatcher) runDiff(args []string) (string, error) {
+	quiet := false
+	var paths []string
+	for _, arg := range args {
+		if arg == "-q" {
+			quiet = true
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	var (
+		old, cur diffSide
+		target   string
+		err      error
+	)
+	switch len(paths) {
+	case 0, 1:
+		old, cur, target, err = d.savedDiffSides(paths)
+	case 2:
+		old, cur, target, err = d.fileDiffSides(paths[0], paths[1])
+	default:
+		err = errors.New("用法: diff [-q] [file] | diff [-q] <fileA> <fileB>")
+	}
+	if err != nil {
+		return "", err
+	}
+	out := diff.Unified(old.lines, cur.lines, diffContext)
+	switch {
+	case len(out) == 0:
+		d.console.Println("无差异")
+	case quiet:
+		d.console.Println("有差异")
+	default:
+		d.console.Println("--- " + old.label)
+		d.console.Println("+++ " + cur.label)
+		for _, line := range out {
+			d.console.Println(line)
+		}
+	}
+	return target, nil
+}
+
+// savedDiffSides pairs an open file's saved version with its current content.
+func (d *Dispatcher) savedDiffSides(paths []string) (diffSide, diffSide, string, error) {
+	var (
+		ed  editor.Editor
+		err error
+	)
+	if len(paths) == 1 {
+		ed, err = d.ws.EditorByPath(paths[0])
+	} else {
+		ed, err = d.ws.ActiveEditor()
+	}
+	if err != nil {
+		return diffSide{}, diffSide{}, "", err
+	}
+	saved, exists, err := d.ws.SavedLines(ed.Path())
+	if err != nil {
+		return diffSide{}, diffSide{}, "", err
+	}
+	current, err := workspace.ContentLines(ed)
+	if err != nil {
+		return diffSide{}, diffSide{}, "", err
+	}
+	label := ed.Path() + " (磁盘)"
+	if !exists {
+		label = ed.Path() + " (尚未保存)"
+	}
+	return diffSide{label, saved}, diffSide{ed.Path() + " (编辑中)", current}, ed.Path(), nil
+}
+
+// fileDiffSides reads two files, taking open ones from their editors and the
+// other from disk.
+func (d *Dispatcher) fileDiffSides(a, b string) (diffSide, diffSide, string, error) {
+	absA, linesA, openA, err := d.ws.FileLines(a)
+	if err != nil {
+		return diffSide{}, diffSide{}, "", err
+	}
+	absB, linesB, openB, err := d.ws.FileLines(b)
+	if err != nil {
+		return diffSide{}, diffSide{}, "", err
+	}
+	if !openA && !openB {
+		return diffSide{}, diffSide{}, "", errors.New("至少需要一个已打开的文件")
+	}
+	target := absA
+	if !openA {
+		target = absB
+	}
+	return diffSide{absA, linesA}, diffSide{absB, linesB}, target, nil
+}
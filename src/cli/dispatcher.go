@@ -1,17 +1,25 @@
 package cli
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"softwaredesign/src/charset"
 	"softwaredesign/src/editor"
+	"softwaredesign/src/events"
+	"softwaredesign/src/fs"
 	"softwaredesign/src/logging"
 	"softwaredesign/src/statistics"
+	"softwaredesign/src/version"
 	"softwaredesign/src/workspace"
 )
 
@@ -20,6 +28,17 @@ type Dispatcher struct {
 	ws      *workspace.Workspace
 	console *Console
 	logger  *logging.Manager
+
+	assertFailures int
+	// treeFiles maps the indexes shown by the last dir-tree --numbered to
+	// file paths; treeBase is the base dir it was taken under.
+	treeFiles []string
+	treeBase  string
+	// listFiles maps the indexes shown by the last editor-list to paths.
+	listFiles []string
+	// nested counts commands run on behalf of another command; they stay
+	// out of the command history and macro recordings.
+	nested int
 }
 
 // NewDispatcher constructs a dispatcher.
@@ -31,22 +50,29 @@ func NewDispatcher(ws *workspace.Workspace, console *Console, logger *logging.Ma
 	}
 }
 
-// Run processes interactive commands until exit.
+// Run processes interactive commands until exit. When input ends or is
+// unavailable it exits once through the persistence path, handling unsaved
+// files by the close policy.
 func (d *Dispatcher) Run() {
 	for {
-		d.console.Print("> ")
+		if d.console.Closed() {
+			d.exitWithoutInput()
+			return
+		}
+		d.console.FlushNotices()
+		d.console.Prompt("> ")
 		line, err := d.console.ReadLine()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
-				_ = d.handleExit()
+				d.exitWithoutInput()
 				return
 			}
-			d.console.Println(fmt.Sprintf("读取命令失败: %v", err))
+			d.console.Errorln(fmt.Sprintf("读取命令失败: %v", err))
 			continue
 		}
 		exit, err := d.execute(line)
 		if err != nil {
-			d.console.Println(fmt.Sprintf("错误: %v", err))
+			d.console.Errorln(fmt.Sprintf("错误: %v", err))
 			continue
 		}
 		if exit {
@@ -62,11 +88,27 @@ func (d *Dispatcher) Execute(raw string) error {
 }
 
 func (d *Dispatcher) execute(raw string) (bool, error) {
+	d.ws.Lock()
+	defer d.ws.Unlock()
+	return d.run(raw)
+}
+
+// run executes one command with the workspace lock already held.
+func (d *Dispatcher) run(raw string) (bool, error) {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
 		return false, nil
 	}
-	tokens, err := tokenize(raw)
+	if strings.HasPrefix(raw, "!") {
+		expanded, err := d.recall(raw)
+		if err != nil {
+			return false, err
+		}
+		// Echo the real command, which is also what gets logged.
+		d.console.Println(expanded)
+		raw = expanded
+	}
+	tokens, err := Tokenize(raw)
 	if err != nil {
 		return false, err
 	}
@@ -75,30 +117,100 @@ func (d *Dispatcher) execute(raw string) (bool, error) {
 	}
 	cmd := strings.ToLower(tokens[0])
 	args := tokens[1:]
+	if cmd != "history" && d.nested == 0 {
+		d.ws.CommandHistory().Add(raw)
+	}
+	if cmd == "assert" {
+		// Assertions are read-only checks and stay out of events and logs.
+		return false, d.runAssert(args)
+	}
 	var targetFile string
 	var exit bool
+	var noop bool
+	var metadata map[string]string
+	redoDepth := d.pendingRedoDepth(cmd)
 
 	switch cmd {
-	case "load":
-		if len(args) != 1 {
-			return false, errors.New("用法: load <file>")
+	case "load", "load-readonly":
+		usage := errors.New("用法: load <file|index> [--as-text] [--readonly] [--encoding " + charset.Names + "]")
+		if cmd == "load-readonly" {
+			usage = errors.New("用法: load-readonly <file|index>")
+		}
+		if len(args) == 0 || cmd == "load-readonly" && len(args) != 1 {
+			return false, usage
+		}
+		asText, readOnly := false, cmd == "load-readonly"
+		var enc charset.Encoding
+		for i := 1; i < len(args); i++ {
+			switch flag := args[i]; {
+			case flag == "--as-text" && !asText:
+				asText = true
+			case flag == "--readonly" && !readOnly:
+				readOnly = true
+			case flag == "--encoding" && enc == "" && i+1 < len(args):
+				i++
+				parsed, err := charset.Parse(args[i])
+				if err != nil {
+					return false, err
+				}
+				enc = parsed
+			default:
+				return false, usage
+			}
+		}
+		if _, numErr := strconv.Atoi(args[0]); numErr == nil && d.treeFiles != nil {
+			path, err := d.treeFile(args[0])
+			if err != nil {
+				return false, err
+			}
+			args[0] = path
 		}
-		ed, err := d.ws.Load(args[0])
+		ed, err := d.ws.LoadEncoded(args[0], enc)
 		if err != nil {
-			return false, err
+			d.printParseExcerpt(args[0], err)
+			var parseErr *editor.XMLParseError
+			if !errors.As(err, &parseErr) {
+				return false, err
+			}
+			if !asText {
+				if open, _ := d.console.Confirm("XML 解析失败, 是否以只读文本方式打开? (y/n): "); !open {
+					return false, err
+				}
+			}
+			d.console.Errorln(fmt.Sprintf("错误: %v", err))
+			if ed, err = d.ws.LoadXMLAsText(args[0]); err != nil {
+				return false, err
+			}
+			targetFile = ed.Path()
+			d.console.Println("已以只读文本方式打开: " + ed.Path())
+			d.console.Println(fmt.Sprintf("出错位置: 第 %d 行, 可使用 show %d:%d 查看; readonly off 解除只读, 修改保存后用 reload 切换回 XML 编辑器",
+				parseErr.Line, max(parseErr.Line-2, 1), parseErr.Line+2))
+			break
 		}
 		targetFile = ed.Path()
+		if readOnly {
+			ed.SetReadOnly(true)
+			d.console.Println("已以只读模式加载: " + ed.Path())
+			break
+		}
 		d.console.Println("已加载: " + ed.Path())
+		if doc, ok := ed.(editor.EncodingEditor); ok && enc == "" && doc.Encoding() == charset.Latin1 {
+			d.console.Println("内容不是有效的 UTF-8, 已按 latin1 原样打开, 保存时字节不变; 可用 set-encoding <编码> --reinterpret 改用其他编码")
+		}
 	case "save":
 		if len(args) == 0 {
-			if err := d.ws.Save(""); err != nil {
+			ed, err := d.ws.ActiveEditor()
+			if err != nil {
 				return false, err
 			}
-			ed, _ := d.ws.ActiveEditor()
-			if ed != nil {
-				targetFile = ed.Path()
+			targetFile = ed.Path()
+			saved, err := d.saveFile(targetFile)
+			if err != nil {
+				return false, err
+			}
+			if saved {
+				d.console.Println("已保存当前文件")
 			}
-			d.console.Println("已保存当前文件")
 		} else if len(args) == 1 && strings.ToLower(args[0]) == "all" {
 			if err := d.ws.SaveAll(); err != nil {
 				return false, err
@@ -106,49 +218,269 @@ func (d *Dispatcher) execute(raw string) (bool, error) {
 			targetFile = ""
 			d.console.Println("已保存全部文件")
 		} else if len(args) == 1 {
-			if err := d.ws.Save(args[0]); err != nil {
+			abs, err := d.ws.ResolveOpen(args[0])
+			if err != nil {
 				return false, err
 			}
-			abs, _ := filepath.Abs(args[0])
 			targetFile = abs
-			d.console.Println("已保存: " + abs)
+			saved, err := d.saveFile(abs)
+			if err != nil {
+				return false, err
+			}
+			if saved {
+				d.console.Println("已保存: " + abs)
+			}
 		} else {
 			return false, errors.New("用法: save [file|all]")
 		}
+	case "save-as":
+		if len(args) != 1 {
+			return false, errors.New("用法: save-as <file>")
+		}
+		dest, err := d.ws.SaveAs(args[0])
+		if err != nil {
+			return false, err
+		}
+		targetFile = dest
+		d.console.Println("已另存为: " + dest)
+	case "autosave":
+		switch {
+		case len(args) == 0:
+			if interval, on := d.ws.AutosaveInterval(); on {
+				d.console.Println(fmt.Sprintf("自动保存: 开启 (每 %d 秒)", int(interval/time.Second)))
+			} else {
+				d.console.Println("自动保存: 关闭")
+			}
+		case args[0] == "on" && len(args) <= 2:
+			interval := workspace.DefaultAutosaveInterval
+			if len(args) == 2 {
+				seconds, err := strconv.Atoi(args[1])
+				if err != nil || seconds < 1 {
+					return false, fmt.Errorf("间隔秒数无效: %s", args[1])
+				}
+				interval = time.Duration(seconds) * time.Second
+			}
+			if err := d.ws.StartAutosave(interval); err != nil {
+				return false, err
+			}
+			d.console.Println(fmt.Sprintf("已开启自动保存, 每 %d 秒保存已修改的文件", int(interval/time.Second)))
+		case args[0] == "off" && len(args) == 1:
+			d.ws.StopAutosave()
+			d.console.Println("已关闭自动保存")
+		default:
+			return false, errors.New("用法: autosave [on [seconds]|off]")
+		}
+	case "watch":
+		switch {
+		case len(args) == 0:
+			if interval, on := d.ws.WatchInterval(); on {
+				d.console.Println(fmt.Sprintf("文件监视: 开启 (每 %d 秒)", int(interval/time.Second)))
+			} else {
+				d.console.Println("文件监视: 关闭")
+			}
+		case args[0] == "on" && len(args) <= 2:
+			interval := workspace.DefaultWatchInterval
+			if len(args) == 2 {
+				seconds, err := strconv.Atoi(args[1])
+				if err != nil || seconds < 1 {
+					return false, fmt.Errorf("间隔秒数无效: %s", args[1])
+				}
+				interval = time.Duration(seconds) * time.Second
+			}
+			if err := d.ws.StartWatch(interval); err != nil {
+				return false, err
+			}
+			d.console.Println(fmt.Sprintf("已开启文件监视, 每 %d 秒检查打开的文件是否在磁盘上变化", int(interval/time.Second)))
+		case args[0] == "off" && len(args) == 1:
+			d.ws.StopWatch()
+			d.console.Println("已关闭文件监视")
+		default:
+			return false, errors.New("用法: watch [on [seconds]|off]")
+		}
+	case "restore-backup":
+		if len(args) < 1 || len(args) > 2 {
+			return false, errors.New("用法: restore-backup <file> [index]")
+		}
+		index := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return false, fmt.Errorf("备份编号无效: %s", args[1])
+			}
+			index = n
+		}
+		ed, err := d.ws.RestoreBackup(args[0], index)
+		if err != nil {
+			return false, err
+		}
+		targetFile = ed.Path()
+		d.console.Println(fmt.Sprintf("已将第 %d 个备份载入未保存的缓冲区: %s", index, ed.Path()))
+	case "rename":
+		if len(args) != 2 {
+			return false, errors.New("用法: rename <old> <new>")
+		}
+		abs, err := d.ws.ResolveOpen(args[0])
+		if err != nil {
+			return false, err
+		}
+		dest, err := d.ws.Rename(abs, args[1])
+		if err != nil {
+			return false, err
+		}
+		targetFile = dest
+		d.console.Println(fmt.Sprintf("已重命名: %s -> %s", abs, dest))
 	case "init":
-		if len(args) < 2 {
+		if len(args) < 2 || len(args) > 3 {
 			return false, errors.New("用法: init <text|xml> <file> [with-log]")
 		}
 		kind := strings.ToLower(args[0])
 		fileArg := args[1]
-		withLog := len(args) > 2 && args[2] == "with-log"
+		withLog := false
+		if len(args) == 3 {
+			if args[2] != "with-log" {
+				return false, fmt.Errorf("未知参数: %s (是否想输入 with-log?)", args[2])
+			}
+			withLog = true
+		}
 		ed, err := d.ws.Init(kind, fileArg, withLog)
 		if err != nil {
 			return false, err
 		}
 		targetFile = ed.Path()
-		d.console.Println("已创建缓冲区: " + ed.Path())
+		if withLog {
+			d.console.Println("已创建缓冲区: " + ed.Path() + " (日志已开启)")
+		} else {
+			d.console.Println("已创建缓冲区: " + ed.Path())
+		}
 	case "close":
+		disposition := workspace.CloseAsk
+		var positional []string
+		for _, arg := range args {
+			flag, ok := answerFlag(arg)
+			if !ok {
+				positional = append(positional, arg)
+				continue
+			}
+			if disposition != workspace.CloseAsk && disposition != flag {
+				return false, errors.New("--save (-y) 与 --discard (-n) 不能同时使用")
+			}
+			disposition = flag
+		}
+		if len(positional) > 1 {
+			return false, errors.New("用法: close [file|#n|all|others] [--save|-y|--discard|-n]")
+		}
+		metadata = map[string]string{"disposition": string(disposition)}
+		var scope string
+		if len(positional) == 1 {
+			scope = strings.ToLower(positional[0])
+		}
+		if scope == "all" || scope == "others" {
+			var except string
+			if scope == "others" {
+				ed, err := d.ws.ActiveEditor()
+				if err != nil {
+					return false, err
+				}
+				except = ed.Path()
+			}
+			results, err := d.ws.CloseAll(disposition, except)
+			if err != nil {
+				if len(results) > 0 {
+					d.console.Println(fmt.Sprintf("已关闭 %d 个文件", len(results)))
+				}
+				return false, err
+			}
+			targetFile = ""
+			message := fmt.Sprintf("已关闭 %d 个文件", len(results))
+			cancelled := len(d.ws.List())
+			if except != "" {
+				cancelled--
+			}
+			if cancelled > 0 {
+				message += fmt.Sprintf(", %d 个已取消仍保持打开", cancelled)
+			}
+			d.console.Println(message)
+			break
+		}
 		var requesting string
-		if len(args) > 0 {
-			requesting = args[0]
+		if len(positional) == 1 {
+			requesting = positional[0]
+		}
+		if strings.HasPrefix(requesting, "#") {
+			path, err := d.listedFile(requesting)
+			if err != nil {
+				return false, err
+			}
+			requesting = path
 		}
 		var abs string
 		if requesting != "" {
-			abs, _ = filepath.Abs(requesting)
+			abs = d.absPath(requesting)
 			targetFile = abs
 		} else if ed, _ := d.ws.ActiveEditor(); ed != nil {
 			targetFile = ed.Path()
 		}
-		if err := d.ws.Close(requesting); err != nil {
+		result, err := d.ws.CloseWith(requesting, disposition)
+		if err != nil {
 			return false, err
 		}
-		d.console.Println("已关闭")
+		switch {
+		case result.Active == "":
+			d.console.Println("已关闭, 无打开文件")
+		case result.FocusChanged():
+			d.console.Println("已关闭, 当前活动文件: " + filepath.Base(result.Active))
+		default:
+			d.console.Println("已关闭")
+		}
+		if result.FocusChanged() {
+			metadata["focus_from"] = result.PreviousActive
+			metadata["focus_to"] = result.Active
+		}
+	case "load-glob":
+		if len(args) != 1 {
+			return false, errors.New("用法: load-glob <pattern>")
+		}
+		pattern := args[0]
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(d.ws.ProjectRoot(), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return false, fmt.Errorf("模式无效: %s", args[0])
+		}
+		if len(matches) == 0 {
+			return false, fmt.Errorf("没有匹配的文件: %s", args[0])
+		}
+		opened, failed := 0, 0
+		for _, match := range matches {
+			if info, statErr := os.Stat(match); statErr == nil && info.IsDir() {
+				d.console.Println("跳过目录: " + match)
+				continue
+			}
+			if _, loadErr := d.runNested("load " + quoteArg(match)); loadErr != nil {
+				d.console.Errorln(fmt.Sprintf("加载失败: %s: %v", match, loadErr))
+				failed++
+				continue
+			}
+			opened++
+		}
+		if opened == 0 && failed > 0 {
+			return false, fmt.Errorf("没有打开任何文件 (%d 个失败)", failed)
+		}
+		d.console.Println(fmt.Sprintf("已打开 %d 个文件, %d 个失败", opened, failed))
 	case "edit":
 		if len(args) != 1 {
-			return false, errors.New("用法: edit <file>")
+			return false, errors.New("用法: edit <file|#n>")
+		}
+		target := args[0]
+		if strings.HasPrefix(target, "#") {
+			path, err := d.listedFile(target)
+			if err != nil {
+				return false, err
+			}
+			target = path
 		}
-		if err := d.ws.Edit(args[0]); err != nil {
+		if err := d.ws.Edit(target); err != nil {
 			return false, err
 		}
 		ed, _ := d.ws.ActiveEditor()
@@ -156,208 +488,1241 @@ func (d *Dispatcher) execute(raw string) (bool, error) {
 			targetFile = ed.Path()
 		}
 		d.console.Println("已切换活动文件")
-	case "editor-list":
-		d.printEditors()
-	case "dir-tree":
-		var dir string
-		if len(args) > 0 {
-			dir = args[0]
+	case "stats":
+		if len(args) != 0 {
+			return false, errors.New("用法: stats")
 		}
-		result, err := d.ws.DirTree(dir)
+		ed, err := d.ws.ActiveEditor()
 		if err != nil {
 			return false, err
 		}
-		d.console.Println(result)
-	case "undo":
-		if err := d.ws.Undo(); err != nil {
+		targetFile = ed.Path()
+		switch doc := ed.(type) {
+		case editor.TextDocument:
+			stats := doc.Stats()
+			d.console.Println(fmt.Sprintf("行数: %d", stats.Lines))
+			d.console.Println(fmt.Sprintf("词数: %d", stats.Words))
+			d.console.Println(fmt.Sprintf("字符数: %d", stats.Chars))
+			d.console.Println(fmt.Sprintf("字节数: %d", stats.Bytes))
+		case editor.XMLTreeEditor:
+			stats := doc.Stats()
+			d.console.Println(fmt.Sprintf("元素数: %d", stats.Elements))
+			d.console.Println(fmt.Sprintf("最大深度: %d", stats.MaxDepth))
+			d.console.Println(fmt.Sprintf("文本长度: %d", stats.TextLength))
+		default:
+			return false, errors.New("当前文件不支持统计")
+		}
+	case "report":
+		switch {
+		case len(args) == 1 && args[0] == "show":
+			rows := d.reportRows()
+			if len(rows) == 0 {
+				d.console.Println("暂无统计数据")
+				break
+			}
+			var cells [][]string
+			for _, row := range rows {
+				cells = append(cells, statistics.ReportRecord(row))
+			}
+			for _, line := range formatTable([]string{"文件", "日期", "分钟", "命令数", "保存数"}, cells) {
+				d.console.Println(line)
+			}
+		case len(args) == 2 && args[0] == "export":
+			path := d.absPath(args[1])
+			if _, err := os.Stat(path); err == nil {
+				overwrite, _ := d.console.Confirm(fmt.Sprintf("文件已存在, 是否覆盖? (y/n) [%s]: ", path))
+				if !overwrite {
+					return false, errors.New("已取消导出")
+				}
+			}
+			mode := d.ws.FileMode()
+			if info, err := os.Stat(path); err == nil {
+				mode = info.Mode().Perm()
+			}
+			op := d.ws.StartOperation("report-export", nil, 1)
+			err := fs.WriteAtomic(path, mode, func(w io.Writer) error {
+				return statistics.WriteCSV(w, d.reportRows())
+			})
+			if err == nil {
+				op.Step(path)
+			}
+			op.Finish(err)
+			if err != nil {
+				return false, err
+			}
+			d.console.Println("已导出: " + path)
+		default:
+			return false, errors.New("用法: report show | report export <csvPath>")
+		}
+	case "clean":
+		if err := d.clean(args); err != nil {
 			return false, err
 		}
-		if ed, err := d.ws.ActiveEditor(); err == nil {
-			targetFile = ed.Path()
+	case "check-external":
+		if len(args) != 0 {
+			return false, errors.New("用法: check-external")
 		}
-		d.console.Println("已撤销")
-	case "redo":
-		if err := d.ws.Redo(); err != nil {
+		statuses, err := d.ws.ExternalChanges()
+		if err != nil {
 			return false, err
 		}
-		if ed, err := d.ws.ActiveEditor(); err == nil {
-			targetFile = ed.Path()
+		if len(statuses) == 0 {
+			d.console.Println("无打开文件")
 		}
-		d.console.Println("已重做")
-	case "append":
-		if len(args) != 1 {
-			return false, errors.New("用法: append \"text\"")
+		for _, status := range statuses {
+			d.console.Println(fmt.Sprintf("%s: %s", d.relPath(status.Path), diskStateLabels[status.State]))
 		}
-		doc, filePath, err := d.requireTextDocument()
+	case "memory":
+		if len(args) != 0 {
+			return false, errors.New("用法: memory")
+		}
+		d.printMemory()
+	case "readonly":
+		if len(args) > 1 || len(args) == 1 && args[0] != "on" && args[0] != "off" {
+			return false, errors.New("用法: readonly [on|off]")
+		}
+		ed, err := d.ws.ActiveEditor()
 		if err != nil {
 			return false, err
 		}
-		if err := doc.Append(args[0]); err != nil {
-			return false, err
+		targetFile = ed.Path()
+		if len(args) == 1 {
+			ed.SetReadOnly(args[0] == "on")
 		}
-		targetFile = filePath
-		d.console.Println("已追加")
-	case "insert":
-		if len(args) != 2 {
-			return false, errors.New("用法: insert <line:col> \"text\"")
+		if ed.IsReadOnly() {
+			d.console.Println("只读: on")
+		} else {
+			d.console.Println("只读: off")
+		}
+	case "set-encoding":
+		usage := errors.New("用法: set-encoding <" + charset.Names + "> [--reinterpret]")
+		if len(args) == 0 || len(args) > 2 || len(args) == 2 && args[1] != "--reinterpret" {
+			return false, usage
 		}
-		line, col, err := parseLineCol(args[0])
+		enc, err := charset.Parse(args[0])
 		if err != nil {
 			return false, err
 		}
-		doc, filePath, err := d.requireTextDocument()
+		ed, err := d.ws.ActiveEditor()
 		if err != nil {
 			return false, err
 		}
-		if err := doc.Insert(line, col, args[1]); err != nil {
+		reinterpret := len(args) == 2
+		if ed, err = d.ws.SetEncoding(ed.Path(), enc, reinterpret); err != nil {
 			return false, err
 		}
-		targetFile = filePath
-		d.console.Println("已插入")
-	case "delete":
-		if len(args) != 2 {
-			return false, errors.New("用法: delete <line:col> <len>")
+		targetFile = ed.Path()
+		if reinterpret {
+			d.console.Println(fmt.Sprintf("已按 %s 编码重新读取: %s", enc, ed.Path()))
+		} else {
+			d.console.Println(fmt.Sprintf("编码: %s (保存时转换)", enc))
+		}
+	case "promote":
+		if len(args) > 1 {
+			return false, errors.New("用法: promote [file]")
+		}
+		var target string
+		if len(args) == 1 {
+			target = args[0]
 		}
-		line, col, err := parseLineCol(args[0])
+		ed, err := d.ws.Promote(target)
 		if err != nil {
 			return false, err
 		}
-		length, err := strconv.Atoi(args[1])
-		if err != nil {
-			return false, fmt.Errorf("长度无效: %s", args[1])
+		targetFile = ed.Path()
+		d.console.Println("已载入完整内容: " + ed.Path())
+	case "line-endings":
+		if len(args) != 0 {
+			return false, errors.New("用法: line-endings")
 		}
-		doc, filePath, err := d.requireTextDocument()
+		ed, err := d.ws.ActiveEditor()
 		if err != nil {
 			return false, err
 		}
-		if err := doc.Delete(line, col, length); err != nil {
-			return false, err
+		doc, ok := ed.(editor.LineEndingEditor)
+		if !ok {
+			return false, errors.New("只有文本文件支持换行符设置")
 		}
-		targetFile = filePath
-		d.console.Println("已删除")
-	case "replace":
-		if len(args) != 3 {
-			return false, errors.New("用法: replace <line:col> <len> \"text\"")
+		targetFile = ed.Path()
+		style := doc.LineStyle()
+		line := "换行符: " + style.Name()
+		if style.Mixed {
+			line += fmt.Sprintf(" (保存时统一为 %s)", style.Ending)
 		}
-		line, col, err := parseLineCol(args[0])
-		if err != nil {
-			return false, err
+		if style.TrailingNewline {
+			line += ", 文件末尾有换行"
 		}
-		length, err := strconv.Atoi(args[1])
-		if err != nil {
-			return false, fmt.Errorf("长度无效: %s", args[1])
+		d.console.Println(line)
+	case "set-line-endings":
+		if len(args) != 1 {
+			return false, errors.New("用法: set-line-endings lf|crlf")
 		}
-		doc, filePath, err := d.requireTextDocument()
+		ending, err := editor.ParseLineEnding(args[0])
 		if err != nil {
 			return false, err
 		}
-		if err := doc.Replace(line, col, length, args[2]); err != nil {
-			return false, err
-		}
-		targetFile = filePath
-		d.console.Println("已替换")
-	case "show":
-		doc, filePath, err := d.requireTextDocument()
+		ed, err := d.ws.ActiveEditor()
 		if err != nil {
 			return false, err
 		}
-		targetFile = filePath
-		displayStart := 1
-		start := 1
-		end := 0
-		if len(args) == 0 {
-			start = 1
-			end = 0
-		} else if len(args) == 1 {
-			var parseErr error
-			start, end, parseErr = parseRange(args[0])
-			if parseErr != nil {
-				return false, parseErr
-			}
-			if start == 0 {
-				start = 1
-			}
-			if end == 0 {
-				end = 0
-			}
-			displayStart = start
-		} else {
-			return false, errors.New("用法: show [start:end]")
+		doc, ok := ed.(editor.LineEndingEditor)
+		if !ok {
+			return false, errors.New("只有文本文件支持换行符设置")
 		}
-		lines, err := doc.Show(start, end)
-		if err != nil {
+		targetFile = ed.Path()
+		if err := doc.ConvertLineEndings(ending); err != nil {
 			return false, err
 		}
-		for i, line := range lines {
-			d.console.Println(fmt.Sprintf("%d: %s", displayStart+i, line))
+		d.console.Println("换行符: " + string(ending))
+	case "reload":
+		if len(args) > 1 {
+			return false, errors.New("用法: reload [file]")
 		}
-	case "insert-before":
-		if len(args) < 3 || len(args) > 4 {
-			return false, errors.New("用法: insert-before <tag> <newId> <targetId> [\"text\"]")
+		var target string
+		if len(args) == 1 {
+			target = args[0]
+		} else if ed, err := d.ws.ActiveEditor(); err == nil {
+			target = ed.Path()
 		}
-		doc, filePath, err := d.requireXMLDocument("")
+		wasText := target != "" && d.ws.IsXMLAsText(target)
+		ed, err := d.ws.Reload(target)
 		if err != nil {
+			d.printParseExcerpt(target, err)
 			return false, err
 		}
-		var textArg *string
-		if len(args) == 4 {
-			val := args[3]
-			textArg = &val
+		targetFile = ed.Path()
+		if wasText && ed.Type() == editor.TypeXML {
+			d.console.Println("已重新加载, 已切换为 XML 编辑器: " + ed.Path())
+		} else {
+			d.console.Println("已重新加载: " + ed.Path())
 		}
-		if err := doc.InsertBefore(args[0], args[1], args[2], textArg); err != nil {
-			return false, err
+	case "revert":
+		if len(args) > 1 {
+			return false, errors.New("用法: revert [file]")
 		}
-		targetFile = filePath
-		d.console.Println("已插入元素")
-	case "append-child":
-		if len(args) < 3 || len(args) > 4 {
-			return false, errors.New("用法: append-child <tag> <newId> <parentId> [\"text\"]")
+		var current editor.Editor
+		var err error
+		if len(args) == 1 {
+			current, err = d.ws.EditorByPath(args[0])
+		} else {
+			current, err = d.ws.ActiveEditor()
 		}
-		doc, filePath, err := d.requireXMLDocument("")
 		if err != nil {
 			return false, err
 		}
-		var textArg *string
-		if len(args) == 4 {
-			val := args[3]
-			textArg = &val
+		if current.IsModified() {
+			discard, confirmErr := d.console.Confirm(fmt.Sprintf("放弃未保存的修改? (y/n) [%s]: ", current.Path()))
+			if confirmErr != nil {
+				return false, confirmErr
+			}
+			if !discard {
+				d.console.Println("已取消还原")
+				break
+			}
 		}
-		if err := doc.AppendChild(args[0], args[1], args[2], textArg); err != nil {
+		ed, err := d.ws.Revert(current.Path())
+		if err != nil {
 			return false, err
 		}
-		targetFile = filePath
-		d.console.Println("已追加子元素")
-	case "edit-id":
-		if len(args) != 2 {
-			return false, errors.New("用法: edit-id <oldId> <newId>")
+		targetFile = ed.Path()
+		d.console.Println("已还原: " + ed.Path())
+	case "editor-list":
+		full := false
+		if len(args) == 1 && args[0] == "--full" {
+			full = true
+		} else if len(args) > 0 {
+			return false, errors.New("用法: editor-list [--full]")
+		}
+		d.printEditors(full)
+	case "open-dir":
+		if len(args) != 1 {
+			return false, errors.New("用法: open-dir <path>")
 		}
-		doc, filePath, err := d.requireXMLDocument("")
+		root, err := d.ws.SetProjectRoot(args[0])
 		if err != nil {
 			return false, err
 		}
-		if err := doc.EditID(args[0], args[1]); err != nil {
-			return false, err
+		d.console.Println("项目目录: " + root)
+	case "files":
+		if len(args) > 1 {
+			return false, errors.New("用法: files [pattern]")
 		}
-		targetFile = filePath
-		d.console.Println("已修改元素 ID")
-	case "edit-text":
-		if len(args) != 2 {
-			return false, errors.New("用法: edit-text <elementId> \"text\"")
+		var pattern string
+		if len(args) == 1 {
+			pattern = args[0]
 		}
-		doc, filePath, err := d.requireXMLDocument("")
+		files, err := d.ws.ProjectFiles(pattern)
 		if err != nil {
 			return false, err
 		}
-		if err := doc.EditText(args[0], args[1]); err != nil {
-			return false, err
+		d.treeFiles, d.treeBase = files, d.ws.ProjectRoot()
+		if len(files) == 0 {
+			d.console.Println("没有匹配的文件")
 		}
-		targetFile = filePath
-		d.console.Println("已更新元素文本")
-	case "delete-element":
-		if len(args) != 1 {
-			return false, errors.New("用法: delete-element <elementId>")
+		for i, path := range files {
+			d.console.Println(fmt.Sprintf("[%d] %s", i+1, d.projectRel(path)))
 		}
-		doc, filePath, err := d.requireXMLDocument("")
+	case "dir-tree":
+		usage := errors.New("用法: dir-tree [path] [--json|--numbered] [--depth n] [--all] [--size]")
+		var dir string
+		asJSON, numbered, all := false, false, false
+		opts := fs.Options{}
+		for i := 0; i < len(args); i++ {
+			switch arg := args[i]; {
+			case arg == "--json":
+				asJSON = true
+			case arg == "--numbered":
+				numbered = true
+			case arg == "--all":
+				all = true
+			case arg == "--size":
+				opts.Sizes = true
+				opts.Annotate = d.ws.EditorMark
+			case arg == "--depth" && i+1 < len(args):
+				i++
+				depth, err := strconv.Atoi(args[i])
+				if err != nil || depth < 1 {
+					return false, fmt.Errorf("深度必须为正整数: %s", args[i])
+				}
+				opts.MaxDepth = depth
+			case dir == "" && !strings.HasPrefix(arg, "--"):
+				dir = arg
+			default:
+				return false, usage
+			}
+		}
+		if asJSON && numbered {
+			return false, usage
+		}
+		opts.SkipHidden = !all
+		d.treeFiles = nil
+		if numbered {
+			result, files, err := d.ws.NumberedDirTree(dir, opts)
+			if err != nil {
+				return false, err
+			}
+			d.treeFiles, d.treeBase = files, d.ws.ProjectRoot()
+			d.console.Println(result)
+			break
+		}
+		if asJSON {
+			opts.Stat = true
+			node, err := d.ws.ScanDir(dir, opts)
+			if err != nil {
+				return false, err
+			}
+			data, err := json.MarshalIndent(node, "", "  ")
+			if err != nil {
+				return false, err
+			}
+			d.console.Println(string(data))
+			break
+		}
+		result, err := d.ws.DirTree(dir, opts)
+		if err != nil {
+			return false, err
+		}
+		d.console.Println(result)
+	case "peek":
+		if len(args) < 1 || len(args) > 2 {
+			return false, errors.New("用法: peek <index> [lines]")
+		}
+		count := peekLines
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return false, fmt.Errorf("行数无效: %s", args[1])
+			}
+			count = n
+		}
+		path, err := d.treeFile(args[0])
+		if err != nil {
+			return false, err
+		}
+		lines, more, err := fs.Head(path, count)
+		if err != nil {
+			return false, err
+		}
+		d.console.Println("== " + path + " ==")
+		for _, line := range lines {
+			d.console.Println(line)
+		}
+		if more {
+			d.console.Println(fmt.Sprintf("... (使用 load %s 打开完整文件)", args[0]))
+		}
+	case "undo":
+		if len(args) > 1 {
+			return false, errors.New("用法: undo [n]")
+		}
+		n, err := parseStepCount(args)
+		if err != nil {
+			return false, err
+		}
+		done, err := d.ws.UndoN(n)
+		if ed, edErr := d.ws.ActiveEditor(); edErr == nil {
+			targetFile = ed.Path()
+		}
+		if err != nil && done == 0 {
+			return false, err
+		}
+		d.console.Println(stepReport("已撤销", n, done))
+		if err != nil {
+			return false, err
+		}
+	case "redo":
+		stashed := len(args) == 1 && args[0] == "--stashed"
+		if len(args) > 1 {
+			return false, errors.New("用法: redo [n|--stashed]")
+		}
+		if stashed {
+			if err := d.ws.RedoStashed(); err != nil {
+				return false, err
+			}
+			if ed, err := d.ws.ActiveEditor(); err == nil {
+				targetFile = ed.Path()
+			}
+			d.console.Println("已重做")
+			break
+		}
+		n, err := parseStepCount(args)
+		if err != nil {
+			return false, err
+		}
+		done, err := d.ws.RedoN(n)
+		if ed, edErr := d.ws.ActiveEditor(); edErr == nil {
+			targetFile = ed.Path()
+		}
+		if err != nil && done == 0 {
+			return false, err
+		}
+		d.console.Println(stepReport("已重做", n, done))
+		if err != nil {
+			return false, err
+		}
+	case "undo-status":
+		if len(args) != 0 {
+			return false, errors.New("用法: undo-status")
+		}
+		ed, err := d.ws.ActiveEditor()
+		if err != nil {
+			return false, err
+		}
+		targetFile = ed.Path()
+		limit := "不限"
+		if l, ok := ed.(editor.UndoLimitingEditor); ok && l.UndoLimit() > 0 {
+			limit = strconv.Itoa(l.UndoLimit())
+		}
+		d.console.Println("撤销上限: " + limit)
+		d.console.Println(fmt.Sprintf("撤销栈: %d", ed.UndoDepth()))
+		d.console.Println(fmt.Sprintf("重做栈: %d", ed.RedoDepth()))
+		if r, ok := ed.(editor.RedoStashingEditor); ok {
+			d.console.Println(fmt.Sprintf("暂存重做: %d", r.StashedRedoDepth()))
+		}
+	case "undo-list":
+		if len(args) != 0 {
+			return false, errors.New("用法: undo-list")
+		}
+		ed, err := d.ws.ActiveEditor()
+		if err != nil {
+			return false, err
+		}
+		targetFile = ed.Path()
+		descs := ed.UndoDescriptions()
+		if len(descs) == 0 {
+			d.console.Println("没有可撤销的操作")
+		}
+		for i, desc := range descs {
+			d.console.Println(fmt.Sprintf("%d. %s", i+1, desc))
+		}
+	case "redo-list":
+		if len(args) != 0 {
+			return false, errors.New("用法: redo-list")
+		}
+		ed, err := d.ws.ActiveEditor()
+		if err != nil {
+			return false, err
+		}
+		targetFile = ed.Path()
+		descs := ed.RedoDescriptions()
+		if len(descs) == 0 {
+			d.console.Println("没有可重做的操作")
+		}
+		for i, desc := range descs {
+			d.console.Println(fmt.Sprintf("%d. %s", i+1, desc))
+		}
+		if r, ok := ed.(editor.RedoStashingEditor); ok && r.StashedRedoDepth() > 0 {
+			d.console.Println(fmt.Sprintf("暂存分支: %d 个操作 (redo --stashed 恢复)", r.StashedRedoDepth()))
+		}
+	case "append":
+		if len(args) != 1 {
+			return false, errors.New("用法: append \"text\"")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		if err := doc.Append(args[0]); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已追加")
+	case "insert":
+		if len(args) != 2 {
+			return false, errors.New("用法: insert <line:col|.> \"text\"")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		line, col, err := parsePosition(args[0], doc)
+		if err != nil {
+			return false, err
+		}
+		if err := doc.Insert(line, col, args[1]); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已插入")
+	case "delete":
+		if len(args) != 2 {
+			return false, errors.New("用法: delete <line:col|.> <len>")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		line, col, err := parsePosition(args[0], doc)
+		if err != nil {
+			return false, err
+		}
+		length, err := strconv.Atoi(args[1])
+		if err != nil {
+			return false, fmt.Errorf("长度无效: %s", args[1])
+		}
+		if err := doc.Delete(line, col, length); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已删除")
+	case "copy":
+		if len(args) != 2 {
+			return false, errors.New("用法: copy <line:col|.> <len>")
+		}
+		reader, _, err := d.requireLineReader()
+		if err != nil {
+			return false, err
+		}
+		doc, ok := reader.(editor.SpanReader)
+		if !ok {
+			return false, errors.New("当前文件不支持文本命令")
+		}
+		line, col, err := parsePosition(args[0], doc)
+		if err != nil {
+			return false, err
+		}
+		length, err := strconv.Atoi(args[1])
+		if err != nil {
+			return false, fmt.Errorf("长度无效: %s", args[1])
+		}
+		text, err := doc.Span(line, col, length)
+		if err != nil {
+			return false, err
+		}
+		d.ws.SetRegister(text)
+		d.console.Println(fmt.Sprintf("已复制 %d 个字符", length))
+	case "copy-lines":
+		if len(args) != 1 {
+			return false, errors.New("用法: copy-lines <start:end>")
+		}
+		doc, _, err := d.requireLineReader()
+		if err != nil {
+			return false, err
+		}
+		start, end, text, err := selectLines(doc, args[0])
+		if err != nil {
+			return false, err
+		}
+		d.ws.SetRegister(text)
+		d.console.Println(fmt.Sprintf("已复制 %d 行", end-start+1))
+	case "cut-lines":
+		if len(args) != 1 {
+			return false, errors.New("用法: cut-lines <start:end>")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		start, end, text, err := selectLines(doc, args[0])
+		if err != nil {
+			return false, err
+		}
+		if err := doc.DeleteLines(start, end); err != nil {
+			return false, err
+		}
+		d.ws.SetRegister(text)
+		targetFile = filePath
+		noop = d.reportEdit(doc, fmt.Sprintf("已剪切 %d 行", end-start+1))
+	case "paste":
+		if len(args) != 1 {
+			return false, errors.New("用法: paste <line:col|.>")
+		}
+		text := d.ws.Register()
+		if text == "" {
+			return false, errors.New("剪贴板为空, 请先使用 copy、copy-lines 或 cut-lines")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		line, col, err := parsePosition(args[0], doc)
+		if err != nil {
+			return false, err
+		}
+		if err := doc.Insert(line, col, text); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已粘贴")
+	case "upper", "lower":
+		if len(args) != 2 {
+			return false, fmt.Errorf("用法: %s <line:col|.> <len>", cmd)
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		line, col, err := parsePosition(args[0], doc)
+		if err != nil {
+			return false, err
+		}
+		length, err := strconv.Atoi(args[1])
+		if err != nil {
+			return false, fmt.Errorf("长度无效: %s", args[1])
+		}
+		fn := strings.ToUpper
+		if cmd == "lower" {
+			fn = strings.ToLower
+		}
+		if err := doc.TransformSpan(line, col, length, fn); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已转换大小写")
+	case "title-case":
+		if len(args) != 1 {
+			return false, errors.New("用法: title-case <start:end>")
+		}
+		start, end, err := parseRange(args[0])
+		if err != nil {
+			return false, err
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		if start == 0 {
+			start = 1
+		}
+		if end == 0 {
+			end = doc.LineCount()
+		}
+		if err := doc.TransformLines(start, end, editor.TitleCase); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已转换大小写")
+	case "replace":
+		if len(args) != 3 {
+			return false, errors.New("用法: replace <line:col|.> <len> \"text\"")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		line, col, err := parsePosition(args[0], doc)
+		if err != nil {
+			return false, err
+		}
+		length, err := strconv.Atoi(args[1])
+		if err != nil {
+			return false, fmt.Errorf("长度无效: %s", args[1])
+		}
+		if err := doc.Replace(line, col, length, args[2]); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已替换")
+	case "insert-line":
+		if len(args) != 2 {
+			return false, errors.New("用法: insert-line <n> \"text\"")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return false, fmt.Errorf("行号无效: %s", args[0])
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		before := doc.LineCount()
+		if err := doc.InsertLines(n, []string{args[1]}); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, fmt.Sprintf("已插入 %d 行", doc.LineCount()-before))
+	case "dup-line":
+		if len(args) < 1 || len(args) > 2 {
+			return false, errors.New("用法: dup-line <n> [count]")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return false, fmt.Errorf("行号无效: %s", args[0])
+		}
+		times := 1
+		if len(args) == 2 {
+			if times, err = strconv.Atoi(args[1]); err != nil {
+				return false, fmt.Errorf("重复次数无效: %s", args[1])
+			}
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		if err := doc.DuplicateLines(n, n, times); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, fmt.Sprintf("已复制 %d 行", times))
+	case "dup-lines":
+		if len(args) != 1 {
+			return false, errors.New("用法: dup-lines <start:end>")
+		}
+		start, end, err := parseRange(args[0])
+		if err != nil {
+			return false, err
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		if start == 0 {
+			start = 1
+		}
+		if end == 0 {
+			end = doc.LineCount()
+		}
+		if err := doc.DuplicateLines(start, end, 1); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, fmt.Sprintf("已复制 %d 行", end-start+1))
+	case "join-lines":
+		if len(args) < 1 || len(args) > 2 {
+			return false, errors.New("用法: join-lines <start:end> [separator]")
+		}
+		start, end, err := parseRange(args[0])
+		if err != nil {
+			return false, err
+		}
+		sep := " "
+		if len(args) == 2 {
+			sep = args[1]
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		if start == 0 {
+			start = 1
+		}
+		if end == 0 {
+			end = doc.LineCount()
+		}
+		if err := doc.JoinLines(start, end, sep); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, fmt.Sprintf("已合并 %d 行", end-start+1))
+	case "sort-lines":
+		var opts editor.SortOptions
+		var positional []string
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+				positional = append(positional, arg)
+				continue
+			}
+			for _, flag := range arg[1:] {
+				switch flag {
+				case 'r':
+					opts.Reverse = true
+				case 'n':
+					opts.Numeric = true
+				case 'u':
+					opts.Unique = true
+				default:
+					return false, fmt.Errorf("未知选项: -%c (可选: -r -n -u)", flag)
+				}
+			}
+		}
+		if len(positional) > 1 {
+			return false, errors.New("用法: sort-lines [start:end] [-r] [-n] [-u]")
+		}
+		var start, end int
+		if len(positional) == 1 {
+			var err error
+			if start, end, err = parseRange(positional[0]); err != nil {
+				return false, err
+			}
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		if start == 0 {
+			start = 1
+		}
+		if end == 0 {
+			end = doc.LineCount()
+		}
+		before := doc.LineCount()
+		if err := doc.SortLines(start, end, opts); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		message := fmt.Sprintf("已排序 %d 行", end-start+1)
+		if removed := before - doc.LineCount(); removed > 0 {
+			message += fmt.Sprintf(", 删除重复 %d 行", removed)
+		}
+		noop = d.reportEdit(doc, message)
+	case "split-line":
+		if len(args) != 1 {
+			return false, errors.New("用法: split-line <line:col|.>")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		line, col, err := parsePosition(args[0], doc)
+		if err != nil {
+			return false, err
+		}
+		if err := doc.SplitLine(line, col); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已拆分")
+	case "move-line", "swap-lines":
+		if len(args) != 2 {
+			if cmd == "move-line" {
+				return false, errors.New("用法: move-line <from> <to>")
+			}
+			return false, errors.New("用法: swap-lines <a> <b>")
+		}
+		var lines [2]int
+		for i, arg := range args {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return false, fmt.Errorf("行号无效: %s", arg)
+			}
+			lines[i] = n
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		if cmd == "move-line" {
+			err = doc.MoveLine(lines[0], lines[1])
+		} else {
+			err = doc.SwapLines(lines[0], lines[1])
+		}
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		if cmd == "move-line" {
+			noop = d.reportEdit(doc, fmt.Sprintf("已移动第 %d 行到第 %d 行", lines[0], lines[1]))
+		} else {
+			noop = d.reportEdit(doc, fmt.Sprintf("已交换第 %d 行和第 %d 行", lines[0], lines[1]))
+		}
+	case "delete-line", "delete-lines":
+		if len(args) != 1 {
+			if cmd == "delete-line" {
+				return false, errors.New("用法: delete-line <n>")
+			}
+			return false, errors.New("用法: delete-lines <start:end>")
+		}
+		var start, end int
+		var err error
+		if cmd == "delete-line" {
+			start, err = strconv.Atoi(args[0])
+			if err != nil {
+				return false, fmt.Errorf("行号无效: %s", args[0])
+			}
+			end = start
+		} else if start, end, err = parseRange(args[0]); err != nil {
+			return false, err
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		if start == 0 {
+			start = 1
+		}
+		if end == 0 {
+			end = doc.LineCount()
+		}
+		if err := doc.DeleteLines(start, end); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, fmt.Sprintf("已删除 %d 行", end-start+1))
+	case "replace-all":
+		if len(args) != 2 {
+			return false, errors.New("用法: replace-all \"old\" \"new\"")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		count, err := doc.ReplaceAll(args[0], args[1])
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		if count == 0 {
+			d.console.Println("未找到匹配")
+			noop = true
+		} else {
+			noop = d.reportEdit(doc, fmt.Sprintf("已替换 %d 处", count))
+		}
+	case "expand-tabs", "compress-spaces":
+		if len(args) > 1 {
+			return false, fmt.Errorf("用法: %s [width]", cmd)
+		}
+		width := defaultTabWidth
+		if len(args) == 1 {
+			var err error
+			width, err = strconv.Atoi(args[0])
+			if err != nil {
+				return false, fmt.Errorf("宽度无效: %s", args[0])
+			}
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		var changed int
+		if cmd == "expand-tabs" {
+			changed, err = doc.ExpandTabs(width)
+		} else {
+			changed, err = doc.CompressSpaces(width)
+		}
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, fmt.Sprintf("已修改 %d 行", changed))
+	case "wrap":
+		if len(args) < 1 || len(args) > 2 {
+			return false, errors.New("用法: wrap <start:end> [width]")
+		}
+		start, end, err := parseRange(args[0])
+		if err != nil {
+			return false, err
+		}
+		width := defaultWrapWidth
+		if len(args) == 2 {
+			width, err = strconv.Atoi(args[1])
+			if err != nil {
+				return false, fmt.Errorf("宽度无效: %s", args[1])
+			}
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		if start == 0 {
+			start = 1
+		}
+		if end == 0 {
+			end = doc.LineCount()
+		}
+		if err := doc.Wrap(start, end, width); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已重排")
+	case "show":
+		doc, filePath, err := d.requireLineReader()
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		fullLines := len(args) > 0 && args[len(args)-1] == "--full-lines"
+		if fullLines {
+			args = args[:len(args)-1]
+		}
+		displayStart := 1
+		start := 1
+		end := 0
+		if len(args) == 0 {
+			start = 1
+			end = 0
+		} else if len(args) == 1 {
+			var parseErr error
+			start, end, parseErr = parseRange(args[0])
+			if parseErr != nil {
+				return false, parseErr
+			}
+			if start == 0 {
+				start = 1
+			}
+			if end == 0 {
+				end = 0
+			}
+			displayStart = start
+		} else {
+			return false, errors.New("用法: show [start:end] [--full-lines]")
+		}
+		lines, err := doc.Show(start, end)
+		if err != nil {
+			return false, err
+		}
+		d.printNumbered(displayStart, lines, fullLines)
+	case "show-head", "show-tail":
+		if len(args) > 1 {
+			return false, fmt.Errorf("用法: %s [n]", cmd)
+		}
+		n := 10
+		if len(args) == 1 {
+			parsed, err := strconv.Atoi(args[0])
+			if err != nil || parsed < 1 {
+				return false, fmt.Errorf("行数无效: %s", args[0])
+			}
+			n = parsed
+		}
+		doc, filePath, err := d.requireLineReader()
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		count := doc.LineCount()
+		if count == 0 {
+			break
+		}
+		start, end := 1, min(n, count)
+		if cmd == "show-tail" {
+			start, end = max(count-n+1, 1), count
+		}
+		lines, err := doc.Show(start, end)
+		if err != nil {
+			return false, err
+		}
+		d.printNumbered(start, lines, false)
+	case "mark":
+		if len(args) < 1 || len(args) > 2 {
+			return false, errors.New("用法: mark <name> [line:col]")
+		}
+		doc, filePath, err := d.requireBookmarker()
+		if err != nil {
+			return false, err
+		}
+		line, col := doc.Cursor()
+		if len(args) == 2 {
+			if line, col, err = parseLineCol(args[1]); err != nil {
+				return false, err
+			}
+		}
+		if err := doc.SetMark(args[0], line, col); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		d.console.Println(fmt.Sprintf("已设置书签 %s: %d:%d", args[0], line, col))
+	case "goto-mark":
+		if len(args) != 1 {
+			return false, errors.New("用法: goto-mark <name>")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		mark, err := doc.GotoMark(args[0])
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		d.console.Println(fmt.Sprintf("光标: %d:%d", mark.Line, mark.Col))
+	case "marks":
+		if len(args) != 0 {
+			return false, errors.New("用法: marks")
+		}
+		doc, filePath, err := d.requireBookmarker()
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		d.printMarks(doc.Marks())
+	case "goto":
+		if len(args) != 1 {
+			return false, errors.New("用法: goto <line>[:col]")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		line, col := 0, 1
+		if strings.Contains(args[0], ":") {
+			line, col, err = parseLineCol(args[0])
+		} else {
+			line, err = strconv.Atoi(args[0])
+			if err != nil {
+				err = fmt.Errorf("行号无效: %s", args[0])
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+		if err := doc.MoveCursor(line, col); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		d.console.Println(fmt.Sprintf("光标: %d:%d", line, col))
+	case "find":
+		ignoreCase := len(args) == 2 && args[1] == "-i"
+		if len(args) < 1 || len(args) > 2 || len(args) == 2 && !ignoreCase {
+			return false, errors.New("用法: find \"text\" [-i]")
+		}
+		if args[0] == "" {
+			return false, errors.New("查找内容不能为空")
+		}
+		doc, filePath, err := d.requireLineReader()
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		matches := doc.Find(args[0], ignoreCase)
+		if len(matches) == 0 {
+			d.console.Println("未找到匹配")
+		}
+		for _, match := range matches {
+			d.console.Println(fmt.Sprintf("%d:%d: %s", match.Line, match.Col, match.Text))
+		}
+	case "find-regex":
+		if len(args) != 1 {
+			return false, errors.New("用法: find-regex \"pattern\"")
+		}
+		doc, filePath, err := d.requireTextDocument()
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		matches, err := doc.FindRegex(args[0])
+		if err != nil {
+			return false, err
+		}
+		if len(matches) == 0 {
+			d.console.Println("未找到匹配")
+		}
+		for _, match := range matches {
+			d.console.Println(fmt.Sprintf("%d:%d -> %q", match.Line, match.Col, match.Matched))
+		}
+	case "insert-before":
+		if len(args) < 3 || len(args) > 4 {
+			return false, errors.New("用法: insert-before <tag> <newId> <targetId|selector> [\"text\"]")
+		}
+		doc, filePath, err := d.requireXMLDocument("")
+		if err != nil {
+			return false, err
+		}
+		var textArg *string
+		if len(args) == 4 {
+			val := args[3]
+			textArg = &val
+		}
+		if err := doc.InsertBefore(args[0], args[1], args[2], textArg); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已插入元素")
+	case "append-child":
+		if len(args) < 3 || len(args) > 4 {
+			return false, errors.New("用法: append-child <tag> <newId> <parentId|selector> [\"text\"]")
+		}
+		doc, filePath, err := d.requireXMLDocument("")
+		if err != nil {
+			return false, err
+		}
+		var textArg *string
+		if len(args) == 4 {
+			val := args[3]
+			textArg = &val
+		}
+		if err := doc.AppendChild(args[0], args[1], args[2], textArg); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已追加子元素")
+	case "edit-id":
+		if len(args) != 2 {
+			return false, errors.New("用法: edit-id <oldId|selector> <newId>")
+		}
+		doc, filePath, err := d.requireXMLDocument("")
+		if err != nil {
+			return false, err
+		}
+		if err := doc.EditID(args[0], args[1]); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已修改元素 ID")
+	case "rename-ids":
+		dryRun := len(args) == 4 && args[3] == "--dry-run"
+		if len(args) != 3 && !dryRun {
+			return false, errors.New("用法: rename-ids <rootId> <oldPrefix> <newPrefix> [--dry-run]")
+		}
+		doc, filePath, err := d.requireXMLDocument("")
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		if dryRun {
+			plan, err := doc.PlanIDRenames(args[0], args[1], args[2])
+			if err != nil {
+				return false, err
+			}
+			if len(plan) == 0 {
+				d.console.Println("没有匹配前缀的 ID")
+			}
+			for _, r := range plan {
+				d.console.Println(fmt.Sprintf("%s -> %s", r.Old, r.New))
+			}
+			noop = true
+			break
+		}
+		count, err := doc.RenameIDs(args[0], args[1], args[2])
+		if err != nil {
+			return false, err
+		}
+		noop = d.reportEdit(doc, fmt.Sprintf("已重命名 %d 个 ID", count))
+	case "edit-text":
+		if len(args) != 2 {
+			return false, errors.New("用法: edit-text <elementId|selector> \"text\"")
+		}
+		doc, filePath, err := d.requireXMLDocument("")
+		if err != nil {
+			return false, err
+		}
+		if err := doc.EditText(args[0], args[1]); err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		noop = d.reportEdit(doc, "已更新元素文本")
+	case "delete-element":
+		if len(args) != 1 {
+			return false, errors.New("用法: delete-element <elementId|selector>")
+		}
+		doc, filePath, err := d.requireXMLDocument("")
 		if err != nil {
 			return false, err
 		}
@@ -365,7 +1730,7 @@ func (d *Dispatcher) execute(raw string) (bool, error) {
 			return false, err
 		}
 		targetFile = filePath
-		d.console.Println("已删除元素")
+		noop = d.reportEdit(doc, "已删除元素")
 	case "xml-tree":
 		if len(args) > 1 {
 			return false, errors.New("用法: xml-tree [file]")
@@ -385,9 +1750,139 @@ func (d *Dispatcher) execute(raw string) (bool, error) {
 		} else {
 			d.console.Println(tree)
 		}
+	case "xml-ids":
+		fileArg, tag, err := parseXMLIDsArgs(args)
+		if err != nil {
+			return false, err
+		}
+		doc, filePath, err := d.requireXMLDocument(fileArg)
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		var matched int
+		doc.Walk(func(view editor.ElementView) bool {
+			if tag == "" || view.Tag == tag {
+				d.console.Println(fmt.Sprintf("%s (%s)", view.ID, view.Tag))
+				matched++
+			}
+			return true
+		})
+		if matched == 0 && tag != "" {
+			d.console.Println("无匹配元素")
+		}
+	case "xml-path":
+		if len(args) != 1 {
+			return false, errors.New("用法: xml-path <elementId|selector>")
+		}
+		doc, filePath, err := d.requireXMLDocument("")
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		path, err := doc.ElementPath(args[0])
+		if err != nil {
+			return false, err
+		}
+		parts := make([]string, len(path))
+		for i, ref := range path {
+			parts[i] = ref.Tag
+			if ref.ElementID != "" {
+				parts[i] += "#" + ref.ElementID
+			}
+		}
+		d.console.Println(strings.Join(parts, " > "))
+	case "xml-grep":
+		if len(args) != 1 {
+			return false, errors.New("用法: xml-grep \"text\"")
+		}
+		doc, filePath, err := d.requireXMLDocument("")
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		matches, err := doc.GrepSerialized(args[0])
+		if err != nil {
+			return false, err
+		}
+		if len(matches) == 0 {
+			d.console.Println("未找到匹配")
+		}
+		for _, match := range matches {
+			owner := match.ElementID
+			if owner == "" {
+				owner = "-"
+			}
+			d.console.Println(fmt.Sprintf("%d: %s  [%s]", match.Line, match.Text, owner))
+		}
+	case "doctor":
+		fix := len(args) == 2 && args[1] == "--fix"
+		if len(args) == 0 || args[0] != "--state" || len(args) > 2 || len(args) == 2 && !fix {
+			return false, errors.New("用法: doctor --state [--fix]")
+		}
+		report, err := d.ws.DoctorState(fix)
+		for _, issue := range report.Issues {
+			d.console.Println(fmt.Sprintf("[%s] %s", issue.Check, issue.Message))
+		}
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case len(report.Issues) == 0:
+			d.console.Println("工作区状态无问题")
+		case fix:
+			d.console.Println(fmt.Sprintf("已修复 %d 个问题, 原状态已备份到 %s", len(report.Issues), report.Backup))
+		default:
+			d.console.Println("可使用 doctor --state --fix 修复")
+		}
+	case "xml-doctor":
+		repair := len(args) == 1 && args[0] == "--repair"
+		if len(args) > 1 || len(args) == 1 && !repair {
+			return false, errors.New("用法: xml-doctor [--repair]")
+		}
+		doc, filePath, err := d.requireXMLDocument("")
+		if err != nil {
+			return false, err
+		}
+		targetFile = filePath
+		check := doc.CheckInvariants
+		if repair {
+			check = doc.RepairIndex
+		}
+		var invariantErr *editor.InvariantError
+		if err := check(); errors.As(err, &invariantErr) {
+			for _, problem := range invariantErr.Problems {
+				d.console.Println("- " + problem)
+			}
+			if !repair {
+				d.console.Println("可使用 xml-doctor --repair 重建索引")
+				d.reportNearDuplicateIDs(doc)
+				break
+			}
+			return false, errors.New("重建索引后仍存在问题")
+		} else if err != nil {
+			return false, err
+		}
+		if repair {
+			d.console.Println("已重建索引, XML 结构一致")
+		} else {
+			d.console.Println("XML 结构一致")
+		}
+		d.reportNearDuplicateIDs(doc)
 	case "spell-check":
 		if len(args) > 1 {
-			return false, errors.New("用法: spell-check [file]")
+			return false, errors.New("用法: spell-check [file|all]")
+		}
+		if len(args) == 1 && strings.ToLower(args[0]) == "all" {
+			results, err := d.ws.SpellCheckAll()
+			for _, result := range results {
+				d.console.Println("== " + result.Path + " ==")
+				d.console.Println(result.Report)
+			}
+			if err != nil {
+				return false, err
+			}
+			break
 		}
 		var (
 			fileArg   string
@@ -421,42 +1916,541 @@ func (d *Dispatcher) execute(raw string) (bool, error) {
 		if err := d.logger.Enable(fileArg); err != nil {
 			return false, err
 		}
-		targetFile = fileArg
-		d.console.Println("已开启日志")
-	case "log-off":
-		fileArg, err := d.resolveFileArg(args)
-		if err != nil {
-			return false, err
+		targetFile = fileArg
+		d.console.Println("已开启日志")
+	case "log-off":
+		fileArg, err := d.resolveFileArg(args)
+		if err != nil {
+			return false, err
+		}
+		if err := d.logger.Disable(fileArg); err != nil {
+			return false, err
+		}
+		targetFile = fileArg
+		d.console.Println("已关闭日志")
+	case "log-show":
+		fileArg, err := d.resolveFileArg(args)
+		if err != nil {
+			return false, err
+		}
+		targetFile = fileArg
+		content, err := d.logger.Show(fileArg)
+		if err != nil {
+			return false, err
+		}
+		d.console.Println(content)
+	case "set":
+		if len(args) < 1 || len(args) > 2 {
+			return false, errors.New("用法: set <name> [value]")
+		}
+		settings := d.ws.Settings()
+		name := strings.ToLower(args[0])
+		if len(args) == 2 {
+			if err := settings.Set(name, args[1]); err != nil {
+				return false, err
+			}
+		}
+		value, err := settings.Get(name)
+		if err != nil {
+			return false, err
+		}
+		if len(args) == 2 {
+			d.console.Println(fmt.Sprintf("已设置 %s = %s", name, value))
+		} else {
+			d.console.Println(fmt.Sprintf("%s = %s", name, value))
+		}
+	case "settings":
+		if len(args) != 0 {
+			return false, errors.New("用法: settings")
+		}
+		for _, view := range d.ws.Settings().List() {
+			d.console.Println(fmt.Sprintf("%s = %s (%s)", view.Name, view.Value, view.Source))
+		}
+	case "info":
+		if len(args) > 1 {
+			return false, errors.New("用法: info [file]")
+		}
+		var (
+			ed  editor.Editor
+			err error
+		)
+		if len(args) == 1 {
+			ed, err = d.ws.EditorByPath(args[0])
+		} else {
+			ed, err = d.ws.ActiveEditor()
+		}
+		if err != nil {
+			return false, err
+		}
+		targetFile = ed.Path()
+		modified := "否"
+		if ed.IsModified() {
+			modified = "是"
+		}
+		d.console.Println("路径: " + ed.Path())
+		d.console.Println(fmt.Sprintf("类型: %s", ed.Type()))
+		d.console.Println("已修改: " + modified)
+		d.console.Println(fmt.Sprintf("大小: %d 字节", ed.Size()))
+	case "diff":
+		diffTarget, err := d.runDiff(args)
+		if err != nil {
+			return false, err
+		}
+		targetFile = diffTarget
+	case "workspace-undo":
+		if len(args) == 1 && args[0] == "--list" {
+			ops := d.ws.FileOperations()
+			if len(ops) == 0 {
+				d.console.Println("没有可撤销的文件操作")
+			}
+			for i, op := range ops {
+				d.console.Println(fmt.Sprintf("%d. %s", i+1, op))
+			}
+			break
+		}
+		if len(args) != 0 {
+			return false, errors.New("用法: workspace-undo [--list]")
+		}
+		desc, err := d.ws.UndoFileOperation()
+		if err != nil {
+			return false, err
+		}
+		if ed, _ := d.ws.ActiveEditor(); ed != nil {
+			targetFile = ed.Path()
+		}
+		d.console.Println("已撤销文件操作: " + desc)
+	case "selftest":
+		if len(args) != 0 {
+			return false, errors.New("用法: selftest")
+		}
+		results := RunSelfTest()
+		failed := 0
+		for _, result := range results {
+			if result.Passed() {
+				d.console.Println("[PASS] " + result.Step)
+				continue
+			}
+			failed++
+			d.console.Println(fmt.Sprintf("[FAIL] %s: %v", result.Step, result.Err))
+		}
+		d.console.Println(fmt.Sprintf("自检完成: %d 通过, %d 失败", len(results)-failed, failed))
+	case "status":
+		if len(args) != 0 {
+			return false, errors.New("用法: status")
+		}
+		summary := d.ws.Summary()
+		active := summary.Active
+		if active == "" {
+			active = "无"
+		}
+		d.console.Println("工作目录: " + summary.BaseDir)
+		d.console.Println(fmt.Sprintf("打开文件: %d (未保存 %d)", summary.Open, summary.Modified))
+		d.console.Println("活动文件: " + active)
+		if ed, err := d.ws.ActiveEditor(); err == nil {
+			stats := ed.MemoryStats()
+			d.console.Println(fmt.Sprintf("撤销历史: %d 字节, %d 步 (本次会话最多 %d 步, 峰值 %d 字节)",
+				stats.HistoryBytes, stats.UndoEntries, stats.PeakUndoDepth, stats.PeakHistoryBytes))
+		}
+		d.console.Println(fmt.Sprintf("事件序号: %d", events.CurrentSeq()))
+	case "tutorial":
+		if len(args) != 0 {
+			return false, errors.New("用法: tutorial")
+		}
+		if err := d.runTutorial(); err != nil {
+			return false, err
+		}
+	case "version":
+		if len(args) != 0 {
+			return false, errors.New("用法: version")
+		}
+		info := version.Get()
+		d.console.Println("版本: " + info.Version)
+		d.console.Println("提交: " + info.Commit)
+		d.console.Println("构建日期: " + info.Date)
+		d.console.Println("Go 版本: " + info.GoVersion)
+	case "recent":
+		if len(args) != 0 {
+			return false, errors.New("用法: recent")
+		}
+		files := d.ws.ClosedFiles()
+		if len(files) == 0 {
+			d.console.Println("没有最近关闭的文件")
+		}
+		for i, path := range files {
+			d.console.Println(fmt.Sprintf("[%d] %s", i+1, path))
+		}
+	case "reopen":
+		if len(args) > 1 {
+			return false, errors.New("用法: reopen [n]")
+		}
+		n := 1
+		if len(args) == 1 {
+			parsed, err := strconv.Atoi(args[0])
+			if err != nil {
+				return false, fmt.Errorf("编号无效: %s", args[0])
+			}
+			n = parsed
+		}
+		path, err := d.ws.ClosedFile(n)
+		if err != nil {
+			return false, err
+		}
+		// Reopening is a plain load, and is logged as one.
+		if _, err := d.runNested("load " + quoteArg(path)); err != nil {
+			return false, err
+		}
+	case "history":
+		if len(args) != 0 {
+			return false, errors.New("用法: history")
+		}
+		for _, entry := range d.ws.CommandHistory().Entries() {
+			d.console.Println(fmt.Sprintf("%5d  %s", entry.Number, entry.Command))
+		}
+	case "macro":
+		usage := errors.New("用法: macro record <name> | macro stop | macro play <name> [times] | macro list")
+		if len(args) == 0 {
+			return false, usage
+		}
+		switch sub := strings.ToLower(args[0]); {
+		case sub == "record" && len(args) == 2:
+			if err := d.ws.StartMacro(args[1]); err != nil {
+				return false, err
+			}
+			d.console.Println(fmt.Sprintf("开始录制宏 %s, 输入 macro stop 结束", args[1]))
+		case sub == "stop" && len(args) == 1:
+			name, steps, err := d.ws.StopMacro()
+			if err != nil {
+				return false, err
+			}
+			d.console.Println(fmt.Sprintf("宏 %s 已录制 (%d 条命令)", name, steps))
+		case sub == "play" && (len(args) == 2 || len(args) == 3):
+			times := 1
+			if len(args) == 3 {
+				n, err := strconv.Atoi(args[2])
+				if err != nil || n < 1 {
+					return false, fmt.Errorf("次数必须为正整数: %s", args[2])
+				}
+				times = n
+			}
+			done, err := d.playMacro(args[1], times)
+			if err != nil {
+				return false, err
+			}
+			exit = done
+		case sub == "list" && len(args) == 1:
+			names := d.ws.MacroNames()
+			if len(names) == 0 {
+				d.console.Println("没有已录制的宏")
+			}
+			for _, name := range names {
+				steps, _ := d.ws.Macro(name)
+				d.console.Println(fmt.Sprintf("%s (%d 条命令)", name, len(steps)))
+			}
+		default:
+			return false, usage
+		}
+	case "exit":
+		disposition := workspace.CloseAsk
+		if len(args) > 0 {
+			flag, ok := answerFlag(args[0])
+			if !ok || len(args) > 1 {
+				return false, errors.New("用法: exit [-y|-n]")
+			}
+			disposition = flag
+		}
+		if err := d.handleExit(disposition); err != nil {
+			return false, err
+		}
+		exit = true
+	default:
+		return false, fmt.Errorf("未知命令: %s", cmd)
+	}
+
+	if redoDepth > 0 && !noop {
+		d.reportDiscardedRedo(redoDepth)
+	}
+	if workspace.IsMutating(cmd) {
+		if warning := d.ws.SizeWarning(); warning != "" {
+			d.console.Errorln(warning)
+		}
+		if warning := d.ws.HistoryWarning(); warning != "" {
+			d.console.Errorln(warning)
+		}
+	} else {
+		d.ws.BreakCoalescing()
+	}
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata["canonical"] = CanonicalCommand(cmd, args)
+	if noop {
+		metadata["noop"] = "true"
+	}
+	if cmd != "exit" {
+		d.ws.PublishCommandWith(cmd, raw, targetFile, metadata)
+	}
+	if cmd != "macro" && cmd != "exit" && d.nested == 0 {
+		d.ws.RecordMacroStep(raw)
+	}
+	return exit, nil
+}
+
+// runNested runs a command on behalf of the one being executed.
+func (d *Dispatcher) runNested(raw string) (bool, error) {
+	d.nested++
+	defer func() { d.nested-- }()
+	return d.run(raw)
+}
+
+// playMacro runs the commands of macro name times over, stopping at the
+// first failing step. {n} in a step becomes the pass number, so repeated
+// passes can create distinct IDs. It reports whether a step asked to exit.
+func (d *Dispatcher) playMacro(name string, times int) (bool, error) {
+	steps, err := d.ws.Macro(name)
+	if err != nil {
+		return false, err
+	}
+	for round := 1; round <= times; round++ {
+		for i, step := range steps {
+			step = strings.ReplaceAll(step, "{n}", strconv.Itoa(round))
+			exit, err := d.run(step)
+			if err != nil {
+				if times > 1 {
+					return false, fmt.Errorf("宏 %s 第 %d 遍第 %d 步失败 (%s): %v", name, round, i+1, step, err)
+				}
+				return false, fmt.Errorf("宏 %s 第 %d 步失败 (%s): %v", name, i+1, step, err)
+			}
+			if exit {
+				return true, nil
+			}
+		}
+	}
+	d.console.Println(fmt.Sprintf("宏 %s 已执行 %d 遍", name, times))
+	return false, nil
+}
+
+// peekLines is how many lines peek shows by default.
+const peekLines = 10
+
+// treeFile resolves an index shown by the last dir-tree --numbered.
+func (d *Dispatcher) treeFile(arg string) (string, error) {
+	if d.treeFiles == nil || d.treeBase != d.ws.ProjectRoot() {
+		return "", errors.New("没有可用的文件编号, 请先运行 dir-tree --numbered 或 files")
+	}
+	index, err := strconv.Atoi(arg)
+	if err != nil {
+		return "", fmt.Errorf("文件编号无效: %s", arg)
+	}
+	if index < 1 || index > len(d.treeFiles) {
+		return "", fmt.Errorf("文件编号 %d 超出范围 (1-%d), 列表可能已过期, 请重新运行 dir-tree --numbered 或 files", index, len(d.treeFiles))
+	}
+	return d.treeFiles[index-1], nil
+}
+
+// listedFile resolves #n to the file numbered n by the last editor-list. The
+// numbers are stale once files have been opened or closed since.
+func (d *Dispatcher) listedFile(arg string) (string, error) {
+	index, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil {
+		return "", fmt.Errorf("索引无效: %s", arg)
+	}
+	if d.listFiles == nil {
+		return "", errors.New("没有可用的索引, 请先执行 editor-list")
+	}
+	infos := d.ws.List()
+	stale := len(infos) != len(d.listFiles)
+	if !stale {
+		sort.Slice(infos, func(i, j int) bool {
+			return infos[i].Path < infos[j].Path
+		})
+		for i, info := range infos {
+			stale = stale || info.Path != d.listFiles[i]
 		}
-		if err := d.logger.Disable(fileArg); err != nil {
-			return false, err
+	}
+	if stale {
+		return "", errors.New("索引已失效，请重新执行 editor-list")
+	}
+	if index < 1 || index > len(d.listFiles) {
+		return "", fmt.Errorf("索引 %d 超出范围 (1-%d)", index, len(d.listFiles))
+	}
+	return d.listFiles[index-1], nil
+}
+
+// saveFile saves abs and reports whether it was written. When its directory
+// has been removed it offers to recreate the directory or to write a copy
+// elsewhere; when the file changed on disk it offers to overwrite or merge.
+func (d *Dispatcher) saveFile(abs string) (bool, error) {
+	err := d.ws.Save(abs)
+	var external *workspace.ExternalChangeError
+	if errors.As(err, &external) {
+		return d.resolveExternalChange(abs, external)
+	}
+	var missing *workspace.MissingDirError
+	if !errors.As(err, &missing) {
+		return err == nil, err
+	}
+	d.console.Errorln(err.Error())
+	recreate, confirmErr := d.console.Confirm(fmt.Sprintf("是否重新创建该目录并保存? (y/n) [%s]: ", missing.Dir))
+	if confirmErr != nil {
+		return false, err
+	}
+	if recreate {
+		if mkErr := d.ws.RecreateDir(abs); mkErr != nil {
+			return false, mkErr
 		}
-		targetFile = fileArg
-		d.console.Println("已关闭日志")
-	case "log-show":
-		fileArg, err := d.resolveFileArg(args)
-		if err != nil {
+		err := d.ws.Save(abs)
+		return err == nil, err
+	}
+	d.console.Prompt("另存为 (输入路径, 留空取消): ")
+	target, readErr := d.console.ReadLine()
+	if readErr != nil || strings.TrimSpace(target) == "" {
+		return false, errors.New("已取消保存")
+	}
+	copyPath, copyErr := d.ws.SaveCopy(abs, strings.TrimSpace(target))
+	if copyErr != nil {
+		return false, copyErr
+	}
+	d.console.Println(fmt.Sprintf("已另存为: %s (原文件仍未保存)", copyPath))
+	return false, nil
+}
+
+// resolveExternalChange asks whether to overwrite the file changed on disk,
+// merge the external changes into the buffer, or cancel the save. Deleted
+// files and files that cannot be merged only offer overwrite or cancel.
+func (d *Dispatcher) resolveExternalChange(abs string, err *workspace.ExternalChangeError) (bool, error) {
+	d.console.Errorln(err.Error())
+	ed, _ := d.ws.EditorByPath(abs)
+	if _, mergeable := ed.(editor.TextDocument); err.Deleted || !mergeable || d.ws.IsXMLAsText(abs) {
+		overwrite, askErr := d.console.ConfirmOverwrite(abs)
+		if askErr != nil {
 			return false, err
 		}
-		targetFile = fileArg
-		content, err := d.logger.Show(fileArg)
-		if err != nil {
-			return false, err
+		if !overwrite {
+			return false, errors.New("已取消保存")
 		}
-		d.console.Println(content)
-	case "exit":
-		if err := d.handleExit(); err != nil {
-			return false, err
+		overwriteErr := d.ws.Overwrite(abs)
+		return overwriteErr == nil, overwriteErr
+	}
+	d.console.Prompt("覆盖 (o) / 合并 (m) / 取消 (c): ")
+	answer, readErr := d.console.ReadLine()
+	if readErr != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "o":
+		overwriteErr := d.ws.Overwrite(abs)
+		return overwriteErr == nil, overwriteErr
+	case "m":
+		conflicts, mergeErr := d.ws.MergeExternal(abs)
+		if mergeErr != nil {
+			return false, mergeErr
+		}
+		if conflicts > 0 {
+			d.console.Println(fmt.Sprintf("已合并外部修改, %d 处冲突需手动解决后再保存", conflicts))
+		} else {
+			d.console.Println("已合并外部修改, 文件尚未保存")
 		}
-		exit = true
+		return false, nil
 	default:
-		return false, fmt.Errorf("未知命令: %s", cmd)
+		return false, errors.New("已取消保存")
 	}
+}
 
-	if cmd != "exit" {
-		d.ws.PublishCommand(cmd, raw, targetFile)
+// parseStepCount reads the optional step count of undo and redo.
+func parseStepCount(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
 	}
-	return exit, nil
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("步数无效: %s", args[0])
+	}
+	return n, nil
+}
+
+// stepReport describes a multi-step undo or redo, noting when fewer steps ran than requested.
+func stepReport(verb string, requested, done int) string {
+	switch {
+	case requested == 1:
+		return verb
+	case done < requested:
+		return fmt.Sprintf("%s %d 步 (请求 %d 步, 已无更多可用)", verb, done, requested)
+	default:
+		return fmt.Sprintf("%s %d 步", verb, done)
+	}
+}
+
+// pendingRedoDepth reports the redo entries an edit command is about to discard.
+func (d *Dispatcher) pendingRedoDepth(cmd string) int {
+	if !workspace.IsMutating(cmd) || cmd == "undo" || cmd == "redo" {
+		return 0
+	}
+	ed, err := d.ws.ActiveEditor()
+	if err != nil {
+		return 0
+	}
+	return ed.RedoDepth()
+}
+
+// reportDiscardedRedo publishes the truncation once the edit has emptied the
+// redo stack and, unless redo-warn is off, tells the user.
+func (d *Dispatcher) reportDiscardedRedo(depth int) {
+	ed, err := d.ws.ActiveEditor()
+	if err != nil || ed.RedoDepth() > 0 {
+		return
+	}
+	r, ok := ed.(editor.RedoStashingEditor)
+	stashed := ok && r.StashedRedoDepth() == depth
+	d.ws.PublishHistoryTruncated(ed.Path(), depth, stashed)
+	if !d.ws.Settings().Bool("redo-warn") {
+		return
+	}
+	if stashed {
+		d.console.Errorln(fmt.Sprintf("已暂存 %d 个可重做操作, 可用 redo --stashed 恢复", depth))
+		return
+	}
+	d.console.Errorln(fmt.Sprintf("已丢弃 %d 个可重做操作", depth))
+}
+
+// reportEdit prints the success message, or 无变化 when the edit changed nothing.
+// Unless output-level is quiet, the message carries a summary of the edited spot.
+func (d *Dispatcher) reportEdit(ed editor.Editor, message string) bool {
+	if ed.LastEditNoOp() {
+		d.console.Println("无变化")
+		return true
+	}
+	if level, _ := d.ws.Settings().Get("output-level"); level != "quiet" {
+		if summary := formatEditSummary(ed.LastEdit()); summary != "" {
+			message += " (" + summary + ")"
+		}
+	}
+	d.console.Println(message)
+	return false
+}
+
+// summaryWidth caps the runes of line or element text quoted in an edit summary.
+const summaryWidth = 60
+
+func formatEditSummary(s editor.EditSummary) string {
+	switch {
+	case s.ElementID != "" && s.Structural:
+		return fmt.Sprintf("%s 现有 %d 个子元素", s.ElementID, s.Children)
+	case s.ElementID != "":
+		return fmt.Sprintf("%s 文本: %q", s.ElementID, truncateRunes(s.Text, summaryWidth))
+	case s.Line > 0:
+		return fmt.Sprintf("第 %d 行: %q, 共 %d 行", s.Line, truncateRunes(s.LineText, summaryWidth), s.LineCount)
+	case s.LineCount > 0:
+		return fmt.Sprintf("共 %d 行", s.LineCount)
+	}
+	return ""
+}
+
+// absPath resolves a file argument against the workspace directory.
+func (d *Dispatcher) absPath(arg string) string {
+	if filepath.IsAbs(arg) {
+		return filepath.Clean(arg)
+	}
+	return filepath.Join(d.ws.ProjectRoot(), arg)
 }
 
 func (d *Dispatcher) resolveFileArg(args []string) (string, error) {
@@ -464,7 +2458,7 @@ func (d *Dispatcher) resolveFileArg(args []string) (string, error) {
 		return "", errors.New("命令参数过多")
 	}
 	if len(args) == 1 {
-		return filepath.Abs(args[0])
+		return d.absPath(args[0]), nil
 	}
 	ed, err := d.ws.ActiveEditor()
 	if err != nil {
@@ -473,38 +2467,356 @@ func (d *Dispatcher) resolveFileArg(args []string) (string, error) {
 	return ed.Path(), nil
 }
 
-func (d *Dispatcher) printEditors() {
+// defaultWrapWidth is the column limit wrap uses when none is given.
+const defaultWrapWidth = 80
+
+// defaultTabWidth is the tab stop width expand-tabs and compress-spaces use when none is given.
+const defaultTabWidth = 4
+
+// maxExcerptSize bounds the files read back to annotate parse errors.
+const maxExcerptSize = 1 << 20
+
+func (d *Dispatcher) printParseExcerpt(path string, err error) {
+	var parseErr *editor.XMLParseError
+	if !errors.As(err, &parseErr) {
+		return
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(d.ws.ProjectRoot(), path)
+	}
+	info, statErr := os.Stat(path)
+	if statErr != nil || info.Size() > maxExcerptSize {
+		return
+	}
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if parseErr.Line < 1 || parseErr.Line > len(lines) {
+		return
+	}
+	prefix := fmt.Sprintf("%d | ", parseErr.Line)
+	d.console.Errorln(prefix + lines[parseErr.Line-1])
+	d.console.Errorln(strings.Repeat(" ", len(prefix)+parseErr.Column-1) + "^")
+}
+
+func truncateRunes(text string, limit int) string {
+	if prefix, cut := runePrefix(text, limit); cut {
+		return prefix + "..."
+	}
+	return text
+}
+
+// runePrefix returns the first limit runes of text and whether anything was
+// cut off, without converting the whole text to runes.
+func runePrefix(text string, limit int) (string, bool) {
+	end := 0
+	for i := 0; i < limit; i++ {
+		if end >= len(text) {
+			return text, false
+		}
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	return text[:end], end < len(text)
+}
+
+func (d *Dispatcher) printEditors(full bool) {
 	infos := d.ws.List()
 	sort.Slice(infos, func(i, j int) bool {
 		return infos[i].Path < infos[j].Path
 	})
-	for _, info := range infos {
+	d.listFiles = make([]string, len(infos))
+	for i, info := range infos {
+		d.listFiles[i] = info.Path
 		activeMark := " "
 		if info.Active {
 			activeMark = "*"
 		}
-		line := fmt.Sprintf("%s %s", activeMark, info.Name)
+		line := fmt.Sprintf("%s [%d] %s", activeMark, i+1, info.Name)
 		if info.Modified {
 			line += " [modified]"
 		}
+		if info.Missing {
+			line += " [missing]"
+		}
+		if info.DirMissing {
+			line += " [目录已不存在]"
+		}
+		if doc, err := d.ws.EditorByPath(info.Path); err == nil {
+			if doc.IsReadOnly() {
+				line += " [RO]"
+			}
+			if _, lazy := doc.(*editor.LargeTextEditor); lazy {
+				line += " [large]"
+			}
+			if enc, ok := doc.(editor.EncodingEditor); ok && enc.Encoding() != charset.UTF8 {
+				line += " [" + string(enc.Encoding()) + "]"
+			}
+		}
 		line += fmt.Sprintf(" (%s)", statistics.FormatDuration(info.Duration))
+		if info.Active {
+			if doc, err := d.ws.EditorByPath(info.Path); err == nil {
+				if text, ok := doc.(editor.TextDocument); ok {
+					cursorLine, cursorCol := text.Cursor()
+					line += fmt.Sprintf(" [光标 %d:%d]", cursorLine, cursorCol)
+				}
+			}
+		}
+		if full && info.LastCommand != "" {
+			line += " last: " + truncateRunes(info.LastCommand, 40)
+		}
+		d.console.Println(line)
+	}
+}
+
+// reportNearDuplicateIDs lists IDs that only the exact policy tells apart;
+// such documents cannot be opened with id-policy case-insensitive.
+func (d *Dispatcher) reportNearDuplicateIDs(doc editor.XMLTreeEditor) {
+	if d.ws.IDPolicy() != editor.IDExact {
+		return
+	}
+	groups := doc.IDCollisions(editor.IDCaseInsensitive)
+	if len(groups) == 0 {
+		return
+	}
+	d.console.Println("忽略大小写时重复的 ID:")
+	for _, group := range groups {
+		d.console.Println("- " + strings.Join(group, ", "))
+	}
+}
+
+func (d *Dispatcher) printMarks(marks []editor.Bookmark) {
+	if len(marks) == 0 {
+		d.console.Println("无书签")
+		return
+	}
+	var rows [][]string
+	for _, mark := range marks {
+		rows = append(rows, []string{mark.Name, fmt.Sprintf("%d:%d", mark.Line, mark.Col)})
+	}
+	for _, line := range formatTable([]string{"书签", "位置"}, rows) {
+		d.console.Println(line)
+	}
+}
+
+// artifactLabels names each artifact kind for clean.
+var artifactLabels = map[workspace.ArtifactKind]string{
+	workspace.ArtifactBackup:    "备份",
+	workspace.ArtifactOrphanLog: "孤立日志",
+	workspace.ArtifactTemp:      "临时文件",
+}
+
+// clean lists generated files older than the threshold, grouped by kind, and
+// deletes them after one confirmation.
+func (d *Dispatcher) clean(args []string) error {
+	usage := errors.New("用法: clean [--older-than 7d] [--dry-run]")
+	age, dryRun := "7d", false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--dry-run" && !dryRun:
+			dryRun = true
+		case args[i] == "--older-than" && i+1 < len(args):
+			age = args[i+1]
+			i++
+		default:
+			return usage
+		}
+	}
+	olderThan, err := workspace.ParseAge(age)
+	if err != nil {
+		return err
+	}
+	artifacts, err := d.ws.StaleArtifacts(olderThan)
+	if err != nil {
+		return err
+	}
+	if len(artifacts) == 0 {
+		d.console.Println("没有需要清理的文件")
+		return nil
+	}
+	var total int64
+	for _, kind := range workspace.ArtifactKinds {
+		var group []workspace.Artifact
+		var size int64
+		for _, artifact := range artifacts {
+			if artifact.Kind == kind {
+				group = append(group, artifact)
+				size += artifact.Size
+			}
+		}
+		if len(group) == 0 {
+			continue
+		}
+		total += size
+		d.console.Println(fmt.Sprintf("%s (%d 个, %d 字节):", artifactLabels[kind], len(group), size))
+		for _, artifact := range group {
+			d.console.Println(fmt.Sprintf("  %s (%d 字节)", d.relPath(artifact.Path), artifact.Size))
+		}
+	}
+	if dryRun {
+		d.console.Println(fmt.Sprintf("共 %d 个文件, %d 字节 (未删除)", len(artifacts), total))
+		return nil
+	}
+	ok, err := d.console.Confirm(fmt.Sprintf("删除以上 %d 个文件 (%d 字节)? (y/n): ", len(artifacts), total))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		d.console.Println("已取消清理")
+		return nil
+	}
+	removed, err := d.ws.RemoveArtifacts(artifacts)
+	if err != nil {
+		return err
+	}
+	d.console.Println(fmt.Sprintf("已删除 %d 个文件", removed))
+	return nil
+}
+
+func (d *Dispatcher) printMemory() {
+	usages := d.ws.Memory()
+	if len(usages) == 0 {
+		d.console.Println("无打开文件")
+		return
+	}
+	var rows [][]string
+	var total editor.MemoryStats
+	for _, usage := range usages {
+		rows = append(rows, memoryRow(usage.Name, usage.Stats))
+		total.ContentBytes += usage.Stats.ContentBytes
+		total.UndoEntries += usage.Stats.UndoEntries
+		total.HistoryBytes += usage.Stats.HistoryBytes
+		total.PeakUndoDepth += usage.Stats.PeakUndoDepth
+		total.PeakHistoryBytes += usage.Stats.PeakHistoryBytes
+	}
+	rows = append(rows, memoryRow("合计", total))
+	for _, line := range formatTable([]string{"文件", "内容(字节)", "撤销步数", "历史(字节)", "最大步数", "历史峰值(字节)"}, rows) {
 		d.console.Println(line)
 	}
 }
 
-func (d *Dispatcher) handleExit() error {
+// printNumbered prints lines numbered from start, truncating lines longer
+// than the show-width setting unless full is set.
+func (d *Dispatcher) printNumbered(start int, lines []string, full bool) {
+	width := d.ws.Settings().Int("show-width")
+	for i, line := range lines {
+		if !full && width > 0 {
+			if prefix, cut := runePrefix(line, width); cut {
+				line = fmt.Sprintf("%s…(共 %d 字符)", prefix, utf8.RuneCountInString(line))
+			}
+		}
+		d.console.Println(fmt.Sprintf("%d: %s", start+i, line))
+	}
+}
+
+// diskStateLabels describes each disk state for check-external.
+var diskStateLabels = map[workspace.DiskState]string{
+	workspace.DiskUnchanged: "未变化",
+	workspace.DiskModified:  "已被外部修改",
+	workspace.DiskDeleted:   "已被外部删除",
+	workspace.DiskUntracked: "尚未保存到磁盘",
+}
+
+// projectRel shows path relative to the project root.
+func (d *Dispatcher) projectRel(path string) string {
+	if rel, err := filepath.Rel(d.ws.ProjectRoot(), path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// relPath shows path relative to the workspace when it lies inside it.
+func (d *Dispatcher) relPath(path string) string {
+	if rel, err := filepath.Rel(d.ws.BaseDir(), path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// reportRows returns the activity report with paths relative to the workspace.
+func (d *Dispatcher) reportRows() []statistics.DayActivity {
+	rows := d.ws.Activity()
+	for i := range rows {
+		rows[i].File = d.relPath(rows[i].File)
+	}
+	return rows
+}
+
+func memoryRow(name string, stats editor.MemoryStats) []string {
+	return []string{name, strconv.Itoa(stats.ContentBytes), strconv.Itoa(stats.UndoEntries), strconv.Itoa(stats.HistoryBytes),
+		strconv.Itoa(stats.PeakUndoDepth), strconv.Itoa(stats.PeakHistoryBytes)}
+}
+
+// recall expands !! to the last command and !<n> to command n of the history.
+func (d *Dispatcher) recall(raw string) (string, error) {
+	history := d.ws.CommandHistory()
+	if raw == "!!" {
+		return history.Last()
+	}
+	n, err := strconv.Atoi(raw[1:])
+	if err != nil {
+		return "", errors.New("用法: !! 或 !<n>")
+	}
+	return history.Entry(n)
+}
+
+// exitWithoutInput announces that no more input will come and exits.
+func (d *Dispatcher) exitWithoutInput() {
+	d.console.Errorln(fmt.Sprintf("输入已结束或不可用, 将按关闭策略 %s 处理未保存的文件并退出", d.ws.ClosePolicy()))
+	d.ws.Lock()
+	defer d.ws.Unlock()
+	if err := d.handleExit(workspace.CloseAsk); err != nil {
+		d.console.Errorln(fmt.Sprintf("错误: %v", err))
+	}
+}
+
+// answerFlag maps the flags that answer a save prompt in advance to a close
+// disposition: --save or -y saves, --discard or -n discards.
+func answerFlag(arg string) (workspace.CloseDisposition, bool) {
+	switch arg {
+	case "--save", "-y":
+		return workspace.CloseSave, true
+	case "--discard", "-n":
+		return workspace.CloseDiscard, true
+	}
+	return "", false
+}
+
+// handleExit saves or discards modified files as disposition says, asking
+// for each one under CloseAsk, then persists the workspace.
+func (d *Dispatcher) handleExit(disposition workspace.CloseDisposition) error {
 	infos := d.ws.List()
 	for _, info := range infos {
 		if !info.Modified {
 			continue
 		}
-		save, err := d.console.ConfirmSave(info.Path)
+		save, err := d.exitAnswer(info.Path, disposition)
+		if errors.Is(err, io.EOF) {
+			save, err = d.ws.SaveWhenUnanswered(info.Path)
+			if err != nil {
+				// Without input nobody can be asked, so exiting must not stop
+				// here; the changes go to a recovery copy instead.
+				d.recoverUnsaved(info.Path, err)
+				continue
+			}
+		}
 		if err != nil {
 			return err
 		}
 		if save {
-			if err := d.ws.Save(info.Path); err != nil {
-				return err
+			saved, err := d.saveFile(info.Path)
+			if err != nil {
+				if !d.console.Closed() {
+					return err
+				}
+				d.recoverUnsaved(info.Path, fmt.Errorf("无法保存 %s: %v", info.Path, err))
+				continue
+			}
+			if !saved {
+				// A merge or a copy elsewhere leaves changes only in the buffer.
+				return fmt.Errorf("%s 仍有未保存的修改, 已取消退出", info.Path)
 			}
 		}
 	}
@@ -515,11 +2827,46 @@ func (d *Dispatcher) handleExit() error {
 	return nil
 }
 
+// recoverUnsaved writes the changes to path that exit could not save to a
+// recovery copy, reporting why alongside where they went.
+func (d *Dispatcher) recoverUnsaved(path string, cause error) {
+	target, err := d.ws.WriteRecovery(path)
+	if err != nil {
+		d.console.Errorln(fmt.Sprintf("警告: %v, 且无法写入恢复文件: %v, 未保存的修改已丢弃", cause, err))
+		return
+	}
+	d.console.Errorln(fmt.Sprintf("警告: %v, 未保存的修改已写入 %s", cause, target))
+}
+
+// exitAnswer decides whether exit saves path, prompting only when neither
+// the command nor the confirm setting has answered already.
+func (d *Dispatcher) exitAnswer(path string, disposition workspace.CloseDisposition) (bool, error) {
+	switch disposition {
+	case workspace.CloseSave:
+		return true, nil
+	case workspace.CloseDiscard:
+		return false, nil
+	}
+	if answer, preset := d.ws.PresetAnswer(); preset {
+		return answer, nil
+	}
+	return d.console.ConfirmSave(path)
+}
+
 func (d *Dispatcher) requireTextDocument() (editor.TextDocument, string, error) {
 	ed, err := d.ws.ActiveEditor()
 	if err != nil {
 		return nil, "", err
 	}
+	if _, lazy := ed.(*editor.LargeTextEditor); lazy {
+		promote, _ := d.console.Confirm(fmt.Sprintf("%s 以大文件模式打开, 是否载入完整内容以继续? (y/n): ", ed.Name()))
+		if !promote {
+			return nil, "", editor.ErrLargeFile
+		}
+		if ed, err = d.ws.Promote(ed.Path()); err != nil {
+			return nil, "", err
+		}
+	}
 	doc, ok := ed.(editor.TextDocument)
 	if !ok {
 		return nil, "", errors.New("当前文件不支持文本命令")
@@ -527,6 +2874,34 @@ func (d *Dispatcher) requireTextDocument() (editor.TextDocument, string, error)
 	return doc, ed.Path(), nil
 }
 
+// requireLineReader returns the active text document, including one open in
+// large-file mode, for commands that only read lines.
+func (d *Dispatcher) requireLineReader() (editor.LineReader, string, error) {
+	ed, err := d.ws.ActiveEditor()
+	if err != nil {
+		return nil, "", err
+	}
+	doc, ok := ed.(editor.LineReader)
+	if !ok {
+		return nil, "", errors.New("当前文件不支持文本命令")
+	}
+	return doc, ed.Path(), nil
+}
+
+// requireBookmarker returns the active document for bookmark commands,
+// which do not edit and so work on large files without loading them.
+func (d *Dispatcher) requireBookmarker() (editor.Bookmarker, string, error) {
+	reader, filePath, err := d.requireLineReader()
+	if err != nil {
+		return nil, "", err
+	}
+	doc, ok := reader.(editor.Bookmarker)
+	if !ok {
+		return nil, "", errors.New("当前文件不支持书签")
+	}
+	return doc, filePath, nil
+}
+
 func (d *Dispatcher) requireXMLDocument(arg string) (editor.XMLTreeEditor, string, error) {
 	var (
 		ed  editor.Editor
@@ -547,6 +2922,26 @@ func (d *Dispatcher) requireXMLDocument(arg string) (editor.XMLTreeEditor, strin
 	return doc, ed.Path(), nil
 }
 
+func parseXMLIDsArgs(args []string) (string, string, error) {
+	usage := errors.New("用法: xml-ids [file] [--tag <tag>]")
+	var fileArg, tag string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--tag" {
+			if i+1 >= len(args) || tag != "" {
+				return "", "", usage
+			}
+			tag = args[i+1]
+			i++
+			continue
+		}
+		if fileArg != "" {
+			return "", "", usage
+		}
+		fileArg = args[i]
+	}
+	return fileArg, tag, nil
+}
+
 func optionalText(argPresent bool, value string) *string {
 	if !argPresent {
 		return nil
@@ -555,43 +2950,13 @@ func optionalText(argPresent bool, value string) *string {
 	return &text
 }
 
-func tokenize(line string) ([]string, error) {
-	var tokens []string
-	var builder strings.Builder
-	inQuotes := false
-	tokenReady := false
-	for i := 0; i < len(line); i++ {
-		ch := line[i]
-		switch ch {
-		case '"':
-			if inQuotes {
-				inQuotes = false
-				if builder.Len() == 0 {
-					tokenReady = true
-				}
-			} else {
-				inQuotes = true
-			}
-		case ' ', '\t':
-			if inQuotes {
-				builder.WriteByte(ch)
-			} else if builder.Len() > 0 || tokenReady {
-				tokens = append(tokens, builder.String())
-				builder.Reset()
-				tokenReady = false
-			}
-		default:
-			builder.WriteByte(ch)
-			tokenReady = false
-		}
-	}
-	if inQuotes {
-		return nil, errors.New("缺少匹配的引号")
-	}
-	if builder.Len() > 0 || tokenReady {
-		tokens = append(tokens, builder.String())
+// parsePosition accepts line:col or "." for the document cursor.
+func parsePosition(token string, doc interface{ Cursor() (int, int) }) (int, int, error) {
+	if token == "." {
+		line, col := doc.Cursor()
+		return line, col, nil
 	}
-	return tokens, nil
+	return parseLineCol(token)
 }
 
 func parseLineCol(token string) (int, int, error) {
@@ -610,6 +2975,27 @@ func parseLineCol(token string) (int, int, error) {
 	return line, col, nil
 }
 
+// selectLines resolves a start:end token against doc, where an omitted bound
+// means the first or last line, and returns the lines as register text. The
+// text ends with a newline so pasting it at column 1 inserts whole lines.
+func selectLines(doc editor.LineReader, token string) (int, int, string, error) {
+	start, end, err := parseRange(token)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if start == 0 {
+		start = 1
+	}
+	lines, err := doc.Show(start, end)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if len(lines) == 0 {
+		return 0, 0, "", errors.New("文档为空")
+	}
+	return start, start + len(lines) - 1, strings.Join(lines, "\n") + "\n", nil
+}
+
 func parseRange(token string) (int, int, error) {
 	if !strings.Contains(token, ":") {
 		start, err := strconv.Atoi(token)
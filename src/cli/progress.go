@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"softwaredesign/src/events"
+)
+
+// ProgressListener renders the progress of long operations on the console's
+// error stream, so command output stays clean.
+type ProgressListener struct {
+	console *Console
+}
+
+// NewProgressListener builds a listener writing to console.
+func NewProgressListener(console *Console) *ProgressListener {
+	return &ProgressListener{console: console}
+}
+
+// Handle prints a line per progress step and notes operations that failed.
+func (p *ProgressListener) Handle(evt events.Event) {
+	switch evt.Type {
+	case events.EventOperationProgress:
+		line := fmt.Sprintf("[%s] %d/%d", evt.Command, evt.Done, evt.Total)
+		if evt.File != "" {
+			line += " " + filepath.Base(evt.File)
+		}
+		p.console.Errorln(line)
+	case events.EventOperationFinished:
+		if reason := evt.Metadata["error"]; reason != "" {
+			p.console.Errorln(fmt.Sprintf("[%s] 已中止 (%d/%d): %s", evt.Command, evt.Done, evt.Total, reason))
+		}
+	}
+}
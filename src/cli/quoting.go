@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"errors"
+	"strings"
+)
+
+// Tokenize splits a command line into arguments. Double quotes group text;
+// inside quotes \" \\ \n and \r are unescaped and other backslashes are kept.
+func Tokenize(line string) ([]string, error) {
+	var tokens []string
+	var builder strings.Builder
+	inQuotes := false
+	tokenReady := false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch ch {
+		case '"':
+			if inQuotes {
+				inQuotes = false
+				if builder.Len() == 0 {
+					tokenReady = true
+				}
+			} else {
+				inQuotes = true
+			}
+		case '\\':
+			if inQuotes && i+1 < len(line) {
+				if decoded, ok := unescape(line[i+1]); ok {
+					builder.WriteByte(decoded)
+					i++
+					continue
+				}
+			}
+			builder.WriteByte(ch)
+			tokenReady = false
+		case ' ', '\t':
+			if inQuotes {
+				builder.WriteByte(ch)
+			} else if builder.Len() > 0 || tokenReady {
+				tokens = append(tokens, builder.String())
+				builder.Reset()
+				tokenReady = false
+			}
+		default:
+			builder.WriteByte(ch)
+			tokenReady = false
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("缺少匹配的引号")
+	}
+	if builder.Len() > 0 || tokenReady {
+		tokens = append(tokens, builder.String())
+	}
+	return tokens, nil
+}
+
+func unescape(ch byte) (byte, bool) {
+	switch ch {
+	case '"', '\\':
+		return ch, true
+	case 'n':
+		return '\n', true
+	case 'r':
+		return '\r', true
+	}
+	return 0, false
+}
+
+// QuoteArgs renders args in the canonical form accepted by Tokenize.
+func QuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// CanonicalCommand renders a command and its arguments on a single line.
+func CanonicalCommand(name string, args []string) string {
+	if len(args) == 0 {
+		return name
+	}
+	return name + " " + QuoteArgs(args)
+}
+
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"\n\r") {
+		return arg
+	}
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		switch ch := arg[i]; ch {
+		case '"', '\\':
+			builder.WriteByte('\\')
+			builder.WriteByte(ch)
+		case '\n':
+			builder.WriteString(`\n`)
+		case '\r':
+			builder.WriteString(`\r`)
+		default:
+			builder.WriteByte(ch)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"softwaredesign/src/workspace"
+)
+
+// ScriptOptions controls how RunScript treats failing commands.
+type ScriptOptions struct {
+	// ContinueOnError runs the remaining commands after one fails.
+	ContinueOnError bool
+}
+
+// RunScript executes the commands in the file at path with a new dispatcher.
+func RunScript(ws *workspace.Workspace, console *Console, path string, opts ScriptOptions) error {
+	return NewDispatcher(ws, console, ws.Logger()).RunScript(path, opts)
+}
+
+// RunScript executes the commands in the file at path one line at a time,
+// skipping blank lines and # comments and echoing each command before its
+// output. It stops at the first failing command unless opts says otherwise.
+// A script that does not exit on its own exits as the interactive mode
+// does, so unsaved files are handled and the workspace state is persisted.
+func (d *Dispatcher) RunScript(path string, opts ScriptOptions) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("无法打开脚本: %v", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	var commands []batchCommand
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commands = append(commands, batchCommand{text: line, where: fmt.Sprintf("脚本第 %d 行", n)})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取脚本失败: %v", err)
+	}
+	return d.runBatch(commands, true, opts)
+}
+
+// RunCommands executes commands given on the command line in order, without
+// echoing them, and exits afterwards the way RunScript does.
+func (d *Dispatcher) RunCommands(commands []string, opts ScriptOptions) error {
+	batch := make([]batchCommand, len(commands))
+	for i, command := range commands {
+		batch[i] = batchCommand{text: command, where: fmt.Sprintf("第 %d 条命令", i+1)}
+	}
+	return d.runBatch(batch, false, opts)
+}
+
+// batchCommand is one command of a non-interactive run and where it came from.
+type batchCommand struct {
+	text  string
+	where string
+}
+
+func (d *Dispatcher) runBatch(commands []batchCommand, echo bool, opts ScriptOptions) error {
+	failures := 0
+	for _, command := range commands {
+		d.console.FlushNotices()
+		if echo {
+			d.console.Println("> " + command.text)
+		}
+		exit, err := d.execute(command.text)
+		if err != nil {
+			d.console.Errorln(fmt.Sprintf("错误: %v", err))
+			if !opts.ContinueOnError {
+				// Stopping early still exits as the interactive mode does.
+				if err := d.exitBatch(); err != nil {
+					d.console.Errorln(fmt.Sprintf("错误: %v", err))
+				}
+				return fmt.Errorf("%s执行失败: %s", command.where, command.text)
+			}
+			failures++
+			continue
+		}
+		if exit {
+			return d.batchResult(failures)
+		}
+	}
+	if err := d.exitBatch(); err != nil {
+		return err
+	}
+	return d.batchResult(failures)
+}
+
+// exitBatch ends a run that did not exit on its own, handling unsaved files
+// and persisting the workspace state.
+func (d *Dispatcher) exitBatch() error {
+	d.ws.Lock()
+	defer d.ws.Unlock()
+	return d.handleExit(workspace.CloseAsk)
+}
+
+// batchResult fails the run when commands failed while continuing past
+// errors, so callers can tell from the exit status.
+func (d *Dispatcher) batchResult(failures int) error {
+	if failures > 0 {
+		return fmt.Errorf("执行完毕, %d 条命令失败", failures)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"strings"
+
+	"softwaredesign/src/editor"
+)
+
+// formatTable aligns rows under header by display width. The first column is
+// left-aligned and the rest right-aligned, which suits name-plus-numbers tables.
+func formatTable(header []string, rows [][]string) []string {
+	widths := make([]int, len(header))
+	all := append([][]string{header}, rows...)
+	for _, row := range all {
+		for i, cell := range row {
+			widths[i] = max(widths[i], editor.DisplayWidth(cell))
+		}
+	}
+	lines := make([]string, 0, len(all))
+	for _, row := range all {
+		var b strings.Builder
+		for i, cell := range row {
+			pad := strings.Repeat(" ", widths[i]-editor.DisplayWidth(cell))
+			if i > 0 {
+				b.WriteString("  ")
+				b.WriteString(pad)
+				b.WriteString(cell)
+			} else {
+				b.WriteString(cell)
+				b.WriteString(pad)
+			}
+		}
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+	}
+	return lines
+}
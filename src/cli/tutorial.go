@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+// tutorialStep is one instruction of the guided tutorial.
+type tutorialStep struct {
+	// Hint explains what the step demonstrates.
+	Hint string
+	// Accept lists equivalent commands; the first is shown to the user.
+	Accept []string
+}
+
+// tutorialSteps drives the tutorial; extend it to add content.
+var tutorialSteps = []tutorialStep{
+	{Hint: "创建一个新的文本缓冲区", Accept: []string{"init text demo.txt", "init text ./demo.txt"}},
+	{Hint: "在文件末尾追加一行", Accept: []string{`append "Hello"`}},
+	{Hint: "再追加一行", Accept: []string{`append "World"`}},
+	{Hint: "查看文件内容", Accept: []string{"show", "show 1:2"}},
+	{Hint: "撤销上一次编辑", Accept: []string{"undo"}},
+	{Hint: "保存当前文件", Accept: []string{"save", "save demo.txt"}},
+	{Hint: "创建一个 XML 文档", Accept: []string{"init xml book.xml", "init xml ./book.xml"}},
+	{Hint: "在根元素下添加子元素", Accept: []string{`append-child title t1 root "Go"`}},
+	{Hint: "查看 XML 树", Accept: []string{"xml-tree", "xml-tree book.xml"}},
+	{Hint: "为当前文件开启日志", Accept: []string{"log-on", "log-on book.xml"}},
+	{Hint: "保存 XML 文档", Accept: []string{"save", "save book.xml"}},
+	{Hint: "退出编辑器", Accept: []string{"exit"}},
+}
+
+// errTutorialQuit signals that the user abandoned the tutorial.
+var errTutorialQuit = errors.New("tutorial quit")
+
+// runTutorial walks the user through tutorialSteps in a temporary sandbox.
+func (d *Dispatcher) runTutorial() error {
+	dir, err := os.MkdirTemp("", "editor-tutorial-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	bus := events.NewBus()
+	logger := logging.NewManager()
+	logger.SetErrorWriter(d.console.ErrWriter())
+	bus.Subscribe(logger)
+	ws := workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logger, d.console)
+	sandbox := NewDispatcher(ws, d.console, logger)
+
+	d.console.Println(fmt.Sprintf("欢迎使用教程, 共 %d 步, 随时输入 quit 退出", len(tutorialSteps)))
+	for i, step := range tutorialSteps {
+		if err := d.tutorialStep(sandbox, i+1, step); err != nil {
+			if errors.Is(err, errTutorialQuit) {
+				d.console.Println("已退出教程")
+				return nil
+			}
+			return err
+		}
+	}
+	d.console.Println("教程完成!")
+	return nil
+}
+
+func (d *Dispatcher) tutorialStep(sandbox *Dispatcher, number int, step tutorialStep) error {
+	d.console.Println(fmt.Sprintf("[%d/%d] %s", number, len(tutorialSteps), step.Hint))
+	d.console.Println("试试输入: " + step.Accept[0])
+	for {
+		d.console.Prompt("tutorial> ")
+		line, err := d.console.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return errTutorialQuit
+		}
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(line) == "quit" {
+			return errTutorialQuit
+		}
+		if !tutorialAccepts(step, line) {
+			d.console.Println("与预期不符, 请输入: " + step.Accept[0])
+			continue
+		}
+		if _, err := sandbox.execute(line); err != nil {
+			d.console.Errorln(fmt.Sprintf("错误: %v", err))
+			continue
+		}
+		return nil
+	}
+}
+
+// tutorialAccepts compares commands in canonical form so quoting and spacing do not matter.
+func tutorialAccepts(step tutorialStep, line string) bool {
+	got, ok := canonicalLine(line)
+	if !ok {
+		return false
+	}
+	for _, accepted := range step.Accept {
+		if want, _ := canonicalLine(accepted); want == got {
+			return true
+		}
+	}
+	return false
+}
+
+func canonicalLine(line string) (string, bool) {
+	tokens, err := Tokenize(strings.TrimSpace(line))
+	if err != nil || len(tokens) == 0 {
+		return "", false
+	}
+	return CanonicalCommand(strings.ToLower(tokens[0]), tokens[1:]), true
+}
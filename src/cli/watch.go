@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"fmt"
+
+	"softwaredesign/src/events"
+	"softwaredesign/src/workspace"
+)
+
+// WatchListener queues a notice on the console when the watcher sees an open
+// file change on disk; it is shown before the next prompt.
+type WatchListener struct {
+	console *Console
+}
+
+// NewWatchListener builds a listener notifying through console.
+func NewWatchListener(console *Console) *WatchListener {
+	return &WatchListener{console: console}
+}
+
+// Handle queues one notice per reported change.
+func (l *WatchListener) Handle(evt events.Event) {
+	if evt.Type != events.EventFileChangedOnDisk {
+		return
+	}
+	if evt.Metadata["state"] == string(workspace.DiskDeleted) {
+		l.console.Notify(fmt.Sprintf("[watch] %s 已在磁盘上被删除", evt.File))
+		return
+	}
+	l.console.Notify(fmt.Sprintf("[watch] %s 已在磁盘上被修改, 可用 reload 重新加载", evt.File))
+}
@@ -0,0 +1,178 @@
+package diff
+
+import "fmt"
+
+// Op tells whether a line is kept, removed, or added.
+type Op int
+
+const (
+	// Equal marks a line present in both versions.
+	Equal Op = iota
+	// Delete marks a line only in the old version.
+	Delete
+	// Insert marks a line only in the new version.
+	Insert
+)
+
+// Edit is one line of a diff.
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// Hunk is a run of edits with surrounding context. Starts are 1-based; an
+// empty side starts at the line before the change, as in unified diffs.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Edits              []Edit
+}
+
+// Lines computes a shortest line diff turning a into b, using the longest
+// common subsequence of the lines between their common prefix and suffix.
+func Lines(a, b []string) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	edits := make([]Edit, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		edits = append(edits, Edit{Equal, line})
+	}
+	edits = append(edits, lcsEdits(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Equal, line})
+	}
+	return edits
+}
+
+func lcsEdits(a, b []string) []Edit {
+	// lengths[i][j] is the LCS length of a[i:] and b[j:].
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	var edits []Edit
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, Edit{Equal, a[i]})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			edits = append(edits, Edit{Delete, a[i]})
+			i++
+		default:
+			edits = append(edits, Edit{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, Edit{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, Edit{Insert, b[j]})
+	}
+	return edits
+}
+
+// Hunks groups changed lines with up to context unchanged lines around them;
+// changes separated by at most 2*context unchanged lines share a hunk.
+func Hunks(edits []Edit, context int) []Hunk {
+	var hunks []Hunk
+	oldLine, newLine := 0, 0
+	start, end := -1, -1
+	oldBefore, newBefore := 0, 0
+	flush := func() {
+		if start < 0 {
+			return
+		}
+		last := min(end+context+1, len(edits))
+		hunk := Hunk{Edits: edits[start:last]}
+		for _, edit := range hunk.Edits {
+			if edit.Op != Insert {
+				hunk.OldLines++
+			}
+			if edit.Op != Delete {
+				hunk.NewLines++
+			}
+		}
+		hunk.OldStart, hunk.NewStart = oldBefore, newBefore
+		if hunk.OldLines > 0 {
+			hunk.OldStart++
+		}
+		if hunk.NewLines > 0 {
+			hunk.NewStart++
+		}
+		hunks = append(hunks, hunk)
+		start = -1
+	}
+	for i, edit := range edits {
+		if edit.Op != Equal {
+			if start >= 0 && i-end-1 > 2*context {
+				flush()
+			}
+			if start < 0 {
+				start = max(i-context, 0)
+				// Count the lines before the hunk's first context line.
+				oldBefore, newBefore = oldLine, newLine
+				for _, prev := range edits[start:i] {
+					if prev.Op != Insert {
+						oldBefore--
+					}
+					if prev.Op != Delete {
+						newBefore--
+					}
+				}
+			}
+			end = i
+		}
+		if edit.Op != Insert {
+			oldLine++
+		}
+		if edit.Op != Delete {
+			newLine++
+		}
+	}
+	flush()
+	return hunks
+}
+
+// Header renders the hunk's "@@ -a,b +c,d @@" line.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Unified renders the difference from a to b as unified-diff hunks, or nil
+// when the versions are equal.
+func Unified(a, b []string, context int) []string {
+	var out []string
+	for _, hunk := range Hunks(Lines(a, b), context) {
+		out = append(out, hunk.Header())
+		for _, edit := range hunk.Edits {
+			prefix := " "
+			switch edit.Op {
+			case Delete:
+				prefix = "-"
+			case Insert:
+				prefix = "+"
+			}
+			out = append(out, prefix+edit.Text)
+		}
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package diff
+
+import "slices"
+
+// Conflict markers written around lines both sides changed differently.
+const (
+	MarkerOurs   = "<<<<<<<"
+	MarkerSep    = "======="
+	MarkerTheirs = ">>>>>>>"
+)
+
+// MergeResult is the outcome of a three-way merge.
+type MergeResult struct {
+	Lines []string
+	// Conflicts counts the regions wrapped in conflict markers.
+	Conflicts int
+}
+
+// Merge combines the changes ours and theirs each made to base. Regions
+// changed on one side take that side; regions changed identically on both
+// sides are kept once; other regions become a conflict labelled with
+// oursLabel and theirsLabel.
+func Merge(base, ours, theirs []string, oursLabel, theirsLabel string) MergeResult {
+	toOurs := matches(base, ours)
+	toTheirs := matches(base, theirs)
+	var result MergeResult
+	b, o, t := 0, 0, 0
+	for {
+		// The next base line both sides kept anchors the end of this chunk.
+		next := b
+		for next < len(base) && (toOurs[next] < 0 || toTheirs[next] < 0) {
+			next++
+		}
+		endOurs, endTheirs := len(ours), len(theirs)
+		if next < len(base) {
+			endOurs, endTheirs = toOurs[next], toTheirs[next]
+		}
+		result.mergeChunk(base[b:next], ours[o:endOurs], theirs[t:endTheirs], oursLabel, theirsLabel)
+		if next == len(base) {
+			return result
+		}
+		result.Lines = append(result.Lines, base[next])
+		b, o, t = next+1, endOurs+1, endTheirs+1
+	}
+}
+
+func (r *MergeResult) mergeChunk(base, ours, theirs []string, oursLabel, theirsLabel string) {
+	switch {
+	case slices.Equal(ours, base):
+		r.Lines = append(r.Lines, theirs...)
+	case slices.Equal(theirs, base), slices.Equal(ours, theirs):
+		r.Lines = append(r.Lines, ours...)
+	default:
+		r.Conflicts++
+		r.Lines = append(r.Lines, MarkerOurs+" "+oursLabel)
+		r.Lines = append(r.Lines, ours...)
+		r.Lines = append(r.Lines, MarkerSep)
+		r.Lines = append(r.Lines, theirs...)
+		r.Lines = append(r.Lines, MarkerTheirs+" "+theirsLabel)
+	}
+}
+
+// matches maps each base line to its index in other, or -1 if the diff
+// removed it.
+func matches(base, other []string) []int {
+	result := make([]int, len(base))
+	i, j := 0, 0
+	for _, edit := range Lines(base, other) {
+		switch edit.Op {
+		case Equal:
+			result[i] = j
+			i++
+			j++
+		case Delete:
+			result[i] = -1
+			i++
+		case Insert:
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Bookmark is a named position in a text document.
+type Bookmark struct {
+	Name string
+	Line int
+	Col  int
+}
+
+// SetMark labels line:col with name, replacing any bookmark of that name.
+// Bookmarks are not content edits, so they bypass undo and read-only checks.
+func (e *TextEditor) SetMark(name string, line, col int) error {
+	if err := checkMarkName(name); err != nil {
+		return err
+	}
+	if err := e.ensureLinePosition(line, col, true); err != nil {
+		return err
+	}
+	if e.marks == nil {
+		e.marks = map[string]position{}
+	}
+	e.marks[name] = position{line, col}
+	return nil
+}
+
+// Mark looks up a bookmark by name.
+func (e *TextEditor) Mark(name string) (Bookmark, bool) {
+	pos, ok := e.marks[name]
+	return Bookmark{Name: name, Line: pos.line, Col: pos.col}, ok
+}
+
+// GotoMark moves the cursor to the named bookmark.
+func (e *TextEditor) GotoMark(name string) (Bookmark, error) {
+	mark, ok := e.Mark(name)
+	if !ok {
+		return Bookmark{}, errors.New("书签不存在: " + name)
+	}
+	e.cursor = position{mark.Line, mark.Col}
+	return mark, nil
+}
+
+// Marks lists the bookmarks in document order.
+func (e *TextEditor) Marks() []Bookmark {
+	return sortedMarks(e.marks)
+}
+
+func checkMarkName(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("书签名无效: %q", name)
+	}
+	return nil
+}
+
+// sortedMarks lists marks by position, then by name.
+func sortedMarks(positions map[string]position) []Bookmark {
+	marks := make([]Bookmark, 0, len(positions))
+	for name, pos := range positions {
+		marks = append(marks, Bookmark{Name: name, Line: pos.line, Col: pos.col})
+	}
+	sort.Slice(marks, func(i, j int) bool {
+		a, b := marks[i], marks[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Col != b.Col {
+			return a.Col < b.Col
+		}
+		return a.Name < b.Name
+	})
+	return marks
+}
+
+// shiftMarks follows d: bookmarks below the changed lines move with them,
+// bookmarks on lines d removed are dropped, and columns are clamped to the
+// new line length.
+func (e *TextEditor) shiftMarks(d lineDelta) {
+	for name, pos := range e.marks {
+		idx := pos.line - 1
+		switch {
+		case idx < d.start:
+		case idx >= d.start+len(d.removed):
+			pos.line += len(d.inserted) - len(d.removed)
+		case idx-d.start >= len(d.inserted):
+			delete(e.marks, name)
+			continue
+		}
+		if pos.line > len(e.lines) {
+			delete(e.marks, name)
+			continue
+		}
+		pos.col = min(pos.col, utf8.RuneCountInString(e.lines[pos.line-1])+1)
+		e.marks[name] = pos
+	}
+}
+
+// inverse returns the delta that undoes d.
+func (d lineDelta) inverse() lineDelta {
+	return lineDelta{start: d.start, removed: d.inserted, inserted: d.removed}
+}
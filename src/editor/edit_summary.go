@@ -0,0 +1,38 @@
+package editor
+
+// EditSummary describes the document around the most recent edit.
+type EditSummary struct {
+	// Line is the 1-based first line a text edit changed; 0 when that line no
+	// longer exists or the last command was not an edit.
+	Line      int
+	LineText  string
+	LineCount int
+	// ElementID names the XML element whose children (Structural) or text changed.
+	ElementID  string
+	Structural bool
+	Children   int
+	Text       string
+}
+
+// LastEdit summarizes the first line changed by the most recent edit.
+func (e *TextEditor) LastEdit() EditSummary {
+	summary := EditSummary{LineCount: len(e.lines)}
+	if e.lastLine > 0 && e.lastLine <= len(e.lines) {
+		summary.Line = e.lastLine
+		summary.LineText = e.lines[e.lastLine-1]
+	}
+	return summary
+}
+
+// LastEdit summarizes the element whose children or text the most recent edit changed.
+func (e *XMLEditor) LastEdit() EditSummary {
+	if e.focus == nil {
+		return EditSummary{}
+	}
+	return EditSummary{
+		ElementID:  e.focus.ID,
+		Structural: e.focusStructural,
+		Children:   len(e.focus.Children),
+		Text:       e.focus.Text,
+	}
+}
@@ -0,0 +1,127 @@
+package editor
+
+import "fmt"
+
+// historyMeter tracks what an editor's undo history retains and the
+// high-water marks reached this session. Editors report each stack change via
+// observe, measuring entries by their own sizeBytes.
+type historyMeter struct {
+	retained  int
+	peakDepth int
+	peakBytes int
+}
+
+func (m *historyMeter) observe(depth, retained int) {
+	m.retained = retained
+	m.peakDepth = max(m.peakDepth, depth)
+	m.peakBytes = max(m.peakBytes, retained)
+}
+
+func (m *historyMeter) fill(stats *MemoryStats) {
+	stats.HistoryBytes = m.retained
+	stats.PeakUndoDepth = m.peakDepth
+	stats.PeakHistoryBytes = m.peakBytes
+}
+
+// sizeBytes estimates the bytes retained by the command's delta.
+func (c *editCommand) sizeBytes() int {
+	return c.delta.sizeBytes()
+}
+
+// sizeBytes estimates the bytes retained by the command's operations.
+func (c *xmlCommand) sizeBytes() int {
+	size := 0
+	for _, op := range c.ops {
+		size += op.sizeBytes()
+	}
+	return size
+}
+
+// recordHistory refreshes the history meter after a stack push, pop, or clear.
+func (e *TextEditor) recordHistory() {
+	retained := 0
+	for _, stack := range [][]*editCommand{e.undoStack, e.redoStack, e.stashedRedo} {
+		for _, cmd := range stack {
+			retained += cmd.sizeBytes()
+		}
+	}
+	retained += linesSize(e.stashBase)
+	e.history.observe(len(e.undoStack), retained)
+}
+
+// recordHistory refreshes the history meter after a stack push, pop, or clear.
+func (e *XMLEditor) recordHistory() {
+	retained := 0
+	for _, stack := range [][]*xmlCommand{e.undoStack, e.redoStack, e.stashedRedo} {
+		for _, cmd := range stack {
+			retained += cmd.sizeBytes()
+		}
+	}
+	if e.stashRoot != nil {
+		retained += e.stashSize
+	}
+	e.history.observe(len(e.undoStack), retained)
+}
+
+// repeatSteps runs step up to n times, stopping when the available entries run
+// out. With nothing available it runs step once so the caller's error surfaces.
+func repeatSteps(n, available int, step func() error) (int, error) {
+	if n < 1 {
+		return 0, fmt.Errorf("步数必须大于0: %d", n)
+	}
+	if available == 0 {
+		return 0, step()
+	}
+	done := 0
+	for done < min(n, available) {
+		if err := step(); err != nil {
+			return done, err
+		}
+		done++
+	}
+	return done, nil
+}
+
+// SetUndoLimit caps the undo stack, truncating it at once if it is deeper.
+func (e *TextEditor) SetUndoLimit(limit int) {
+	e.undoLimit = max(limit, 0)
+	e.trimUndo()
+	e.recordHistory()
+}
+
+// UndoLimit reports the undo stack cap; 0 means unlimited.
+func (e *TextEditor) UndoLimit() int {
+	return e.undoLimit
+}
+
+// trimUndo evicts the oldest undo entries beyond the limit. Redo entries hold
+// their own snapshots, so they stay valid.
+func (e *TextEditor) trimUndo() {
+	if e.undoLimit == 0 || len(e.undoStack) <= e.undoLimit {
+		return
+	}
+	excess := len(e.undoStack) - e.undoLimit
+	e.undoStack = append([]*editCommand(nil), e.undoStack[excess:]...)
+}
+
+// SetUndoLimit caps the undo stack, truncating it at once if it is deeper.
+func (e *XMLEditor) SetUndoLimit(limit int) {
+	e.undoLimit = max(limit, 0)
+	e.trimUndo()
+	e.recordHistory()
+}
+
+// UndoLimit reports the undo stack cap; 0 means unlimited.
+func (e *XMLEditor) UndoLimit() int {
+	return e.undoLimit
+}
+
+// trimUndo evicts the oldest undo entries beyond the limit. Redo entries only
+// touch states newer than the evicted ones, so they stay valid.
+func (e *XMLEditor) trimUndo() {
+	if e.undoLimit == 0 || len(e.undoStack) <= e.undoLimit {
+		return
+	}
+	excess := len(e.undoStack) - e.undoLimit
+	e.undoStack = append([]*xmlCommand(nil), e.undoStack[excess:]...)
+}
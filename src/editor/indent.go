@@ -0,0 +1,57 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExpandTabs converts the leading whitespace of every line to spaces, with tab
+// stops every width columns, as one undoable edit. It returns the number of
+// lines changed.
+func (e *TextEditor) ExpandTabs(width int) (int, error) {
+	return e.reindent("expand-tabs", width, func(col int) string {
+		return strings.Repeat(" ", col)
+	})
+}
+
+// CompressSpaces rewrites the leading whitespace of every line as tabs,
+// keeping spaces only for a remainder narrower than width. It returns the
+// number of lines changed.
+func (e *TextEditor) CompressSpaces(width int) (int, error) {
+	return e.reindent("compress-spaces", width, func(col int) string {
+		return strings.Repeat("\t", col/width) + strings.Repeat(" ", col%width)
+	})
+}
+
+func (e *TextEditor) reindent(desc string, width int, render func(col int) string) (int, error) {
+	if width < 1 {
+		return 0, fmt.Errorf("宽度必须大于0: %d", width)
+	}
+	changed := 0
+	err := e.execute(desc, func() error {
+		for i, line := range e.lines {
+			indent := len(line) - len(strings.TrimLeft(line, " \t"))
+			replaced := render(indentColumns(line[:indent], width)) + line[indent:]
+			if replaced != line {
+				e.lines[i] = replaced
+				changed++
+			}
+		}
+		e.size = linesSize(e.lines)
+		return nil
+	})
+	return changed, err
+}
+
+// indentColumns measures a run of spaces and tabs in display columns.
+func indentColumns(indent string, width int) int {
+	col := 0
+	for _, r := range indent {
+		if r == '\t' {
+			col += width - col%width
+		} else {
+			col++
+		}
+	}
+	return col
+}
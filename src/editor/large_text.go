@@ -0,0 +1,375 @@
+package editor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrLargeFile is returned when editing a file opened in large-file mode.
+var ErrLargeFile = errors.New("文件以大文件模式打开, 不支持编辑 (可用 promote 载入完整内容后编辑)")
+
+// largeReadChunk is how much of the file is read at a time while indexing,
+// searching, or iterating.
+const largeReadChunk = 1 << 20
+
+// indexBlock is how many line offsets one block of the index holds. Fixed
+// blocks let the index grow without copying what it already holds.
+const indexBlock = 1 << 16
+
+// lineIndex stores line start offsets in fixed-size blocks.
+type lineIndex struct {
+	blocks [][]int64
+	count  int
+}
+
+func (x *lineIndex) add(offset int64) {
+	if x.count%indexBlock == 0 {
+		x.blocks = append(x.blocks, make([]int64, 0, indexBlock))
+	}
+	last := len(x.blocks) - 1
+	x.blocks[last] = append(x.blocks[last], offset)
+	x.count++
+}
+
+func (x *lineIndex) at(i int) int64 {
+	return x.blocks[i/indexBlock][i%indexBlock]
+}
+
+// LargeTextEditor shows a text file without holding its content: it keeps
+// the byte offset where each line starts and reads lines from disk on
+// demand. It cannot be edited; promote it to a TextEditor first.
+type LargeTextEditor struct {
+	path string
+	// offsets holds where line i+1 starts at i; the last entry is the end
+	// of the data, so there is one more offset than lines.
+	offsets  *lineIndex
+	size     int64
+	modified bool
+	readOnly bool
+	marks    map[string]position
+}
+
+// OpenLargeText indexes the lines of the UTF-8 file at path. A leading byte
+// order mark is skipped; CRLF and LF both end a line.
+func OpenLargeText(path string) (*LargeTextEditor, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReaderSize(file, largeReadChunk)
+	var start int64
+	if head, _ := reader.Peek(3); bytes.Equal(head, []byte{0xEF, 0xBB, 0xBF}) {
+		if _, err := reader.Discard(3); err != nil {
+			return nil, err
+		}
+		start = 3
+	}
+	offsets := &lineIndex{}
+	offsets.add(start)
+	pos := start
+	buf := make([]byte, largeReadChunk)
+	for {
+		n, readErr := reader.Read(buf)
+		chunk := buf[:n]
+		for {
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			pos += int64(i) + 1
+			offsets.add(pos)
+			chunk = chunk[i+1:]
+		}
+		pos += int64(len(chunk))
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	// A final line without a newline still counts.
+	if pos > offsets.at(offsets.count-1) {
+		offsets.add(pos)
+	}
+	return &LargeTextEditor{path: path, offsets: offsets, size: pos}, nil
+}
+
+// Path returns the backing file path.
+func (e *LargeTextEditor) Path() string {
+	return e.path
+}
+
+// Rename rebinds the editor; the new file must hold the indexed content.
+func (e *LargeTextEditor) Rename(path string) {
+	e.path = path
+}
+
+// Name returns the file name for display.
+func (e *LargeTextEditor) Name() string {
+	return filepath.Base(e.path)
+}
+
+// Type returns the editor kind.
+func (e *LargeTextEditor) Type() Type {
+	return TypeText
+}
+
+// IsModified reports whether editor has unsaved changes.
+func (e *LargeTextEditor) IsModified() bool {
+	return e.modified
+}
+
+// SetModified forces modified flag.
+func (e *LargeTextEditor) SetModified(value bool) {
+	e.modified = value
+}
+
+// Content reads the whole file, joined the way TextEditor joins lines.
+func (e *LargeTextEditor) Content() (string, error) {
+	lines, err := e.Show(1, 0)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Size reports the byte size of the file.
+func (e *LargeTextEditor) Size() int {
+	return int(e.size)
+}
+
+// LineCount returns the number of lines.
+func (e *LargeTextEditor) LineCount() int {
+	return e.offsets.count - 1
+}
+
+// Show reads lines start through end (0 meaning the last line) from disk.
+func (e *LargeTextEditor) Show(start, end int) ([]string, error) {
+	count := e.LineCount()
+	if count == 0 {
+		return []string{}, nil
+	}
+	if start < 1 || start > count {
+		return nil, fmt.Errorf("起始行越界: %d", start)
+	}
+	if end == 0 {
+		end = count
+	}
+	if end < start || end > count {
+		return nil, fmt.Errorf("结束行越界: %d", end)
+	}
+	view := make([]string, 0, end-start+1)
+	err := e.eachLine(start, end, func(_ int, line string) bool {
+		view = append(view, line)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// Span returns length runes starting at line:col, reading only that line.
+func (e *LargeTextEditor) Span(line, col, length int) (string, error) {
+	if line < 1 || line > e.LineCount() {
+		return "", fmt.Errorf("行号越界: %d", line)
+	}
+	lines, err := e.Show(line, line)
+	if err != nil {
+		return "", err
+	}
+	text := lines[0]
+	if offset, ok := runeOffset(text, col); !ok || offset == len(text) {
+		return "", fmt.Errorf("列号越界: %d", col)
+	}
+	start, end, err := lineSpan(text, col, length)
+	if err != nil {
+		return "", err
+	}
+	return text[start:end], nil
+}
+
+// Cursor is always 1:1: large-file mode cannot move the cursor.
+func (e *LargeTextEditor) Cursor() (int, int) {
+	return 1, 1
+}
+
+// SetMark labels line:col with name, replacing any bookmark of that name.
+func (e *LargeTextEditor) SetMark(name string, line, col int) error {
+	if err := checkMarkName(name); err != nil {
+		return err
+	}
+	if err := e.checkPosition(line, col); err != nil {
+		return err
+	}
+	if e.marks == nil {
+		e.marks = map[string]position{}
+	}
+	e.marks[name] = position{line, col}
+	return nil
+}
+
+// Marks lists the bookmarks in document order.
+func (e *LargeTextEditor) Marks() []Bookmark {
+	return sortedMarks(e.marks)
+}
+
+// checkPosition validates line:col, which may sit just past the line end,
+// reading only that line from disk.
+func (e *LargeTextEditor) checkPosition(line, col int) error {
+	count := e.LineCount()
+	if count == 0 {
+		if line == 1 && col == 1 {
+			return nil
+		}
+		return errors.New("空文件只能在1:1位置插入")
+	}
+	if line < 1 || line > count {
+		return fmt.Errorf("行号越界: %d", line)
+	}
+	lines, err := e.Show(line, line)
+	if err != nil {
+		return err
+	}
+	if _, ok := runeOffset(lines[0], col); !ok {
+		return fmt.Errorf("列号越界: %d", col)
+	}
+	return nil
+}
+
+// Find returns every occurrence of pattern, reading the file line by line.
+// A read error ends the search early.
+func (e *LargeTextEditor) Find(pattern string, ignoreCase bool) []Match {
+	needle := foldRunes([]rune(pattern), ignoreCase)
+	if len(needle) == 0 {
+		return nil
+	}
+	var matches []Match
+	_ = e.EachLine(func(n int, line string) bool {
+		matches = appendLineMatches(matches, n, line, needle, ignoreCase)
+		return true
+	})
+	return matches
+}
+
+// EachLine calls fn with each 1-based line number and line until fn returns
+// false.
+func (e *LargeTextEditor) EachLine(fn func(n int, line string) bool) error {
+	if e.LineCount() == 0 {
+		return nil
+	}
+	return e.eachLine(1, e.LineCount(), fn)
+}
+
+func (e *LargeTextEditor) eachLine(start, end int, fn func(n int, line string) bool) error {
+	file, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	from, to := e.offsets.at(start-1), e.offsets.at(end)
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, from, to-from), largeReadChunk)
+	for n := start; n <= end; n++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return fmt.Errorf("文件已在外部被修改, 请重新加载: %s", e.path)
+			}
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if !fn(n, line) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Undo always fails: large-file mode keeps no history.
+func (e *LargeTextEditor) Undo() error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	return errors.New("没有可撤销的操作")
+}
+
+// Redo always fails: large-file mode keeps no history.
+func (e *LargeTextEditor) Redo() error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	return errors.New("没有可重做的操作")
+}
+
+// UndoDescription is always empty.
+func (e *LargeTextEditor) UndoDescription() string {
+	return ""
+}
+
+// RedoDescription is always empty.
+func (e *LargeTextEditor) RedoDescription() string {
+	return ""
+}
+
+// UndoDescriptions is always empty.
+func (e *LargeTextEditor) UndoDescriptions() []string {
+	return nil
+}
+
+// RedoDescriptions is always empty.
+func (e *LargeTextEditor) RedoDescriptions() []string {
+	return nil
+}
+
+// UndoN fails like Undo.
+func (e *LargeTextEditor) UndoN(n int) (int, error) {
+	return repeatSteps(n, 0, e.Undo)
+}
+
+// RedoN fails like Redo.
+func (e *LargeTextEditor) RedoN(n int) (int, error) {
+	return repeatSteps(n, 0, e.Redo)
+}
+
+// UndoDepth is always 0.
+func (e *LargeTextEditor) UndoDepth() int {
+	return 0
+}
+
+// RedoDepth is always 0.
+func (e *LargeTextEditor) RedoDepth() int {
+	return 0
+}
+
+// LastEditNoOp is always false.
+func (e *LargeTextEditor) LastEditNoOp() bool {
+	return false
+}
+
+// LastEdit reports only the line count.
+func (e *LargeTextEditor) LastEdit() EditSummary {
+	return EditSummary{LineCount: e.LineCount()}
+}
+
+// MemoryStats counts the line index, which is all the editor holds.
+func (e *LargeTextEditor) MemoryStats() MemoryStats {
+	return MemoryStats{ContentBytes: 8 * e.offsets.count}
+}
+
+// IsReadOnly reports whether undo and redo are refused; edits always are.
+func (e *LargeTextEditor) IsReadOnly() bool {
+	return e.readOnly
+}
+
+// SetReadOnly toggles the read-only flag kept across promotion.
+func (e *LargeTextEditor) SetReadOnly(value bool) {
+	e.readOnly = value
+}
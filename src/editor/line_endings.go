@@ -0,0 +1,129 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LineEnding is the newline sequence written between lines.
+type LineEnding string
+
+const (
+	LineEndingLF   LineEnding = "lf"
+	LineEndingCRLF LineEnding = "crlf"
+)
+
+// ParseLineEnding reads lf or crlf, ignoring case.
+func ParseLineEnding(name string) (LineEnding, error) {
+	switch LineEnding(strings.ToLower(name)) {
+	case LineEndingLF:
+		return LineEndingLF, nil
+	case LineEndingCRLF:
+		return LineEndingCRLF, nil
+	}
+	return "", fmt.Errorf("不支持的换行符: %s (可选 lf|crlf)", name)
+}
+
+// Sequence returns the characters the ending stands for.
+func (l LineEnding) Sequence() string {
+	if l == LineEndingCRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// LineStyle describes how a file's lines are terminated on disk.
+type LineStyle struct {
+	Ending LineEnding
+	// Mixed records that the file used both endings; Ending is the majority.
+	Mixed bool
+	// TrailingNewline records that the last line ended with a newline.
+	TrailingNewline bool
+}
+
+// DetectLineStyle finds the dominant line ending of text, preferring LF on a
+// tie.
+func DetectLineStyle(text string) LineStyle {
+	crlf := strings.Count(text, "\r\n")
+	lf := strings.Count(text, "\n") - crlf
+	style := LineStyle{Ending: LineEndingLF, Mixed: crlf > 0 && lf > 0, TrailingNewline: strings.HasSuffix(text, "\n")}
+	if crlf > lf {
+		style.Ending = LineEndingCRLF
+	}
+	return style
+}
+
+// Join renders lines as file content in this style.
+func (s LineStyle) Join(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	sep := s.Ending.Sequence()
+	text := strings.Join(lines, sep)
+	if s.TrailingNewline {
+		text += sep
+	}
+	return text
+}
+
+// Name reports the ending, or mixed when the file used both.
+func (s LineStyle) Name() string {
+	if s.Mixed {
+		return "mixed"
+	}
+	if s.Ending == "" {
+		return string(LineEndingLF)
+	}
+	return string(s.Ending)
+}
+
+// LineStyle reports how the file's lines are terminated.
+func (e *TextEditor) LineStyle() LineStyle {
+	style := e.lineStyle
+	if style.Ending == "" {
+		style.Ending = LineEndingLF
+	}
+	return style
+}
+
+// SetLineStyle records the style detected on disk without touching history.
+func (e *TextEditor) SetLineStyle(style LineStyle) {
+	e.lineStyle = style
+}
+
+// ConvertLineEndings switches every line to ending as an undoable edit.
+func (e *TextEditor) ConvertLineEndings(ending LineEnding) error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	before := e.LineStyle()
+	after := before
+	after.Ending, after.Mixed = ending, false
+	e.lastLine = 0
+	e.lastNoOp = before == after
+	if e.lastNoOp {
+		return nil
+	}
+	e.undoStack = append(e.undoStack, &editCommand{
+		description:  "set-line-endings",
+		style:        &styleChange{before: before, after: after},
+		beforeSize:   e.size,
+		afterSize:    e.size,
+		executedAt:   e.clock.Now(),
+		cursorBefore: e.cursor,
+		cursorAfter:  e.cursor,
+	})
+	e.lineStyle = after
+	e.coalesceBroken = true
+	e.discardRedo(e.lines)
+	e.trimUndo()
+	e.recordHistory()
+	e.modified = true
+	return nil
+}
+
+// styleChange is the line style before and after a set-line-endings edit.
+type styleChange struct {
+	before LineStyle
+	after  LineStyle
+}
@@ -0,0 +1,67 @@
+package editor
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextStats summarizes a text document.
+type TextStats struct {
+	Lines int
+	// Words counts runs of letters and digits; each CJK character is a word.
+	Words int
+	// Chars counts runes, excluding line breaks.
+	Chars int
+	Bytes int
+}
+
+// XMLStats summarizes an XML document.
+type XMLStats struct {
+	Elements int
+	// MaxDepth is 1 for a document with only a root element.
+	MaxDepth int
+	// TextLength counts the runes of all element text.
+	TextLength int
+}
+
+// Stats counts lines, words, characters, and bytes.
+func (e *TextEditor) Stats() TextStats {
+	stats := TextStats{Lines: len(e.lines), Bytes: e.size}
+	for _, line := range e.lines {
+		stats.Chars += utf8.RuneCountInString(line)
+		stats.Words += countWords(line)
+	}
+	return stats
+}
+
+func countWords(line string) int {
+	words := 0
+	inWord := false
+	for _, r := range line {
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			// Punctuation neither starts nor ends a word.
+		case isWide(r):
+			words++
+			inWord = false
+		case !inWord:
+			words++
+			inWord = true
+		}
+	}
+	return words
+}
+
+// Stats counts elements, tree depth, and text length.
+func (e *XMLEditor) Stats() XMLStats {
+	var stats XMLStats
+	e.Walk(func(view ElementView) bool {
+		stats.Elements++
+		stats.MaxDepth = max(stats.MaxDepth, view.Depth)
+		stats.TextLength += utf8.RuneCountInString(view.Text)
+		return true
+	})
+	return stats
+}
@@ -0,0 +1,76 @@
+package editor
+
+// lineDelta records an edit as the lines it replaced: from line index start,
+// removed became inserted. Undo splices removed back in; redo splices inserted.
+type lineDelta struct {
+	start    int
+	removed  []string
+	inserted []string
+}
+
+// diffLines returns the delta turning before into after, trimmed to the lines
+// between their common prefix and suffix.
+func diffLines(before, after []string) lineDelta {
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	return lineDelta{
+		start:    prefix,
+		removed:  cloneLines(before[prefix : len(before)-suffix]),
+		inserted: cloneLines(after[prefix : len(after)-suffix]),
+	}
+}
+
+// mergeDelta combines d, which produced mid, with next, which turned mid into
+// after, into one delta from d's original state to after.
+func mergeDelta(d lineDelta, mid, after []string, next lineDelta) lineDelta {
+	lo := min(d.start, next.start)
+	hi := max(d.start+len(d.inserted), next.start+len(next.removed))
+	removed := make([]string, 0, hi-lo-len(d.inserted)+len(d.removed))
+	removed = append(removed, mid[lo:d.start]...)
+	removed = append(removed, d.removed...)
+	removed = append(removed, mid[d.start+len(d.inserted):hi]...)
+	return lineDelta{
+		start:    lo,
+		removed:  removed,
+		inserted: cloneLines(after[lo : hi+len(next.inserted)-len(next.removed)]),
+	}
+}
+
+func (d lineDelta) undo(lines []string) []string {
+	return spliceLines(lines, d.start, len(d.inserted), d.removed)
+}
+
+func (d lineDelta) redo(lines []string) []string {
+	return spliceLines(lines, d.start, len(d.removed), d.inserted)
+}
+
+// sizeBytes estimates the bytes the delta retains.
+func (d lineDelta) sizeBytes() int {
+	return linesSize(d.removed) + linesSize(d.inserted)
+}
+
+// spliceLines replaces cut lines at start with repl, reusing the backing array
+// when it has room.
+func spliceLines(lines []string, start, cut int, repl []string) []string {
+	oldLen := len(lines)
+	newLen := oldLen - cut + len(repl)
+	if newLen > cap(lines) {
+		spliced := make([]string, 0, newLen)
+		spliced = append(spliced, lines[:start]...)
+		spliced = append(spliced, repl...)
+		return append(spliced, lines[start+cut:]...)
+	}
+	tail := lines[start+cut:]
+	lines = lines[:max(oldLen, newLen)]
+	copy(lines[start+len(repl):], tail)
+	copy(lines[start:], repl)
+	clear(lines[newLen:])
+	return lines[:newLen]
+}
@@ -4,27 +4,103 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
+
+	"softwaredesign/src/charset"
 )
 
 // TextEditor manages in-memory text lines with undo/redo support.
 type TextEditor struct {
 	path      string
 	lines     []string
+	size      int
 	modified  bool
+	readOnly  bool
+	encoding  charset.Encoding
+	lineStyle LineStyle
+	lastNoOp  bool
+	cursor    position
 	undoStack []*editCommand
 	redoStack []*editCommand
+
+	preserveRedo bool
+	stashedRedo  []*editCommand
+	// stashBase is the document the stashed branch's next redo applies to.
+	stashBase []string
+	// scratch is reused by execute to hold the pre-edit lines.
+	scratch   []string
+	history   historyMeter
+	undoLimit int
+	// lastLine is the 1-based first line changed by the last edit, 0 if none.
+	lastLine int
+	marks    map[string]position
+
+	coalesce       bool
+	coalesceWindow time.Duration
+	coalesceLimit  int
+	coalesceBroken bool
+	clock          Clock
+}
+
+// Clock abstracts time retrieval for testing.
+type Clock interface {
+	Now() time.Time
 }
 
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+const (
+	defaultCoalesceWindow = 2 * time.Second
+	defaultCoalesceLimit  = 100
+)
+
 // NewTextEditor constructs an editor for the provided path.
 func NewTextEditor(path string, lines []string, modified bool) *TextEditor {
 	copied := cloneLines(lines)
 	return &TextEditor{
 		path:     path,
 		lines:    copied,
+		size:     linesSize(copied),
 		modified: modified,
+		cursor:   position{1, 1},
+
+		coalesceWindow: defaultCoalesceWindow,
+		coalesceLimit:  defaultCoalesceLimit,
+		clock:          realClock{},
+	}
+}
+
+// SetCoalescing toggles merging of consecutive identical commands into one undo entry.
+func (e *TextEditor) SetCoalescing(enabled bool) {
+	e.coalesce = enabled
+	e.coalesceBroken = true
+}
+
+// ConfigureCoalescing sets the merge window and the maximum lines a merged entry may cover.
+func (e *TextEditor) ConfigureCoalescing(window time.Duration, maxLines int) {
+	e.coalesceWindow = window
+	e.coalesceLimit = maxLines
+}
+
+// BreakCoalescing ends the current merge run, typically after a read command.
+func (e *TextEditor) BreakCoalescing() {
+	e.coalesceBroken = true
+}
+
+// WithClock swaps the clock used for coalescing windows.
+func (e *TextEditor) WithClock(clock Clock) {
+	if clock == nil {
+		e.clock = realClock{}
+		return
 	}
+	e.clock = clock
 }
 
 // Path returns the backing file path.
@@ -32,6 +108,11 @@ func (e *TextEditor) Path() string {
 	return e.path
 }
 
+// Rename rebinds the editor to another backing file.
+func (e *TextEditor) Rename(path string) {
+	e.path = path
+}
+
 // Name returns the file name for display.
 func (e *TextEditor) Name() string {
 	return filepath.Base(e.path)
@@ -47,9 +128,21 @@ func (e *TextEditor) Lines() []string {
 	return cloneLines(e.lines)
 }
 
+// LineCount returns the number of lines without copying them.
+func (e *TextEditor) LineCount() int {
+	return len(e.lines)
+}
+
 // SetLines replaces editor content.
 func (e *TextEditor) SetLines(lines []string) {
 	e.lines = cloneLines(lines)
+	e.size = linesSize(e.lines)
+	e.clampCursor()
+}
+
+// Size reports the byte size of the serialized content.
+func (e *TextEditor) Size() int {
+	return e.size
 }
 
 // IsModified reports whether editor has unsaved changes.
@@ -66,8 +159,14 @@ func (e *TextEditor) SetModified(value bool) {
 func (e *TextEditor) Append(text string) error {
 	return e.execute("append", func() error {
 		for _, line := range splitWithKeep(text) {
+			if len(e.lines) > 0 {
+				e.size++
+			}
 			e.lines = append(e.lines, line)
+			e.size += len(line)
 		}
+		last := len(e.lines)
+		e.cursor = position{last, utf8.RuneCountInString(e.lines[last-1]) + 1}
 		return nil
 	})
 }
@@ -75,14 +174,22 @@ func (e *TextEditor) Append(text string) error {
 // Insert adds text at the specified 1-based line and column.
 func (e *TextEditor) Insert(line, col int, text string) error {
 	return e.execute("insert", func() error {
-		return e.insertSpan(line, col, text)
+		if err := e.insertSpan(line, col, text); err != nil {
+			return err
+		}
+		e.cursor = endOfInsert(line, col, text)
+		return nil
 	})
 }
 
 // Delete removes len characters starting at line:col.
 func (e *TextEditor) Delete(line, col, length int) error {
 	return e.execute("delete", func() error {
-		return e.deleteSpan(line, col, length)
+		if err := e.deleteSpan(line, col, length); err != nil {
+			return err
+		}
+		e.cursor = position{line, col}
+		return nil
 	})
 }
 
@@ -92,10 +199,310 @@ func (e *TextEditor) Replace(line, col, length int, text string) error {
 		if err := e.deleteSpan(line, col, length); err != nil {
 			return err
 		}
-		return e.insertSpan(line, col, text)
+		if err := e.insertSpan(line, col, text); err != nil {
+			return err
+		}
+		e.cursor = endOfInsert(line, col, text)
+		return nil
+	})
+}
+
+// DeleteLines removes lines start..end (1-based, inclusive) as one undoable edit.
+func (e *TextEditor) DeleteLines(start, end int) error {
+	if start < 1 || end < start || end > len(e.lines) {
+		return fmt.Errorf("行范围越界: %d:%d", start, end)
+	}
+	return e.execute("delete-lines", func() error {
+		remaining := make([]string, 0, len(e.lines)-(end-start+1))
+		remaining = append(remaining, e.lines[:start-1]...)
+		remaining = append(remaining, e.lines[end:]...)
+		e.lines = remaining
+		e.size = linesSize(e.lines)
+		e.cursor = position{start, 1}
+		return nil
+	})
+}
+
+// InsertLines inserts lines before line n as one undoable edit; n equal to
+// the line count + 1 appends. Entries containing newlines split like Append.
+func (e *TextEditor) InsertLines(n int, lines []string) error {
+	if n < 1 || n > len(e.lines)+1 {
+		return fmt.Errorf("行号越界: %d", n)
+	}
+	var inserted []string
+	for _, line := range lines {
+		inserted = append(inserted, splitWithKeep(line)...)
+	}
+	if len(inserted) == 0 {
+		return errors.New("没有要插入的行")
+	}
+	return e.execute("insert-lines", func() error {
+		composed := make([]string, 0, len(e.lines)+len(inserted))
+		composed = append(composed, e.lines[:n-1]...)
+		composed = append(composed, inserted...)
+		composed = append(composed, e.lines[n-1:]...)
+		e.lines = composed
+		e.size = linesSize(e.lines)
+		last := n + len(inserted) - 1
+		e.cursor = position{last, utf8.RuneCountInString(e.lines[last-1]) + 1}
+		return nil
+	})
+}
+
+// MoveLine moves line from so that it ends up at line to (both 1-based).
+func (e *TextEditor) MoveLine(from, to int) error {
+	if from < 1 || from > len(e.lines) {
+		return fmt.Errorf("行号越界: %d", from)
+	}
+	if to < 1 || to > len(e.lines) {
+		return fmt.Errorf("行号越界: %d", to)
+	}
+	return e.execute("move-line", func() error {
+		line := e.lines[from-1]
+		rest := append(append([]string{}, e.lines[:from-1]...), e.lines[from:]...)
+		moved := make([]string, 0, len(e.lines))
+		moved = append(moved, rest[:to-1]...)
+		moved = append(moved, line)
+		moved = append(moved, rest[to-1:]...)
+		e.lines = moved
+		e.cursor = position{to, 1}
+		return nil
+	})
+}
+
+// SwapLines exchanges lines a and b (both 1-based).
+func (e *TextEditor) SwapLines(a, b int) error {
+	for _, n := range []int{a, b} {
+		if n < 1 || n > len(e.lines) {
+			return fmt.Errorf("行号越界: %d", n)
+		}
+	}
+	return e.execute("swap-lines", func() error {
+		e.lines[a-1], e.lines[b-1] = e.lines[b-1], e.lines[a-1]
+		e.cursor = position{b, 1}
+		return nil
+	})
+}
+
+// maxDuplicatedLines caps how many lines one DuplicateLines call may add.
+const maxDuplicatedLines = 1 << 20
+
+// DuplicateLines inserts times copies of lines start..end (1-based,
+// inclusive) directly below the block as one undoable edit.
+func (e *TextEditor) DuplicateLines(start, end, times int) error {
+	if times < 1 {
+		return fmt.Errorf("重复次数无效: %d", times)
+	}
+	if start < 1 || end < start || end > len(e.lines) {
+		return fmt.Errorf("行范围越界: %d:%d", start, end)
+	}
+	if times > maxDuplicatedLines/(end-start+1) {
+		return fmt.Errorf("重复次数过大: %d (最多新增 %d 行)", times, maxDuplicatedLines)
+	}
+	return e.execute("dup-lines", func() error {
+		block := e.lines[start-1 : end]
+		composed := make([]string, 0, len(e.lines)+len(block)*times)
+		composed = append(composed, e.lines[:end]...)
+		for i := 0; i < times; i++ {
+			composed = append(composed, block...)
+		}
+		composed = append(composed, e.lines[end:]...)
+		e.lines = composed
+		e.size = linesSize(e.lines)
+		e.cursor = position{end + 1, 1}
+		return nil
+	})
+}
+
+// JoinLines merges lines start..end (1-based, inclusive) into one, separated
+// by sep, as one undoable edit.
+func (e *TextEditor) JoinLines(start, end int, sep string) error {
+	if start < 1 || end < start || end > len(e.lines) {
+		return fmt.Errorf("行范围越界: %d:%d", start, end)
+	}
+	if start == end {
+		return errors.New("至少需要两行才能合并")
+	}
+	return e.execute("join-lines", func() error {
+		joined := strings.Join(e.lines[start-1:end], sep)
+		composed := make([]string, 0, len(e.lines)-(end-start))
+		composed = append(composed, e.lines[:start-1]...)
+		composed = append(composed, joined)
+		composed = append(composed, e.lines[end:]...)
+		e.cursor = position{start, utf8.RuneCountInString(e.lines[start-1]) + 1}
+		e.lines = composed
+		e.size = linesSize(e.lines)
+		return nil
+	})
+}
+
+// SplitLine breaks line at the rune column col; the text from col onwards
+// becomes the next line.
+func (e *TextEditor) SplitLine(line, col int) error {
+	if line < 1 || line > len(e.lines) {
+		return fmt.Errorf("行号越界: %d", line)
+	}
+	return e.execute("split-line", func() error {
+		head, tail, err := splitLineAtColumn(e.lines[line-1], col)
+		if err != nil {
+			return err
+		}
+		composed := make([]string, 0, len(e.lines)+1)
+		composed = append(composed, e.lines[:line-1]...)
+		composed = append(composed, head, tail)
+		composed = append(composed, e.lines[line:]...)
+		e.lines = composed
+		e.size = linesSize(e.lines)
+		e.cursor = position{line + 1, 1}
+		return nil
+	})
+}
+
+// ReplaceAll replaces every occurrence of old as a single undoable edit and
+// returns the number of replacements. Newlines in new split lines like Insert.
+func (e *TextEditor) ReplaceAll(old, new string) (int, error) {
+	if old == "" {
+		return 0, errors.New("查找内容不能为空")
+	}
+	count := 0
+	err := e.execute("replace-all", func() error {
+		text := strings.Join(e.lines, "\n")
+		count = strings.Count(text, old)
+		if count == 0 {
+			return nil
+		}
+		e.lines = splitWithKeep(strings.ReplaceAll(text, old, new))
+		e.size = linesSize(e.lines)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ApplyMerge replaces the content with merged lines as a single undoable
+// "merge" edit.
+func (e *TextEditor) ApplyMerge(lines []string) error {
+	return e.execute("merge", func() error {
+		e.lines = cloneLines(lines)
+		e.size = linesSize(e.lines)
+		return nil
+	})
+}
+
+// Cursor reports the 1-based cursor position.
+func (e *TextEditor) Cursor() (int, int) {
+	return e.cursor.line, e.cursor.col
+}
+
+// MoveCursor places the cursor at line:col, which may sit just past the line end.
+func (e *TextEditor) MoveCursor(line, col int) error {
+	if err := e.ensureLinePosition(line, col, true); err != nil {
+		return err
+	}
+	e.cursor = position{line, col}
+	return nil
+}
+
+// Find returns every non-overlapping occurrence of pattern with rune-based columns.
+func (e *TextEditor) Find(pattern string, ignoreCase bool) []Match {
+	needle := foldRunes([]rune(pattern), ignoreCase)
+	if len(needle) == 0 {
+		return nil
+	}
+	var matches []Match
+	for i, line := range e.lines {
+		matches = appendLineMatches(matches, i+1, line, needle, ignoreCase)
+	}
+	return matches
+}
+
+// appendLineMatches adds the non-overlapping occurrences of the folded
+// needle in line n.
+func appendLineMatches(matches []Match, n int, line string, needle []rune, ignoreCase bool) []Match {
+	hay := foldRunes([]rune(line), ignoreCase)
+	for col := 0; col+len(needle) <= len(hay); {
+		if runesEqual(hay[col:col+len(needle)], needle) {
+			matched := string([]rune(line)[col : col+len(needle)])
+			matches = append(matches, Match{Line: n, Col: col + 1, Text: line, Matched: matched})
+			col += len(needle)
+			continue
+		}
+		col++
+	}
+	return matches
+}
+
+// FindRegex returns every match of a Go regular expression, line by line.
+func (e *TextEditor) FindRegex(pattern string) ([]Match, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("正则表达式无效: %v", err)
+	}
+	var matches []Match
+	for i, line := range e.lines {
+		for _, loc := range re.FindAllStringIndex(line, -1) {
+			matches = append(matches, Match{
+				Line:    i + 1,
+				Col:     utf8.RuneCountInString(line[:loc[0]]) + 1,
+				Text:    line,
+				Matched: line[loc[0]:loc[1]],
+			})
+		}
+	}
+	return matches, nil
+}
+
+func foldRunes(runes []rune, ignoreCase bool) []rune {
+	if ignoreCase {
+		for i, r := range runes {
+			runes[i] = unicode.ToLower(r)
+		}
+	}
+	return runes
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ReplaceWordAt swaps the word at line:col after verifying it still equals oldWord.
+func (e *TextEditor) ReplaceWordAt(line, col int, oldWord, newWord string) error {
+	return e.execute("replace-word", func() error {
+		if err := e.ensureLinePosition(line, col, false); err != nil {
+			return err
+		}
+		runes := []rune(e.lines[line-1])
+		found := wordAt(runes, col-1)
+		if found != oldWord {
+			return &WordMismatchError{Expected: oldWord, Found: found}
+		}
+		if err := e.deleteSpan(line, col, utf8.RuneCountInString(oldWord)); err != nil {
+			return err
+		}
+		if err := e.insertSpan(line, col, newWord); err != nil {
+			return err
+		}
+		e.cursor = endOfInsert(line, col, newWord)
+		return nil
 	})
 }
 
+// Span returns length characters starting at line:col, within one line.
+func (e *TextEditor) Span(line, col, length int) (string, error) {
+	start, end, err := e.checkSpan(line, col, length)
+	if err != nil {
+		return "", err
+	}
+	return e.lines[line-1][start:end], nil
+}
+
 // Show returns lines within the inclusive range (1-based).
 func (e *TextEditor) Show(start, end int) ([]string, error) {
 	if len(e.lines) == 0 {
@@ -117,49 +524,312 @@ func (e *TextEditor) Show(start, end int) ([]string, error) {
 	return view, nil
 }
 
+// UndoDescription names the command the next undo would revert.
+func (e *TextEditor) UndoDescription() string {
+	if len(e.undoStack) == 0 {
+		return ""
+	}
+	return e.undoStack[len(e.undoStack)-1].description
+}
+
+// RedoDescription names the command the next redo would reapply.
+func (e *TextEditor) RedoDescription() string {
+	if len(e.redoStack) == 0 {
+		return ""
+	}
+	return e.redoStack[len(e.redoStack)-1].description
+}
+
+// UndoDescriptions lists the undo stack, next undo first.
+func (e *TextEditor) UndoDescriptions() []string {
+	descs := make([]string, 0, len(e.undoStack))
+	for i := len(e.undoStack) - 1; i >= 0; i-- {
+		descs = append(descs, e.undoStack[i].description)
+	}
+	return descs
+}
+
+// UndoN reverts up to n commands and returns how many were reverted.
+func (e *TextEditor) UndoN(n int) (int, error) {
+	return repeatSteps(n, len(e.undoStack), e.Undo)
+}
+
+// RedoN reapplies up to n commands and returns how many were reapplied.
+func (e *TextEditor) RedoN(n int) (int, error) {
+	return repeatSteps(n, len(e.redoStack), e.Redo)
+}
+
+// RedoDescriptions lists the redo stack, next redo first.
+func (e *TextEditor) RedoDescriptions() []string {
+	descs := make([]string, 0, len(e.redoStack))
+	for i := len(e.redoStack) - 1; i >= 0; i-- {
+		descs = append(descs, e.redoStack[i].description)
+	}
+	return descs
+}
+
+// SetPreserveRedo toggles stashing of the redo branch a new edit would discard.
+func (e *TextEditor) SetPreserveRedo(enabled bool) {
+	e.preserveRedo = enabled
+	if !enabled {
+		e.stashedRedo = nil
+		e.stashBase = nil
+		e.recordHistory()
+	}
+}
+
+// StashedRedoDepth reports how many operations the stashed redo branch holds.
+func (e *TextEditor) StashedRedoDepth() int {
+	return len(e.stashedRedo)
+}
+
+// RedoStashed reapplies the first operation of the stashed redo branch as a new
+// undoable edit and restores the rest of the branch as the redo stack.
+func (e *TextEditor) RedoStashed() error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	if len(e.stashedRedo) == 0 {
+		return errors.New("没有暂存的重做分支")
+	}
+	branch, base := e.stashedRedo, e.stashBase
+	e.stashedRedo, e.stashBase = nil, nil
+	next := branch[len(branch)-1]
+	before := e.lines
+	target := next.delta.redo(cloneLines(base))
+	delta := diffLines(before, target)
+	cmd := &editCommand{description: next.description, delta: delta, beforeSize: e.size, afterSize: next.afterSize, executedAt: e.clock.Now(), mergedLines: touchedLines(before, target), cursorBefore: e.cursor, cursorAfter: next.cursorAfter}
+	if next.style != nil {
+		cmd.style = &styleChange{before: e.LineStyle(), after: next.style.after}
+		e.lineStyle = next.style.after
+	}
+	e.undoStack = append(e.undoStack, cmd)
+	e.lines = target
+	e.shiftMarks(delta)
+	e.size = next.afterSize
+	e.cursor = next.cursorAfter
+	e.clampCursor()
+	e.discardRedo(before)
+	e.redoStack = branch[:len(branch)-1]
+	e.trimUndo()
+	e.recordHistory()
+	e.coalesceBroken = true
+	e.lastNoOp = false
+	e.lastLine = 0
+	e.modified = true
+	return nil
+}
+
+// discardRedo drops the redo stack, stashing it when redo preservation is on;
+// base is the document the stack's next redo applies to.
+func (e *TextEditor) discardRedo(base []string) {
+	if e.preserveRedo && len(e.redoStack) > 0 {
+		e.stashedRedo = e.redoStack
+		e.stashBase = cloneLines(base)
+	}
+	e.redoStack = nil
+}
+
+// IsReadOnly reports whether edits are refused.
+func (e *TextEditor) IsReadOnly() bool {
+	return e.readOnly
+}
+
+// SetReadOnly toggles refusal of edits, undo, and redo.
+func (e *TextEditor) SetReadOnly(value bool) {
+	e.readOnly = value
+}
+
+// Encoding reports the encoding the file is read and saved in.
+func (e *TextEditor) Encoding() charset.Encoding {
+	if e.encoding == "" {
+		return charset.UTF8
+	}
+	return e.encoding
+}
+
+// SetEncoding changes the encoding used for the next save.
+func (e *TextEditor) SetEncoding(enc charset.Encoding) {
+	e.encoding = enc
+}
+
 // Undo reverts the last command.
 func (e *TextEditor) Undo() error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
 	if len(e.undoStack) == 0 {
 		return errors.New("没有可撤销的操作")
 	}
 	last := e.undoStack[len(e.undoStack)-1]
 	e.undoStack = e.undoStack[:len(e.undoStack)-1]
+	e.coalesceBroken = true
+	e.lastNoOp = false
+	e.lastLine = 0
 	if err := last.undo(e); err != nil {
 		return err
 	}
 	e.redoStack = append(e.redoStack, last)
+	e.recordHistory()
 	e.modified = true
 	return nil
 }
 
+// UndoDepth reports how many commands can be undone.
+func (e *TextEditor) UndoDepth() int {
+	return len(e.undoStack)
+}
+
+// RedoDepth reports how many commands can be redone.
+func (e *TextEditor) RedoDepth() int {
+	return len(e.redoStack)
+}
+
+// LastEditNoOp reports whether the most recent edit left the document unchanged.
+func (e *TextEditor) LastEditNoOp() bool {
+	return e.lastNoOp
+}
+
+// MemoryStats estimates the content and history held by the editor.
+func (e *TextEditor) MemoryStats() MemoryStats {
+	stats := MemoryStats{ContentBytes: e.size, UndoEntries: len(e.undoStack)}
+	e.history.fill(&stats)
+	return stats
+}
+
 // Redo reapplies the last undone command.
 func (e *TextEditor) Redo() error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
 	if len(e.redoStack) == 0 {
 		return errors.New("没有可重做的操作")
 	}
 	last := e.redoStack[len(e.redoStack)-1]
 	e.redoStack = e.redoStack[:len(e.redoStack)-1]
+	e.coalesceBroken = true
+	e.lastNoOp = false
+	e.lastLine = 0
 	if err := last.redo(e); err != nil {
 		return err
 	}
 	e.undoStack = append(e.undoStack, last)
+	e.trimUndo()
+	e.recordHistory()
 	e.modified = true
 	return nil
 }
 
 func (e *TextEditor) execute(desc string, mutate func() error) error {
-	before := cloneLines(e.lines)
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	// Only the changed lines are kept, so the pre-edit copy goes into a
+	// reusable buffer rather than the undo stack.
+	e.scratch = append(e.scratch[:0], e.lines...)
+	before := e.scratch
+	beforeSize := e.size
+	beforeCursor := e.cursor
 	if err := mutate(); err != nil {
+		e.lines = cloneLines(before)
+		e.size = beforeSize
+		e.cursor = beforeCursor
 		return err
 	}
-	after := cloneLines(e.lines)
-	cmd := &editCommand{description: desc, before: before, after: after}
-	e.undoStack = append(e.undoStack, cmd)
-	e.redoStack = nil
+	e.clampCursor()
+	e.lastNoOp = slices.Equal(before, e.lines)
+	e.lastLine = 0
+	if e.lastNoOp {
+		return nil
+	}
+	delta := diffLines(before, e.lines)
+	e.lastLine = delta.start + 1
+	e.shiftMarks(delta)
+	now := e.clock.Now()
+	touched := touchedLines(before, e.lines)
+	if top := e.mergeTarget(desc, now, touched); top != nil {
+		top.delta = mergeDelta(top.delta, before, e.lines, delta)
+		top.afterSize = e.size
+		top.cursorAfter = e.cursor
+		top.executedAt = now
+		top.mergedLines += touched
+	} else {
+		cmd := &editCommand{description: desc, delta: delta, beforeSize: beforeSize, afterSize: e.size, executedAt: now, mergedLines: touched, cursorBefore: beforeCursor, cursorAfter: e.cursor}
+		e.undoStack = append(e.undoStack, cmd)
+	}
+	e.coalesceBroken = false
+	e.discardRedo(before)
+	e.trimUndo()
+	e.recordHistory()
 	e.modified = true
 	return nil
 }
 
+func (e *TextEditor) mergeTarget(desc string, now time.Time, touched int) *editCommand {
+	if !e.coalesce || e.coalesceBroken || len(e.undoStack) == 0 {
+		return nil
+	}
+	top := e.undoStack[len(e.undoStack)-1]
+	if top.description != desc {
+		return nil
+	}
+	if e.coalesceWindow > 0 && now.Sub(top.executedAt) > e.coalesceWindow {
+		return nil
+	}
+	if e.coalesceLimit > 0 && top.mergedLines+touched > e.coalesceLimit {
+		return nil
+	}
+	return top
+}
+
+// position is a 1-based line and rune column.
+type position struct {
+	line int
+	col  int
+}
+
+func endOfInsert(line, col int, text string) position {
+	inserted := splitWithKeep(text)
+	last := utf8.RuneCountInString(inserted[len(inserted)-1])
+	if len(inserted) == 1 {
+		return position{line, col + last}
+	}
+	return position{line + len(inserted) - 1, last + 1}
+}
+
+// clampCursor keeps the cursor within the current content.
+func (e *TextEditor) clampCursor() {
+	if len(e.lines) == 0 {
+		e.cursor = position{1, 1}
+		return
+	}
+	if e.cursor.line < 1 {
+		e.cursor.line = 1
+	}
+	if e.cursor.line > len(e.lines) {
+		e.cursor.line = len(e.lines)
+	}
+	maxCol := utf8.RuneCountInString(e.lines[e.cursor.line-1]) + 1
+	if e.cursor.col < 1 {
+		e.cursor.col = 1
+	}
+	if e.cursor.col > maxCol {
+		e.cursor.col = maxCol
+	}
+}
+
+// touchedLines approximates how many lines a command affected.
+func touchedLines(before, after []string) int {
+	delta := len(after) - len(before)
+	if delta < 0 {
+		delta = -delta
+	}
+	if delta == 0 {
+		return 1
+	}
+	return delta
+}
+
 func (e *TextEditor) ensureLinePosition(line, col int, allowEOF bool) error {
 	if len(e.lines) == 0 {
 		if allowEOF && line == 1 && col == 1 {
@@ -170,33 +840,91 @@ func (e *TextEditor) ensureLinePosition(line, col int, allowEOF bool) error {
 	if line < 1 || line > len(e.lines) {
 		return fmt.Errorf("行号越界: %d", line)
 	}
-	lineLen := utf8.RuneCountInString(e.lines[line-1])
-	maxCol := lineLen + 1
-	if !allowEOF {
-		maxCol = lineLen
-	}
-	if col < 1 || col > maxCol {
+	text := e.lines[line-1]
+	offset, ok := runeOffset(text, col)
+	if !ok || !allowEOF && offset == len(text) {
 		return fmt.Errorf("列号越界: %d", col)
 	}
 	return nil
 }
 
+// runeOffset returns the byte offset of the 1-based rune column col in s,
+// scanning only up to that column; col may be one past the last rune.
+func runeOffset(s string, col int) (int, bool) {
+	if col < 1 {
+		return 0, false
+	}
+	offset := 0
+	for i := 1; i < col; i++ {
+		if offset >= len(s) {
+			return 0, false
+		}
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+	}
+	return offset, true
+}
+
 type editCommand struct {
-	description string
-	before      []string
-	after       []string
+	description  string
+	delta        lineDelta
+	beforeSize   int
+	afterSize    int
+	executedAt   time.Time
+	mergedLines  int
+	cursorBefore position
+	cursorAfter  position
+	// style is set for commands that change line endings.
+	style *styleChange
 }
 
 func (c *editCommand) undo(e *TextEditor) error {
-	e.lines = cloneLines(c.before)
+	if c.style != nil {
+		e.lineStyle = c.style.before
+	}
+	e.lines = c.delta.undo(e.lines)
+	e.shiftMarks(c.delta.inverse())
+	e.size = c.beforeSize
+	e.cursor = c.cursorBefore
+	e.clampCursor()
 	return nil
 }
 
 func (c *editCommand) redo(e *TextEditor) error {
-	e.lines = cloneLines(c.after)
+	if c.style != nil {
+		e.lineStyle = c.style.after
+	}
+	e.lines = c.delta.redo(e.lines)
+	e.shiftMarks(c.delta)
+	e.size = c.afterSize
+	e.cursor = c.cursorAfter
+	e.clampCursor()
 	return nil
 }
 
+func linesSize(lines []string) int {
+	if len(lines) == 0 {
+		return 0
+	}
+	size := len(lines) - 1
+	for _, line := range lines {
+		size += len(line)
+	}
+	return size
+}
+
+// wordAt returns the letter run starting at idx, or "" when idx is inside a word.
+func wordAt(runes []rune, idx int) string {
+	if idx < 0 || idx >= len(runes) || (idx > 0 && unicode.IsLetter(runes[idx-1])) {
+		return ""
+	}
+	end := idx
+	for end < len(runes) && unicode.IsLetter(runes[end]) {
+		end++
+	}
+	return string(runes[idx:end])
+}
+
 func cloneLines(src []string) []string {
 	dst := make([]string, len(src))
 	copy(dst, src)
@@ -218,11 +946,11 @@ func splitWithKeep(text string) []string {
 }
 
 func splitLineAtColumn(line string, col int) (string, string, error) {
-	runes := []rune(line)
-	if col < 1 || col > len(runes)+1 {
+	offset, ok := runeOffset(line, col)
+	if !ok {
 		return "", "", fmt.Errorf("列号越界: %d", col)
 	}
-	return string(runes[:col-1]), string(runes[col-1:]), nil
+	return line[:offset], line[offset:], nil
 }
 
 func (e *TextEditor) insertSpan(line, col int, text string) error {
@@ -238,6 +966,7 @@ func (e *TextEditor) insertSpan(line, col int, text string) error {
 		return err
 	}
 	newLines := splitWithKeep(text)
+	e.size += len(strings.Join(newLines, "\n"))
 	if len(newLines) == 1 {
 		e.lines[lineIdx] = left + newLines[0] + right
 		return nil
@@ -254,19 +983,36 @@ func (e *TextEditor) insertSpan(line, col int, text string) error {
 	return nil
 }
 
-func (e *TextEditor) deleteSpan(line, col, length int) error {
+// checkSpan validates a span of length runes starting at line:col that must
+// not cross the end of the line, and returns its byte offsets.
+func (e *TextEditor) checkSpan(line, col, length int) (int, int, error) {
 	if err := e.ensureLinePosition(line, col, false); err != nil {
-		return err
+		return 0, 0, err
 	}
+	return lineSpan(e.lines[line-1], col, length)
+}
+
+// lineSpan returns the byte offsets of length runes starting at the valid
+// rune column col of text.
+func lineSpan(text string, col, length int) (int, int, error) {
 	if length < 1 {
-		return errors.New("删除长度必须大于0")
+		return 0, 0, errors.New("长度必须大于0")
 	}
-	lineIdx := line - 1
-	runes := []rune(e.lines[lineIdx])
-	if col-1+length > len(runes) {
-		return errors.New("删除长度超出行尾")
+	start, _ := runeOffset(text, col)
+	span, ok := runeOffset(text[start:], length+1)
+	if !ok {
+		return 0, 0, errors.New("长度超出行尾")
+	}
+	return start, start + span, nil
+}
+
+func (e *TextEditor) deleteSpan(line, col, length int) error {
+	start, end, err := e.checkSpan(line, col, length)
+	if err != nil {
+		return err
 	}
-	newLine := string(runes[:col-1]) + string(runes[col-1+length:])
-	e.lines[lineIdx] = newLine
+	text := e.lines[line-1]
+	e.lines[line-1] = text[:start] + text[end:]
+	e.size -= end - start
 	return nil
 }
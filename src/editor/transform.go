@@ -0,0 +1,69 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var errTransformNewline = errors.New("变换结果不能包含换行")
+
+// TransformSpan replaces the span of length runes at line:col with fn applied
+// to it, as one undoable edit. The span is validated like Delete.
+func (e *TextEditor) TransformSpan(line, col, length int, fn func(string) string) error {
+	start, end, err := e.checkSpan(line, col, length)
+	if err != nil {
+		return err
+	}
+	return e.execute("transform", func() error {
+		text := e.lines[line-1]
+		span := fn(text[start:end])
+		if strings.Contains(span, "\n") {
+			return errTransformNewline
+		}
+		e.lines[line-1] = text[:start] + span + text[end:]
+		e.size = linesSize(e.lines)
+		e.cursor = position{line, col}
+		return nil
+	})
+}
+
+// TransformLines applies fn to each of lines start..end (1-based, inclusive)
+// as one undoable edit.
+func (e *TextEditor) TransformLines(start, end int, fn func(string) string) error {
+	if start < 1 || end < start || end > len(e.lines) {
+		return fmt.Errorf("行范围越界: %d:%d", start, end)
+	}
+	return e.execute("transform", func() error {
+		for i := start - 1; i < end; i++ {
+			line := fn(e.lines[i])
+			if strings.Contains(line, "\n") {
+				return errTransformNewline
+			}
+			e.lines[i] = line
+		}
+		e.size = linesSize(e.lines)
+		e.cursor = position{start, 1}
+		return nil
+	})
+}
+
+// TitleCase upper-cases the first letter of every word and lower-cases the rest.
+func TitleCase(text string) string {
+	var b strings.Builder
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) && !inWord:
+			b.WriteRune(unicode.ToTitle(r))
+			inWord = true
+		case unicode.IsLetter(r):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+			inWord = unicode.IsDigit(r) || r == '\''
+		}
+	}
+	return b.String()
+}
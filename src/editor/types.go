@@ -1,5 +1,12 @@
 package editor
 
+import (
+	"errors"
+	"fmt"
+
+	"softwaredesign/src/charset"
+)
+
 // Type enumerates supported editor kinds.
 type Type string
 
@@ -13,13 +20,53 @@ const (
 // Editor exposes the common behaviour shared by all editors.
 type Editor interface {
 	Path() string
+	// Rename rebinds the editor to another backing file path.
+	Rename(path string)
 	Name() string
 	Type() Type
 	IsModified() bool
 	SetModified(bool)
 	Content() (string, error)
+	Size() int
 	Undo() error
 	Redo() error
+	UndoDescription() string
+	RedoDescription() string
+	// UndoDescriptions lists the undo stack, next undo first.
+	UndoDescriptions() []string
+	// RedoDescriptions lists the redo stack, next redo first.
+	RedoDescriptions() []string
+	// UndoN reverts up to n commands and reports how many were reverted.
+	UndoN(n int) (int, error)
+	// RedoN reapplies up to n commands and reports how many were reapplied.
+	RedoN(n int) (int, error)
+	// UndoDepth counts the entries on the undo stack.
+	UndoDepth() int
+	// RedoDepth counts the entries on the redo stack.
+	RedoDepth() int
+	// LastEditNoOp reports whether the most recent edit left the document unchanged.
+	LastEditNoOp() bool
+	// LastEdit describes where the most recent edit landed.
+	LastEdit() EditSummary
+	// MemoryStats estimates what the editor holds in memory.
+	MemoryStats() MemoryStats
+	// IsReadOnly reports whether edits, undo, and redo are refused.
+	IsReadOnly() bool
+	SetReadOnly(value bool)
+}
+
+// MemoryStats is a deterministic estimate of an editor's memory footprint.
+type MemoryStats struct {
+	// ContentBytes is the size of the document content.
+	ContentBytes int
+	// UndoEntries counts undo stack entries.
+	UndoEntries int
+	// HistoryBytes estimates what undo, redo, and stashed redo entries retain.
+	HistoryBytes int
+	// PeakUndoDepth is the deepest the undo stack has been this session.
+	PeakUndoDepth int
+	// PeakHistoryBytes is the largest HistoryBytes seen this session.
+	PeakHistoryBytes int
 }
 
 // TextDocument offers plain text editing commands.
@@ -32,8 +79,106 @@ type TextDocument interface {
 	Delete(line, col, length int) error
 	Replace(line, col, length int, text string) error
 	Show(start, end int) ([]string, error)
+	Span(line, col, length int) (string, error)
+	ReplaceWordAt(line, col int, oldWord, newWord string) error
+	Find(pattern string, ignoreCase bool) []Match
+	FindRegex(pattern string) ([]Match, error)
+	ReplaceAll(old, new string) (int, error)
+	ApplyMerge(lines []string) error
+	Wrap(start, end, width int) error
+	DeleteLines(start, end int) error
+	InsertLines(n int, lines []string) error
+	MoveLine(from, to int) error
+	SwapLines(a, b int) error
+	DuplicateLines(start, end, times int) error
+	JoinLines(start, end int, sep string) error
+	SplitLine(line, col int) error
+	Stats() TextStats
+	LineCount() int
+	TransformSpan(line, col, length int, fn func(string) string) error
+	TransformLines(start, end int, fn func(string) string) error
+	SortLines(start, end int, opts SortOptions) error
+	ExpandTabs(width int) (int, error)
+	CompressSpaces(width int) (int, error)
+	Cursor() (line, col int)
+	MoveCursor(line, col int) error
+	SetMark(name string, line, col int) error
+	GotoMark(name string) (Bookmark, error)
+	Marks() []Bookmark
+}
+
+// LineReader reads a text document's lines. Both TextDocument and the
+// lazily loaded LargeTextEditor provide it.
+type LineReader interface {
+	Editor
+	LineCount() int
+	Show(start, end int) ([]string, error)
+	Find(pattern string, ignoreCase bool) []Match
 }
 
+// Bookmarker keeps named bookmarks in a text document without editing it.
+// Both TextDocument and the lazily loaded LargeTextEditor provide it.
+type Bookmarker interface {
+	LineReader
+	Cursor() (line, col int)
+	SetMark(name string, line, col int) error
+	Marks() []Bookmark
+}
+
+// SpanReader copies text out of a document without editing it. Both
+// TextDocument and the lazily loaded LargeTextEditor provide it.
+type SpanReader interface {
+	LineReader
+	Cursor() (line, col int)
+	Span(line, col, length int) (string, error)
+}
+
+// Match locates a search hit by 1-based line and rune column.
+type Match struct {
+	Line    int
+	Col     int
+	Text    string
+	Matched string
+}
+
+// CoalescingEditor merges consecutive identical commands into a single undo entry.
+type CoalescingEditor interface {
+	SetCoalescing(enabled bool)
+	BreakCoalescing()
+}
+
+// RedoStashingEditor keeps the redo branch discarded by a new edit so it can be recovered.
+type RedoStashingEditor interface {
+	SetPreserveRedo(enabled bool)
+	StashedRedoDepth() int
+	RedoStashed() error
+}
+
+// UndoLimitingEditor caps its undo stack, evicting the oldest entries.
+type UndoLimitingEditor interface {
+	// SetUndoLimit caps the undo stack at limit entries; 0 removes the cap.
+	SetUndoLimit(limit int)
+	UndoLimit() int
+}
+
+// EncodingEditor keeps the encoding its file is stored in; editors without it
+// always use UTF-8.
+type EncodingEditor interface {
+	Encoding() charset.Encoding
+	SetEncoding(enc charset.Encoding)
+}
+
+// LineEndingEditor keeps the line endings its file is written with.
+type LineEndingEditor interface {
+	LineStyle() LineStyle
+	SetLineStyle(style LineStyle)
+	// ConvertLineEndings changes the ending as an undoable edit.
+	ConvertLineEndings(ending LineEnding) error
+}
+
+// ErrReadOnly is returned when editing a read-only editor.
+var ErrReadOnly = errors.New("文件为只读模式")
+
 // XMLTreeEditor describes XML specific operations.
 type XMLTreeEditor interface {
 	Editor
@@ -41,10 +186,34 @@ type XMLTreeEditor interface {
 	AppendChild(tag, newID, parentID string, text *string) error
 	EditID(oldID, newID string) error
 	EditText(elementID string, text string) error
+	ReplaceWordInText(elementID, oldWord, newWord string, occurrence int) error
 	DeleteElement(elementID string) error
+	// Resolve finds an element by plain ID or by @tag=/@attr: selector.
+	Resolve(selector string) (ElementView, error)
+	Element(id string) (ElementView, bool)
+	Walk(fn func(ElementView) bool)
+	ElementPath(ref string) ([]XMLElementRef, error)
 	TreeString() string
 	TextNodes() []XMLTextNode
+	ElementText(elementID string) (string, error)
+	IDs() []string
+	IDsByTag(tag string) []string
+	Elements() []XMLElementRef
 	RootAttributes() map[string]string
+	CheckInvariants() error
+	RepairIndex() error
+	// IDCollisions groups distinct IDs that would be equal under policy.
+	IDCollisions(policy IDPolicy) [][]string
+	PlanIDRenames(rootID, oldPrefix, newPrefix string) ([]IDRename, error)
+	RenameIDs(rootID, oldPrefix, newPrefix string) (int, error)
+	GrepSerialized(text string) ([]XMLLineMatch, error)
+	Stats() XMLStats
+}
+
+// IDRename is one planned element ID change.
+type IDRename struct {
+	Old string
+	New string
 }
 
 // XMLTextNode describes an XML element with text content for spell checking.
@@ -52,3 +221,22 @@ type XMLTextNode struct {
 	ElementID string
 	Text      string
 }
+
+// XMLElementRef identifies an element by ID together with its tag.
+type XMLElementRef struct {
+	ElementID string
+	Tag       string
+}
+
+// WordMismatchError reports that the document no longer holds the word a report referred to.
+type WordMismatchError struct {
+	Expected string
+	Found    string
+}
+
+func (e *WordMismatchError) Error() string {
+	if e.Found == "" {
+		return fmt.Sprintf("文档已变化: 未找到 \"%s\"", e.Expected)
+	}
+	return fmt.Sprintf("文档已变化: 期望 \"%s\"，实际为 \"%s\"", e.Expected, e.Found)
+}
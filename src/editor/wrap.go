@@ -0,0 +1,143 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DisplayWidth returns the terminal column width of text, counting CJK and
+// fullwidth characters as two columns and combining marks as zero.
+func DisplayWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+func runeWidth(r rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r):
+		return 0
+	case isWide(r):
+		return 2
+	default:
+		return 1
+	}
+}
+
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana) ||
+		r >= 0x3000 && r <= 0x303F ||
+		r >= 0xFF01 && r <= 0xFF60 ||
+		r >= 0xFFE0 && r <= 0xFFE6
+}
+
+// Wrap reflows lines start..end (1-based, inclusive) to width display columns
+// as one undoable edit. Blank lines separate paragraphs and are kept.
+func (e *TextEditor) Wrap(start, end, width int) error {
+	if width < 1 {
+		return fmt.Errorf("宽度无效: %d", width)
+	}
+	if len(e.lines) == 0 {
+		return errors.New("文件为空")
+	}
+	if start < 1 || end < start || end > len(e.lines) {
+		return fmt.Errorf("行范围越界: %d:%d", start, end)
+	}
+	return e.execute("wrap", func() error {
+		var wrapped []string
+		var paragraph []string
+		flush := func() {
+			if len(paragraph) > 0 {
+				wrapped = append(wrapped, wrapParagraph(paragraph, width)...)
+				paragraph = nil
+			}
+		}
+		for _, line := range e.lines[start-1 : end] {
+			if strings.TrimSpace(line) == "" {
+				flush()
+				wrapped = append(wrapped, "")
+				continue
+			}
+			paragraph = append(paragraph, line)
+		}
+		flush()
+		composed := make([]string, 0, len(e.lines)-(end-start+1)+len(wrapped))
+		composed = append(composed, e.lines[:start-1]...)
+		composed = append(composed, wrapped...)
+		composed = append(composed, e.lines[end:]...)
+		e.lines = composed
+		e.size = linesSize(e.lines)
+		return nil
+	})
+}
+
+// wrapToken is an unbreakable piece of a paragraph.
+type wrapToken struct {
+	text        string
+	spaceBefore bool
+}
+
+func wrapParagraph(lines []string, width int) []string {
+	var tokens []wrapToken
+	prevLast := rune(0)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			first, _ := utf8.DecodeRuneInString(field)
+			// A line break between two wide runes carries no space, so that
+			// rewrapping CJK text does not introduce spaces.
+			space := len(tokens) > 0 && (i > 0 || !(isWide(prevLast) && isWide(first)))
+			for j, segment := range splitWide(field) {
+				tokens = append(tokens, wrapToken{text: segment, spaceBefore: space && j == 0})
+			}
+			prevLast, _ = utf8.DecodeLastRuneInString(field)
+		}
+	}
+
+	var result []string
+	var builder strings.Builder
+	lineWidth := 0
+	for _, token := range tokens {
+		tokenWidth := DisplayWidth(token.text)
+		gap := 0
+		if token.spaceBefore && lineWidth > 0 {
+			gap = 1
+		}
+		if lineWidth > 0 && lineWidth+gap+tokenWidth > width {
+			result = append(result, builder.String())
+			builder.Reset()
+			lineWidth = 0
+			gap = 0
+		}
+		if gap > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(token.text)
+		lineWidth += gap + tokenWidth
+	}
+	if builder.Len() > 0 {
+		result = append(result, builder.String())
+	}
+	return result
+}
+
+// splitWide breaks a whitespace-free field between consecutive wide runes,
+// the only places CJK text may wrap without a space.
+func splitWide(field string) []string {
+	var segments []string
+	startIdx := 0
+	prev := rune(0)
+	for idx, r := range field {
+		if idx > 0 && isWide(prev) && isWide(r) {
+			segments = append(segments, field[startIdx:idx])
+			startIdx = idx
+		}
+		prev = r
+	}
+	return append(segments, field[startIdx:])
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"path/filepath"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // XMLEditor manages XML DOM style editing with undo/redo support.
@@ -15,9 +17,32 @@ type XMLEditor struct {
 	path      string
 	root      *XMLNode
 	index     map[string]*XMLNode
+	idPolicy  IDPolicy
+	size      int
 	modified  bool
+	readOnly  bool
+	lastNoOp  bool
 	undoStack []*xmlCommand
 	redoStack []*xmlCommand
+
+	preserveRedo bool
+	stashedRedo  []*xmlCommand
+	// stashRoot is a copy of the tree the stashed branch was recorded against;
+	// the branch's operations refer to its nodes.
+	stashRoot *XMLNode
+	stashSize int
+	// pending collects the operations of the edit being executed.
+	pending   []xmlOp
+	history   historyMeter
+	undoLimit int
+
+	// collided is set when undo or redo indexes an ID already held by
+	// another element, which a stricter ID policy can cause.
+	collided bool
+
+	// focus is the element whose children or text the last edit changed.
+	focus           *XMLNode
+	focusStructural bool
 }
 
 // XMLNode represents a DOM element.
@@ -31,26 +56,38 @@ type XMLNode struct {
 	Parent     *XMLNode
 }
 
+// XMLParseError reports a parse failure together with its source position.
+type XMLParseError struct {
+	Line    int
+	Column  int
+	Element string
+	Reason  string
+}
+
+// Error formats the failure uniformly for decoder and structural errors.
+func (e *XMLParseError) Error() string {
+	if e.Element != "" {
+		return fmt.Sprintf("XML 解析失败 (第%d行第%d列, 元素 <%s>): %s", e.Line, e.Column, e.Element, e.Reason)
+	}
+	return fmt.Sprintf("XML 解析失败 (第%d行第%d列): %s", e.Line, e.Column, e.Reason)
+}
+
 // XMLAttribute retains attribute order.
 type XMLAttribute struct {
 	Name  string
 	Value string
 }
 
-type xmlCommand struct {
-	description string
-	before      *XMLNode
-	after       *XMLNode
-}
-
 // NewXMLEditor constructs an editor for the provided root.
 func NewXMLEditor(path string, root *XMLNode, modified bool) *XMLEditor {
 	index := map[string]*XMLNode{}
-	rebuildIndex(root, index)
+	rebuildIndex(root, index, IDExact)
 	return &XMLEditor{
 		path:     path,
 		root:     root,
 		index:    index,
+		idPolicy: IDExact,
+		size:     subtreeSize(root),
 		modified: modified,
 	}
 }
@@ -71,13 +108,23 @@ func NewDefaultXMLDocument(withLog bool) *XMLNode {
 	}
 }
 
-// ParseXMLEditor parses XML content into an editor.
+// ParseXMLEditor parses XML content into an editor with exact ID comparison.
 func ParseXMLEditor(path string, data []byte) (*XMLEditor, error) {
-	root, err := parseXML(bytes.NewReader(data))
+	return ParseXMLEditorWithPolicy(path, data, IDExact)
+}
+
+// ParseXMLEditorWithPolicy parses XML content, rejecting IDs that are
+// duplicates under policy.
+func ParseXMLEditorWithPolicy(path string, data []byte, policy IDPolicy) (*XMLEditor, error) {
+	root, err := parseXML(data, policy)
 	if err != nil {
 		return nil, err
 	}
-	return NewXMLEditor(path, root, false), nil
+	ed := NewXMLEditor(path, root, false)
+	if err := ed.SetIDPolicy(policy); err != nil {
+		return nil, err
+	}
+	return ed, nil
 }
 
 // Path returns the backing file path.
@@ -85,6 +132,11 @@ func (e *XMLEditor) Path() string {
 	return e.path
 }
 
+// Rename rebinds the editor to another backing file.
+func (e *XMLEditor) Rename(path string) {
+	e.path = path
+}
+
 // Name returns the file name for display.
 func (e *XMLEditor) Name() string {
 	return filepath.Base(e.path)
@@ -105,39 +157,226 @@ func (e *XMLEditor) SetModified(value bool) {
 	e.modified = value
 }
 
+// Size estimates the serialized size from tags, attributes and text lengths.
+func (e *XMLEditor) Size() int {
+	return e.size
+}
+
 // Content serializes the XML tree.
 func (e *XMLEditor) Content() (string, error) {
 	if e.root == nil {
 		return "", errors.New("缺少根元素")
 	}
+	return e.serialize(nil), nil
+}
+
+// serialize renders the tree; when owners is non-nil it receives the owning
+// element ID of each output line, "" for the declaration.
+func (e *XMLEditor) serialize(owners *[]string) string {
 	var buf bytes.Buffer
 	buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
-	writeNode(&buf, e.root, 0)
-	return buf.String(), nil
+	if owners != nil {
+		*owners = append(*owners, "")
+	}
+	writeNode(&buf, e.root, 0, owners)
+	return buf.String()
+}
+
+// UndoDescription names the command the next undo would revert.
+func (e *XMLEditor) UndoDescription() string {
+	if len(e.undoStack) == 0 {
+		return ""
+	}
+	return e.undoStack[len(e.undoStack)-1].description
+}
+
+// RedoDescription names the command the next redo would reapply.
+func (e *XMLEditor) RedoDescription() string {
+	if len(e.redoStack) == 0 {
+		return ""
+	}
+	return e.redoStack[len(e.redoStack)-1].description
+}
+
+// UndoDescriptions lists the undo stack, next undo first.
+func (e *XMLEditor) UndoDescriptions() []string {
+	descs := make([]string, 0, len(e.undoStack))
+	for i := len(e.undoStack) - 1; i >= 0; i-- {
+		descs = append(descs, e.undoStack[i].description)
+	}
+	return descs
+}
+
+// UndoN reverts up to n commands and returns how many were reverted.
+func (e *XMLEditor) UndoN(n int) (int, error) {
+	return repeatSteps(n, len(e.undoStack), e.Undo)
+}
+
+// RedoN reapplies up to n commands and returns how many were reapplied.
+func (e *XMLEditor) RedoN(n int) (int, error) {
+	return repeatSteps(n, len(e.redoStack), e.Redo)
+}
+
+// RedoDescriptions lists the redo stack, next redo first.
+func (e *XMLEditor) RedoDescriptions() []string {
+	descs := make([]string, 0, len(e.redoStack))
+	for i := len(e.redoStack) - 1; i >= 0; i-- {
+		descs = append(descs, e.redoStack[i].description)
+	}
+	return descs
+}
+
+// SetPreserveRedo toggles stashing of the redo branch a new edit would discard.
+func (e *XMLEditor) SetPreserveRedo(enabled bool) {
+	e.preserveRedo = enabled
+	if !enabled {
+		e.stashedRedo = nil
+		e.stashRoot = nil
+		e.recordHistory()
+	}
+}
+
+// StashedRedoDepth reports how many operations the stashed redo branch holds.
+func (e *XMLEditor) StashedRedoDepth() int {
+	return len(e.stashedRedo)
+}
+
+// RedoStashed reapplies the first operation of the stashed redo branch as a new
+// undoable edit and restores the rest of the branch as the redo stack.
+func (e *XMLEditor) RedoStashed() error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	if len(e.stashedRedo) == 0 {
+		return errors.New("没有暂存的重做分支")
+	}
+	branch, root := e.stashedRedo, e.stashRoot
+	next := branch[len(branch)-1]
+	swap := &rootOp{old: e.root, new: root, oldSize: e.size, newSize: e.stashSize}
+	cmd := &xmlCommand{description: next.description, ops: append([]xmlOp{swap}, next.ops...)}
+	if err := e.replay(func() { cmd.redo(e) }, func() { cmd.undo(e) }); err != nil {
+		return err
+	}
+	e.stashedRedo, e.stashRoot = nil, nil
+	e.undoStack = append(e.undoStack, cmd)
+	e.discardRedo(cmd)
+	e.redoStack = branch[:len(branch)-1]
+	e.trimUndo()
+	e.recordHistory()
+	e.lastNoOp = false
+	e.focus = nil
+	e.modified = true
+	return nil
+}
+
+// discardRedo clears the redo stack after cmd was applied. When preserving,
+// the branch is moved onto a copy of the tree cmd started from, so later edits
+// to the live nodes cannot disturb it.
+func (e *XMLEditor) discardRedo(cmd *xmlCommand) {
+	if e.preserveRedo && len(e.redoStack) > 0 {
+		cmd.undo(e)
+		clones := map[*XMLNode]*XMLNode{}
+		e.stashRoot = cloneTree(e.root, nil, clones)
+		e.stashSize = e.size
+		cmd.redo(e)
+		for _, stashed := range e.redoStack {
+			for _, op := range stashed.ops {
+				op.remap(clones)
+			}
+		}
+		e.stashedRedo = e.redoStack
+	}
+	e.redoStack = nil
+}
+
+// replay runs forward, which undoes or redoes history. If that reintroduces
+// IDs the current policy treats as equal, back reverts it and the index is
+// rebuilt, since the clash overwrote index entries.
+func (e *XMLEditor) replay(forward, back func()) error {
+	e.collided = false
+	forward()
+	if !e.collided {
+		return nil
+	}
+	back()
+	e.collided = false
+	index := map[string]*XMLNode{}
+	rebuildIndex(e.root, index, e.idPolicy)
+	e.index = index
+	return fmt.Errorf("该操作会产生在 %s 策略下重复的元素 ID", e.idPolicy)
+}
+
+// IsReadOnly reports whether edits are refused.
+func (e *XMLEditor) IsReadOnly() bool {
+	return e.readOnly
+}
+
+// SetReadOnly toggles refusal of edits, undo, and redo.
+func (e *XMLEditor) SetReadOnly(value bool) {
+	e.readOnly = value
 }
 
 // Undo reverts the last operation.
 func (e *XMLEditor) Undo() error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
 	if len(e.undoStack) == 0 {
 		return errors.New("没有可撤销的操作")
 	}
 	last := e.undoStack[len(e.undoStack)-1]
+	if err := e.replay(func() { last.undo(e) }, func() { last.redo(e) }); err != nil {
+		return err
+	}
 	e.undoStack = e.undoStack[:len(e.undoStack)-1]
-	e.applySnapshot(last.before)
+	e.lastNoOp = false
+	e.focus = nil
 	e.redoStack = append(e.redoStack, last)
+	e.recordHistory()
 	e.modified = true
 	return nil
 }
 
+// UndoDepth reports how many operations can be undone.
+func (e *XMLEditor) UndoDepth() int {
+	return len(e.undoStack)
+}
+
+// RedoDepth reports how many operations can be redone.
+func (e *XMLEditor) RedoDepth() int {
+	return len(e.redoStack)
+}
+
+// LastEditNoOp reports whether the most recent edit left the document unchanged.
+func (e *XMLEditor) LastEditNoOp() bool {
+	return e.lastNoOp
+}
+
+// MemoryStats estimates the serialized content and history held by the editor.
+func (e *XMLEditor) MemoryStats() MemoryStats {
+	stats := MemoryStats{ContentBytes: e.size, UndoEntries: len(e.undoStack)}
+	e.history.fill(&stats)
+	return stats
+}
+
 // Redo reapplies the last undone operation.
 func (e *XMLEditor) Redo() error {
+	if e.readOnly {
+		return ErrReadOnly
+	}
 	if len(e.redoStack) == 0 {
 		return errors.New("没有可重做的操作")
 	}
 	last := e.redoStack[len(e.redoStack)-1]
+	if err := e.replay(func() { last.redo(e) }, func() { last.undo(e) }); err != nil {
+		return err
+	}
 	e.redoStack = e.redoStack[:len(e.redoStack)-1]
-	e.applySnapshot(last.after)
+	e.lastNoOp = false
+	e.focus = nil
 	e.undoStack = append(e.undoStack, last)
+	e.trimUndo()
+	e.recordHistory()
 	e.modified = true
 	return nil
 }
@@ -145,12 +384,12 @@ func (e *XMLEditor) Redo() error {
 // InsertBefore inserts a sibling element before the target.
 func (e *XMLEditor) InsertBefore(tag, newID, targetID string, text *string) error {
 	return e.execute("insert-before", func() error {
-		if _, exists := e.index[newID]; exists {
-			return fmt.Errorf("元素 ID 已存在: %s", newID)
+		if existing, ok := e.conflictingID(newID, nil); ok {
+			return fmt.Errorf("元素 ID 已存在: %s", describeID(newID, existing))
 		}
-		target, ok := e.index[targetID]
-		if !ok {
-			return fmt.Errorf("目标元素不存在: %s", targetID)
+		target, err := e.element(targetID, "目标元素不存在")
+		if err != nil {
+			return err
 		}
 		if target.Parent == nil {
 			return errors.New("不能在根元素前插入元素")
@@ -160,10 +399,8 @@ func (e *XMLEditor) InsertBefore(tag, newID, targetID string, text *string) erro
 			return errors.New("该元素已有文本内容，不支持混合内容")
 		}
 		node := createXMLNode(tag, newID, text)
-		node.Parent = parent
-		idx := indexOfChild(parent, target)
-		parent.Children = append(parent.Children[:idx], append([]*XMLNode{node}, parent.Children[idx:]...)...)
-		registerNode(node, e.index)
+		e.do(newChildOp(parent, node, indexOfChild(parent, target), false))
+		e.focus, e.focusStructural = parent, true
 		return nil
 	})
 }
@@ -171,20 +408,19 @@ func (e *XMLEditor) InsertBefore(tag, newID, targetID string, text *string) erro
 // AppendChild appends a child element to the parent.
 func (e *XMLEditor) AppendChild(tag, newID, parentID string, text *string) error {
 	return e.execute("append-child", func() error {
-		if _, exists := e.index[newID]; exists {
-			return fmt.Errorf("元素 ID 已存在: %s", newID)
+		if existing, ok := e.conflictingID(newID, nil); ok {
+			return fmt.Errorf("元素 ID 已存在: %s", describeID(newID, existing))
 		}
-		parent, ok := e.index[parentID]
-		if !ok {
-			return fmt.Errorf("父元素不存在: %s", parentID)
+		parent, err := e.element(parentID, "父元素不存在")
+		if err != nil {
+			return err
 		}
 		if strings.TrimSpace(parent.Text) != "" {
 			return errors.New("该元素已有文本内容，不支持混合内容")
 		}
 		node := createXMLNode(tag, newID, text)
-		node.Parent = parent
-		parent.Children = append(parent.Children, node)
-		registerNode(node, e.index)
+		e.do(newChildOp(parent, node, len(parent.Children), false))
+		e.focus, e.focusStructural = parent, true
 		return nil
 	})
 }
@@ -192,61 +428,104 @@ func (e *XMLEditor) AppendChild(tag, newID, parentID string, text *string) error
 // EditID renames an element id.
 func (e *XMLEditor) EditID(oldID, newID string) error {
 	return e.execute("edit-id", func() error {
-		node, ok := e.index[oldID]
-		if !ok {
-			return fmt.Errorf("元素不存在: %s", oldID)
+		node, err := e.element(oldID, "元素不存在")
+		if err != nil {
+			return err
 		}
 		if node.Parent == nil {
 			return errors.New("不允许修改根元素 ID")
 		}
-		if _, exists := e.index[newID]; exists {
-			return fmt.Errorf("目标 ID 已存在: %s", newID)
-		}
-		delete(e.index, oldID)
-		node.ID = newID
-		if node.attrIndex == nil {
-			node.attrIndex = map[string]int{}
-		}
-		if idx, ok := node.attrIndex["id"]; ok {
-			node.Attributes[idx].Value = newID
-		} else {
-			node.attrIndex["id"] = len(node.Attributes)
-			node.Attributes = append(node.Attributes, XMLAttribute{Name: "id", Value: newID})
+		if existing, ok := e.conflictingID(newID, node); ok {
+			return fmt.Errorf("目标 ID 已存在: %s", describeID(newID, existing))
 		}
-		e.index[newID] = node
+		e.do(newRenameOp([]*XMLNode{node}, []string{newID}))
+		e.focus, e.focusStructural = node, false
 		return nil
 	})
 }
 
+// setNodeID updates the node's ID and id attribute; callers maintain the index.
+func (e *XMLEditor) setNodeID(node *XMLNode, newID string) {
+	oldID := node.ID
+	node.ID = newID
+	if node.attrIndex == nil {
+		node.attrIndex = map[string]int{}
+	}
+	if idx, ok := node.attrIndex["id"]; ok {
+		node.Attributes[idx].Value = newID
+		e.size += len(newID) - len(oldID)
+	} else {
+		node.attrIndex["id"] = len(node.Attributes)
+		node.Attributes = append(node.Attributes, XMLAttribute{Name: "id", Value: newID})
+		e.size += attributeSize(node.Attributes[len(node.Attributes)-1])
+	}
+}
+
 // EditText updates the text content of an element.
 func (e *XMLEditor) EditText(elementID string, text string) error {
 	return e.execute("edit-text", func() error {
-		node, ok := e.index[elementID]
-		if !ok {
-			return fmt.Errorf("元素不存在: %s", elementID)
+		node, err := e.element(elementID, "元素不存在")
+		if err != nil {
+			return err
 		}
 		if len(node.Children) > 0 {
 			return errors.New("该元素有子元素，不支持混合内容")
 		}
-		node.Text = text
+		if text != node.Text {
+			e.do(&textOp{node: node, old: node.Text, new: text})
+		}
+		e.focus, e.focusStructural = node, false
 		return nil
 	})
 }
 
+// ReplaceWordInText swaps the nth (1-based) occurrence of oldWord in an element's text.
+func (e *XMLEditor) ReplaceWordInText(elementID, oldWord, newWord string, occurrence int) error {
+	return e.execute("replace-word", func() error {
+		node, err := e.element(elementID, "元素不存在")
+		if err != nil {
+			return err
+		}
+		if occurrence < 1 {
+			return fmt.Errorf("出现次序无效: %d", occurrence)
+		}
+		runes := []rune(node.Text)
+		seen := 0
+		for i := 0; i < len(runes); i++ {
+			word := wordAt(runes, i)
+			if word == "" {
+				continue
+			}
+			if word == oldWord {
+				seen++
+				if seen == occurrence {
+					replaced := string(runes[:i]) + newWord + string(runes[i+len([]rune(word)):])
+					if replaced != node.Text {
+						e.do(&textOp{node: node, old: node.Text, new: replaced})
+					}
+					e.focus, e.focusStructural = node, false
+					return nil
+				}
+			}
+			i += len([]rune(word)) - 1
+		}
+		return &WordMismatchError{Expected: oldWord}
+	})
+}
+
 // DeleteElement removes the specified element and its subtree.
 func (e *XMLEditor) DeleteElement(elementID string) error {
 	return e.execute("delete-element", func() error {
-		node, ok := e.index[elementID]
-		if !ok {
-			return fmt.Errorf("元素不存在: %s", elementID)
+		node, err := e.element(elementID, "元素不存在")
+		if err != nil {
+			return err
 		}
 		if node.Parent == nil {
 			return errors.New("不能删除根元素")
 		}
 		parent := node.Parent
-		idx := indexOfChild(parent, node)
-		parent.Children = append(parent.Children[:idx], parent.Children[idx+1:]...)
-		removeFromIndex(node, e.index)
+		e.do(newChildOp(parent, node, indexOfChild(parent, node), true))
+		e.focus, e.focusStructural = parent, true
 		return nil
 	})
 }
@@ -264,7 +543,47 @@ func (e *XMLEditor) TreeString() string {
 // TextNodes collects element texts for spell checking.
 func (e *XMLEditor) TextNodes() []XMLTextNode {
 	var result []XMLTextNode
-	collectTextNodes(e.root, &result)
+	e.Walk(func(view ElementView) bool {
+		if text := strings.TrimSpace(view.Text); text != "" {
+			result = append(result, XMLTextNode{ElementID: view.ID, Text: text})
+		}
+		return true
+	})
+	return result
+}
+
+// ElementText returns an element's text exactly as stored.
+func (e *XMLEditor) ElementText(elementID string) (string, error) {
+	node, err := e.element(elementID, "元素不存在")
+	if err != nil {
+		return "", err
+	}
+	return node.Text, nil
+}
+
+// IDs lists every element ID in document order.
+func (e *XMLEditor) IDs() []string {
+	return e.IDsByTag("")
+}
+
+// IDsByTag lists element IDs with the given tag in document order (empty tag matches all).
+func (e *XMLEditor) IDsByTag(tag string) []string {
+	var ids []string
+	for _, ref := range e.Elements() {
+		if tag == "" || ref.Tag == tag {
+			ids = append(ids, ref.ElementID)
+		}
+	}
+	return ids
+}
+
+// Elements lists element IDs and tags in document order.
+func (e *XMLEditor) Elements() []XMLElementRef {
+	var result []XMLElementRef
+	e.Walk(func(view ElementView) bool {
+		result = append(result, XMLElementRef{ElementID: view.ID, Tag: view.Tag})
+		return true
+	})
 	return result
 }
 
@@ -281,26 +600,32 @@ func (e *XMLEditor) RootAttributes() map[string]string {
 }
 
 func (e *XMLEditor) execute(desc string, mutate func() error) error {
-	before := cloneTree(e.root, nil)
-	if err := mutate(); err != nil {
+	if e.readOnly {
+		return ErrReadOnly
+	}
+	e.pending = nil
+	e.focus = nil
+	err := mutate()
+	cmd := &xmlCommand{description: desc, ops: e.pending}
+	e.pending = nil
+	if err != nil {
+		cmd.undo(e)
+		e.focus = nil
 		return err
 	}
-	after := cloneTree(e.root, nil)
-	cmd := &xmlCommand{description: desc, before: before, after: after}
+	e.lastNoOp = len(cmd.ops) == 0
+	if e.lastNoOp {
+		e.focus = nil
+		return nil
+	}
 	e.undoStack = append(e.undoStack, cmd)
-	e.redoStack = nil
+	e.discardRedo(cmd)
+	e.trimUndo()
+	e.recordHistory()
 	e.modified = true
 	return nil
 }
 
-func (e *XMLEditor) applySnapshot(snapshot *XMLNode) {
-	cloned := cloneTree(snapshot, nil)
-	index := map[string]*XMLNode{}
-	rebuildIndex(cloned, index)
-	e.root = cloned
-	e.index = index
-}
-
 func createXMLNode(tag, id string, text *string) *XMLNode {
 	attrIndex := map[string]int{"id": 0}
 	attrs := []XMLAttribute{{Name: "id", Value: id}}
@@ -316,7 +641,7 @@ func createXMLNode(tag, id string, text *string) *XMLNode {
 	return node
 }
 
-func registerNode(node *XMLNode, index map[string]*XMLNode) {
+func registerNode(node *XMLNode, index map[string]*XMLNode, policy IDPolicy) {
 	if index == nil || node == nil {
 		return
 	}
@@ -326,16 +651,16 @@ func registerNode(node *XMLNode, index map[string]*XMLNode) {
 			node.attrIndex[attr.Name] = idx
 		}
 	}
-	index[node.ID] = node
+	index[policy.key(node.ID)] = node
 }
 
-func removeFromIndex(node *XMLNode, index map[string]*XMLNode) {
+func removeFromIndex(node *XMLNode, index map[string]*XMLNode, policy IDPolicy) {
 	if node == nil {
 		return
 	}
-	delete(index, node.ID)
+	delete(index, policy.key(node.ID))
 	for _, child := range node.Children {
-		removeFromIndex(child, index)
+		removeFromIndex(child, index, policy)
 	}
 }
 
@@ -372,16 +697,28 @@ func renderTree(node *XMLNode, prefix string, lines *[]string) {
 	}
 }
 
-func collectTextNodes(node *XMLNode, acc *[]XMLTextNode) {
-	if node == nil {
-		return
+// nodeSize approximates the serialized bytes of a single element.
+func nodeSize(node *XMLNode) int {
+	size := 2*len(node.Tag) + 5 + len(node.Text)
+	for _, attr := range node.Attributes {
+		size += attributeSize(attr)
 	}
-	if strings.TrimSpace(node.Text) != "" {
-		*acc = append(*acc, XMLTextNode{ElementID: node.ID, Text: strings.TrimSpace(node.Text)})
+	return size
+}
+
+func attributeSize(attr XMLAttribute) int {
+	return len(attr.Name) + len(attr.Value) + 4
+}
+
+func subtreeSize(node *XMLNode) int {
+	if node == nil {
+		return 0
 	}
+	size := nodeSize(node)
 	for _, child := range node.Children {
-		collectTextNodes(child, acc)
+		size += subtreeSize(child)
 	}
+	return size
 }
 
 func formatNodeLabel(node *XMLNode) string {
@@ -398,13 +735,21 @@ func formatNodeLabel(node *XMLNode) string {
 	return fmt.Sprintf("%s [%s]", node.Tag, strings.Join(parts, ", "))
 }
 
-func writeNode(buf *bytes.Buffer, node *XMLNode, depth int) {
+// writeNode writes one line per tag; text and attributes are escaped, so they
+// never introduce line breaks. Each line's owner is appended to owners if set.
+func writeNode(buf *bytes.Buffer, node *XMLNode, depth int, owners *[]string) {
 	if node == nil {
 		return
 	}
+	record := func() {
+		if owners != nil {
+			*owners = append(*owners, node.ID)
+		}
+	}
 	indent := strings.Repeat("    ", depth)
 	attrText := formatAttributes(node.Attributes)
 	if len(node.Children) == 0 {
+		record()
 		if strings.TrimSpace(node.Text) == "" {
 			fmt.Fprintf(buf, "%s<%s%s></%s>\n", indent, node.Tag, attrText, node.Tag)
 			return
@@ -412,10 +757,12 @@ func writeNode(buf *bytes.Buffer, node *XMLNode, depth int) {
 		fmt.Fprintf(buf, "%s<%s%s>%s</%s>\n", indent, node.Tag, attrText, escapeText(node.Text), node.Tag)
 		return
 	}
+	record()
 	fmt.Fprintf(buf, "%s<%s%s>\n", indent, node.Tag, attrText)
 	for _, child := range node.Children {
-		writeNode(buf, child, depth+1)
+		writeNode(buf, child, depth+1, owners)
 	}
+	record()
 	fmt.Fprintf(buf, "%s</%s>\n", indent, node.Tag)
 }
 
@@ -442,7 +789,8 @@ func escapeAttribute(value string) string {
 	return escapeText(value)
 }
 
-func cloneTree(node *XMLNode, parent *XMLNode) *XMLNode {
+// cloneTree deep-copies node; clones, when non-nil, maps each original to its copy.
+func cloneTree(node *XMLNode, parent *XMLNode, clones map[*XMLNode]*XMLNode) *XMLNode {
 	if node == nil {
 		return nil
 	}
@@ -454,21 +802,26 @@ func cloneTree(node *XMLNode, parent *XMLNode) *XMLNode {
 		attrIndex:  make(map[string]int, len(node.attrIndex)),
 		Parent:     parent,
 	}
+	if clones != nil {
+		clones[node] = cloned
+	}
 	copy(cloned.Attributes, node.Attributes)
 	for k, v := range node.attrIndex {
 		cloned.attrIndex[k] = v
 	}
 	cloned.Children = make([]*XMLNode, len(node.Children))
 	for i, child := range node.Children {
-		clonedChild := cloneTree(child, cloned)
+		clonedChild := cloneTree(child, cloned, clones)
 		cloned.Children[i] = clonedChild
 	}
 	return cloned
 }
 
-func rebuildIndex(node *XMLNode, index map[string]*XMLNode) {
+// rebuildIndex indexes the subtree under node and reports whether it
+// displaced another node holding an equal ID.
+func rebuildIndex(node *XMLNode, index map[string]*XMLNode, policy IDPolicy) bool {
 	if node == nil {
-		return
+		return false
 	}
 	if node.attrIndex == nil {
 		node.attrIndex = map[string]int{}
@@ -476,26 +829,42 @@ func rebuildIndex(node *XMLNode, index map[string]*XMLNode) {
 			node.attrIndex[attr.Name] = idx
 		}
 	}
-	index[node.ID] = node
+	key := policy.key(node.ID)
+	existing, clash := index[key]
+	clash = clash && existing != node
+	index[key] = node
 	for _, child := range node.Children {
 		child.Parent = node
-		rebuildIndex(child, index)
+		if rebuildIndex(child, index, policy) {
+			clash = true
+		}
 	}
+	return clash
 }
 
-func parseXML(reader io.Reader) (*XMLNode, error) {
-	decoder := xml.NewDecoder(reader)
+func parseXML(data []byte, policy IDPolicy) (*XMLNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
 	var stack []*XMLNode
 	var root *XMLNode
-	ids := map[string]struct{}{}
+	ids := map[string]string{}
+	fail := func(offset int64, element, reason string) error {
+		line, column := offsetPosition(data, offset)
+		return &XMLParseError{Line: line, Column: column, Element: element, Reason: reason}
+	}
 
 	for {
+		offset := decoder.InputOffset()
 		token, err := decoder.Token()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return nil, err
+			reason := err.Error()
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				reason = syntaxErr.Msg
+			}
+			return nil, fail(decoder.InputOffset(), "", reason)
 		}
 
 		switch tok := token.(type) {
@@ -515,19 +884,19 @@ func parseXML(reader io.Reader) (*XMLNode, error) {
 				}
 			}
 			if node.ID == "" {
-				return nil, fmt.Errorf("元素缺少 id 属性: %s", node.Tag)
+				return nil, fail(offset, node.Tag, "元素缺少 id 属性")
 			}
-			if _, exists := ids[node.ID]; exists {
-				return nil, fmt.Errorf("元素 ID 已存在: %s", node.ID)
+			if existing, exists := ids[policy.key(node.ID)]; exists {
+				return nil, fail(offset, node.Tag, "元素 ID 已存在: "+describeID(node.ID, existing))
 			}
-			ids[node.ID] = struct{}{}
+			ids[policy.key(node.ID)] = node.ID
 
 			if len(stack) == 0 {
 				root = node
 			} else {
 				parent := stack[len(stack)-1]
 				if strings.TrimSpace(parent.Text) != "" {
-					return nil, errors.New("该元素已有文本内容，不支持混合内容")
+					return nil, fail(offset, parent.Tag, "该元素已有文本内容，不支持混合内容")
 				}
 				node.Parent = parent
 				parent.Children = append(parent.Children, node)
@@ -535,7 +904,7 @@ func parseXML(reader io.Reader) (*XMLNode, error) {
 			stack = append(stack, node)
 		case xml.EndElement:
 			if len(stack) == 0 {
-				return nil, errors.New("XML 结构不匹配")
+				return nil, fail(offset, tok.Name.Local, "XML 结构不匹配")
 			}
 			stack = stack[:len(stack)-1]
 		case xml.CharData:
@@ -548,7 +917,8 @@ func parseXML(reader io.Reader) (*XMLNode, error) {
 				continue
 			}
 			if len(current.Children) > 0 {
-				return nil, errors.New("该元素已有子元素，不支持混合内容")
+				textOffset := offset + int64(len(data)-len(strings.TrimLeftFunc(data, unicode.IsSpace)))
+				return nil, fail(textOffset, current.Tag, "该元素已有子元素，不支持混合内容")
 			}
 			if strings.TrimSpace(current.Text) == "" {
 				current.Text = strings.TrimSpace(data)
@@ -563,7 +933,18 @@ func parseXML(reader io.Reader) (*XMLNode, error) {
 	}
 
 	if root == nil {
-		return nil, errors.New("未找到根元素")
+		return nil, fail(int64(len(data)), "", "未找到根元素")
 	}
 	return root, nil
 }
+
+// offsetPosition maps a byte offset to a 1-based line and rune column.
+func offsetPosition(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	head := data[:offset]
+	line := bytes.Count(head, []byte("\n")) + 1
+	lineStart := bytes.LastIndexByte(head, '\n') + 1
+	return line, utf8.RuneCount(head[lineStart:]) + 1
+}
@@ -0,0 +1,35 @@
+package editor
+
+import (
+	"errors"
+	"strings"
+)
+
+// XMLLineMatch is a search hit in the serialized XML, as save would write it.
+type XMLLineMatch struct {
+	// Line is the 1-based line number in the serialized output.
+	Line int
+	Text string
+	// ElementID owns the line; it is empty for the XML declaration.
+	ElementID string
+}
+
+// GrepSerialized searches the serialized document line by line for text.
+func (e *XMLEditor) GrepSerialized(text string) ([]XMLLineMatch, error) {
+	if text == "" {
+		return nil, errors.New("查找内容不能为空")
+	}
+	if e.root == nil {
+		return nil, errors.New("缺少根元素")
+	}
+	var owners []string
+	content := e.serialize(&owners)
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	var matches []XMLLineMatch
+	for i, line := range lines {
+		if strings.Contains(line, text) {
+			matches = append(matches, XMLLineMatch{Line: i + 1, Text: line, ElementID: owners[i]})
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,119 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IDPolicy decides when two XML element IDs count as the same ID.
+type IDPolicy string
+
+const (
+	// IDExact compares IDs byte for byte.
+	IDExact IDPolicy = "exact"
+	// IDCaseInsensitive treats IDs differing only in letter case as equal.
+	IDCaseInsensitive IDPolicy = "case-insensitive"
+)
+
+// key returns the index key of id: IDs with equal keys collide.
+func (p IDPolicy) key(id string) string {
+	if p == IDCaseInsensitive {
+		return strings.ToLower(id)
+	}
+	return id
+}
+
+// IDPolicyEditor lets the workspace choose how an editor compares element IDs.
+type IDPolicyEditor interface {
+	// SetIDPolicy re-indexes the document under policy; it fails and keeps
+	// the current policy if existing IDs would collide.
+	SetIDPolicy(policy IDPolicy) error
+	IDPolicy() IDPolicy
+}
+
+// IDCollisionError lists IDs that are distinct but equal under a policy.
+type IDCollisionError struct {
+	Policy IDPolicy
+	Groups [][]string
+}
+
+func (e *IDCollisionError) Error() string {
+	groups := make([]string, len(e.Groups))
+	for i, group := range e.Groups {
+		groups[i] = strings.Join(group, "/")
+	}
+	return fmt.Sprintf("在 %s 策略下元素 ID 冲突: %s", e.Policy, strings.Join(groups, ", "))
+}
+
+// IDPolicy reports how the editor compares element IDs.
+func (e *XMLEditor) IDPolicy() IDPolicy {
+	return e.idPolicy
+}
+
+// SetIDPolicy switches the ID comparison policy and rebuilds the index.
+func (e *XMLEditor) SetIDPolicy(policy IDPolicy) error {
+	if policy == e.idPolicy {
+		return nil
+	}
+	if groups := e.IDCollisions(policy); len(groups) > 0 {
+		return &IDCollisionError{Policy: policy, Groups: groups}
+	}
+	e.idPolicy = policy
+	index := map[string]*XMLNode{}
+	rebuildIndex(e.root, index, policy)
+	e.index = index
+	// Stashed operations hold nodes rather than keys, so only the live index
+	// needs rebuilding; undo and redo re-key as they go.
+	return nil
+}
+
+// IDCollisions groups the document's IDs that would be equal under policy,
+// each group and the list sorted.
+func (e *XMLEditor) IDCollisions(policy IDPolicy) [][]string {
+	byKey := map[string][]string{}
+	var walk func(node *XMLNode)
+	walk = func(node *XMLNode) {
+		key := policy.key(node.ID)
+		byKey[key] = append(byKey[key], node.ID)
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	if e.root != nil {
+		walk(e.root)
+	}
+	var groups [][]string
+	for _, ids := range byKey {
+		if len(ids) > 1 {
+			sort.Strings(ids)
+			groups = append(groups, ids)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+// lookup finds the element whose ID matches id under the editor's policy.
+func (e *XMLEditor) lookup(id string) (*XMLNode, bool) {
+	node, ok := e.index[e.idPolicy.key(id)]
+	return node, ok
+}
+
+// conflictingID reports the stored ID that id would collide with. self may
+// take an ID that differs from its own only in ways the policy ignores.
+func (e *XMLEditor) conflictingID(id string, self *XMLNode) (string, bool) {
+	node, ok := e.lookup(id)
+	if !ok || node == self && node.ID != id {
+		return "", false
+	}
+	return node.ID, true
+}
+
+// describeID names id, adding the stored ID it collides with when they differ.
+func describeID(id, existing string) string {
+	if id == existing {
+		return id
+	}
+	return fmt.Sprintf("%s (与 %s 冲突)", id, existing)
+}
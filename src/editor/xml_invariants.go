@@ -0,0 +1,103 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// InvariantError lists every consistency problem found in an XML editor.
+type InvariantError struct {
+	Problems []string
+}
+
+func (e *InvariantError) Error() string {
+	return "XML 结构不一致: " + strings.Join(e.Problems, "; ")
+}
+
+// CheckInvariants verifies that the ID index, parent pointers, and attribute
+// indexes agree with the tree reachable from root.
+func (e *XMLEditor) CheckInvariants() error {
+	var problems []string
+	report := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if e.root == nil {
+		return &InvariantError{Problems: []string{"缺少根元素"}}
+	}
+	if e.root.Parent != nil {
+		report("根元素 %s 不应有父元素", e.root.ID)
+	}
+	reachable := map[*XMLNode]bool{}
+	seen := map[string]bool{}
+	var walk func(node *XMLNode)
+	walk = func(node *XMLNode) {
+		reachable[node] = true
+		key := e.idPolicy.key(node.ID)
+		if seen[key] {
+			report("元素 ID 重复: %s", node.ID)
+		}
+		seen[key] = true
+		if indexed, ok := e.index[key]; !ok {
+			report("元素 %s 未登记在索引中", node.ID)
+		} else if indexed != node {
+			report("索引项 %s 指向其他节点", node.ID)
+		}
+		if len(node.attrIndex) != len(node.Attributes) {
+			report("元素 %s 的属性索引数量 (%d) 与属性数量 (%d) 不符", node.ID, len(node.attrIndex), len(node.Attributes))
+		}
+		for i, attr := range node.Attributes {
+			if idx, ok := node.attrIndex[attr.Name]; !ok || idx != i {
+				report("元素 %s 的属性索引缺少或错位: %s", node.ID, attr.Name)
+			}
+			if attr.Name == "id" && attr.Value != node.ID {
+				report("元素 %s 的 id 属性为 %s", node.ID, attr.Value)
+			}
+		}
+		for _, child := range node.Children {
+			if child.Parent != node {
+				report("元素 %s 的父指针未指向 %s", child.ID, node.ID)
+			}
+			walk(child)
+		}
+	}
+	walk(e.root)
+	ids := make([]string, 0, len(e.index))
+	for id := range e.index {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		node := e.index[id]
+		if !reachable[node] {
+			report("索引项 %s 指向已脱离文档的节点", id)
+		} else if e.idPolicy.key(node.ID) != id {
+			report("索引项 %s 指向 ID 为 %s 的节点", id, node.ID)
+		}
+	}
+	if len(problems) > 0 {
+		return &InvariantError{Problems: problems}
+	}
+	return nil
+}
+
+// RepairIndex rebuilds the ID index, parent pointers, and attribute indexes
+// from the tree, then re-checks the invariants.
+func (e *XMLEditor) RepairIndex() error {
+	if e.root == nil {
+		return e.CheckInvariants()
+	}
+	e.root.Parent = nil
+	var reindex func(node *XMLNode)
+	reindex = func(node *XMLNode) {
+		node.attrIndex = nil
+		for _, child := range node.Children {
+			reindex(child)
+		}
+	}
+	reindex(e.root)
+	index := map[string]*XMLNode{}
+	rebuildIndex(e.root, index, e.idPolicy)
+	e.index = index
+	return e.CheckInvariants()
+}
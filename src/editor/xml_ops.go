@@ -0,0 +1,213 @@
+package editor
+
+import "slices"
+
+// xmlCommand is one undoable edit: the operations it applied, in order.
+type xmlCommand struct {
+	description string
+	ops         []xmlOp
+}
+
+// xmlOp is a targeted tree mutation that can be reverted. Operations hold the
+// live nodes they touch, so undo and redo keep node identity and update the
+// ID index incrementally instead of rebuilding the tree.
+type xmlOp interface {
+	apply(e *XMLEditor)
+	revert(e *XMLEditor)
+	// remap retargets the operation onto a cloned tree.
+	remap(clones map[*XMLNode]*XMLNode)
+	sizeBytes() int
+}
+
+func (c *xmlCommand) redo(e *XMLEditor) {
+	for _, op := range c.ops {
+		op.apply(e)
+	}
+}
+
+func (c *xmlCommand) undo(e *XMLEditor) {
+	for i := len(c.ops) - 1; i >= 0; i-- {
+		c.ops[i].revert(e)
+	}
+}
+
+// do applies op as part of the edit being executed.
+func (e *XMLEditor) do(op xmlOp) {
+	op.apply(e)
+	e.pending = append(e.pending, op)
+}
+
+// childOp inserts node into parent at pos, or removes it from there when
+// remove is set.
+type childOp struct {
+	parent *XMLNode
+	node   *XMLNode
+	pos    int
+	remove bool
+	size   int
+}
+
+func newChildOp(parent, node *XMLNode, pos int, remove bool) *childOp {
+	return &childOp{parent: parent, node: node, pos: pos, remove: remove, size: subtreeSize(node)}
+}
+
+func (op *childOp) apply(e *XMLEditor) {
+	if op.remove {
+		op.detach(e)
+	} else {
+		op.attach(e)
+	}
+}
+
+func (op *childOp) revert(e *XMLEditor) {
+	if op.remove {
+		op.attach(e)
+	} else {
+		op.detach(e)
+	}
+}
+
+func (op *childOp) attach(e *XMLEditor) {
+	op.parent.Children = slices.Insert(op.parent.Children, op.pos, op.node)
+	op.node.Parent = op.parent
+	if rebuildIndex(op.node, e.index, e.idPolicy) {
+		e.collided = true
+	}
+	e.size += subtreeSize(op.node)
+}
+
+func (op *childOp) detach(e *XMLEditor) {
+	op.parent.Children = slices.Delete(op.parent.Children, op.pos, op.pos+1)
+	removeFromIndex(op.node, e.index, e.idPolicy)
+	e.size -= subtreeSize(op.node)
+}
+
+func (op *childOp) remap(clones map[*XMLNode]*XMLNode) {
+	op.parent = remapNode(clones, op.parent)
+	op.node = remapNode(clones, op.node)
+}
+
+func (op *childOp) sizeBytes() int {
+	return op.size
+}
+
+// textOp replaces an element's text.
+type textOp struct {
+	node     *XMLNode
+	old, new string
+}
+
+func (op *textOp) apply(e *XMLEditor) {
+	e.setText(op.node, op.new)
+}
+
+func (op *textOp) revert(e *XMLEditor) {
+	e.setText(op.node, op.old)
+}
+
+func (e *XMLEditor) setText(node *XMLNode, text string) {
+	e.size += len(text) - len(node.Text)
+	node.Text = text
+}
+
+func (op *textOp) remap(clones map[*XMLNode]*XMLNode) {
+	op.node = remapNode(clones, op.node)
+}
+
+func (op *textOp) sizeBytes() int {
+	return len(op.old) + len(op.new)
+}
+
+// renameOp changes the IDs of several elements at once, so renames that reuse
+// each other's IDs never collide in the index.
+type renameOp struct {
+	nodes    []*XMLNode
+	old, new []string
+}
+
+func newRenameOp(nodes []*XMLNode, ids []string) *renameOp {
+	op := &renameOp{nodes: nodes, new: ids}
+	for _, node := range nodes {
+		op.old = append(op.old, node.ID)
+	}
+	return op
+}
+
+func (op *renameOp) apply(e *XMLEditor) {
+	e.relabel(op.nodes, op.new)
+}
+
+func (op *renameOp) revert(e *XMLEditor) {
+	e.relabel(op.nodes, op.old)
+}
+
+func (e *XMLEditor) relabel(nodes []*XMLNode, ids []string) {
+	for _, node := range nodes {
+		delete(e.index, e.idPolicy.key(node.ID))
+	}
+	for i, node := range nodes {
+		e.setNodeID(node, ids[i])
+		key := e.idPolicy.key(ids[i])
+		if _, taken := e.index[key]; taken {
+			e.collided = true
+		}
+		e.index[key] = node
+	}
+}
+
+func (op *renameOp) remap(clones map[*XMLNode]*XMLNode) {
+	for i, node := range op.nodes {
+		op.nodes[i] = remapNode(clones, node)
+	}
+}
+
+func (op *renameOp) sizeBytes() int {
+	size := 0
+	for i := range op.old {
+		size += len(op.old[i]) + len(op.new[i])
+	}
+	return size
+}
+
+// rootOp swaps in a whole tree; RedoStashed uses it to return to the state a
+// stashed redo branch was recorded against.
+type rootOp struct {
+	old, new         *XMLNode
+	oldSize, newSize int
+}
+
+func (op *rootOp) apply(e *XMLEditor) {
+	e.setRoot(op.new, op.newSize)
+}
+
+func (op *rootOp) revert(e *XMLEditor) {
+	e.setRoot(op.old, op.oldSize)
+}
+
+func (e *XMLEditor) setRoot(root *XMLNode, size int) {
+	root.Parent = nil
+	index := map[string]*XMLNode{}
+	if rebuildIndex(root, index, e.idPolicy) {
+		e.collided = true
+	}
+	e.root = root
+	e.index = index
+	e.size = size
+}
+
+func (op *rootOp) remap(clones map[*XMLNode]*XMLNode) {
+	op.old = remapNode(clones, op.old)
+	op.new = remapNode(clones, op.new)
+}
+
+// sizeBytes counts the larger tree, since whichever one is not live is retained.
+func (op *rootOp) sizeBytes() int {
+	return max(op.oldSize, op.newSize)
+}
+
+func remapNode(clones map[*XMLNode]*XMLNode, node *XMLNode) *XMLNode {
+	if clone, ok := clones[node]; ok {
+		return clone
+	}
+	return node
+}
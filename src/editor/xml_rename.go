@@ -0,0 +1,76 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PlanIDRenames lists the renames RenameIDs would apply: every ID in the
+// subtree under rootID that starts with oldPrefix gets newPrefix instead.
+// It fails if any resulting ID would collide with an ID that remains.
+func (e *XMLEditor) PlanIDRenames(rootID, oldPrefix, newPrefix string) ([]IDRename, error) {
+	root, ok := e.lookup(rootID)
+	if !ok {
+		return nil, fmt.Errorf("元素不存在: %s", rootID)
+	}
+	var plan []IDRename
+	var walk func(node *XMLNode)
+	walk = func(node *XMLNode) {
+		if rest, ok := strings.CutPrefix(node.ID, oldPrefix); ok {
+			plan = append(plan, IDRename{Old: node.ID, New: newPrefix + rest})
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	renamed := map[*XMLNode]bool{}
+	for _, r := range plan {
+		node, _ := e.lookup(r.Old)
+		renamed[node] = true
+	}
+	for _, r := range plan {
+		if r.Old == r.New {
+			continue
+		}
+		if r.New == "" {
+			return nil, fmt.Errorf("重命名后 ID 为空: %s", r.Old)
+		}
+		if node, _ := e.lookup(r.Old); node.Parent == nil {
+			return nil, errors.New("不允许修改根元素 ID")
+		}
+		if existing, exists := e.lookup(r.New); exists && !renamed[existing] {
+			return nil, fmt.Errorf("目标 ID 已存在: %s (由 %s 重命名而来)", describeID(r.New, existing.ID), r.Old)
+		}
+	}
+	return plan, nil
+}
+
+// RenameIDs applies PlanIDRenames as one undoable edit and returns the
+// number of IDs changed. Nothing changes when the plan is refused.
+func (e *XMLEditor) RenameIDs(rootID, oldPrefix, newPrefix string) (int, error) {
+	plan, err := e.PlanIDRenames(rootID, oldPrefix, newPrefix)
+	if err != nil {
+		return 0, err
+	}
+	var nodes []*XMLNode
+	var ids []string
+	for _, r := range plan {
+		if r.Old != r.New {
+			node, _ := e.lookup(r.Old)
+			nodes = append(nodes, node)
+			ids = append(ids, r.New)
+		}
+	}
+	err = e.execute("rename-ids", func() error {
+		if len(nodes) > 0 {
+			e.do(newRenameOp(nodes, ids))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(nodes), nil
+}
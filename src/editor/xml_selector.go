@@ -0,0 +1,158 @@
+package editor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selector prefixes; any other element reference is a plain ID.
+const (
+	tagSelectorPrefix  = "@tag="
+	attrSelectorPrefix = "@attr:"
+)
+
+// Selector picks elements by tag or by attribute value instead of by ID.
+type Selector struct {
+	// Tag is set for @tag=<tag> selectors.
+	Tag string
+	// Attr and Value are set for @attr:<name>=<value> selectors.
+	Attr  string
+	Value string
+	// Index is the 1-based position among matches; 0 requires a unique match.
+	Index int
+}
+
+// IsSelector reports whether ref uses selector syntax rather than naming an ID.
+func IsSelector(ref string) bool {
+	return strings.HasPrefix(ref, tagSelectorPrefix) || strings.HasPrefix(ref, attrSelectorPrefix)
+}
+
+// ParseSelector parses @tag=<tag>[n] and @attr:<name>=<value>[n].
+func ParseSelector(text string) (Selector, error) {
+	invalid := fmt.Errorf("选择器格式无效: %s (应为 @tag=<tag>[n] 或 @attr:<name>=<value>[n])", text)
+	body, index, err := splitSelectorIndex(text)
+	if err != nil {
+		return Selector{}, err
+	}
+	sel := Selector{Index: index}
+	switch {
+	case strings.HasPrefix(body, tagSelectorPrefix):
+		sel.Tag = strings.TrimPrefix(body, tagSelectorPrefix)
+		if sel.Tag == "" || strings.ContainsAny(sel.Tag, "=[]") {
+			return Selector{}, invalid
+		}
+	case strings.HasPrefix(body, attrSelectorPrefix):
+		name, value, ok := strings.Cut(strings.TrimPrefix(body, attrSelectorPrefix), "=")
+		if !ok || name == "" {
+			return Selector{}, invalid
+		}
+		sel.Attr, sel.Value = name, value
+	default:
+		return Selector{}, invalid
+	}
+	return sel, nil
+}
+
+// splitSelectorIndex strips a trailing [n] and returns it, or 0 when absent.
+func splitSelectorIndex(text string) (string, int, error) {
+	if !strings.HasSuffix(text, "]") {
+		return text, 0, nil
+	}
+	open := strings.LastIndex(text, "[")
+	if open < 0 {
+		return "", 0, fmt.Errorf("选择器格式无效: %s (应为 @tag=<tag>[n] 或 @attr:<name>=<value>[n])", text)
+	}
+	index, err := strconv.Atoi(text[open+1 : len(text)-1])
+	if err != nil || index < 1 {
+		return "", 0, fmt.Errorf("选择器序号无效: %s (应为从 1 开始的整数)", text)
+	}
+	return text[:open], index, nil
+}
+
+// String renders the selector in the syntax ParseSelector accepts.
+func (s Selector) String() string {
+	text := tagSelectorPrefix + s.Tag
+	if s.Attr != "" {
+		text = attrSelectorPrefix + s.Attr + "=" + s.Value
+	}
+	if s.Index > 0 {
+		text += "[" + strconv.Itoa(s.Index) + "]"
+	}
+	return text
+}
+
+// matches reports whether node satisfies the selector, ignoring Index.
+func (s Selector) matches(node *XMLNode) bool {
+	if s.Attr == "" {
+		return node.Tag == s.Tag
+	}
+	idx, ok := node.attrIndex[s.Attr]
+	return ok && node.Attributes[idx].Value == s.Value
+}
+
+// Resolve returns a snapshot of the element named by a plain ID or a selector.
+func (e *XMLEditor) Resolve(selector string) (ElementView, error) {
+	node, err := e.element(selector, "元素不存在")
+	if err != nil {
+		return ElementView{}, err
+	}
+	return newElementView(node, nodeDepth(node)), nil
+}
+
+// element resolves ref; a plain ID that is not found reports missing.
+func (e *XMLEditor) element(ref, missing string) (*XMLNode, error) {
+	if !IsSelector(ref) {
+		node, ok := e.lookup(ref)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s", missing, ref)
+		}
+		return node, nil
+	}
+	sel, err := ParseSelector(ref)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*XMLNode
+	collectMatches(e.root, sel, &matches)
+	switch {
+	case len(matches) == 0:
+		return nil, fmt.Errorf("没有匹配选择器的元素: %s", ref)
+	case sel.Index > len(matches):
+		return nil, fmt.Errorf("选择器 %s 超出范围: 仅有 %d 个匹配元素", ref, len(matches))
+	case sel.Index > 0:
+		return matches[sel.Index-1], nil
+	case len(matches) > 1:
+		ids := make([]string, len(matches))
+		for i, node := range matches {
+			ids[i] = node.ID
+		}
+		return nil, fmt.Errorf("选择器 %s 匹配多个元素: %s (可用 [n] 指定第几个)", ref, strings.Join(ids, ", "))
+	}
+	return matches[0], nil
+}
+
+func collectMatches(node *XMLNode, sel Selector, acc *[]*XMLNode) {
+	if node == nil {
+		return
+	}
+	if sel.matches(node) {
+		*acc = append(*acc, node)
+	}
+	for _, child := range node.Children {
+		collectMatches(child, sel, acc)
+	}
+}
+
+// ElementPath lists the element named by ref and its ancestors, root first.
+func (e *XMLEditor) ElementPath(ref string) ([]XMLElementRef, error) {
+	node, err := e.element(ref, "元素不存在")
+	if err != nil {
+		return nil, err
+	}
+	var path []XMLElementRef
+	for ; node != nil; node = node.Parent {
+		path = append([]XMLElementRef{{ElementID: node.ID, Tag: node.Tag}}, path...)
+	}
+	return path, nil
+}
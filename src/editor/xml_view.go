@@ -0,0 +1,75 @@
+package editor
+
+// ElementView is a read-only snapshot of one element. It shares nothing with
+// the document, so changing a view never bypasses undo or the ID index.
+type ElementView struct {
+	Tag        string
+	ID         string
+	Attributes []XMLAttribute
+	Text       string
+	// Children lists the child element IDs in document order.
+	Children []string
+	// Depth is 1 for the root element.
+	Depth int
+}
+
+// Attr returns the value of the named attribute.
+func (v ElementView) Attr(name string) (string, bool) {
+	for _, attr := range v.Attributes {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// Element returns a snapshot of the element with the given ID.
+func (e *XMLEditor) Element(id string) (ElementView, bool) {
+	node, ok := e.lookup(id)
+	if !ok {
+		return ElementView{}, false
+	}
+	return newElementView(node, nodeDepth(node)), true
+}
+
+// Walk visits a snapshot of every element in document order until fn
+// returns false.
+func (e *XMLEditor) Walk(fn func(ElementView) bool) {
+	var visit func(node *XMLNode, depth int) bool
+	visit = func(node *XMLNode, depth int) bool {
+		if !fn(newElementView(node, depth)) {
+			return false
+		}
+		for _, child := range node.Children {
+			if !visit(child, depth+1) {
+				return false
+			}
+		}
+		return true
+	}
+	if e.root != nil {
+		visit(e.root, 1)
+	}
+}
+
+func newElementView(node *XMLNode, depth int) ElementView {
+	view := ElementView{
+		Tag:        node.Tag,
+		ID:         node.ID,
+		Attributes: append([]XMLAttribute(nil), node.Attributes...),
+		Text:       node.Text,
+		Depth:      depth,
+	}
+	for _, child := range node.Children {
+		view.Children = append(view.Children, child.ID)
+	}
+	return view
+}
+
+func nodeDepth(node *XMLNode) int {
+	depth := 0
+	for ; node != nil; node = node.Parent {
+		depth++
+	}
+	return depth
+}
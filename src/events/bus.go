@@ -2,6 +2,7 @@ package events
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,16 +12,48 @@ type EventType string
 const (
 	// EventCommandExecuted is emitted after a command completes.
 	EventCommandExecuted EventType = "command_executed"
+	// EventHistoryTruncated is emitted when an edit discards the redo stack.
+	EventHistoryTruncated EventType = "history_truncated"
+	// EventOperationStarted is emitted when a long operation begins.
+	EventOperationStarted EventType = "operation_started"
+	// EventOperationProgress is emitted after each step of a long operation.
+	EventOperationProgress EventType = "operation_progress"
+	// EventOperationFinished is emitted once when a long operation ends,
+	// with Metadata["error"] set if it failed.
+	EventOperationFinished EventType = "operation_finished"
+	// EventAutosaved is emitted after autosave tried to save a file, with
+	// Metadata["error"] set if it failed.
+	EventAutosaved EventType = "autosaved"
+	// EventFileChangedOnDisk is emitted when the watcher sees an unmodified
+	// editor's file change on disk, with Metadata["state"] set to "modified"
+	// or "deleted".
+	EventFileChangedOnDisk EventType = "file_changed_on_disk"
 )
 
 // Event captures domain happenings for observers.
 type Event struct {
+	Seq       uint64
 	Type      EventType
 	Timestamp time.Time
 	Command   string
 	Raw       string
 	File      string
 	Metadata  map[string]string
+	// Operation identifies a long operation across its lifecycle events.
+	Operation string
+	// Done and Total count the steps of a long operation.
+	Done  int
+	Total int
+	// Files lists the files a long operation covers.
+	Files []string
+}
+
+// sequence orders events process-wide, independent of clock resolution.
+var sequence atomic.Uint64
+
+// CurrentSeq reports the sequence number of the most recently published event.
+func CurrentSeq() uint64 {
+	return sequence.Load()
 }
 
 // Listener consumes published events.
@@ -46,8 +79,13 @@ func (b *Bus) Subscribe(listener Listener) {
 	b.listeners = append(b.listeners, listener)
 }
 
-// Publish sends an event to listeners.
+// Publish stamps the next sequence number and sends the event to listeners.
+// Publishing on a nil bus does nothing.
 func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	event.Seq = sequence.Add(1)
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	for _, l := range b.listeners {
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// operationSeq numbers operations so concurrent runs of one kind stay apart.
+var operationSeq atomic.Uint64
+
+// Operation publishes the lifecycle events of one long operation.
+type Operation struct {
+	bus      *Bus
+	id       string
+	name     string
+	files    []string
+	done     int
+	total    int
+	finished bool
+}
+
+// StartOperation publishes EventOperationStarted for an operation named name
+// that takes total steps over files. The caller must call Finish.
+func (b *Bus) StartOperation(name string, files []string, total int) *Operation {
+	op := &Operation{
+		bus:   b,
+		id:    fmt.Sprintf("%s-%d", name, operationSeq.Add(1)),
+		name:  name,
+		files: files,
+		total: total,
+	}
+	op.publish(EventOperationStarted, "", nil)
+	return op
+}
+
+// ID identifies the operation in its events.
+func (o *Operation) ID() string {
+	return o.id
+}
+
+// Step records one finished step, naming the file it worked on if any.
+func (o *Operation) Step(file string) {
+	o.done++
+	o.publish(EventOperationProgress, file, nil)
+}
+
+// Finish publishes EventOperationFinished, recording err if the operation
+// failed. Later calls do nothing, so it is safe to defer.
+func (o *Operation) Finish(err error) {
+	if o.finished {
+		return
+	}
+	o.finished = true
+	var metadata map[string]string
+	if err != nil {
+		metadata = map[string]string{"error": err.Error()}
+	}
+	o.publish(EventOperationFinished, "", metadata)
+}
+
+func (o *Operation) publish(kind EventType, file string, metadata map[string]string) {
+	o.bus.Publish(Event{
+		Type:      kind,
+		Timestamp: time.Now(),
+		Command:   o.name,
+		File:      file,
+		Metadata:  metadata,
+		Operation: o.id,
+		Done:      o.done,
+		Total:     o.total,
+		Files:     o.files,
+	})
+}
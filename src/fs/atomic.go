@@ -0,0 +1,47 @@
+package fs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic replaces path with what write produces. The data goes to a
+// temporary file in the same directory, is synced, and is then renamed over
+// path, so a failure at any stage leaves the original file untouched. A
+// symlinked path has its target replaced.
+func WriteAtomic(path string, mode os.FileMode, write func(io.Writer) error) (err error) {
+	target := path
+	if info, statErr := os.Lstat(path); statErr == nil && info.Mode()&os.ModeSymlink != 0 {
+		if resolved, evalErr := filepath.EvalSymlinks(path); evalErr == nil {
+			target = resolved
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("保存 %s 失败: 无法创建临时文件: %w", path, err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if err := write(tmp); err != nil {
+		return fmt.Errorf("保存 %s 失败: 写入内容出错: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("保存 %s 失败: 同步到磁盘出错: %w", path, err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("保存 %s 失败: 无法设置权限: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("保存 %s 失败: 关闭临时文件出错: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("保存 %s 失败: 无法替换原文件: %w", path, err)
+	}
+	return nil
+}
@@ -8,56 +8,190 @@ import (
 	"strings"
 )
 
-// Tree renders a directory tree rooted at path.
-func Tree(path string) (string, error) {
-	abs, err := filepath.Abs(path)
+// Node is one entry of a scanned directory tree.
+type Node struct {
+	Name     string      `json:"name"`
+	IsDir    bool        `json:"isDir"`
+	Size     int64       `json:"size,omitempty"`
+	Mode     os.FileMode `json:"mode,omitempty"`
+	Err      string      `json:"error,omitempty"`
+	Children []*Node     `json:"children,omitempty"`
+	// Truncated marks a directory at the depth limit whose entries were not read.
+	Truncated bool `json:"truncated,omitempty"`
+	// Note is the text Options.Annotate returned for a file.
+	Note string `json:"note,omitempty"`
+}
+
+// Options controls scanning and rendering of directory trees.
+type Options struct {
+	// Stat records size and mode for every entry.
+	Stat bool
+	// Numbered prefixes file entries with their 1-based index in Files order.
+	Numbered bool
+	// MaxDepth limits how many levels below the root are read; directories
+	// at the limit are marked Truncated. 0 means no limit.
+	MaxDepth int
+	// SkipHidden leaves out files and directories whose names start with a dot.
+	SkipHidden bool
+	// Sizes shows each file's size after its name.
+	Sizes bool
+	// Annotate is called with the absolute path of every file; a non-empty
+	// result is shown after the file name.
+	Annotate func(path string) string
+}
+
+// Tree renders a directory tree rooted at path; zero options list every
+// entry at every depth.
+func Tree(path string, opts Options) (string, error) {
+	node, err := Scan(path, opts)
 	if err != nil {
 		return "", err
 	}
+	return Render(node, opts), nil
+}
+
+// Scan builds the directory tree rooted at path.
+func Scan(path string, opts Options) (*Node, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
 	info, err := os.Stat(abs)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if !info.IsDir() {
-		return "", fmt.Errorf("%s 不是目录", path)
+		return nil, fmt.Errorf("%s 不是目录", path)
+	}
+	root := &Node{Name: filepath.Base(abs), IsDir: true}
+	if opts.Stat {
+		root.Mode = info.Mode()
 	}
 	entries, err := readEntries(abs)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if len(entries) == 0 {
-		return "", nil
+	root.Children = scanEntries(abs, entries, opts, 1)
+	return root, nil
+}
+
+// scanEntries builds the nodes for entries, which sit depth levels below the root.
+func scanEntries(parent string, entries []os.DirEntry, opts Options, depth int) []*Node {
+	nodes := make([]*Node, 0, len(entries))
+	for _, entry := range entries {
+		if opts.SkipHidden && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		node := &Node{Name: entry.Name(), IsDir: entry.IsDir()}
+		if opts.Stat || opts.Sizes {
+			if info, err := entry.Info(); err == nil {
+				if opts.Stat {
+					node.Mode = info.Mode()
+				}
+				if !entry.IsDir() {
+					node.Size = info.Size()
+				}
+			}
+		}
+		switch {
+		case !entry.IsDir():
+			if opts.Annotate != nil {
+				node.Note = opts.Annotate(filepath.Join(parent, entry.Name()))
+			}
+		case opts.MaxDepth > 0 && depth >= opts.MaxDepth:
+			node.Truncated = true
+		default:
+			childPath := filepath.Join(parent, entry.Name())
+			childEntries, err := readEntries(childPath)
+			if err != nil {
+				node.Err = err.Error()
+			} else {
+				node.Children = scanEntries(childPath, childEntries, opts, depth+1)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// Render draws the children of node as an indented tree.
+func Render(node *Node, opts Options) string {
+	if node == nil || len(node.Children) == 0 {
+		return ""
 	}
 	var lines []string
-	for i, entry := range entries {
-		last := i == len(entries)-1
-		lines = append(lines, formatEntry(entry, abs, "", last)...)
+	index := 0
+	for i, child := range node.Children {
+		last := i == len(node.Children)-1
+		lines = append(lines, formatNode(child, "", last, opts, &index)...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Files lists the files under node as paths joined onto dir, in the order
+// Render numbers them.
+func Files(node *Node, dir string) []string {
+	var files []string
+	for _, child := range node.Children {
+		path := filepath.Join(dir, child.Name)
+		if child.IsDir {
+			files = append(files, Files(child, path)...)
+		} else {
+			files = append(files, path)
+		}
 	}
-	return strings.Join(lines, "\n"), nil
+	return files
 }
 
-func formatEntry(entry os.DirEntry, parent, prefix string, last bool) []string {
+func formatNode(node *Node, prefix string, last bool, opts Options, index *int) []string {
 	connector := "├── "
 	nextPrefix := prefix + "│   "
 	if last {
 		connector = "└── "
 		nextPrefix = prefix + "    "
 	}
-	line := fmt.Sprintf("%s%s%s", prefix, connector, entry.Name())
+	name := node.Name
+	if opts.Numbered && !node.IsDir {
+		*index++
+		name = fmt.Sprintf("[%d] %s", *index, name)
+	}
+	if node.Truncated {
+		name += "/..."
+	}
+	if opts.Sizes && !node.IsDir {
+		name += " (" + FormatSize(node.Size) + ")"
+	}
+	if node.Note != "" {
+		name += " " + node.Note
+	}
+	line := fmt.Sprintf("%s%s%s", prefix, connector, name)
 	lines := []string{line}
-	if entry.IsDir() {
-		childEntries, err := readEntries(filepath.Join(parent, entry.Name()))
-		if err != nil {
-			return append(lines, fmt.Sprintf("%s%s<error: %v>", nextPrefix, "├── ", err))
-		}
-		for i, child := range childEntries {
-			childLast := i == len(childEntries)-1
-			lines = append(lines, formatEntry(child, filepath.Join(parent, entry.Name()), nextPrefix, childLast)...)
-		}
+	if node.Err != "" {
+		return append(lines, fmt.Sprintf("%s%s<error: %s>", nextPrefix, "├── ", node.Err))
+	}
+	for i, child := range node.Children {
+		childLast := i == len(node.Children)-1
+		lines = append(lines, formatNode(child, nextPrefix, childLast, opts, index)...)
 	}
 	return lines
 }
 
+// FormatSize renders a byte count with one decimal in the largest fitting
+// unit, e.g. 512B, 1.2KB or 3.4MB.
+func FormatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%dB", size)
+	}
+	value := float64(size) / 1024
+	units := []string{"KB", "MB", "GB", "TB"}
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
+
 func readEntries(path string) ([]os.DirEntry, error) {
 	entries, err := os.ReadDir(path)
 	if err != nil {
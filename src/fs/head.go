@@ -0,0 +1,34 @@
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Head reads up to n lines from the start of path without loading the rest
+// of the file; more reports whether the file goes on.
+func Head(path string, n int) (lines []string, more bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if info.IsDir() {
+		return nil, false, fmt.Errorf("%s 是目录", path)
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		if len(lines) == n {
+			return lines, true, nil
+		}
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	return lines, false, scanner.Err()
+}
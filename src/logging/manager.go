@@ -3,6 +3,7 @@ package logging
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -15,24 +16,53 @@ import (
 
 const timeLayout = "20060102 15:04:05"
 
+// sessionHeader starts every session written to a log file.
+const sessionHeader = "session start at "
+
 // Manager coordinates file-based logging as an observer.
 type Manager struct {
 	mu             sync.Mutex
 	enabled        map[string]bool
 	sessionStarted map[string]bool
+	// explicit records user decisions (on/off); marker-driven logging is not recorded.
+	explicit  map[string]bool
+	errWriter io.Writer
+	// operations enables start and finish lines for long operations.
+	operations bool
 }
 
-// NewManager builds a Manager.
+// NewManager builds a Manager reporting warnings to stderr.
 func NewManager() *Manager {
 	return &Manager{
 		enabled:        map[string]bool{},
 		sessionStarted: map[string]bool{},
+		explicit:       map[string]bool{},
+		errWriter:      os.Stderr,
 	}
 }
 
-// Handle consumes command events for logging.
+// SetErrorWriter redirects log warnings.
+func (m *Manager) SetErrorWriter(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errWriter = w
+}
+
+// SetOperationLogging toggles logging the start and finish of long
+// operations to the enabled files they cover.
+func (m *Manager) SetOperationLogging(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.operations = enabled
+}
+
+// Handle consumes command, autosave and operation events for logging.
 func (m *Manager) Handle(evt events.Event) {
-	if evt.Type != events.EventCommandExecuted || evt.File == "" {
+	if evt.Type == events.EventOperationStarted || evt.Type == events.EventOperationFinished {
+		m.handleOperation(evt)
+		return
+	}
+	if evt.Type != events.EventCommandExecuted && evt.Type != events.EventAutosaved || evt.File == "" {
 		return
 	}
 	m.mu.Lock()
@@ -41,12 +71,47 @@ func (m *Manager) Handle(evt events.Event) {
 	if !enabled {
 		return
 	}
-	if err := m.append(evt.File, fmt.Sprintf("%s %s", evt.Timestamp.Format(timeLayout), evt.Raw)); err != nil {
-		fmt.Printf("[log warning] %v\n", err)
+	command := evt.Raw
+	if canonical := evt.Metadata["canonical"]; canonical != "" {
+		command = canonical
+	}
+	if evt.Type == events.EventAutosaved {
+		command = "autosave"
+		if reason := evt.Metadata["error"]; reason != "" {
+			command += " 失败: " + reason
+		}
+	}
+	if err := m.append(evt.File, fmt.Sprintf("%s %s", evt.Timestamp.Format(timeLayout), command)); err != nil {
+		m.warn(err)
 	}
 }
 
-// Enable activates logging for a file.
+func (m *Manager) handleOperation(evt events.Event) {
+	m.mu.Lock()
+	var targets []string
+	if m.operations {
+		for _, file := range evt.Files {
+			if m.enabled[file] {
+				targets = append(targets, file)
+			}
+		}
+	}
+	m.mu.Unlock()
+	line := fmt.Sprintf("%s [%s] 开始 (%d 项)", evt.Timestamp.Format(timeLayout), evt.Operation, evt.Total)
+	if evt.Type == events.EventOperationFinished {
+		line = fmt.Sprintf("%s [%s] 完成 (%d/%d 项)", evt.Timestamp.Format(timeLayout), evt.Operation, evt.Done, evt.Total)
+		if reason := evt.Metadata["error"]; reason != "" {
+			line = fmt.Sprintf("%s [%s] 失败 (%d/%d 项): %s", evt.Timestamp.Format(timeLayout), evt.Operation, evt.Done, evt.Total, reason)
+		}
+	}
+	for _, file := range targets {
+		if err := m.append(file, line); err != nil {
+			m.warn(err)
+		}
+	}
+}
+
+// Enable activates logging for a file as an explicit user decision.
 func (m *Manager) Enable(path string) error {
 	abs, err := filepath.Abs(path)
 	if err != nil {
@@ -54,18 +119,39 @@ func (m *Manager) Enable(path string) error {
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.explicit[abs] = true
+	m.enableLocked(abs)
+	return nil
+}
+
+// AutoEnable activates logging requested by a file marker unless the user
+// already decided for that file.
+func (m *Manager) AutoEnable(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, decided := m.explicit[abs]; decided {
+		return nil
+	}
+	m.enableLocked(abs)
+	return nil
+}
+
+func (m *Manager) enableLocked(abs string) {
 	m.enabled[abs] = true
 	if !m.sessionStarted[abs] {
-		if err := m.append(abs, fmt.Sprintf("session start at %s", time.Now().Format(timeLayout))); err != nil {
-			fmt.Printf("[log warning] %v\n", err)
+		if err := m.append(abs, sessionHeader+time.Now().Format(timeLayout)); err != nil {
+			fmt.Fprintf(m.errWriter, "[log warning] %v\n", err)
 		} else {
 			m.sessionStarted[abs] = true
 		}
 	}
-	return nil
 }
 
-// Disable turns off logging for a file.
+// Disable turns off logging for a file as an explicit user decision.
 func (m *Manager) Disable(path string) error {
 	abs, err := filepath.Abs(path)
 	if err != nil {
@@ -73,10 +159,68 @@ func (m *Manager) Disable(path string) error {
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.explicit[abs] = false
 	delete(m.enabled, abs)
 	return nil
 }
 
+// Rename carries the logging decision for oldPath over to newPath, starting
+// a session in the new file's log when logging was on.
+func (m *Manager) Rename(oldPath, newPath string) error {
+	oldAbs, err := filepath.Abs(oldPath)
+	if err != nil {
+		return err
+	}
+	newAbs, err := filepath.Abs(newPath)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if decision, ok := m.explicit[oldAbs]; ok {
+		m.explicit[newAbs] = decision
+		delete(m.explicit, oldAbs)
+	}
+	if m.enabled[oldAbs] {
+		delete(m.enabled, oldAbs)
+		m.enableLocked(newAbs)
+	}
+	return nil
+}
+
+// Move follows a file renamed on disk: its log file is renamed along with it
+// when logging is on, and the logging decision carries over.
+func (m *Manager) Move(oldPath, newPath string) error {
+	oldAbs, err := filepath.Abs(oldPath)
+	if err != nil {
+		return err
+	}
+	newAbs, err := filepath.Abs(newPath)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.enabled[oldAbs] {
+		oldLog, _ := LogFilePath(oldAbs)
+		newLog, _ := LogFilePath(newAbs)
+		if err := os.Rename(oldLog, newLog); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(m.enabled, oldAbs)
+		m.enabled[newAbs] = true
+	}
+	if decision, ok := m.explicit[oldAbs]; ok {
+		m.explicit[newAbs] = decision
+		delete(m.explicit, oldAbs)
+	}
+	if m.sessionStarted[oldAbs] {
+		m.sessionStarted[newAbs] = true
+		delete(m.sessionStarted, oldAbs)
+	}
+	return nil
+}
+
 // Enabled returns whether logging is active for a path.
 func (m *Manager) Enabled(path string) bool {
 	abs, err := filepath.Abs(path)
@@ -88,11 +232,30 @@ func (m *Manager) Enabled(path string) bool {
 	return m.enabled[abs]
 }
 
-// Restore hydrates manager state from saved entries.
-func (m *Manager) Restore(paths []string) {
-	for _, p := range paths {
+// Restore replays saved explicit decisions; they take precedence over file markers.
+func (m *Manager) Restore(enabled, disabled []string) {
+	for _, p := range enabled {
 		_ = m.Enable(p)
 	}
+	for _, p := range disabled {
+		_ = m.Disable(p)
+	}
+}
+
+// ExplicitPaths lists files the user explicitly switched logging on or off for.
+func (m *Manager) ExplicitPaths() (enabled, disabled []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for path, on := range m.explicit {
+		if on {
+			enabled = append(enabled, path)
+		} else {
+			disabled = append(disabled, path)
+		}
+	}
+	sort.Strings(enabled)
+	sort.Strings(disabled)
+	return enabled, disabled
 }
 
 // ActivePaths lists currently enabled files.
@@ -118,6 +281,22 @@ func LogFilePath(source string) (string, error) {
 	return filepath.Join(dir, fmt.Sprintf(".%s.log", name)), nil
 }
 
+// IsLogFile reports whether path holds a log written by Manager, that is
+// one whose first line is a session header.
+func IsLogFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, sessionHeader) {
+		return false
+	}
+	_, err = time.Parse(timeLayout, strings.TrimSuffix(line[len(sessionHeader):], "\n"))
+	return err == nil
+}
+
 // Show prints the log contents for a file.
 func (m *Manager) Show(path string) (string, error) {
 	logPath, err := LogFilePath(path)
@@ -131,6 +310,12 @@ func (m *Manager) Show(path string) (string, error) {
 	return string(data), nil
 }
 
+func (m *Manager) warn(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(m.errWriter, "[log warning] %v\n", err)
+}
+
 func (m *Manager) append(sourcePath, line string) error {
 	logPath, err := LogFilePath(sourcePath)
 	if err != nil {
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"softwaredesign/src/workspace"
+)
+
+// Server exposes a read-only HTTP view of the workspace.
+type Server struct {
+	ws   *workspace.Workspace
+	http *http.Server
+}
+
+type statusView struct {
+	BaseDir  string `json:"baseDir"`
+	Open     int    `json:"open"`
+	Modified int    `json:"modified"`
+	Active   string `json:"active"`
+}
+
+type fileView struct {
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	Modified   bool   `json:"modified"`
+	Active     bool   `json:"active"`
+	DurationMs int64  `json:"durationMs"`
+	Duration   string `json:"duration"`
+}
+
+type contentView struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+type errorView struct {
+	Error string `json:"error"`
+}
+
+// New creates a server for ws.
+func New(ws *workspace.Workspace) *Server {
+	s := &Server{ws: ws}
+	s.http = &http.Server{Handler: s.Handler()}
+	return s
+}
+
+// Handler returns the HTTP routes served by s.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/files", s.handleFiles)
+	mux.HandleFunc("/files/", s.handleContent)
+	return readOnly(mux)
+}
+
+// Start listens on addr and serves in the background.
+func (s *Server) Start(addr string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_ = s.http.Serve(listener)
+	}()
+	return listener.Addr(), nil
+}
+
+// Shutdown stops accepting requests and waits for active ones to finish.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.http.Shutdown(ctx)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var view statusView
+	s.ws.View(func() {
+		summary := s.ws.Summary()
+		view = statusView{BaseDir: summary.BaseDir, Open: summary.Open, Modified: summary.Modified, Active: summary.Active}
+	})
+	writeJSON(w, http.StatusOK, view)
+}
+
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	var infos []workspace.Info
+	s.ws.View(func() {
+		infos = s.ws.List()
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Path < infos[j].Path
+	})
+	views := make([]fileView, 0, len(infos))
+	for _, info := range infos {
+		views = append(views, fileView{
+			Path:       info.Path,
+			Name:       info.Name,
+			Modified:   info.Modified,
+			Active:     info.Active,
+			DurationMs: info.Duration.Milliseconds(),
+			Duration:   info.Duration.String(),
+		})
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (s *Server) handleContent(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), "/files/")
+	escaped, ok := strings.CutSuffix(rest, "/content")
+	if !ok || escaped == "" {
+		writeJSON(w, http.StatusNotFound, errorView{Error: "未知路径"})
+		return
+	}
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorView{Error: err.Error()})
+		return
+	}
+	var (
+		view    contentView
+		lookErr error
+	)
+	s.ws.View(func() {
+		ed, err := s.ws.EditorByPath(path)
+		if err != nil {
+			lookErr = err
+			return
+		}
+		content, err := ed.Content()
+		if err != nil {
+			lookErr = err
+			return
+		}
+		view = contentView{Path: ed.Path(), Content: content}
+	})
+	if lookErr != nil {
+		writeJSON(w, http.StatusNotFound, errorView{Error: lookErr.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+func readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSON(w, http.StatusMethodNotAllowed, errorView{Error: "只读服务"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
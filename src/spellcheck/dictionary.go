@@ -0,0 +1,83 @@
+package spellcheck
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"time"
+)
+
+// WordSet is a set of lower-cased words.
+type WordSet map[string]struct{}
+
+// DictionaryCache loads word lists, re-reading a file only when its
+// modification time or size changes.
+type DictionaryCache struct {
+	entries map[string]cachedDictionary
+}
+
+type cachedDictionary struct {
+	modTime time.Time
+	size    int64
+	words   WordSet
+}
+
+// NewDictionaryCache creates an empty cache.
+func NewDictionaryCache() *DictionaryCache {
+	return &DictionaryCache{entries: map[string]cachedDictionary{}}
+}
+
+// Load returns the words of the list at path: one word per line, with blank
+// lines and lines starting with # skipped.
+func (c *DictionaryCache) Load(path string) (WordSet, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(c.entries, path)
+		return nil, err
+	}
+	if cached, ok := c.entries[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.words, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	words := WordSet{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words[strings.ToLower(word)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	c.entries[path] = cachedDictionary{modTime: info.ModTime(), size: info.Size(), words: words}
+	return words, nil
+}
+
+// WithIgnored returns a service that also accepts the given words.
+func (s *Service) WithIgnored(words WordSet) *Service {
+	if s == nil || len(words) == 0 {
+		return s
+	}
+	return &Service{checker: ignoringChecker{base: s.checker, words: words}, extractors: s.extractors}
+}
+
+type ignoringChecker struct {
+	base  Checker
+	words WordSet
+}
+
+func (c ignoringChecker) Check(word string) (bool, []string) {
+	if _, ok := c.words[strings.ToLower(word)]; ok {
+		return true, nil
+	}
+	if c.base == nil {
+		return true, nil
+	}
+	return c.base.Check(word)
+}
@@ -0,0 +1,180 @@
+package spellcheck
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// WordRef locates a word by 1-based line and rune column.
+type WordRef struct {
+	Word   string
+	Line   int
+	Column int
+}
+
+// Extractor splits document lines into the words worth checking.
+type Extractor interface {
+	Extract(lines []string) []WordRef
+}
+
+// PlainExtractor treats every run of letters as a word.
+type PlainExtractor struct{}
+
+// Extract returns every word of every line.
+func (PlainExtractor) Extract(lines []string) []WordRef {
+	var refs []WordRef
+	for i, line := range lines {
+		for _, pos := range extractWordPositions(line) {
+			refs = append(refs, WordRef{Word: pos.word, Line: i + 1, Column: pos.column})
+		}
+	}
+	return refs
+}
+
+// ChunkExtractor is an Extractor that can take a document in chunks,
+// carrying state such as an open code fence from one chunk to the next.
+type ChunkExtractor interface {
+	Extractor
+	// ExtractChunk extracts the words of lines that follow a chunk which
+	// ended in state ("" at the start of a document), numbering lines from 1
+	// within the chunk, and returns the state lines end in.
+	ExtractChunk(lines []string, state string) ([]WordRef, string)
+}
+
+// MarkdownExtractor skips fenced code blocks, inline code, and link targets.
+type MarkdownExtractor struct{}
+
+// Extract returns the prose words of a Markdown document.
+func (x MarkdownExtractor) Extract(lines []string) []WordRef {
+	refs, _ := x.ExtractChunk(lines, "")
+	return refs
+}
+
+// ExtractChunk returns the prose words of lines; state is the marker of the
+// code fence open at their start, if any.
+func (MarkdownExtractor) ExtractChunk(lines []string, state string) ([]WordRef, string) {
+	var refs []WordRef
+	fence := state
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if marker := fenceMarker(trimmed); marker != "" {
+			fence = marker
+			continue
+		}
+		for _, pos := range extractWordPositions(maskMarkdownLine(line)) {
+			refs = append(refs, WordRef{Word: pos.word, Line: i + 1, Column: pos.column})
+		}
+	}
+	return refs, fence
+}
+
+func fenceMarker(line string) string {
+	for _, ch := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, ch))
+		if n >= 3 {
+			return strings.Repeat(ch, n)
+		}
+	}
+	return ""
+}
+
+// maskMarkdownLine blanks inline code spans, link destinations, and
+// autolinks so column positions of the remaining prose stay intact.
+func maskMarkdownLine(line string) string {
+	runes := []rune(line)
+	blank := func(from, to int) {
+		for k := from; k < to; k++ {
+			runes[k] = ' '
+		}
+	}
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '`':
+			run := 1
+			for i+run < len(runes) && runes[i+run] == '`' {
+				run++
+			}
+			if end := findBackticks(runes, i+run, run); end >= 0 {
+				blank(i, end+run)
+				i = end + run - 1
+			} else {
+				i += run - 1
+			}
+		case runes[i] == ']' && i+1 < len(runes) && runes[i+1] == '(':
+			if end := indexRune(runes, i+2, ')'); end >= 0 {
+				blank(i+1, end+1)
+				i = end
+			}
+		case runes[i] == ']' && i+1 < len(runes) && runes[i+1] == ':':
+			// Reference definition: [id]: https://example.com
+			blank(i+1, len(runes))
+			i = len(runes)
+		case runes[i] == '<':
+			if end := indexRune(runes, i+1, '>'); end >= 0 && strings.Contains(string(runes[i+1:end]), "://") {
+				blank(i, end+1)
+				i = end
+			}
+		}
+	}
+	return string(runes)
+}
+
+func findBackticks(runes []rune, from, run int) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] != '`' {
+			continue
+		}
+		n := 1
+		for i+n < len(runes) && runes[i+n] == '`' {
+			n++
+		}
+		if n == run {
+			return i
+		}
+		i += n - 1
+	}
+	return -1
+}
+
+func indexRune(runes []rune, from int, target rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// Registry maps file extensions to extractors.
+type Registry struct {
+	extractors map[string]Extractor
+	fallback   Extractor
+}
+
+// NewRegistry returns a registry with Markdown support and plain extraction
+// for every other extension.
+func NewRegistry() *Registry {
+	r := &Registry{extractors: map[string]Extractor{}, fallback: PlainExtractor{}}
+	r.Register(".md", MarkdownExtractor{})
+	r.Register(".markdown", MarkdownExtractor{})
+	return r
+}
+
+// Register assigns x to ext (for example ".md"), case-insensitively.
+func (r *Registry) Register(ext string, x Extractor) {
+	r.extractors[strings.ToLower(ext)] = x
+}
+
+// ForPath selects the extractor for path's extension.
+func (r *Registry) ForPath(path string) Extractor {
+	if x, ok := r.extractors[strings.ToLower(filepath.Ext(path))]; ok {
+		return x
+	}
+	return r.fallback
+}
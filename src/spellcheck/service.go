@@ -13,12 +13,18 @@ type Checker interface {
 
 // Service orchestrates spell checking across different document types.
 type Service struct {
-	checker Checker
+	checker    Checker
+	extractors *Registry
 }
 
 // NewService constructs a spell check service.
 func NewService(checker Checker) *Service {
-	return &Service{checker: checker}
+	return &Service{checker: checker, extractors: NewRegistry()}
+}
+
+// Extractors exposes the extension-to-extractor registry.
+func (s *Service) Extractors() *Registry {
+	return s.extractors
 }
 
 // TextIssue represents a finding in a plain text file.
@@ -33,6 +39,8 @@ type TextIssue struct {
 type XMLIssue struct {
 	ElementID   string
 	Word        string
+	Offset      int
+	Occurrence  int
 	Suggestions []string
 }
 
@@ -44,25 +52,42 @@ type XMLText struct {
 
 // CheckLines evaluates each line of a text document.
 func (s *Service) CheckLines(lines []string) []TextIssue {
+	return s.CheckLinesWith(PlainExtractor{}, lines)
+}
+
+// CheckLinesWith evaluates the words x extracts from a text document.
+func (s *Service) CheckLinesWith(x Extractor, lines []string) []TextIssue {
+	issues, _ := s.CheckChunkWith(x, lines, "")
+	return issues
+}
+
+// CheckChunkWith evaluates one chunk of a text document that follows a chunk
+// which left x in state, and returns the state for the next chunk. Only a
+// ChunkExtractor carries state; other extractors see each chunk afresh.
+func (s *Service) CheckChunkWith(x Extractor, lines []string, state string) ([]TextIssue, string) {
 	if s == nil || s.checker == nil {
-		return nil
+		return nil, state
+	}
+	var refs []WordRef
+	if chunked, ok := x.(ChunkExtractor); ok {
+		refs, state = chunked.ExtractChunk(lines, state)
+	} else {
+		refs = x.Extract(lines)
 	}
 	var issues []TextIssue
-	for i, line := range lines {
-		for _, pos := range extractWordPositions(line) {
-			ok, suggestions := s.checker.Check(pos.word)
-			if ok {
-				continue
-			}
-			issues = append(issues, TextIssue{
-				Line:        i + 1,
-				Column:      pos.column,
-				Word:        pos.word,
-				Suggestions: suggestions,
-			})
+	for _, ref := range refs {
+		ok, suggestions := s.checker.Check(ref.Word)
+		if ok {
+			continue
 		}
+		issues = append(issues, TextIssue{
+			Line:        ref.Line,
+			Column:      ref.Column,
+			Word:        ref.Word,
+			Suggestions: suggestions,
+		})
 	}
-	return issues
+	return issues, state
 }
 
 // CheckXMLText evaluates the text content of XML elements.
@@ -72,14 +97,18 @@ func (s *Service) CheckXMLText(nodes []XMLText) []XMLIssue {
 	}
 	var issues []XMLIssue
 	for _, entry := range nodes {
-		for _, word := range extractWords(entry.Text) {
-			ok, suggestions := s.checker.Check(word)
+		seen := map[string]int{}
+		for _, pos := range extractWordPositions(entry.Text) {
+			seen[pos.word]++
+			ok, suggestions := s.checker.Check(pos.word)
 			if ok {
 				continue
 			}
 			issues = append(issues, XMLIssue{
 				ElementID:   entry.ElementID,
-				Word:        word,
+				Word:        pos.word,
+				Offset:      pos.column - 1,
+				Occurrence:  seen[pos.word],
 				Suggestions: suggestions,
 			})
 		}
@@ -152,15 +181,6 @@ func extractWordPositions(line string) []wordPosition {
 	return result
 }
 
-func extractWords(text string) []string {
-	tokens := extractWordPositions(text)
-	words := make([]string, len(tokens))
-	for i, t := range tokens {
-		words[i] = t.word
-	}
-	return words
-}
-
 func collectSuggestions(word string, dictionary map[string]struct{}) []string {
 	type candidate struct {
 		word string
@@ -168,7 +188,7 @@ func collectSuggestions(word string, dictionary map[string]struct{}) []string {
 	}
 	var candidates []candidate
 	for dictWord := range dictionary {
-		dist := levenshtein(word, dictWord)
+		dist := Levenshtein(word, dictWord)
 		if dist <= 2 {
 			candidates = append(candidates, candidate{word: dictWord, dist: dist})
 		}
@@ -190,7 +210,8 @@ func collectSuggestions(word string, dictionary map[string]struct{}) []string {
 	return result
 }
 
-func levenshtein(a, b string) int {
+// Levenshtein returns the rune edit distance between a and b.
+func Levenshtein(a, b string) int {
 	ar := []rune(a)
 	br := []rune(b)
 	if len(ar) == 0 {
@@ -0,0 +1,120 @@
+package statistics
+
+import (
+	"sync"
+	"time"
+)
+
+// dayLayout formats the calendar day of an activity entry.
+const dayLayout = "2006-01-02"
+
+// DayActivity is one file's activity on one calendar day.
+type DayActivity struct {
+	File     string        `json:"file"`
+	Day      string        `json:"day"`
+	Duration time.Duration `json:"duration"`
+	Commands int           `json:"commands"`
+	Saves    int           `json:"saves"`
+}
+
+type activityKey struct {
+	file string
+	day  string
+}
+
+// Ledger accumulates per-file, per-day activity that outlives closing a file.
+type Ledger struct {
+	mu      sync.Mutex
+	entries map[activityKey]*DayActivity
+	clock   Clock
+}
+
+// NewLedger constructs an empty ledger with a real clock.
+func NewLedger() *Ledger {
+	return &Ledger{entries: map[activityKey]*DayActivity{}, clock: realClock{}}
+}
+
+// WithClock swaps the clock used to date commands and saves.
+func (l *Ledger) WithClock(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if clock == nil {
+		clock = realClock{}
+	}
+	l.clock = clock
+}
+
+// AddSpan records editing time between start and end, split at local midnight.
+func (l *Ledger) AddSpan(file string, start, end time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if file == "" {
+		return
+	}
+	for start.Before(end) {
+		y, m, d := start.Date()
+		midnight := time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+		stop := end
+		if midnight.Before(end) {
+			stop = midnight
+		}
+		l.entry(file, start).Duration += stop.Sub(start)
+		start = stop
+	}
+}
+
+// CountCommand records a command that targeted file.
+func (l *Ledger) CountCommand(file string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if file != "" {
+		l.entry(file, l.clock.Now()).Commands++
+	}
+}
+
+// CountSave records a save of file.
+func (l *Ledger) CountSave(file string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if file != "" {
+		l.entry(file, l.clock.Now()).Saves++
+	}
+}
+
+// Entries returns a copy of every recorded entry in no particular order.
+func (l *Ledger) Entries() []DayActivity {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := make([]DayActivity, 0, len(l.entries))
+	for _, entry := range l.entries {
+		result = append(result, *entry)
+	}
+	return result
+}
+
+// Restore adds previously persisted entries to the ledger.
+func (l *Ledger) Restore(entries []DayActivity) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, saved := range entries {
+		key := activityKey{file: saved.File, day: saved.Day}
+		entry, ok := l.entries[key]
+		if !ok {
+			entry = &DayActivity{File: saved.File, Day: saved.Day}
+			l.entries[key] = entry
+		}
+		entry.Duration += saved.Duration
+		entry.Commands += saved.Commands
+		entry.Saves += saved.Saves
+	}
+}
+
+func (l *Ledger) entry(file string, at time.Time) *DayActivity {
+	key := activityKey{file: file, day: at.Format(dayLayout)}
+	entry, ok := l.entries[key]
+	if !ok {
+		entry = &DayActivity{File: file, Day: key.day}
+		l.entries[key] = entry
+	}
+	return entry
+}
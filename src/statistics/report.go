@@ -0,0 +1,65 @@
+package statistics
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Aggregate merges entries for the same file and day and orders the rows by
+// file, then day.
+func Aggregate(entries []DayActivity) []DayActivity {
+	merged := map[activityKey]*DayActivity{}
+	for _, entry := range entries {
+		key := activityKey{file: entry.File, day: entry.Day}
+		row, ok := merged[key]
+		if !ok {
+			row = &DayActivity{File: entry.File, Day: entry.Day}
+			merged[key] = row
+		}
+		row.Duration += entry.Duration
+		row.Commands += entry.Commands
+		row.Saves += entry.Saves
+	}
+	rows := make([]DayActivity, 0, len(merged))
+	for _, row := range merged {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].File != rows[j].File {
+			return rows[i].File < rows[j].File
+		}
+		return rows[i].Day < rows[j].Day
+	})
+	return rows
+}
+
+// ReportHeader names the report columns.
+var ReportHeader = []string{"file", "date", "minutes", "commands", "saves"}
+
+// ReportRecord renders row as report column values.
+func ReportRecord(row DayActivity) []string {
+	return []string{
+		row.File,
+		row.Day,
+		strconv.FormatFloat(row.Duration.Minutes(), 'f', 1, 64),
+		strconv.Itoa(row.Commands),
+		strconv.Itoa(row.Saves),
+	}
+}
+
+// WriteCSV writes rows with a header line.
+func WriteCSV(w io.Writer, rows []DayActivity) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(ReportHeader); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := out.Write(ReportRecord(row)); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
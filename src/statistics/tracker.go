@@ -22,6 +22,7 @@ type Tracker struct {
 	active    string
 	started   time.Time
 	clock     Clock
+	ledger    *Ledger
 }
 
 // NewTracker constructs a tracker with a real clock.
@@ -43,13 +44,41 @@ func (t *Tracker) WithClock(clock Clock) {
 	t.clock = clock
 }
 
+// WithLedger also records every timed span in l, split by day.
+func (t *Tracker) WithLedger(l *Ledger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ledger = l
+}
+
+// addSpan credits the span from started to now to path.
+func (t *Tracker) addSpan(path string, now time.Time) {
+	t.durations[path] += now.Sub(t.started)
+	if t.ledger != nil {
+		t.ledger.AddSpan(path, t.started, now)
+	}
+}
+
+// Checkpoint credits the running span of the active file without stopping
+// it, so the ledger is current before it is read or persisted.
+func (t *Tracker) Checkpoint() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active == "" {
+		return
+	}
+	now := t.clock.Now()
+	t.addSpan(t.active, now)
+	t.started = now
+}
+
 // Switch transitions timing from prev to next active file.
 func (t *Tracker) Switch(prev, next string) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	now := t.clock.Now()
 	if prev != "" && t.active == prev {
-		t.durations[prev] += now.Sub(t.started)
+		t.addSpan(prev, now)
 	}
 	if next != "" {
 		if _, ok := t.durations[next]; !ok {
@@ -71,12 +100,25 @@ func (t *Tracker) Close(path string) {
 		return
 	}
 	if t.active == path {
-		t.durations[path] += now.Sub(t.started)
+		t.addSpan(path, now)
 		t.active = ""
 	}
 	delete(t.durations, path)
 }
 
+// Rename moves the duration tracked for oldPath to newPath.
+func (t *Tracker) Rename(oldPath, newPath string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d, ok := t.durations[oldPath]; ok {
+		t.durations[newPath] += d
+		delete(t.durations, oldPath)
+	}
+	if t.active == oldPath {
+		t.active = newPath
+	}
+}
+
 // StopAll flushes the active timer without clearing durations.
 func (t *Tracker) StopAll() {
 	t.mu.Lock()
@@ -84,10 +126,25 @@ func (t *Tracker) StopAll() {
 	if t.active == "" {
 		return
 	}
-	t.durations[t.active] += t.clock.Now().Sub(t.started)
+	t.addSpan(t.active, t.clock.Now())
 	t.active = ""
 }
 
+// Credit adds d to path without changing the active file, for work done on
+// a background file through an explicit file argument.
+func (t *Tracker) Credit(path string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if path == "" || d <= 0 {
+		return
+	}
+	t.durations[path] += d
+	if t.ledger != nil {
+		now := t.clock.Now()
+		t.ledger.AddSpan(path, now.Add(-d), now)
+	}
+}
+
 // Duration reports the accumulated duration for the file.
 func (t *Tracker) Duration(path string) time.Duration {
 	t.mu.Lock()
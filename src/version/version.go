@@ -0,0 +1,45 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build metadata injected at link time, e.g.
+//
+//	go build -ldflags "-X softwaredesign/src/version.Version=1.2.0 -X softwaredesign/src/version.Commit=$(git rev-parse --short HEAD) -X softwaredesign/src/version.Date=$(date -u +%Y-%m-%d)"
+var (
+	Version = "dev"
+	Commit  = "dev"
+	Date    = "dev"
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information, falling back to "dev" for unset fields.
+func Get() Info {
+	return Info{
+		Version:   fallback(Version),
+		Commit:    fallback(Commit),
+		Date:      fallback(Date),
+		GoVersion: runtime.Version(),
+	}
+}
+
+// String renders the info on one line.
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", i.Version, i.Commit, i.Date, i.GoVersion)
+}
+
+func fallback(value string) string {
+	if value == "" {
+		return "dev"
+	}
+	return value
+}
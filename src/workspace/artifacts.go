@@ -0,0 +1,144 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"softwaredesign/src/fs"
+	"softwaredesign/src/logging"
+)
+
+// ArtifactKind classifies files generated by the editor next to user files.
+type ArtifactKind string
+
+const (
+	ArtifactBackup ArtifactKind = "backup"
+	// ArtifactOrphanLog is a log written by the editor whose file no longer
+	// exists.
+	ArtifactOrphanLog ArtifactKind = "orphan-log"
+	// ArtifactTemp is a temporary file left behind by an interrupted save.
+	ArtifactTemp ArtifactKind = "temp"
+)
+
+// ArtifactKinds lists the kinds in the order clean reports them.
+var ArtifactKinds = []ArtifactKind{ArtifactBackup, ArtifactOrphanLog, ArtifactTemp}
+
+// Artifact is a generated file and the file it belongs to.
+type Artifact struct {
+	Path    string
+	Kind    ArtifactKind
+	Owner   string
+	Size    int64
+	ModTime time.Time
+}
+
+var (
+	logName  = regexp.MustCompile(`^\.(.+)\.log$`)
+	tempName = regexp.MustCompile(`^\.(.+)\.tmp-[^.]*$`)
+)
+
+// ParseAge reads a duration written as a whole number of days, hours or
+// minutes, such as 7d, 24h or 30m.
+func ParseAge(text string) (time.Duration, error) {
+	invalid := fmt.Errorf("时长格式无效: %s (例如 7d 或 24h)", text)
+	if len(text) < 2 {
+		return 0, invalid
+	}
+	n, err := strconv.Atoi(text[:len(text)-1])
+	if err != nil || n < 0 {
+		return 0, invalid
+	}
+	switch text[len(text)-1] {
+	case 'd':
+		return time.Duration(n) * 24 * time.Hour, nil
+	case 'h':
+		return time.Duration(n) * time.Hour, nil
+	case 'm':
+		return time.Duration(n) * time.Minute, nil
+	}
+	return 0, invalid
+}
+
+// MatchArtifact reports whether path is a file the editor generated and
+// which file it belongs to. A log counts as an artifact only once its file
+// is gone, and only when it starts with the editor's session header.
+func MatchArtifact(path string) (kind ArtifactKind, owner string, ok bool) {
+	dir, name := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	if filepath.Base(dir) == backupDir && len(name) > len(backupStamp)+1 {
+		stamp := name[len(name)-len(backupStamp):]
+		if _, err := time.Parse(backupStamp, stamp); err == nil && name[len(name)-len(backupStamp)-1] == '.' {
+			return ArtifactBackup, filepath.Join(filepath.Dir(dir), strings.TrimSuffix(name, "."+stamp)), true
+		}
+	}
+	if m := tempName.FindStringSubmatch(name); m != nil {
+		return ArtifactTemp, filepath.Join(dir, m[1]), true
+	}
+	if m := logName.FindStringSubmatch(name); m != nil {
+		owner := filepath.Join(dir, m[1])
+		if _, err := os.Stat(owner); errors.Is(err, os.ErrNotExist) && logging.IsLogFile(path) {
+			return ArtifactOrphanLog, owner, true
+		}
+	}
+	return "", "", false
+}
+
+// StaleArtifacts lists the generated files under the base directory last
+// modified more than olderThan ago, sorted by kind and path. Artifacts of
+// open files are left out.
+func (w *Workspace) StaleArtifacts(olderThan time.Duration) ([]Artifact, error) {
+	root, err := fs.Scan(w.baseDir, fs.Options{})
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-olderThan)
+	var result []Artifact
+	for _, path := range fs.Files(root, w.baseDir) {
+		kind, owner, ok := MatchArtifact(path)
+		if !ok {
+			continue
+		}
+		if _, open := w.editors[owner]; open {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		result = append(result, Artifact{Path: path, Kind: kind, Owner: owner, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	order := map[ArtifactKind]int{}
+	for i, kind := range ArtifactKinds {
+		order[kind] = i
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Kind != result[j].Kind {
+			return order[result[i].Kind] < order[result[j].Kind]
+		}
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// RemoveArtifacts deletes artifacts, skipping any whose file was opened
+// since they were listed, and returns how many were removed.
+func (w *Workspace) RemoveArtifacts(artifacts []Artifact) (int, error) {
+	removed := 0
+	for _, artifact := range artifacts {
+		if _, open := w.editors[artifact.Owner]; open {
+			continue
+		}
+		if err := os.Remove(artifact.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
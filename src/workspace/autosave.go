@@ -0,0 +1,161 @@
+package workspace
+
+import (
+	"errors"
+	"time"
+
+	"softwaredesign/src/events"
+)
+
+// DefaultAutosaveInterval is used when autosave is turned on without one.
+const DefaultAutosaveInterval = 30 * time.Second
+
+// pollLockRetry is how often a pending autosave or watch tick retries the
+// workspace lock while a command holds it.
+const pollLockRetry = 10 * time.Millisecond
+
+// Ticker delivers the ticks that trigger autosave and file watching.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// handledNotifier is implemented by tickers that want to know when a tick
+// has been handled (used by tests).
+type handledNotifier interface {
+	Handled()
+}
+
+// TickerFactory builds a ticker firing every interval.
+type TickerFactory func(interval time.Duration) Ticker
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+func newRealTicker(interval time.Duration) Ticker {
+	return realTicker{time.NewTicker(interval)}
+}
+
+// poller is a running background goroutine acting on each tick.
+type poller struct {
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// SetTickerFactory overrides how autosave and watch tickers are built (used
+// in tests).
+func (w *Workspace) SetTickerFactory(factory TickerFactory) {
+	if factory == nil {
+		factory = newRealTicker
+	}
+	w.newTicker = factory
+}
+
+// StartAutosave saves every modified editor each interval in the background,
+// replacing a running autosave.
+func (w *Workspace) StartAutosave(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("自动保存间隔必须大于 0")
+	}
+	w.StopAutosave()
+	w.autosave = w.startPoller(interval, w.autosaveModified)
+	return nil
+}
+
+// StopAutosave stops the autosave goroutine and waits for it to exit. It is
+// safe to call while holding the workspace lock.
+func (w *Workspace) StopAutosave() {
+	if w.autosave == nil {
+		return
+	}
+	w.autosave.halt()
+	w.autosave = nil
+}
+
+// AutosaveInterval reports the interval of the running autosave.
+func (w *Workspace) AutosaveInterval() (time.Duration, bool) {
+	if w.autosave == nil {
+		return 0, false
+	}
+	return w.autosave.interval, true
+}
+
+// startPoller runs tick under the workspace lock every interval until halted.
+func (w *Workspace) startPoller(interval time.Duration, tick func()) *poller {
+	p := &poller{interval: interval, stop: make(chan struct{}), done: make(chan struct{})}
+	ticker := w.newTicker(interval)
+	go func() {
+		defer close(p.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C():
+				if !w.lockUnlessStopped(p.stop) {
+					return
+				}
+				tick()
+				w.mu.Unlock()
+				if n, ok := ticker.(handledNotifier); ok {
+					n.Handled()
+				}
+			}
+		}
+	}()
+	return p
+}
+
+// halt stops the poller and waits for its goroutine to exit.
+func (p *poller) halt() {
+	close(p.stop)
+	<-p.done
+}
+
+// lockUnlessStopped takes the workspace lock, giving up once stop closes so
+// that a command holding the lock can stop a poller without deadlock.
+func (w *Workspace) lockUnlessStopped(stop <-chan struct{}) bool {
+	for !w.mu.TryLock() {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(pollLockRetry):
+		}
+	}
+	select {
+	case <-stop:
+		w.mu.Unlock()
+		return false
+	default:
+		return true
+	}
+}
+
+// autosaveModified saves each modified editor, publishing one event per
+// file. Failures are reported through the event and do not stop the others.
+func (w *Workspace) autosaveModified() {
+	for _, path := range w.openPaths() {
+		ed := w.editors[path]
+		if !ed.IsModified() {
+			continue
+		}
+		metadata := map[string]string{}
+		if err := w.saveEditor(ed); err != nil {
+			metadata["error"] = err.Error()
+		} else {
+			ed.SetModified(false)
+			w.ledger.CountSave(path)
+		}
+		w.bus.Publish(events.Event{
+			Type:      events.EventAutosaved,
+			Timestamp: time.Now(),
+			Command:   "autosave",
+			File:      path,
+			Metadata:  metadata,
+		})
+	}
+}
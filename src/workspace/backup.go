@@ -0,0 +1,170 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"softwaredesign/src/charset"
+	"softwaredesign/src/editor"
+)
+
+// backupDir is the directory, next to each file, holding its backups.
+const backupDir = ".backup"
+
+// backupStamp names backups so that they sort oldest first.
+const backupStamp = "20060102-150405.000000000"
+
+// defaultBackupCount is how many backups are kept per file.
+const defaultBackupCount = 3
+
+// backupBeforeSave copies the on-disk version of path into the backup
+// directory and prunes the oldest copies beyond the configured count. Files
+// not on disk yet have nothing to back up.
+func (w *Workspace) backupBeforeSave(path string) error {
+	if !w.backup {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(filepath.Dir(path), backupDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("无法创建备份目录: %v", err)
+	}
+	name := filepath.Base(path) + "." + time.Now().Format(backupStamp)
+	if err := os.WriteFile(filepath.Join(dir, name), data, w.fileMode); err != nil {
+		return fmt.Errorf("无法写入备份: %v", err)
+	}
+	backups, err := Backups(path)
+	if err != nil {
+		return err
+	}
+	for _, old := range backups[min(w.backupCount, len(backups)):] {
+		if err := os.Remove(old); err != nil {
+			return fmt.Errorf("无法清理旧备份: %v", err)
+		}
+	}
+	return nil
+}
+
+// Backups lists the backups of path, newest first.
+func Backups(path string) ([]string, error) {
+	dir := filepath.Join(filepath.Dir(path), backupDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(path) + "."
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(backupStamp, strings.TrimPrefix(name, prefix)); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups, nil
+}
+
+// RestoreBackup opens backup index (1 is the newest) of path in a new
+// unsaved buffer next to the file, leaving the file itself alone.
+func (w *Workspace) RestoreBackup(path string, index int) (editor.Editor, error) {
+	abs, err := w.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	backups, err := Backups(abs)
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("没有 %s 的备份", abs)
+	}
+	if index < 1 || index > len(backups) {
+		return nil, fmt.Errorf("备份编号 %d 超出范围 (1-%d)", index, len(backups))
+	}
+	data, err := os.ReadFile(backups[index-1])
+	if err != nil {
+		return nil, err
+	}
+	target := w.siblingPath(abs, "restored")
+	var ed editor.Editor
+	if strings.ToLower(filepath.Ext(abs)) == ".xml" {
+		parsed, err := editor.ParseXMLEditorWithPolicy(target, data, w.idPolicy)
+		if err != nil {
+			return nil, err
+		}
+		parsed.SetModified(true)
+		ed = parsed
+	} else {
+		enc := charset.Detect(data)
+		if open, ok := w.editors[abs]; ok {
+			enc = encodingOf(open)
+		}
+		text, err := charset.Decode(data, enc)
+		if err != nil {
+			return nil, err
+		}
+		restored := editor.NewTextEditor(target, splitLines(text), true)
+		restored.SetEncoding(enc)
+		restored.SetLineStyle(editor.DetectLineStyle(text))
+		ed = restored
+	}
+	w.configureEditor(ed)
+	w.editors[target] = ed
+	w.setActive(target)
+	return ed, nil
+}
+
+// siblingPath picks a free name next to abs tagged with tag, such as
+// a.restored.txt for a restored backup.
+func (w *Workspace) siblingPath(abs, tag string) string {
+	ext := filepath.Ext(abs)
+	stem := strings.TrimSuffix(abs, ext)
+	candidate := stem + "." + tag + ext
+	for n := 2; ; n++ {
+		_, open := w.editors[candidate]
+		if _, err := os.Stat(candidate); !open && errors.Is(err, os.ErrNotExist) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s.%s-%d%s", stem, tag, n, ext)
+	}
+}
+
+// WriteRecovery writes the content of open file path to a free name such as
+// a.recovered.txt next to it, leaving the file and the editor alone. Exit uses
+// it when nobody can answer whether to save.
+func (w *Workspace) WriteRecovery(path string) (string, error) {
+	abs, err := w.ResolveOpen(path)
+	if err != nil {
+		return "", err
+	}
+	data, _, err := fileData(w.editors[abs])
+	if err != nil {
+		return "", err
+	}
+	target := w.siblingPath(abs, "recovered")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(target, data, w.fileMode); err != nil {
+		return "", err
+	}
+	return target, nil
+}
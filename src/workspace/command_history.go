@@ -0,0 +1,149 @@
+package workspace
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// historyFile stores the command history next to the workspace state.
+const historyFile = ".editor_history"
+
+// defaultCommandHistoryLimit caps the commands kept by a workspace.
+const defaultCommandHistoryLimit = 500
+
+// HistoryEntry is one recorded command with its history number.
+type HistoryEntry struct {
+	Number  int
+	Command string
+}
+
+// CommandHistory keeps the most recent commands in the order they ran.
+// Numbers stay stable when old entries drop past the limit.
+type CommandHistory struct {
+	entries []string
+	// first is the number of entries[0].
+	first int
+	limit int
+}
+
+// NewCommandHistory builds an empty history holding at most limit commands.
+func NewCommandHistory(limit int) *CommandHistory {
+	return &CommandHistory{first: 1, limit: limit}
+}
+
+// Add records command, dropping the oldest entries beyond the limit.
+func (h *CommandHistory) Add(command string) {
+	if command == "" {
+		return
+	}
+	h.entries = append(h.entries, command)
+	h.evict()
+}
+
+// Entries returns the recorded commands, oldest first.
+func (h *CommandHistory) Entries() []HistoryEntry {
+	result := make([]HistoryEntry, len(h.entries))
+	for i, command := range h.entries {
+		result[i] = HistoryEntry{Number: h.first + i, Command: command}
+	}
+	return result
+}
+
+// Commands returns the recorded commands without numbers, oldest first.
+func (h *CommandHistory) Commands() []string {
+	return append([]string(nil), h.entries...)
+}
+
+// Entry returns the command numbered n.
+func (h *CommandHistory) Entry(n int) (string, error) {
+	if n < h.first || n >= h.first+len(h.entries) {
+		return "", fmt.Errorf("历史记录中没有第 %d 条命令", n)
+	}
+	return h.entries[n-h.first], nil
+}
+
+// Last returns the most recent command.
+func (h *CommandHistory) Last() (string, error) {
+	if len(h.entries) == 0 {
+		return "", errors.New("历史记录为空")
+	}
+	return h.entries[len(h.entries)-1], nil
+}
+
+// Len counts the recorded commands.
+func (h *CommandHistory) Len() int {
+	return len(h.entries)
+}
+
+// SetLimit changes the cap, dropping the oldest entries beyond it.
+func (h *CommandHistory) SetLimit(limit int) {
+	h.limit = limit
+	h.evict()
+}
+
+func (h *CommandHistory) evict() {
+	if h.limit > 0 && len(h.entries) > h.limit {
+		drop := len(h.entries) - h.limit
+		h.entries = append([]string(nil), h.entries[drop:]...)
+		h.first += drop
+	}
+}
+
+// historyPath places the history file in the state file's directory.
+func (s *StateKeeper) historyPath() string {
+	return filepath.Join(filepath.Dir(s.path), historyFile)
+}
+
+// SaveHistory writes commands to the history file, one per line.
+func (s *StateKeeper) SaveHistory(commands []string) error {
+	var b strings.Builder
+	for _, command := range commands {
+		b.WriteString(command)
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(s.historyPath(), []byte(b.String()), 0o644)
+}
+
+// LoadHistory reads the history file; a missing file holds no commands.
+func (s *StateKeeper) LoadHistory() ([]string, error) {
+	file, err := os.Open(s.historyPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	var commands []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			commands = append(commands, line)
+		}
+	}
+	return commands, scanner.Err()
+}
+
+// CommandHistory exposes the commands recorded by the dispatcher.
+func (w *Workspace) CommandHistory() *CommandHistory {
+	return w.commands
+}
+
+// loadCommandHistory puts the saved commands before those of this session.
+func (w *Workspace) loadCommandHistory() error {
+	saved, err := w.keeper.LoadHistory()
+	if err != nil {
+		return err
+	}
+	current := w.commands.Commands()
+	w.commands = NewCommandHistory(w.commands.limit)
+	for _, command := range append(saved, current...) {
+		w.commands.Add(command)
+	}
+	return nil
+}
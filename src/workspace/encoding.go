@@ -0,0 +1,70 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"softwaredesign/src/charset"
+	"softwaredesign/src/editor"
+)
+
+var errXMLEncoding = errors.New("XML 文件仅支持 UTF-8 编码")
+
+// encodingOf reports the encoding ed's file is stored in.
+func encodingOf(ed editor.Editor) charset.Encoding {
+	if e, ok := ed.(editor.EncodingEditor); ok {
+		return e.Encoding()
+	}
+	return charset.UTF8
+}
+
+// readLines reads abs decoded from enc, split the way files are loaded.
+func readLines(abs string, enc charset.Encoding) ([]string, error) {
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	text, err := charset.Decode(data, enc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", abs, err)
+	}
+	return splitLines(text), nil
+}
+
+// SetEncoding changes the encoding of an open text file. With reinterpret the
+// unmodified file is read again from disk in enc; otherwise the buffer is
+// kept and marked modified so the next save converts it.
+func (w *Workspace) SetEncoding(path string, enc charset.Encoding, reinterpret bool) (editor.Editor, error) {
+	abs, err := w.ResolveOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	current := w.editors[abs]
+	target, ok := current.(editor.EncodingEditor)
+	if !ok || w.xmlAsText[abs] {
+		if enc == charset.UTF8 {
+			return current, nil
+		}
+		return nil, errXMLEncoding
+	}
+	if !reinterpret {
+		if target.Encoding() != enc {
+			target.SetEncoding(enc)
+			current.SetModified(true)
+		}
+		return current, nil
+	}
+	if current.IsModified() {
+		return nil, errors.New("文件有未保存的修改, 请先保存")
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return nil, fmt.Errorf("文件尚未保存到磁盘, 无法重新解读: %s", abs)
+	}
+	ed, err := openEditor(abs, w.idPolicy, enc)
+	if err != nil {
+		return nil, err
+	}
+	w.replaceEditor(abs, ed)
+	return ed, nil
+}
@@ -0,0 +1,200 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"softwaredesign/src/editor"
+)
+
+// journalLimit caps how many file operations workspace-undo can revert.
+const journalLimit = 10
+
+// fileOperation is a journaled workspace operation that can be reverted.
+// The journal lives for the session only.
+type fileOperation interface {
+	describe() string
+	// revert undoes the operation, or refuses without changing anything.
+	revert(w *Workspace) error
+}
+
+// closedFile keeps what closing a file dropped, so it can be reopened with
+// its unsaved changes and undo history.
+type closedFile struct {
+	ed         editor.Editor
+	xmlAsText  bool
+	dictionary string
+	onDisk     bool
+	baseline   *baseline
+	wasActive  bool
+}
+
+// closeOperation records files closed by one close or close all.
+type closeOperation struct {
+	files []closedFile
+}
+
+func (op *closeOperation) describe() string {
+	names := make([]string, len(op.files))
+	for i, file := range op.files {
+		names[i] = filepath.Base(file.ed.Path())
+	}
+	return "close " + strings.Join(names, ", ")
+}
+
+func (op *closeOperation) revert(w *Workspace) error {
+	for _, file := range op.files {
+		if err := w.checkReopen(file); err != nil {
+			return fmt.Errorf("无法撤销关闭: %v", err)
+		}
+	}
+	for _, file := range op.files {
+		abs := file.ed.Path()
+		w.configureEditor(file.ed)
+		w.editors[abs] = file.ed
+		if file.xmlAsText {
+			w.xmlAsText[abs] = true
+		}
+		if file.dictionary != "" {
+			w.dictionaries[abs] = file.dictionary
+		}
+		if file.onDisk {
+			w.onDisk[abs] = true
+		}
+		if file.baseline != nil {
+			w.baselines[abs] = file.baseline
+		}
+		w.history.Touch(abs)
+	}
+	for _, file := range op.files {
+		if file.wasActive || w.active == "" {
+			w.setActive(file.ed.Path())
+		}
+	}
+	return nil
+}
+
+// renameOperation records an open file renamed from one path to another.
+type renameOperation struct {
+	from, to string
+}
+
+func (op *renameOperation) describe() string {
+	return fmt.Sprintf("rename %s -> %s", filepath.Base(op.from), filepath.Base(op.to))
+}
+
+func (op *renameOperation) revert(w *Workspace) error {
+	if _, ok := w.editors[op.to]; !ok {
+		return fmt.Errorf("无法撤销重命名: %s 已不再打开", op.to)
+	}
+	if err := w.checkTarget(op.to, op.from); err != nil {
+		return fmt.Errorf("无法撤销重命名: %v", err)
+	}
+	return w.moveOpen(op.to, op.from)
+}
+
+// saveAsOperation records an editor saved under a new path, with what the
+// workspace tracked for its old one.
+type saveAsOperation struct {
+	from, to    string
+	modified    bool
+	onDisk      bool
+	baseline    *baseline
+	initialized bool
+}
+
+func (op *saveAsOperation) describe() string {
+	return fmt.Sprintf("save-as %s -> %s", filepath.Base(op.from), filepath.Base(op.to))
+}
+
+// revert points the editor back at its old path; the file written by
+// save-as stays on disk.
+func (op *saveAsOperation) revert(w *Workspace) error {
+	ed, ok := w.editors[op.to]
+	if !ok {
+		return fmt.Errorf("无法撤销另存为: %s 已不再打开", op.to)
+	}
+	if _, open := w.editors[op.from]; open {
+		return fmt.Errorf("无法撤销另存为: %s 已重新打开", op.from)
+	}
+	ed.Rename(op.from)
+	w.rebind(op.to, op.from)
+	if op.onDisk {
+		w.onDisk[op.from] = true
+	}
+	if op.baseline != nil {
+		w.baselines[op.from] = op.baseline
+	}
+	if op.initialized {
+		w.initialized[op.from] = true
+	}
+	ed.SetModified(op.modified || ed.IsModified())
+	_ = w.logger.Rename(op.to, op.from)
+	return nil
+}
+
+// checkReopen refuses to bring back a closed editor whose path is taken or
+// whose saved content changed on disk since it was closed.
+func (w *Workspace) checkReopen(file closedFile) error {
+	abs := file.ed.Path()
+	if _, ok := w.editors[abs]; ok {
+		return fmt.Errorf("%s 已重新打开", abs)
+	}
+	if p, ok := file.ed.(editor.IDPolicyEditor); ok && p.IDPolicy() != w.idPolicy {
+		if err := p.SetIDPolicy(w.idPolicy); err != nil {
+			return fmt.Errorf("%s: %v", abs, err)
+		}
+	}
+	if file.ed.IsModified() {
+		return nil
+	}
+	lines, err := readLines(abs, encodingOf(file.ed))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content, err := file.ed.Content()
+	if err != nil {
+		return err
+	}
+	if strings.Join(lines, "\n") != strings.Join(splitLines(content), "\n") {
+		return fmt.Errorf("%s 在关闭后已被修改", abs)
+	}
+	return nil
+}
+
+// journal records op, dropping the oldest entry beyond journalLimit.
+func (w *Workspace) journal(op fileOperation) {
+	w.fileOps = append(w.fileOps, op)
+	if len(w.fileOps) > journalLimit {
+		w.fileOps = w.fileOps[len(w.fileOps)-journalLimit:]
+	}
+}
+
+// UndoFileOperation reverts the most recent journaled file operation and
+// describes it. A refused operation stays in the journal.
+func (w *Workspace) UndoFileOperation() (string, error) {
+	if len(w.fileOps) == 0 {
+		return "", errors.New("没有可撤销的文件操作")
+	}
+	op := w.fileOps[len(w.fileOps)-1]
+	if err := op.revert(w); err != nil {
+		return "", err
+	}
+	w.fileOps = w.fileOps[:len(w.fileOps)-1]
+	return op.describe(), nil
+}
+
+// FileOperations lists the journaled file operations, most recent first.
+func (w *Workspace) FileOperations() []string {
+	descs := make([]string, 0, len(w.fileOps))
+	for i := len(w.fileOps) - 1; i >= 0; i-- {
+		descs = append(descs, w.fileOps[i].describe())
+	}
+	return descs
+}
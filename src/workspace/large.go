@@ -0,0 +1,133 @@
+package workspace
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"softwaredesign/src/charset"
+	"softwaredesign/src/editor"
+	"softwaredesign/src/spellcheck"
+)
+
+// defaultLargeFileMB is the size from which text files open in large-file
+// mode unless large-file says otherwise.
+const defaultLargeFileMB = 10
+
+// spellCheckChunk is how many lines of a large file are checked at a time.
+const spellCheckChunk = 4096
+
+// openFile opens abs, indexing a UTF-8 text file at or above the large-file
+// threshold instead of reading it.
+func (w *Workspace) openFile(abs string, enc charset.Encoding) (editor.Editor, error) {
+	if w.isLargeCandidate(abs, enc) {
+		return editor.OpenLargeText(abs)
+	}
+	return openEditor(abs, w.idPolicy, enc)
+}
+
+// isLargeCandidate reports whether abs is a big enough text file in UTF-8,
+// the only encoding lines can be read from without decoding it all.
+func (w *Workspace) isLargeCandidate(abs string, enc charset.Encoding) bool {
+	if w.largeFile <= 0 || strings.EqualFold(filepath.Ext(abs), ".xml") {
+		return false
+	}
+	if enc != "" && enc != charset.UTF8 {
+		return false
+	}
+	info, err := os.Stat(abs)
+	if err != nil || info.IsDir() || info.Size() < w.largeFile {
+		return false
+	}
+	if enc == "" {
+		file, err := os.Open(abs)
+		if err != nil {
+			return false
+		}
+		defer file.Close()
+		head := make([]byte, 2)
+		n, _ := io.ReadFull(file, head)
+		if charset.Detect(head[:n]) != charset.UTF8 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsLarge reports whether path is open in large-file mode.
+func (w *Workspace) IsLarge(path string) bool {
+	abs, err := w.resolvePath(path)
+	if err != nil {
+		return false
+	}
+	_, lazy := w.editors[abs].(*editor.LargeTextEditor)
+	return lazy
+}
+
+// Promote reads a file opened in large-file mode fully into a text editor so
+// it can be edited.
+func (w *Workspace) Promote(path string) (editor.Editor, error) {
+	target := path
+	if target == "" {
+		target = w.active
+	}
+	if target == "" {
+		return nil, errors.New("没有活动文件")
+	}
+	abs, err := w.ResolveOpen(target)
+	if err != nil {
+		return nil, err
+	}
+	lazy, ok := w.editors[abs].(*editor.LargeTextEditor)
+	if !ok {
+		return nil, errors.New("文件未以大文件模式打开")
+	}
+	ed, err := openEditor(abs, w.idPolicy, "")
+	if err != nil {
+		return nil, err
+	}
+	if doc, ok := ed.(editor.Bookmarker); ok {
+		for _, mark := range lazy.Marks() {
+			_ = doc.SetMark(mark.Name, mark.Line, mark.Col)
+		}
+	}
+	w.replaceEditor(abs, ed)
+	return ed, nil
+}
+
+// spellCheckLarge checks a large file a chunk of lines at a time. Markdown
+// fences open at the end of a chunk stay open into the next.
+func spellCheckLarge(speller *spellcheck.Service, abs string, doc *editor.LargeTextEditor) ([]spellcheck.TextIssue, error) {
+	extractor := speller.Extractors().ForPath(abs)
+	var issues []spellcheck.TextIssue
+	chunk := make([]string, 0, spellCheckChunk)
+	first := 1
+	state := ""
+	flush := func() {
+		var found []spellcheck.TextIssue
+		found, state = speller.CheckChunkWith(extractor, chunk, state)
+		for _, issue := range found {
+			issue.Line += first - 1
+			issues = append(issues, issue)
+		}
+		first += len(chunk)
+		chunk = chunk[:0]
+	}
+	err := doc.EachLine(func(n int, line string) bool {
+		if n == 1 && parseDictDirective(line) != "" {
+			line = ""
+		}
+		chunk = append(chunk, line)
+		if len(chunk) == spellCheckChunk {
+			flush()
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	flush()
+	return issues, nil
+}
@@ -0,0 +1,72 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// macroRecording collects the commands of a macro being recorded.
+type macroRecording struct {
+	name  string
+	steps []string
+}
+
+// StartMacro begins recording the commands that follow into macro name.
+func (w *Workspace) StartMacro(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("宏名称无效: %q", name)
+	}
+	if w.recording != nil {
+		return fmt.Errorf("正在录制宏 %s, 请先 macro stop", w.recording.name)
+	}
+	w.recording = &macroRecording{name: name}
+	return nil
+}
+
+// StopMacro ends recording and stores the macro, replacing any macro of the
+// same name. It returns the macro name and how many commands it holds.
+func (w *Workspace) StopMacro() (string, int, error) {
+	if w.recording == nil {
+		return "", 0, errors.New("没有正在录制的宏")
+	}
+	rec := w.recording
+	w.recording = nil
+	w.macros[rec.name] = rec.steps
+	return rec.name, len(rec.steps), nil
+}
+
+// RecordingMacro returns the name of the macro being recorded, or "".
+func (w *Workspace) RecordingMacro() string {
+	if w.recording == nil {
+		return ""
+	}
+	return w.recording.name
+}
+
+// RecordMacroStep appends command to the macro being recorded, if any.
+func (w *Workspace) RecordMacroStep(command string) {
+	if w.recording != nil {
+		w.recording.steps = append(w.recording.steps, command)
+	}
+}
+
+// Macro returns a copy of the commands stored under name.
+func (w *Workspace) Macro(name string) ([]string, error) {
+	steps, ok := w.macros[name]
+	if !ok {
+		return nil, fmt.Errorf("宏不存在: %s", name)
+	}
+	return append([]string(nil), steps...), nil
+}
+
+// MacroNames lists the stored macros in name order.
+func (w *Workspace) MacroNames() []string {
+	names := make([]string, 0, len(w.macros))
+	for name := range w.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
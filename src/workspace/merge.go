@@ -0,0 +1,212 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"softwaredesign/src/charset"
+	"softwaredesign/src/diff"
+	"softwaredesign/src/editor"
+)
+
+// Labels written on the conflict markers of an external merge.
+const (
+	mergeLabelOurs   = "编辑器"
+	mergeLabelTheirs = "磁盘"
+)
+
+// ExternalChangeError reports that a file changed on disk since it was last
+// read or saved, so saving would overwrite someone else's edits.
+type ExternalChangeError struct {
+	Path string
+	// Deleted is set when the file was removed rather than modified.
+	Deleted bool
+}
+
+func (e *ExternalChangeError) Error() string {
+	if e.Deleted {
+		return fmt.Sprintf("文件在打开后已被外部删除: %s", e.Path)
+	}
+	return fmt.Sprintf("文件在打开后已被外部修改: %s", e.Path)
+}
+
+// OverwriteDecider is a SaveDecider that can also confirm overwriting a file
+// changed on disk, or recreating one deleted there.
+type OverwriteDecider interface {
+	ConfirmOverwrite(path string) (bool, error)
+}
+
+// DiskState describes an open file's disk copy relative to its baseline.
+type DiskState string
+
+const (
+	DiskUnchanged DiskState = "unchanged"
+	DiskModified  DiskState = "modified"
+	DiskDeleted   DiskState = "deleted"
+	// DiskUntracked marks buffers never read from or written to disk.
+	DiskUntracked DiskState = "untracked"
+)
+
+// ExternalStatus is one open file's disk state.
+type ExternalStatus struct {
+	Path  string
+	State DiskState
+}
+
+// baseline is a file as last read from or written to disk: its lines are the
+// common ancestor for merges, its modification time and size detect changes.
+type baseline struct {
+	lines   []string
+	modTime time.Time
+	size    int64
+	// enc is the encoding lines were decoded from.
+	enc charset.Encoding
+	// statOnly marks a large file whose lines were not read; only its stat
+	// is compared.
+	statOnly bool
+}
+
+// recordBaseline remembers abs's on-disk lines and stat as the reference for
+// detecting and merging external changes.
+func (w *Workspace) recordBaseline(abs string) {
+	if _, lazy := w.editors[abs].(*editor.LargeTextEditor); lazy {
+		w.setBaseline(abs, nil)
+		w.baselines[abs].statOnly = true
+		return
+	}
+	lines, err := readLines(abs, encodingOf(w.editors[abs]))
+	if err != nil {
+		delete(w.baselines, abs)
+		return
+	}
+	w.setBaseline(abs, lines)
+}
+
+// setBaseline records lines as abs's disk content, stamped with abs's
+// current modification time and size and the open editor's encoding.
+func (w *Workspace) setBaseline(abs string, lines []string) {
+	base := &baseline{lines: lines, enc: encodingOf(w.editors[abs])}
+	if info, err := os.Stat(abs); err == nil {
+		base.modTime, base.size = info.ModTime(), info.Size()
+	}
+	w.baselines[abs] = base
+}
+
+// diskState compares abs on disk with its baseline. A changed modification
+// time or size counts as modified even if the content is the same; equal
+// stats still have their content compared, since a quick rewrite may keep
+// both.
+func (w *Workspace) diskState(abs string) (DiskState, error) {
+	base, ok := w.baselines[abs]
+	if !ok {
+		return DiskUntracked, nil
+	}
+	info, err := os.Stat(abs)
+	if errors.Is(err, os.ErrNotExist) {
+		return DiskDeleted, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.ModTime().Equal(base.modTime) || info.Size() != base.size {
+		return DiskModified, nil
+	}
+	if base.statOnly {
+		return DiskUnchanged, nil
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", err
+	}
+	text, err := charset.Decode(data, base.enc)
+	if err != nil || !slices.Equal(base.lines, splitLines(text)) {
+		return DiskModified, nil
+	}
+	return DiskUnchanged, nil
+}
+
+// checkExternal fails with ExternalChangeError when ed's file on disk was
+// modified or deleted since its baseline. A file whose directory is gone
+// passes, so the missing directory can be reported instead.
+func (w *Workspace) checkExternal(ed editor.Editor) error {
+	state, err := w.diskState(ed.Path())
+	if err != nil {
+		return err
+	}
+	switch state {
+	case DiskModified:
+		return &ExternalChangeError{Path: ed.Path()}
+	case DiskDeleted:
+		if w.missingDir(ed.Path()) != "" {
+			return nil
+		}
+		return &ExternalChangeError{Path: ed.Path(), Deleted: true}
+	}
+	return nil
+}
+
+// ExternalChanges reports the disk state of every open file in path order.
+func (w *Workspace) ExternalChanges() ([]ExternalStatus, error) {
+	var result []ExternalStatus
+	for _, path := range w.openPaths() {
+		state, err := w.diskState(path)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ExternalStatus{Path: path, State: state})
+	}
+	return result, nil
+}
+
+// saveConfirmed saves ed, asking the decider before overwriting external
+// changes; a refusal or an unanswerable prompt leaves the file unsaved.
+func (w *Workspace) saveConfirmed(ed editor.Editor) error {
+	err := w.saveEditor(ed)
+	var external *ExternalChangeError
+	decider, ok := w.decider.(OverwriteDecider)
+	if !errors.As(err, &external) || !ok {
+		return err
+	}
+	overwrite, askErr := decider.ConfirmOverwrite(ed.Path())
+	if askErr != nil || !overwrite {
+		return err
+	}
+	return w.writeEditor(ed)
+}
+
+// Overwrite saves a file like Save but replaces external changes on disk.
+func (w *Workspace) Overwrite(path string) error {
+	return w.save(path, w.writeEditor)
+}
+
+// MergeExternal merges the external changes on disk into a text file's
+// buffer as one undoable edit and returns the number of conflicts, which are
+// left in the buffer between markers. The file is not saved; the next save
+// no longer counts the merged changes as external.
+func (w *Workspace) MergeExternal(path string) (int, error) {
+	abs, err := w.ResolveOpen(path)
+	if err != nil {
+		return 0, err
+	}
+	doc, ok := w.editors[abs].(editor.TextDocument)
+	if !ok || w.xmlAsText[abs] {
+		return 0, errors.New("只有文本文件支持合并外部修改")
+	}
+	base, ok := w.baselines[abs]
+	if !ok {
+		return 0, fmt.Errorf("没有 %s 的基准版本, 无法合并", abs)
+	}
+	theirs, err := readLines(abs, base.enc)
+	if err != nil {
+		return 0, err
+	}
+	result := diff.Merge(base.lines, doc.Lines(), theirs, mergeLabelOurs, mergeLabelTheirs)
+	if err := doc.ApplyMerge(result.Lines); err != nil {
+		return 0, err
+	}
+	w.setBaseline(abs, theirs)
+	return result.Conflicts, nil
+}
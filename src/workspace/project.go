@@ -0,0 +1,82 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"softwaredesign/src/fs"
+)
+
+// ProjectRoot is the directory relative paths resolve against: the one set
+// by open-dir, or the workspace directory.
+func (w *Workspace) ProjectRoot() string {
+	if w.projectRoot != "" {
+		return w.projectRoot
+	}
+	return w.baseDir
+}
+
+// SetProjectRoot makes dir, resolved against the current project root, the
+// project root. Open editors keep their absolute paths.
+func (w *Workspace) SetProjectRoot(dir string) (string, error) {
+	abs, err := w.resolvePath(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s 不是目录", dir)
+	}
+	w.projectRoot = abs
+	if abs == w.baseDir {
+		w.projectRoot = ""
+	}
+	return abs, nil
+}
+
+// ProjectFiles lists the files under the project root whose relative path
+// matches pattern: a glob when it holds *, ? or [, otherwise a
+// case-insensitive substring. An empty pattern matches every file.
+func (w *Workspace) ProjectFiles(pattern string) ([]string, error) {
+	root := w.ProjectRoot()
+	node, err := fs.Scan(root, fs.Options{})
+	if err != nil {
+		return nil, err
+	}
+	glob := strings.ContainsAny(pattern, "*?[")
+	if glob {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("模式无效: %s", pattern)
+		}
+	}
+	needle := strings.ToLower(pattern)
+	var files []string
+	for _, path := range fs.Files(node, root) {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		var ok bool
+		switch {
+		case glob:
+			// Patterns without a slash match the file name at any depth.
+			name := rel
+			if !strings.Contains(pattern, "/") {
+				name = filepath.Base(path)
+			}
+			ok, _ = filepath.Match(pattern, name)
+		default:
+			ok = strings.Contains(strings.ToLower(rel), needle)
+		}
+		if ok {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,156 @@
+package workspace
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// defaultRecentLimit caps the recently used files kept by a workspace.
+const defaultRecentLimit = 32
+
+func init() {
+	RegisterStateCheck(StateCheck{Name: "recent", Run: checkRecent})
+}
+
+// checkRecent drops recent entries that are repeated or not in the editor list.
+func checkRecent(_ StateEnv, state *WorkspaceState) []string {
+	open := map[string]bool{}
+	for _, entry := range state.Editors {
+		open[entry.Path] = true
+	}
+	var issues []string
+	seen := map[string]bool{}
+	kept := state.Recent[:0]
+	for _, path := range state.Recent {
+		switch {
+		case seen[path]:
+			issues = append(issues, fmt.Sprintf("最近使用列表中 %s 重复, 已移除", path))
+		case !open[path]:
+			issues = append(issues, fmt.Sprintf("最近使用列表中的 %s 不在编辑器列表中, 已移除", path))
+		default:
+			seen[path] = true
+			kept = append(kept, path)
+		}
+	}
+	state.Recent = kept
+	return issues
+}
+
+// RecentList is an ordered set of paths, most recently used first. Touch and
+// Remove run in constant time; beyond the limit the oldest entries drop.
+type RecentList struct {
+	order *list.List
+	items map[string]*list.Element
+	limit int
+}
+
+// NewRecentList builds an empty list holding at most limit paths; a limit
+// below 1 means no cap.
+func NewRecentList(limit int) *RecentList {
+	return &RecentList{order: list.New(), items: map[string]*list.Element{}, limit: limit}
+}
+
+// Touch moves path to the front, adding it if needed.
+func (r *RecentList) Touch(path string) {
+	if path == "" {
+		return
+	}
+	if elem, ok := r.items[path]; ok {
+		r.order.MoveToFront(elem)
+		return
+	}
+	r.items[path] = r.order.PushFront(path)
+	r.evict()
+}
+
+// Remove drops path if present.
+func (r *RecentList) Remove(path string) {
+	if elem, ok := r.items[path]; ok {
+		r.order.Remove(elem)
+		delete(r.items, path)
+	}
+}
+
+// Rename replaces oldPath with newPath in place.
+func (r *RecentList) Rename(oldPath, newPath string) {
+	elem, ok := r.items[oldPath]
+	if !ok {
+		return
+	}
+	r.Remove(newPath)
+	delete(r.items, oldPath)
+	elem.Value = newPath
+	r.items[newPath] = elem
+}
+
+// Contains reports whether path is in the list.
+func (r *RecentList) Contains(path string) bool {
+	_, ok := r.items[path]
+	return ok
+}
+
+// Front returns the most recently used path, or "" when empty.
+func (r *RecentList) Front() string {
+	if elem := r.order.Front(); elem != nil {
+		return elem.Value.(string)
+	}
+	return ""
+}
+
+// Len counts the paths in the list.
+func (r *RecentList) Len() int {
+	return r.order.Len()
+}
+
+// Paths returns a copy of the list, most recently used first.
+func (r *RecentList) Paths() []string {
+	paths := make([]string, 0, r.order.Len())
+	for elem := r.order.Front(); elem != nil; elem = elem.Next() {
+		paths = append(paths, elem.Value.(string))
+	}
+	return paths
+}
+
+// SetLimit changes the cap, dropping the oldest entries beyond it.
+func (r *RecentList) SetLimit(limit int) {
+	r.limit = limit
+	r.evict()
+}
+
+func (r *RecentList) evict() {
+	for r.limit > 0 && r.order.Len() > r.limit {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.items, oldest.Value.(string))
+	}
+}
+
+// ClosedFiles lists the recently closed files, most recent first, leaving
+// out files open again. Files no longer on disk are dropped from the list.
+func (w *Workspace) ClosedFiles() []string {
+	var files []string
+	for _, path := range w.closed.Paths() {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			w.closed.Remove(path)
+			continue
+		}
+		if _, open := w.editors[path]; !open {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// ClosedFile returns entry n (1-based) of ClosedFiles.
+func (w *Workspace) ClosedFile(n int) (string, error) {
+	files := w.ClosedFiles()
+	if len(files) == 0 {
+		return "", errors.New("没有最近关闭的文件")
+	}
+	if n < 1 || n > len(files) {
+		return "", fmt.Errorf("编号 %d 超出范围 (1-%d)", n, len(files))
+	}
+	return files[n-1], nil
+}
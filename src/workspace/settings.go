@@ -0,0 +1,511 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"softwaredesign/src/editor"
+)
+
+// SettingKind describes how a setting value is parsed.
+type SettingKind string
+
+const (
+	// SettingBool accepts on/off (or true/false).
+	SettingBool SettingKind = "bool"
+	// SettingInt accepts a decimal integer.
+	SettingInt SettingKind = "int"
+	// SettingOctal accepts an octal number such as 0640.
+	SettingOctal SettingKind = "octal"
+	// SettingEnum accepts one of the listed options.
+	SettingEnum SettingKind = "enum"
+	// SettingString accepts any text, subject to the validator.
+	SettingString SettingKind = "string"
+)
+
+// Setting sources reported by the settings command.
+const (
+	SourceDefault = "default"
+	SourceUser    = "user"
+	SourceState   = "state"
+)
+
+// SettingDef declares a runtime setting.
+type SettingDef struct {
+	Name        string
+	Kind        SettingKind
+	Default     string
+	Options     []string
+	Persist     bool
+	Description string
+	// Validate performs extra checks on the normalized value.
+	Validate func(value string) error
+}
+
+// SettingView is a read-only snapshot of a setting for display.
+type SettingView struct {
+	Name        string
+	Value       string
+	Default     string
+	Source      string
+	Persist     bool
+	Description string
+}
+
+// Settings is a typed registry of runtime settings with change notification.
+type Settings struct {
+	defs      map[string]SettingDef
+	values    map[string]string
+	sources   map[string]string
+	listeners map[string][]func(value string) error
+}
+
+// NewSettings creates an empty registry.
+func NewSettings() *Settings {
+	return &Settings{
+		defs:      map[string]SettingDef{},
+		values:    map[string]string{},
+		sources:   map[string]string{},
+		listeners: map[string][]func(value string) error{},
+	}
+}
+
+// Register declares a setting; its default must itself be valid.
+func (s *Settings) Register(def SettingDef) error {
+	if def.Name == "" {
+		return fmt.Errorf("设置项名称不能为空")
+	}
+	if _, exists := s.defs[def.Name]; exists {
+		return fmt.Errorf("设置项已存在: %s", def.Name)
+	}
+	value, err := normalizeSetting(def, def.Default)
+	if err != nil {
+		return fmt.Errorf("设置项 %s 的默认值无效: %v", def.Name, err)
+	}
+	def.Default = value
+	s.defs[def.Name] = def
+	s.values[def.Name] = value
+	s.sources[def.Name] = SourceDefault
+	return nil
+}
+
+// OnChange registers a hook invoked with the normalized value after each change.
+func (s *Settings) OnChange(name string, hook func(value string) error) {
+	s.listeners[name] = append(s.listeners[name], hook)
+}
+
+// Set validates and applies a user-provided value.
+func (s *Settings) Set(name, value string) error {
+	return s.apply(name, value, SourceUser)
+}
+
+// Get returns the current normalized value.
+func (s *Settings) Get(name string) (string, error) {
+	if _, ok := s.defs[name]; !ok {
+		return "", fmt.Errorf("未知设置项: %s", name)
+	}
+	return s.values[name], nil
+}
+
+// Bool returns a boolean setting value.
+func (s *Settings) Bool(name string) bool {
+	return s.values[name] == "on"
+}
+
+// Int returns an integer setting value.
+func (s *Settings) Int(name string) int {
+	n, _ := strconv.Atoi(s.values[name])
+	return n
+}
+
+// List returns every setting sorted by name.
+func (s *Settings) List() []SettingView {
+	names := make([]string, 0, len(s.defs))
+	for name := range s.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	views := make([]SettingView, 0, len(names))
+	for _, name := range names {
+		def := s.defs[name]
+		views = append(views, SettingView{
+			Name:        name,
+			Value:       s.values[name],
+			Default:     def.Default,
+			Source:      s.sources[name],
+			Persist:     def.Persist,
+			Description: def.Description,
+		})
+	}
+	return views
+}
+
+// Persisted returns persistable values that differ from their defaults.
+func (s *Settings) Persisted() map[string]string {
+	result := map[string]string{}
+	for name, def := range s.defs {
+		if def.Persist && s.values[name] != def.Default {
+			result[name] = s.values[name]
+		}
+	}
+	return result
+}
+
+// Restore applies saved values, skipping unknown or invalid entries.
+func (s *Settings) Restore(saved map[string]string) []error {
+	var errs []error
+	names := make([]string, 0, len(saved))
+	for name := range saved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def, ok := s.defs[name]
+		if !ok || !def.Persist {
+			continue
+		}
+		if err := s.apply(name, saved[name], SourceState); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Validate reports whether value would be accepted for a persisted setting.
+func (s *Settings) Validate(name, value string) error {
+	def, ok := s.defs[name]
+	if !ok || !def.Persist {
+		return fmt.Errorf("未知设置项: %s", name)
+	}
+	if _, err := normalizeSetting(def, value); err != nil {
+		return fmt.Errorf("设置项 %s 的值无效: %v", name, err)
+	}
+	return nil
+}
+
+func init() {
+	RegisterStateCheck(StateCheck{Name: "setting", Run: checkSettings})
+}
+
+// checkSettings drops saved settings that Restore would skip or reject.
+func checkSettings(env StateEnv, state *WorkspaceState) []string {
+	names := make([]string, 0, len(state.Settings))
+	for name := range state.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var issues []string
+	for _, name := range names {
+		if err := env.Settings.Validate(name, state.Settings[name]); err != nil {
+			issues = append(issues, fmt.Sprintf("%v, 已移除", err))
+			delete(state.Settings, name)
+		}
+	}
+	return issues
+}
+
+func (s *Settings) apply(name, value, source string) error {
+	def, ok := s.defs[name]
+	if !ok {
+		return fmt.Errorf("未知设置项: %s", name)
+	}
+	normalized, err := normalizeSetting(def, value)
+	if err != nil {
+		return fmt.Errorf("设置项 %s 的值无效: %v", name, err)
+	}
+	previous := s.values[name]
+	for _, hook := range s.listeners[name] {
+		if err := hook(normalized); err != nil {
+			for _, undo := range s.listeners[name] {
+				_ = undo(previous)
+			}
+			return fmt.Errorf("设置项 %s 应用失败: %v", name, err)
+		}
+	}
+	s.values[name] = normalized
+	s.sources[name] = source
+	return nil
+}
+
+func normalizeSetting(def SettingDef, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	var normalized string
+	switch def.Kind {
+	case SettingBool:
+		switch strings.ToLower(value) {
+		case "on", "true":
+			normalized = "on"
+		case "off", "false":
+			normalized = "off"
+		default:
+			return "", fmt.Errorf("%s (应为 on 或 off)", value)
+		}
+	case SettingInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("%s (应为整数)", value)
+		}
+		normalized = strconv.Itoa(n)
+	case SettingOctal:
+		n, err := strconv.ParseUint(value, 8, 32)
+		if err != nil {
+			return "", fmt.Errorf("%s (应为八进制数)", value)
+		}
+		normalized = fmt.Sprintf("0%o", n)
+	case SettingEnum:
+		lower := strings.ToLower(value)
+		for _, option := range def.Options {
+			if lower == option {
+				normalized = option
+			}
+		}
+		if normalized == "" {
+			return "", fmt.Errorf("%s (可选: %s)", value, strings.Join(def.Options, "|"))
+		}
+	default:
+		normalized = value
+	}
+	if def.Validate != nil {
+		if err := def.Validate(normalized); err != nil {
+			return "", err
+		}
+	}
+	return normalized, nil
+}
+
+// registerSettings declares the workspace settings and wires their hooks.
+func (w *Workspace) registerSettings() {
+	defs := []struct {
+		def  SettingDef
+		hook func(value string) error
+	}{
+		{SettingDef{Name: "file-mode", Kind: SettingOctal, Default: "0644", Persist: true,
+			Description: "新文件的默认权限",
+			Validate: func(value string) error {
+				mode, _ := strconv.ParseUint(value, 8, 32)
+				if os.FileMode(mode)&^os.ModePerm != 0 {
+					return fmt.Errorf("%s (超出权限位范围)", value)
+				}
+				return nil
+			}},
+			func(value string) error {
+				mode, _ := strconv.ParseUint(value, 8, 32)
+				return w.SetFileMode(os.FileMode(mode))
+			}},
+		{SettingDef{Name: "close-policy", Kind: SettingEnum, Default: string(ClosePolicyAsk), Persist: true,
+			Options:     []string{string(ClosePolicyAsk), string(ClosePolicySave), string(ClosePolicyDiscard)},
+			Description: "保存提示无法回答时的处理方式"},
+			func(value string) error {
+				w.SetClosePolicy(ClosePolicy(value))
+				return nil
+			}},
+		{SettingDef{Name: "prompt-timeout", Kind: SettingInt, Default: "0", Persist: true,
+			Description: "确认提示的等待时间 (秒), 超时后采用 prompt-default (0 表示一直等待)",
+			Validate: func(value string) error {
+				if n, _ := strconv.Atoi(value); n < 0 {
+					return fmt.Errorf("%s (不能为负数)", value)
+				}
+				return nil
+			}},
+			func(value string) error {
+				seconds, _ := strconv.Atoi(value)
+				w.SetPromptTimeout(time.Duration(seconds)*time.Second, w.promptDefault)
+				return nil
+			}},
+		{SettingDef{Name: "prompt-default", Kind: SettingEnum, Default: "no", Persist: true,
+			Options:     []string{"no", "yes"},
+			Description: "确认提示超时或 confirm 关闭时自动选择的答案"},
+			func(value string) error {
+				w.SetPromptTimeout(w.promptTimeout, value == "yes")
+				return nil
+			}},
+		{SettingDef{Name: "confirm", Kind: SettingBool, Default: "on", Persist: true,
+			Description: "关闭后保存提示不再询问, 直接采用 prompt-default 的答案"},
+			func(value string) error {
+				w.confirm = value == "on"
+				return nil
+			}},
+		{SettingDef{Name: "size-thresholds", Kind: SettingString, Default: "10,50", Persist: true,
+			Description: "文档体积告警阈值 (MB，逗号分隔)",
+			Validate: func(value string) error {
+				_, err := parseSizeThresholds(value)
+				return err
+			}},
+			func(value string) error {
+				thresholds, err := parseSizeThresholds(value)
+				if err != nil {
+					return err
+				}
+				w.SetSizeThresholds(thresholds)
+				return nil
+			}},
+		{SettingDef{Name: "history-warn", Kind: SettingInt, Default: "64", Persist: true,
+			Description: "撤销历史超过该大小 (MB) 时提示保存后重新打开 (0 表示不提示)",
+			Validate: func(value string) error {
+				if n, _ := strconv.Atoi(value); n < 0 {
+					return fmt.Errorf("%s (不能为负数)", value)
+				}
+				return nil
+			}},
+			func(value string) error {
+				mb, _ := strconv.Atoi(value)
+				w.SetHistoryLimit(mb << 20)
+				return nil
+			}},
+		{SettingDef{Name: "undo-coalesce", Kind: SettingBool, Default: "off", Persist: true,
+			Description: "合并连续相同的编辑为一个撤销步骤"},
+			func(value string) error {
+				w.SetUndoCoalescing(value == "on")
+				return nil
+			}},
+		{SettingDef{Name: "stats-credit", Kind: SettingInt, Default: "1", Persist: true,
+			Description: "显式指定非活动文件的命令计入该文件的时长 (秒)",
+			Validate: func(value string) error {
+				if n, _ := strconv.Atoi(value); n < 0 {
+					return fmt.Errorf("%s (不能为负数)", value)
+				}
+				return nil
+			}},
+			func(value string) error {
+				seconds, _ := strconv.Atoi(value)
+				w.SetCreditSlice(time.Duration(seconds) * time.Second)
+				return nil
+			}},
+		{SettingDef{Name: "show-width", Kind: SettingInt, Default: "200", Persist: true,
+			Description: "show 显示单行的最大字符数, 超出部分截断 (0 表示不截断)",
+			Validate: func(value string) error {
+				if n, _ := strconv.Atoi(value); n < 0 {
+					return fmt.Errorf("%s (不能为负数)", value)
+				}
+				return nil
+			}}, nil},
+		{SettingDef{Name: "undo-limit", Kind: SettingInt, Default: strconv.Itoa(defaultUndoLimit), Persist: true,
+			Description: "每个文件保留的撤销步数上限, 超出时丢弃最早的步骤 (0 表示不限)",
+			Validate: func(value string) error {
+				if n, _ := strconv.Atoi(value); n < 0 {
+					return fmt.Errorf("%s (不能为负数)", value)
+				}
+				return nil
+			}},
+			func(value string) error {
+				limit, _ := strconv.Atoi(value)
+				w.SetUndoLimit(limit)
+				return nil
+			}},
+		{SettingDef{Name: "large-file", Kind: SettingInt, Default: strconv.Itoa(defaultLargeFileMB), Persist: true,
+			Description: "文本文件达到该大小 (MB) 时以大文件模式只读打开, 按需读取行 (0 表示关闭)",
+			Validate: func(value string) error {
+				if n, _ := strconv.Atoi(value); n < 0 {
+					return fmt.Errorf("%s (不能为负数)", value)
+				}
+				return nil
+			}},
+			func(value string) error {
+				mb, _ := strconv.Atoi(value)
+				w.largeFile = int64(mb) << 20
+				return nil
+			}},
+		{SettingDef{Name: "backup", Kind: SettingBool, Default: "off", Persist: true,
+			Description: "保存前把磁盘上的旧版本备份到同目录的 .backup 下 (restore-backup 取回)"},
+			func(value string) error {
+				w.backup = value == "on"
+				return nil
+			}},
+		{SettingDef{Name: "backup-count", Kind: SettingInt, Default: strconv.Itoa(defaultBackupCount), Persist: true,
+			Description: "每个文件保留的备份数, 超出时删除最早的备份",
+			Validate: func(value string) error {
+				if n, _ := strconv.Atoi(value); n < 1 {
+					return fmt.Errorf("%s (至少为 1)", value)
+				}
+				return nil
+			}},
+			func(value string) error {
+				w.backupCount, _ = strconv.Atoi(value)
+				return nil
+			}},
+		{SettingDef{Name: "recent-limit", Kind: SettingInt, Default: strconv.Itoa(defaultRecentLimit), Persist: true,
+			Description: "最近使用及最近关闭文件列表保留的条目数, 超出时丢弃最早的文件",
+			Validate: func(value string) error {
+				if n, _ := strconv.Atoi(value); n < 1 {
+					return fmt.Errorf("%s (至少为 1)", value)
+				}
+				return nil
+			}},
+			func(value string) error {
+				limit, _ := strconv.Atoi(value)
+				w.history.SetLimit(limit)
+				w.closed.SetLimit(limit)
+				return nil
+			}},
+		{SettingDef{Name: "command-history", Kind: SettingInt, Default: strconv.Itoa(defaultCommandHistoryLimit), Persist: true,
+			Description: "命令历史保留的条目数, 超出时丢弃最早的命令",
+			Validate: func(value string) error {
+				if n, _ := strconv.Atoi(value); n < 1 {
+					return fmt.Errorf("%s (至少为 1)", value)
+				}
+				return nil
+			}},
+			func(value string) error {
+				limit, _ := strconv.Atoi(value)
+				w.commands.SetLimit(limit)
+				return nil
+			}},
+		{SettingDef{Name: "command-history-file", Kind: SettingBool, Default: "off", Persist: true,
+			Description: "退出时把命令历史保存到 " + historyFile + ", 下次启动时载入"},
+			func(value string) error {
+				w.saveCommands = value == "on"
+				if !w.saveCommands || w.commandsLoaded {
+					return nil
+				}
+				w.commandsLoaded = true
+				return w.loadCommandHistory()
+			}},
+		{SettingDef{Name: "id-policy", Kind: SettingEnum, Default: string(editor.IDExact), Persist: true,
+			Options:     []string{string(editor.IDExact), string(editor.IDCaseInsensitive)},
+			Description: "XML 元素 ID 的比较方式: exact 区分大小写, case-insensitive 忽略大小写 (查找与重复检查均适用)"},
+			func(value string) error {
+				return w.SetIDPolicy(editor.IDPolicy(value))
+			}},
+		{SettingDef{Name: "log-operations", Kind: SettingBool, Default: "off", Persist: true,
+			Description: "在已开启日志的文件中记录保存全部、拼写检查全部等长操作的开始与结束"},
+			func(value string) error {
+				w.logger.SetOperationLogging(value == "on")
+				return nil
+			}},
+		{SettingDef{Name: "output-level", Kind: SettingEnum, Default: "normal", Persist: true,
+			Options:     []string{"normal", "quiet"},
+			Description: "编辑成功后的输出: normal 附带受影响行或元素的摘要, quiet 仅显示简短确认"}, nil},
+		{SettingDef{Name: "redo-warn", Kind: SettingBool, Default: "on", Persist: true,
+			Description: "新编辑丢弃重做栈时给出提示"}, nil},
+		{SettingDef{Name: "redo-preserve", Kind: SettingBool, Default: "off", Persist: true,
+			Description: "暂存被丢弃的重做分支 (redo --stashed 恢复)"},
+			func(value string) error {
+				w.SetRedoPreserve(value == "on")
+				return nil
+			}},
+	}
+	for _, entry := range defs {
+		if err := w.settings.Register(entry.def); err != nil {
+			panic(err)
+		}
+		if entry.hook != nil {
+			w.settings.OnChange(entry.def.Name, entry.hook)
+		}
+	}
+}
+
+func parseSizeThresholds(value string) ([]int, error) {
+	var thresholds []int
+	for _, part := range strings.Split(value, ",") {
+		mb, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || mb <= 0 {
+			return nil, fmt.Errorf("阈值无效: %s", part)
+		}
+		thresholds = append(thresholds, mb<<20)
+	}
+	return thresholds, nil
+}
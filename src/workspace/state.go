@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+
+	"softwaredesign/src/charset"
+	"softwaredesign/src/statistics"
 )
 
 const stateFile = ".editor_workspace"
@@ -12,13 +15,40 @@ const stateFile = ".editor_workspace"
 type EditorState struct {
 	Path     string `json:"path"`
 	Modified bool   `json:"modified"`
+	// DirMissing records that the file's directory was gone when the state was saved.
+	DirMissing bool            `json:"dirMissing,omitempty"`
+	Bookmarks  []BookmarkState `json:"bookmarks,omitempty"`
+	ReadOnly   bool            `json:"readOnly,omitempty"`
+	// Encoding is set for files not stored as UTF-8.
+	Encoding charset.Encoding `json:"encoding,omitempty"`
+}
+
+// BookmarkState stores a named text position.
+type BookmarkState struct {
+	Name string `json:"name"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
 }
 
 // WorkspaceState captures persisted workspace info.
 type WorkspaceState struct {
-	Editors []EditorState `json:"editors"`
-	Active  string        `json:"active"`
-	Logging []string      `json:"logging"`
+	Editors  []EditorState     `json:"editors"`
+	Active   string            `json:"active"`
+	Logging  []string          `json:"logging"`
+	LogOff   []string          `json:"logOff,omitempty"`
+	Settings map[string]string `json:"settings,omitempty"`
+	// Version records the build that wrote the state file.
+	Version string `json:"version,omitempty"`
+	// Recent lists the open files by recent use, most recent first.
+	Recent []string `json:"recent,omitempty"`
+	// Closed lists recently closed files, most recent first.
+	Closed []string `json:"closed,omitempty"`
+	// ProjectRoot is the directory set by open-dir, if any.
+	ProjectRoot string `json:"projectRoot,omitempty"`
+	// Activity holds per-file, per-day statistics for reports.
+	Activity []statistics.DayActivity `json:"activity,omitempty"`
+	// Macros maps macro names to the commands they replay.
+	Macros map[string][]string `json:"macros,omitempty"`
 }
 
 // StateKeeper reads/writes workspace state.
@@ -42,6 +72,19 @@ func (s *StateKeeper) Save(state WorkspaceState) error {
 	return os.WriteFile(s.path, data, 0o644)
 }
 
+// Backup copies the state file next to itself and returns the copy's path.
+func (s *StateKeeper) Backup() (string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", err
+	}
+	backup := s.path + ".bak"
+	if err := os.WriteFile(backup, data, 0o644); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
 // Load restores workspace state if present.
 func (s *StateKeeper) Load() (WorkspaceState, error) {
 	data, err := os.ReadFile(s.path)
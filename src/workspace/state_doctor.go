@@ -0,0 +1,210 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StateCheck validates one aspect of a saved workspace state. Run reports
+// each inconsistency it finds and repairs it in state; doctor only keeps the
+// repairs when asked to fix.
+type StateCheck struct {
+	Name string
+	Run  func(env StateEnv, state *WorkspaceState) []string
+}
+
+// StateEnv gives checks access to the workspace registries the state refers to.
+type StateEnv struct {
+	Settings *Settings
+}
+
+// StateIssue is one inconsistency reported by a check.
+type StateIssue struct {
+	Check   string
+	Message string
+}
+
+// StateReport is the outcome of DoctorState.
+type StateReport struct {
+	Issues []StateIssue
+	// Backup is where the original state was copied when it was fixed.
+	Backup string
+}
+
+// stateChecks starts with the checks for the core fields; features register
+// theirs from init functions, which run after this is initialized.
+var stateChecks = []StateCheck{
+	{Name: "duplicate-editor", Run: checkDuplicateEditors},
+	{Name: "missing-file", Run: checkMissingFiles},
+	{Name: "active", Run: checkActive},
+	{Name: "logging", Run: checkLogging},
+	{Name: "bookmark", Run: checkBookmarks},
+}
+
+// RegisterStateCheck adds a check run by DoctorState after those registered
+// before it, so features persisting new state fields can validate them.
+func RegisterStateCheck(check StateCheck) {
+	stateChecks = append(stateChecks, check)
+}
+
+// DoctorState validates the saved state file without opening the files it
+// names. With fix, the original is backed up and the repaired state saved.
+func (w *Workspace) DoctorState(fix bool) (StateReport, error) {
+	state, err := w.keeper.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		return StateReport{}, errors.New("没有已保存的工作区状态")
+	}
+	if err != nil {
+		return StateReport{}, fmt.Errorf("无法读取工作区状态: %v", err)
+	}
+	env := StateEnv{Settings: w.settings}
+	var report StateReport
+	for _, check := range stateChecks {
+		for _, msg := range check.Run(env, &state) {
+			report.Issues = append(report.Issues, StateIssue{Check: check.Name, Message: msg})
+		}
+	}
+	if !fix || len(report.Issues) == 0 {
+		return report, nil
+	}
+	if report.Backup, err = w.keeper.Backup(); err != nil {
+		return report, err
+	}
+	return report, w.keeper.Save(state)
+}
+
+func checkDuplicateEditors(_ StateEnv, state *WorkspaceState) []string {
+	var issues []string
+	kept := state.Editors[:0]
+	for _, entry := range state.Editors {
+		dup := -1
+		for i, other := range kept {
+			if sameStatePath(entry.Path, other.Path) {
+				dup = i
+				break
+			}
+		}
+		if dup < 0 {
+			kept = append(kept, entry)
+			continue
+		}
+		issues = append(issues, fmt.Sprintf("%s 与 %s 重复, 已合并", entry.Path, kept[dup].Path))
+		if _, err := os.Stat(kept[dup].Path); err != nil {
+			if _, err := os.Stat(entry.Path); err == nil {
+				kept[dup].Path = entry.Path
+			}
+		}
+		kept[dup].Modified = kept[dup].Modified || entry.Modified
+	}
+	state.Editors = kept
+	return issues
+}
+
+func checkMissingFiles(_ StateEnv, state *WorkspaceState) []string {
+	var issues []string
+	kept := state.Editors[:0]
+	for _, entry := range state.Editors {
+		if _, err := os.Stat(entry.Path); !errors.Is(err, os.ErrNotExist) {
+			kept = append(kept, entry)
+			continue
+		}
+		reason := "文件不存在"
+		if _, err := os.Stat(filepath.Dir(entry.Path)); errors.Is(err, os.ErrNotExist) {
+			reason = "目录已不存在"
+		}
+		issues = append(issues, fmt.Sprintf("%s: %s, 重启时不会重新打开, 已移除", entry.Path, reason))
+	}
+	state.Editors = kept
+	return issues
+}
+
+func checkActive(_ StateEnv, state *WorkspaceState) []string {
+	if state.Active == "" {
+		return nil
+	}
+	for _, entry := range state.Editors {
+		if entry.Path == state.Active {
+			return nil
+		}
+	}
+	for _, entry := range state.Editors {
+		if sameStatePath(entry.Path, state.Active) {
+			msg := fmt.Sprintf("活动文件 %s 与编辑器列表中的 %s 写法不同, 已更正", state.Active, entry.Path)
+			state.Active = entry.Path
+			return []string{msg}
+		}
+	}
+	msg := fmt.Sprintf("活动文件 %s 不在编辑器列表中, 已清除", state.Active)
+	state.Active = ""
+	return []string{msg}
+}
+
+func checkLogging(_ StateEnv, state *WorkspaceState) []string {
+	var issues []string
+	clean := func(field string, paths []string) []string {
+		kept := paths[:0]
+		for _, path := range paths {
+			duplicate := false
+			for _, other := range kept {
+				if sameStatePath(path, other) {
+					duplicate = true
+					break
+				}
+			}
+			switch _, err := os.Stat(path); {
+			case duplicate:
+				issues = append(issues, fmt.Sprintf("%s 中 %s 重复, 已移除", field, path))
+			case errors.Is(err, os.ErrNotExist):
+				issues = append(issues, fmt.Sprintf("%s 中的 %s 已不存在, 已移除", field, path))
+			default:
+				kept = append(kept, path)
+			}
+		}
+		return kept
+	}
+	state.Logging = clean("logging", state.Logging)
+	state.LogOff = clean("logOff", state.LogOff)
+	return issues
+}
+
+func checkBookmarks(_ StateEnv, state *WorkspaceState) []string {
+	var issues []string
+	for i := range state.Editors {
+		entry := &state.Editors[i]
+		seen := map[string]bool{}
+		kept := entry.Bookmarks[:0]
+		for _, mark := range entry.Bookmarks {
+			switch {
+			case mark.Name == "" || mark.Line < 1 || mark.Col < 1:
+				issues = append(issues, fmt.Sprintf("%s 的书签 %q 位置无效 (%d:%d), 已移除", entry.Path, mark.Name, mark.Line, mark.Col))
+			case seen[mark.Name]:
+				issues = append(issues, fmt.Sprintf("%s 的书签 %s 重复, 已移除", entry.Path, mark.Name))
+			default:
+				seen[mark.Name] = true
+				kept = append(kept, mark)
+			}
+		}
+		entry.Bookmarks = kept
+	}
+	return issues
+}
+
+// sameStatePath reports whether two saved paths name the same file. Paths
+// differing only in case match unless both exist as different files.
+func sameStatePath(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	if !strings.EqualFold(filepath.Clean(a), filepath.Clean(b)) {
+		return false
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	return os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,75 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"softwaredesign/src/events"
+)
+
+// DefaultWatchInterval is used when watching is turned on without one.
+const DefaultWatchInterval = 2 * time.Second
+
+// StartWatch polls the files of open, unmodified editors every interval and
+// publishes EventFileChangedOnDisk once per change, replacing a running
+// watcher. Nothing is reloaded; modified editors are never reported.
+func (w *Workspace) StartWatch(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("监视间隔必须大于 0")
+	}
+	w.StopWatch()
+	w.watchSeen = map[string]string{}
+	w.watcher = w.startPoller(interval, w.pollDisk)
+	return nil
+}
+
+// StopWatch stops the watcher and waits for it to exit. It is safe to call
+// while holding the workspace lock.
+func (w *Workspace) StopWatch() {
+	if w.watcher == nil {
+		return
+	}
+	w.watcher.halt()
+	w.watcher = nil
+}
+
+// WatchInterval reports the interval of the running watcher.
+func (w *Workspace) WatchInterval() (time.Duration, bool) {
+	if w.watcher == nil {
+		return 0, false
+	}
+	return w.watcher.interval, true
+}
+
+// pollDisk publishes an event for each unmodified editor whose file changed
+// since its baseline and since the last event about it.
+func (w *Workspace) pollDisk() {
+	seen := map[string]string{}
+	for _, path := range w.openPaths() {
+		if w.editors[path].IsModified() {
+			continue
+		}
+		state, err := w.diskState(path)
+		if err != nil || state != DiskModified && state != DiskDeleted {
+			continue
+		}
+		version := string(state)
+		if info, err := os.Stat(path); err == nil {
+			version = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+		}
+		seen[path] = version
+		if w.watchSeen[path] == version {
+			continue
+		}
+		w.bus.Publish(events.Event{
+			Type:      events.EventFileChangedOnDisk,
+			Timestamp: time.Now(),
+			Command:   "watch",
+			File:      path,
+			Metadata:  map[string]string{"state": string(state)},
+		})
+	}
+	w.watchSeen = seen
+}
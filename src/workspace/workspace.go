@@ -3,60 +3,247 @@ package workspace
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"softwaredesign/src/charset"
 	"softwaredesign/src/editor"
 	"softwaredesign/src/events"
 	"softwaredesign/src/fs"
 	"softwaredesign/src/logging"
 	"softwaredesign/src/spellcheck"
 	"softwaredesign/src/statistics"
+	"softwaredesign/src/version"
 )
 
+const defaultFileMode os.FileMode = 0o644
+
+// defaultUndoLimit caps each editor's undo stack unless undo-limit says otherwise.
+const defaultUndoLimit = 100
+
 // SaveDecider asks user whether to save modifications.
 type SaveDecider interface {
 	ConfirmSave(path string) (bool, error)
 }
 
+// ErrCloseCancelled is returned by a SaveDecider asked to keep the file open
+// instead of deciding whether to save it.
+var ErrCloseCancelled = errors.New("已取消关闭")
+
+// TimedDecider is a SaveDecider whose prompts can give up after a timeout and
+// fall back to a default answer.
+type TimedDecider interface {
+	SetPromptTimeout(timeout time.Duration, defaultAnswer bool)
+}
+
+// PresetDecider is a SaveDecider that can already know the answer to a save
+// prompt, so no prompt is needed.
+type PresetDecider interface {
+	// PresetSave returns the answer and true when asking is unnecessary.
+	PresetSave() (save bool, preset bool)
+}
+
+// ClosePolicy decides how modified editors are handled when a save prompt cannot be answered.
+type ClosePolicy string
+
+const (
+	// ClosePolicyAsk reports an error when the prompt cannot be answered.
+	ClosePolicyAsk ClosePolicy = "ask"
+	// ClosePolicySave saves the editor when the prompt cannot be answered.
+	ClosePolicySave ClosePolicy = "save"
+	// ClosePolicyDiscard drops unsaved changes when the prompt cannot be answered.
+	ClosePolicyDiscard ClosePolicy = "discard"
+)
+
+// ParseClosePolicy validates a close policy name.
+func ParseClosePolicy(value string) (ClosePolicy, error) {
+	switch policy := ClosePolicy(strings.ToLower(value)); policy {
+	case ClosePolicyAsk, ClosePolicySave, ClosePolicyDiscard:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("未知的关闭策略: %s", value)
+	}
+}
+
 // Info describes an open editor.
 type Info struct {
-	Path     string
-	Name     string
-	Modified bool
-	Active   bool
-	Duration time.Duration
+	Path        string
+	Name        string
+	Modified    bool
+	Active      bool
+	Duration    time.Duration
+	LastCommand string
+	// Missing reports that the file was on disk but has since been removed.
+	Missing bool
+	// DirMissing reports that the file's whole directory has been removed.
+	DirMissing bool
+}
+
+// MemoryUsage pairs an open file with its editor's memory estimate.
+type MemoryUsage struct {
+	Path  string
+	Name  string
+	Stats editor.MemoryStats
+}
+
+// Summary aggregates the workspace overview shown by status.
+type Summary struct {
+	BaseDir  string
+	Open     int
+	Modified int
+	Active   string
+}
+
+// mutatingCommands lists commands that change document content.
+var mutatingCommands = map[string]bool{
+	"append": true, "insert": true, "insert-line": true, "move-line": true, "upper": true, "lower": true, "title-case": true, "join-lines": true, "split-line": true, "dup-line": true, "dup-lines": true, "swap-lines": true, "sort-lines": true, "expand-tabs": true, "compress-spaces": true, "delete": true, "replace": true, "replace-all": true, "wrap": true,
+	"delete-line": true, "delete-lines": true, "cut-lines": true, "paste": true,
+	"undo": true, "redo": true, "insert-before": true, "append-child": true,
+	"edit-id": true, "rename-ids": true, "edit-text": true, "delete-element": true,
+	"set-line-endings": true,
+}
+
+// IsMutating reports whether the named command changes document content.
+func IsMutating(command string) bool {
+	return mutatingCommands[command]
 }
 
 // Workspace coordinates editors, persistence, and observers.
 type Workspace struct {
+	mu      sync.RWMutex
 	baseDir string
 	editors map[string]editor.Editor
-	active  string
-	history []string
+	// xmlAsText marks XML files opened as read-only text after a parse failure.
+	xmlAsText map[string]bool
+	active    string
+	history   *RecentList
+	// closed lists recently closed files, most recent first.
+	closed   *RecentList
+	fileMode os.FileMode
+	policy   ClosePolicy
+
+	sizeThresholds []int
+	sizeWarned     map[string]int
+	historyLimit   int
+	historyWarned  map[string]bool
+	coalesce       bool
+	preserveRedo   bool
+	undoLimit      int
+	idPolicy       editor.IDPolicy
+	promptTimeout  time.Duration
+	promptDefault  bool
+	creditSlice    time.Duration
+	lastCommand    map[string]string
+	settings       *Settings
 
 	bus     *events.Bus
 	keeper  *StateKeeper
 	logger  *logging.Manager
 	decider SaveDecider
 	stats   *statistics.Tracker
+	ledger  *statistics.Ledger
 	speller *spellcheck.Service
+	// dictionaries maps open files to the word list their directive names.
+	dictionaries map[string]string
+	dictCache    *spellcheck.DictionaryCache
+	// onDisk marks open files that were read from or written to disk, so a
+	// vanished directory can be told apart from a new file's future one.
+	onDisk       map[string]bool
+	restoreNotes []string
+	// register holds text copied or cut for paste; it is not persisted.
+	register string
+	// fileOps journals reversible file operations for workspace-undo.
+	fileOps []fileOperation
+	// baselines holds each open file as last read from or written to disk,
+	// for detecting and merging external changes.
+	baselines map[string]*baseline
+	// initialized records buffers created by init and whether they started
+	// with a log header, so revert can reset them.
+	initialized map[string]bool
+	autosave    *poller
+	newTicker   TickerFactory
+	watcher     *poller
+	// watchSeen holds the disk version last reported for each changed file.
+	watchSeen map[string]string
+	// backup keeps backupCount copies of each file's previous version on save.
+	backup      bool
+	backupCount int
+	// largeFile is the size (bytes) from which text files are indexed
+	// instead of read; 0 disables large-file mode.
+	largeFile int64
+	// commands records the commands run; saveCommands keeps them in the
+	// history file across restarts.
+	commands       *CommandHistory
+	saveCommands   bool
+	commandsLoaded bool
+	// macros maps macro names to their commands; recording collects the
+	// macro being recorded, which is lost if not stopped before exit.
+	macros    map[string][]string
+	recording *macroRecording
+	// confirm is false when save prompts answer promptDefault unasked.
+	confirm bool
+	// projectRoot, when set by open-dir, replaces baseDir for resolving
+	// relative paths.
+	projectRoot string
 }
 
 // NewWorkspace builds a workspace.
 func NewWorkspace(baseDir string, bus *events.Bus, keeper *StateKeeper, logger *logging.Manager, decider SaveDecider) *Workspace {
-	return &Workspace{
-		baseDir: baseDir,
-		editors: map[string]editor.Editor{},
-		bus:     bus,
-		keeper:  keeper,
-		logger:  logger,
-		decider: decider,
-		stats:   statistics.NewTracker(),
-		speller: spellcheck.NewService(spellcheck.NewLanguageToolAdapter()),
+	w := &Workspace{
+		baseDir:        baseDir,
+		editors:        map[string]editor.Editor{},
+		xmlAsText:      map[string]bool{},
+		bus:            bus,
+		keeper:         keeper,
+		logger:         logger,
+		decider:        decider,
+		fileMode:       defaultFileMode,
+		policy:         ClosePolicyAsk,
+		history:        NewRecentList(defaultRecentLimit),
+		closed:         NewRecentList(defaultRecentLimit),
+		sizeThresholds: []int{10 << 20, 50 << 20},
+		sizeWarned:     map[string]int{},
+		historyLimit:   64 << 20,
+		historyWarned:  map[string]bool{},
+		lastCommand:    map[string]string{},
+		settings:       NewSettings(),
+		creditSlice:    time.Second,
+		undoLimit:      defaultUndoLimit,
+		idPolicy:       editor.IDExact,
+		stats:          statistics.NewTracker(),
+		ledger:         statistics.NewLedger(),
+		speller:        spellcheck.NewService(spellcheck.NewLanguageToolAdapter()),
+		dictionaries:   map[string]string{},
+		dictCache:      spellcheck.NewDictionaryCache(),
+		onDisk:         map[string]bool{},
+		baselines:      map[string]*baseline{},
+		initialized:    map[string]bool{},
+		newTicker:      newRealTicker,
+		backupCount:    defaultBackupCount,
+		largeFile:      defaultLargeFileMB << 20,
+		commands:       NewCommandHistory(defaultCommandHistoryLimit),
+		confirm:        true,
+		macros:         map[string][]string{},
 	}
+	w.stats.WithLedger(w.ledger)
+	w.registerSettings()
+	return w
+}
+
+// Logger exposes the log manager the workspace records commands with.
+func (w *Workspace) Logger() *logging.Manager {
+	return w.logger
+}
+
+// Settings exposes the runtime settings registry.
+func (w *Workspace) Settings() *Settings {
+	return w.settings
 }
 
 // SetDecider overrides the save decider.
@@ -74,71 +261,330 @@ func (w *Workspace) SetClock(clock statistics.Clock) {
 	w.stats.WithClock(clock)
 }
 
+// SetFileMode configures the permission bits used when saving new files.
+func (w *Workspace) SetFileMode(mode os.FileMode) error {
+	if mode&^os.ModePerm != 0 {
+		return fmt.Errorf("文件权限无效: %o", mode)
+	}
+	w.fileMode = mode
+	return nil
+}
+
+// SetClosePolicy configures the fallback used when a save prompt hits end of input.
+func (w *Workspace) SetClosePolicy(policy ClosePolicy) {
+	w.policy = policy
+}
+
+// ClosePolicy reports the configured close policy.
+func (w *Workspace) ClosePolicy() ClosePolicy {
+	return w.policy
+}
+
+// SetSizeThresholds configures the document sizes (bytes) that trigger a warning.
+func (w *Workspace) SetSizeThresholds(thresholds []int) {
+	sorted := append([]int(nil), thresholds...)
+	sort.Ints(sorted)
+	w.sizeThresholds = sorted
+	w.sizeWarned = map[string]int{}
+}
+
+// SizeWarning returns a one-time warning when the active editor crosses a size threshold.
+func (w *Workspace) SizeWarning() string {
+	ed, err := w.ActiveEditor()
+	if err != nil {
+		return ""
+	}
+	if _, lazy := ed.(*editor.LargeTextEditor); lazy {
+		return ""
+	}
+	size := ed.Size()
+	crossed := 0
+	for _, limit := range w.sizeThresholds {
+		if size >= limit {
+			crossed++
+		}
+	}
+	if crossed <= w.sizeWarned[ed.Path()] {
+		return ""
+	}
+	w.sizeWarned[ed.Path()] = crossed
+	limit := w.sizeThresholds[crossed-1]
+	return fmt.Sprintf("警告: %s 已超过 %dMB (当前约 %d 字节)，建议保存后重新打开，或使用 set size-thresholds 提高阈值", ed.Name(), limit>>20, size)
+}
+
+// SetHistoryLimit sets the retained undo history (bytes) that triggers a
+// suggestion to save and reopen; 0 disables it.
+func (w *Workspace) SetHistoryLimit(limit int) {
+	w.historyLimit = limit
+	w.historyWarned = map[string]bool{}
+}
+
+// HistoryWarning returns a one-time suggestion when the active editor's undo
+// history retains more than the history limit.
+func (w *Workspace) HistoryWarning() string {
+	ed, err := w.ActiveEditor()
+	if err != nil || w.historyLimit <= 0 || w.historyWarned[ed.Path()] {
+		return ""
+	}
+	stats := ed.MemoryStats()
+	if stats.HistoryBytes < w.historyLimit {
+		return ""
+	}
+	w.historyWarned[ed.Path()] = true
+	return fmt.Sprintf("提示: %s 的撤销历史已占用约 %d 字节 (%d 步)，建议保存后重新打开以释放历史，或使用 set history-warn 调整阈值", ed.Name(), stats.HistoryBytes, stats.UndoEntries)
+}
+
+// SetUndoCoalescing toggles undo coalescing for every open and future editor.
+func (w *Workspace) SetUndoCoalescing(enabled bool) {
+	w.coalesce = enabled
+	for _, ed := range w.editors {
+		w.configureEditor(ed)
+	}
+}
+
+// SetRedoPreserve toggles stashing of redo branches discarded by new edits.
+func (w *Workspace) SetRedoPreserve(enabled bool) {
+	w.preserveRedo = enabled
+	for _, ed := range w.editors {
+		w.configureEditor(ed)
+	}
+}
+
+// SetPromptTimeout bounds how long save prompts wait before answering with
+// defaultAnswer; zero waits indefinitely. It only affects a TimedDecider.
+func (w *Workspace) SetPromptTimeout(timeout time.Duration, defaultAnswer bool) {
+	w.promptTimeout = timeout
+	w.promptDefault = defaultAnswer
+	if timed, ok := w.decider.(TimedDecider); ok {
+		timed.SetPromptTimeout(timeout, defaultAnswer)
+	}
+}
+
+// PresetAnswer returns the answer to a save prompt and true when no prompt
+// is needed, because the confirm setting is off or a PresetDecider knows it.
+func (w *Workspace) PresetAnswer() (bool, bool) {
+	if !w.confirm {
+		return w.promptDefault, true
+	}
+	if preset, ok := w.decider.(PresetDecider); ok {
+		return preset.PresetSave()
+	}
+	return false, false
+}
+
+// SetUndoLimit caps the undo stack of every open and future editor; 0 removes the cap.
+func (w *Workspace) SetUndoLimit(limit int) {
+	w.undoLimit = limit
+	for _, ed := range w.editors {
+		w.configureEditor(ed)
+	}
+}
+
+// SetIDPolicy changes how every open and future XML editor compares element
+// IDs. It changes nothing if an open document has IDs that would collide.
+func (w *Workspace) SetIDPolicy(policy editor.IDPolicy) error {
+	paths := w.openPaths()
+	var applied []editor.IDPolicyEditor
+	for _, path := range paths {
+		p, ok := w.editors[path].(editor.IDPolicyEditor)
+		if !ok {
+			continue
+		}
+		previous := p.IDPolicy()
+		if err := p.SetIDPolicy(policy); err != nil {
+			for _, done := range applied {
+				_ = done.SetIDPolicy(previous)
+			}
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		applied = append(applied, p)
+	}
+	w.idPolicy = policy
+	return nil
+}
+
+// IDPolicy reports the XML ID comparison policy applied to editors.
+func (w *Workspace) IDPolicy() editor.IDPolicy {
+	return w.idPolicy
+}
+
+// UndoLimit reports the undo stack cap applied to editors.
+func (w *Workspace) UndoLimit() int {
+	return w.undoLimit
+}
+
+// SetRegister replaces the text held for paste.
+func (w *Workspace) SetRegister(text string) {
+	w.register = text
+}
+
+// Register returns the text held for paste, empty if nothing was copied.
+func (w *Workspace) Register() string {
+	return w.register
+}
+
+// SetCreditSlice sets the time credited to a non-active file targeted by a command.
+func (w *Workspace) SetCreditSlice(d time.Duration) {
+	w.creditSlice = d
+}
+
+// BreakCoalescing ends the active editor's current merge run.
+func (w *Workspace) BreakCoalescing() {
+	ed, err := w.ActiveEditor()
+	if err != nil {
+		return
+	}
+	if c, ok := ed.(editor.CoalescingEditor); ok {
+		c.BreakCoalescing()
+	}
+}
+
+// FileMode reports the permission bits used when saving new files.
+func (w *Workspace) FileMode() os.FileMode {
+	return w.fileMode
+}
+
 // BaseDir exposes the root directory.
 func (w *Workspace) BaseDir() string {
 	return w.baseDir
 }
 
-// Load opens or activates a file.
+// Load opens or activates a file, detecting its encoding from a byte order
+// mark.
 func (w *Workspace) Load(path string) (editor.Editor, error) {
+	return w.LoadEncoded(path, "")
+}
+
+// LoadEncoded opens or activates a file read in enc; an empty enc detects it.
+// An open file keeps its encoding, so naming a different one fails.
+func (w *Workspace) LoadEncoded(path string, enc charset.Encoding) (editor.Editor, error) {
 	abs, err := w.resolvePath(path)
 	if err != nil {
 		return nil, err
 	}
 	if ed, ok := w.editors[abs]; ok {
+		if current := encodingOf(ed); enc != "" && enc != current {
+			return nil, fmt.Errorf("文件已按 %s 编码打开, 请使用 set-encoding 修改", current)
+		}
 		w.setActive(abs)
 		return ed, nil
 	}
-	ext := strings.ToLower(filepath.Ext(abs))
-	var ed editor.Editor
-	switch ext {
-	case ".xml":
-		info, statErr := os.Stat(abs)
-		if statErr != nil {
-			if errors.Is(statErr, os.ErrNotExist) {
-				return nil, fmt.Errorf("XML 文件不存在: %s", abs)
-			}
-			return nil, statErr
-		}
-		if info.IsDir() {
-			return nil, fmt.Errorf("无法打开目录: %s", abs)
-		}
-		data, readErr := os.ReadFile(abs)
-		if readErr != nil {
-			return nil, readErr
-		}
-		parsed, parseErr := editor.ParseXMLEditor(abs, data)
-		if parseErr != nil {
-			return nil, parseErr
-		}
-		ed = parsed
-	default:
-		lines := []string{}
-		modified := false
-		info, statErr := os.Stat(abs)
-		if statErr != nil {
-			if errors.Is(statErr, os.ErrNotExist) {
-				modified = true
-			} else {
-				return nil, statErr
-			}
-		} else if info.IsDir() {
-			return nil, fmt.Errorf("无法打开目录: %s", abs)
-		} else {
-			data, readErr := os.ReadFile(abs)
-			if readErr != nil {
-				return nil, readErr
-			}
-			lines = splitLines(string(data))
-		}
-		ed = editor.NewTextEditor(abs, lines, modified)
+	ed, err := w.openFile(abs, enc)
+	if err != nil {
+		return nil, err
 	}
+	w.configureEditor(ed)
 	w.editors[abs] = ed
+	w.onDisk[abs] = true
+	w.recordBaseline(abs)
 	w.setActive(abs)
 	w.applyAutoLog(ed)
+	w.applyDictDirective(ed)
+	return ed, nil
+}
+
+// LoadXMLAsText opens an XML file that fails to parse as a read-only text
+// editor, so it can be inspected, fixed, and reloaded.
+func (w *Workspace) LoadXMLAsText(path string) (editor.Editor, error) {
+	abs, err := w.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if ed, ok := w.editors[abs]; ok {
+		w.setActive(abs)
+		return ed, nil
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	ed := editor.NewTextEditor(abs, splitLines(string(data)), false)
+	ed.SetReadOnly(true)
+	w.configureEditor(ed)
+	w.editors[abs] = ed
+	w.xmlAsText[abs] = true
+	w.onDisk[abs] = true
+	w.setBaseline(abs, splitLines(string(data)))
+	w.setActive(abs)
+	return ed, nil
+}
+
+// IsXMLAsText reports whether path is an XML file opened as text.
+func (w *Workspace) IsXMLAsText(path string) bool {
+	abs, err := w.resolvePath(path)
+	return err == nil && w.xmlAsText[abs]
+}
+
+// Reload re-reads an unmodified file from disk; an XML file opened as text
+// switches back to the XML editor once it parses.
+func (w *Workspace) Reload(path string) (editor.Editor, error) {
+	target := path
+	if target == "" {
+		target = w.active
+	}
+	if target == "" {
+		return nil, errors.New("没有活动文件")
+	}
+	abs, err := w.resolvePath(target)
+	if err != nil {
+		return nil, err
+	}
+	current, ok := w.editors[abs]
+	if !ok {
+		return nil, fmt.Errorf("文件未打开: %s", target)
+	}
+	if current.IsModified() {
+		return nil, errors.New("文件有未保存的修改, 请先保存")
+	}
+	ed, err := w.openFile(abs, encodingOf(current))
+	if err != nil {
+		return nil, err
+	}
+	w.replaceEditor(abs, ed)
 	return ed, nil
 }
 
+// Revert discards a file's unsaved changes and undo history, reloading it
+// from disk or, for a buffer never saved, resetting it to what init created.
+func (w *Workspace) Revert(path string) (editor.Editor, error) {
+	target := path
+	if target == "" {
+		target = w.active
+	}
+	if target == "" {
+		return nil, errors.New("没有活动文件")
+	}
+	abs, err := w.ResolveOpen(target)
+	if err != nil {
+		return nil, err
+	}
+	var ed editor.Editor
+	withLog, initialized := w.initialized[abs]
+	if _, statErr := os.Stat(abs); statErr != nil && initialized {
+		ed = newBuffer(abs, w.editors[abs].Type(), withLog)
+	} else if ed, err = w.openFile(abs, encodingOf(w.editors[abs])); err != nil {
+		return nil, err
+	}
+	w.replaceEditor(abs, ed)
+	return ed, nil
+}
+
+// replaceEditor swaps in a freshly read editor for abs, keeping a read-only
+// flag unless it only marked a file that failed to parse.
+func (w *Workspace) replaceEditor(abs string, ed editor.Editor) {
+	if old, ok := w.editors[abs]; ok && !w.xmlAsText[abs] {
+		ed.SetReadOnly(old.IsReadOnly())
+	}
+	w.configureEditor(ed)
+	w.editors[abs] = ed
+	delete(w.xmlAsText, abs)
+	delete(w.sizeWarned, abs)
+	delete(w.historyWarned, abs)
+	w.recordBaseline(abs)
+	w.applyAutoLog(ed)
+	w.applyDictDirective(ed)
+}
+
 // Init creates an unsaved buffer.
 func (w *Workspace) Init(kind, path string, withLog bool) (editor.Editor, error) {
 	abs, err := w.resolvePath(path)
@@ -151,27 +597,43 @@ func (w *Workspace) Init(kind, path string, withLog bool) (editor.Editor, error)
 	var ed editor.Editor
 	switch strings.ToLower(kind) {
 	case "text":
-		lines := []string{}
-		if withLog {
-			lines = []string{"# log"}
-		}
-		ed = editor.NewTextEditor(abs, lines, true)
+		ed = newBuffer(abs, editor.TypeText, withLog)
 	case "xml":
-		root := editor.NewDefaultXMLDocument(withLog)
-		ed = editor.NewXMLEditor(abs, root, true)
+		ed = newBuffer(abs, editor.TypeXML, withLog)
 	default:
 		return nil, fmt.Errorf("未知的编辑器类型: %s", kind)
 	}
+	w.configureEditor(ed)
 	w.editors[abs] = ed
+	w.initialized[abs] = withLog
 	w.setActive(abs)
 	if withLog {
-		_ = w.logger.Enable(abs)
+		if err := w.logger.Enable(abs); err == nil {
+			w.PublishCommandWith("log-on", "log-on "+abs, abs, map[string]string{"source": "init"})
+		}
 	}
 	return ed, nil
 }
 
-// Save writes the specified file (empty path means active).
+// newBuffer builds the initial content of an unsaved buffer.
+func newBuffer(abs string, kind editor.Type, withLog bool) editor.Editor {
+	if kind == editor.TypeXML {
+		return editor.NewXMLEditor(abs, editor.NewDefaultXMLDocument(withLog), true)
+	}
+	lines := []string{}
+	if withLog {
+		lines = []string{"# log"}
+	}
+	return editor.NewTextEditor(abs, lines, true)
+}
+
+// Save writes the specified file (empty path means active). It fails with
+// ExternalChangeError when the file changed on disk since it was read.
 func (w *Workspace) Save(path string) error {
+	return w.save(path, w.saveEditor)
+}
+
+func (w *Workspace) save(path string, write func(editor.Editor) error) error {
 	target := path
 	if target == "" {
 		target = w.active
@@ -179,74 +641,295 @@ func (w *Workspace) Save(path string) error {
 	if target == "" {
 		return errors.New("没有活动文件")
 	}
-	abs, err := w.resolvePath(target)
+	abs, err := w.ResolveOpen(target)
 	if err != nil {
 		return err
 	}
-	ed, ok := w.editors[abs]
-	if !ok {
-		return fmt.Errorf("文件未打开: %s", target)
-	}
-	if err := w.saveEditor(ed); err != nil {
+	ed := w.editors[abs]
+	if err := write(ed); err != nil {
 		return err
 	}
 	ed.SetModified(false)
+	w.ledger.CountSave(abs)
 	return nil
 }
 
-// SaveAll writes every open editor.
-func (w *Workspace) SaveAll() error {
-	for _, ed := range w.editors {
+// NotOpenError reports a path that matches no open editor, telling apart a
+// file that exists on disk from a likely typo. Suggestions lists open files
+// with the same name elsewhere, or else open names close to it.
+type NotOpenError struct {
+	Path        string
+	OnDisk      bool
+	Suggestions []string
+}
+
+func (e *NotOpenError) Error() string {
+	switch {
+	case e.OnDisk && len(e.Suggestions) > 0:
+		return fmt.Sprintf("文件未打开: %s (文件存在于磁盘, 可使用 load 打开; 已打开的同名文件: %s)", e.Path, strings.Join(e.Suggestions, ", "))
+	case e.OnDisk:
+		return fmt.Sprintf("文件未打开: %s (文件存在于磁盘, 可使用 load 打开)", e.Path)
+	case len(e.Suggestions) > 0:
+		return fmt.Sprintf("文件未打开: %s (是否想输入: %s?)", e.Path, strings.Join(e.Suggestions, ", "))
+	default:
+		return fmt.Sprintf("文件未打开: %s", e.Path)
+	}
+}
+
+// ResolveOpen maps path to the absolute path of an open editor. Besides the
+// exact path it accepts other spellings of the same file, such as symlinks;
+// otherwise it returns a *NotOpenError.
+func (w *Workspace) ResolveOpen(path string) (string, error) {
+	abs, err := w.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := w.editors[abs]; ok {
+		return abs, nil
+	}
+	info, statErr := os.Stat(abs)
+	if statErr == nil {
+		for open := range w.editors {
+			if openInfo, err := os.Stat(open); err == nil && os.SameFile(info, openInfo) {
+				return open, nil
+			}
+		}
+	}
+	notOpen := &NotOpenError{Path: path, OnDisk: statErr == nil}
+	notOpen.Suggestions = w.sameNameOpen(filepath.Base(abs))
+	if len(notOpen.Suggestions) == 0 && !notOpen.OnDisk {
+		notOpen.Suggestions = w.similarOpenNames(filepath.Base(path))
+	}
+	return "", notOpen
+}
+
+// sameNameOpen lists the open files named name, relative to the project
+// root where possible, in path order.
+func (w *Workspace) sameNameOpen(name string) []string {
+	var matches []string
+	for open := range w.editors {
+		if filepath.Base(open) != name {
+			continue
+		}
+		if rel, err := filepath.Rel(w.ProjectRoot(), open); err == nil && !strings.HasPrefix(rel, "..") {
+			open = rel
+		}
+		matches = append(matches, open)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// similarOpenNames lists up to three open file names within edit distance 2 of name.
+func (w *Workspace) similarOpenNames(name string) []string {
+	type candidate struct {
+		name string
+		dist int
+	}
+	var candidates []candidate
+	for open := range w.editors {
+		base := filepath.Base(open)
+		if dist := spellcheck.Levenshtein(name, base); dist <= 2 {
+			candidates = append(candidates, candidate{name: base, dist: dist})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].dist == candidates[j].dist {
+			return candidates[i].name < candidates[j].name
+		}
+		return candidates[i].dist < candidates[j].dist
+	})
+	var names []string
+	for i := 0; i < len(candidates) && i < 3; i++ {
+		names = append(names, candidates[i].name)
+	}
+	return names
+}
+
+// SaveAll writes every open editor in path order, reporting progress as a
+// save-all operation.
+func (w *Workspace) SaveAll() (err error) {
+	paths := w.openPaths()
+	op := w.StartOperation("save-all", paths, len(paths))
+	defer func() { op.Finish(err) }()
+	for _, path := range paths {
+		ed := w.editors[path]
 		if err := w.saveEditor(ed); err != nil {
 			return err
 		}
 		ed.SetModified(false)
+		w.ledger.CountSave(ed.Path())
+		op.Step(path)
 	}
 	return nil
 }
 
+// StartOperation announces a long operation to observers; the caller must
+// finish it.
+func (w *Workspace) StartOperation(name string, files []string, total int) *events.Operation {
+	return w.bus.StartOperation(name, files, total)
+}
+
+// openPaths lists the open files in path order.
+func (w *Workspace) openPaths() []string {
+	paths := make([]string, 0, len(w.editors))
+	for path := range w.editors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// CloseResult describes the focus change caused by closing an editor.
+type CloseResult struct {
+	Closed         string
+	PreviousActive string
+	Active         string
+}
+
+// FocusChanged reports whether the active editor differs after the close.
+func (r CloseResult) FocusChanged() bool {
+	return r.PreviousActive != r.Active
+}
+
+// CloseDisposition decides what happens to unsaved changes on close.
+type CloseDisposition string
+
+const (
+	// CloseAsk consults the save decider (the default).
+	CloseAsk CloseDisposition = "ask"
+	// CloseSave writes unsaved changes without asking.
+	CloseSave CloseDisposition = "save"
+	// CloseDiscard drops unsaved changes without asking.
+	CloseDiscard CloseDisposition = "discard"
+)
+
 // Close removes an editor, prompting when necessary.
-func (w *Workspace) Close(path string) error {
+func (w *Workspace) Close(path string) (CloseResult, error) {
+	return w.CloseWith(path, CloseAsk)
+}
+
+// CloseAll closes every open editor but except (none when empty) in path
+// order using the given disposition. Files whose save prompt is cancelled
+// stay open; any other failure stops it, and editors closed before it stay
+// closed.
+func (w *Workspace) CloseAll(disposition CloseDisposition, except string) ([]CloseResult, error) {
+	var keep string
+	if except != "" {
+		abs, err := w.ResolveOpen(except)
+		if err != nil {
+			return nil, err
+		}
+		keep = abs
+	}
+	paths := w.openPaths()
+	results := make([]CloseResult, 0, len(paths))
+	closed := &closeOperation{}
+	active := w.active
+	defer func() {
+		if len(closed.files) == 0 {
+			return
+		}
+		// Closing moves focus along, so only the file active beforehand counts.
+		for i := range closed.files {
+			closed.files[i].wasActive = closed.files[i].ed.Path() == active
+		}
+		w.journal(closed)
+	}()
+	for _, path := range paths {
+		if path == keep {
+			continue
+		}
+		result, file, err := w.closeEditor(path, disposition)
+		if errors.Is(err, ErrCloseCancelled) {
+			continue
+		}
+		if err != nil {
+			return results, err
+		}
+		closed.files = append(closed.files, file)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// CloseWith removes an editor; CloseSave and CloseDiscard bypass the save decider.
+func (w *Workspace) CloseWith(path string, disposition CloseDisposition) (CloseResult, error) {
+	result, file, err := w.closeEditor(path, disposition)
+	if err != nil {
+		return CloseResult{}, err
+	}
+	w.journal(&closeOperation{files: []closedFile{file}})
+	return result, nil
+}
+
+// closeEditor closes one editor and returns what workspace-undo needs to reopen it.
+func (w *Workspace) closeEditor(path string, disposition CloseDisposition) (CloseResult, closedFile, error) {
+	if disposition == "" {
+		disposition = CloseAsk
+	}
 	target := path
 	if target == "" {
 		target = w.active
 	}
 	if target == "" {
-		return errors.New("没有活动文件")
+		return CloseResult{}, closedFile{}, errors.New("没有活动文件")
 	}
-	abs, err := w.resolvePath(target)
+	abs, err := w.ResolveOpen(target)
 	if err != nil {
-		return err
-	}
-	ed, ok := w.editors[abs]
-	if !ok {
-		return fmt.Errorf("文件未打开: %s", target)
+		return CloseResult{}, closedFile{}, err
 	}
-	if ed.IsModified() && w.decider != nil {
-		save, decErr := w.decider.ConfirmSave(abs)
-		if decErr != nil {
-			return decErr
+	ed := w.editors[abs]
+	if ed.IsModified() {
+		save := disposition == CloseSave
+		if disposition == CloseAsk && (w.decider != nil || !w.confirm) {
+			var decErr error
+			save, decErr = w.confirmSave(abs)
+			if decErr != nil {
+				return CloseResult{}, closedFile{}, decErr
+			}
 		}
 		if save {
-			if err := w.saveEditor(ed); err != nil {
-				return err
+			if err := w.saveConfirmed(ed); err != nil {
+				return CloseResult{}, closedFile{}, err
 			}
 			ed.SetModified(false)
 		}
 	}
+	result := CloseResult{Closed: abs, PreviousActive: w.active}
+	file := closedFile{
+		ed:         ed,
+		xmlAsText:  w.xmlAsText[abs],
+		dictionary: w.dictionaries[abs],
+		onDisk:     w.onDisk[abs],
+		baseline:   w.baselines[abs],
+		wasActive:  w.active == abs,
+	}
 	w.stats.Close(abs)
 	delete(w.editors, abs)
-	w.removeFromHistory(abs)
+	delete(w.xmlAsText, abs)
+	delete(w.sizeWarned, abs)
+	delete(w.historyWarned, abs)
+	delete(w.dictionaries, abs)
+	delete(w.lastCommand, abs)
+	delete(w.onDisk, abs)
+	delete(w.baselines, abs)
+	delete(w.initialized, abs)
+	w.history.Remove(abs)
+	w.closed.Touch(abs)
 	next := ""
 	if w.active == abs {
-		if len(w.history) > 0 {
-			next = w.history[0]
+		next = w.history.Front()
+		if next == "" && len(w.editors) > 0 {
+			// Files beyond the history cap are still open.
+			next = w.openPaths()[0]
 		}
 	} else {
 		next = w.active
 	}
 	w.setActive(next)
-	return nil
+	result.Active = w.active
+	return result, file, nil
 }
 
 // Edit switches the active editor.
@@ -267,41 +950,186 @@ func (w *Workspace) List() []Info {
 	result := make([]Info, 0, len(w.editors))
 	for path, ed := range w.editors {
 		result = append(result, Info{
-			Path:     path,
-			Name:     ed.Name(),
-			Modified: ed.IsModified(),
-			Active:   path == w.active,
-			Duration: w.stats.Duration(path),
+			Path:        path,
+			Name:        ed.Name(),
+			Modified:    ed.IsModified(),
+			Active:      path == w.active,
+			Duration:    w.stats.Duration(path),
+			LastCommand: w.lastCommand[path],
+			Missing:     w.missingFile(path),
+			DirMissing:  w.missingDir(path) != "",
 		})
 	}
 	return result
 }
 
+// Memory reports the memory estimate of every open editor, ordered by path.
+func (w *Workspace) Memory() []MemoryUsage {
+	result := make([]MemoryUsage, 0, len(w.editors))
+	for path, ed := range w.editors {
+		result = append(result, MemoryUsage{Path: path, Name: ed.Name(), Stats: ed.MemoryStats()})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// Activity reports per-file, per-day activity, including the running span of
+// the active file, ordered by file and day.
+func (w *Workspace) Activity() []statistics.DayActivity {
+	w.stats.Checkpoint()
+	return statistics.Aggregate(w.ledger.Entries())
+}
+
+// Ledger exposes the activity ledger (primarily for tests).
+func (w *Workspace) Ledger() *statistics.Ledger {
+	return w.ledger
+}
+
+// Summary reports open and unsaved file counts together with the active file.
+func (w *Workspace) Summary() Summary {
+	summary := Summary{BaseDir: w.baseDir, Open: len(w.editors), Active: w.active}
+	for _, ed := range w.editors {
+		if ed.IsModified() {
+			summary.Modified++
+		}
+	}
+	return summary
+}
+
+// Lock grants exclusive access while a command runs.
+func (w *Workspace) Lock() {
+	w.mu.Lock()
+}
+
+// Unlock releases the access granted by Lock.
+func (w *Workspace) Unlock() {
+	w.mu.Unlock()
+}
+
+// View runs fn while holding shared access, for readers on other goroutines.
+func (w *Workspace) View(fn func()) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	fn()
+}
+
 // DirTree prints a directory tree.
-func (w *Workspace) DirTree(path string) (string, error) {
-	target := path
-	if target == "" {
-		target = w.baseDir
+func (w *Workspace) DirTree(path string, opts fs.Options) (string, error) {
+	target, err := w.treeTarget(path)
+	if err != nil {
+		return "", err
+	}
+	return fs.Tree(target, opts)
+}
+
+// NumberedDirTree prints a directory tree with numbered files and returns
+// the file paths by number, starting at index 0 for [1].
+func (w *Workspace) NumberedDirTree(path string, opts fs.Options) (string, []string, error) {
+	target, err := w.treeTarget(path)
+	if err != nil {
+		return "", nil, err
+	}
+	opts.Numbered = true
+	node, err := fs.Scan(target, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	return fs.Render(node, opts), fs.Files(node, target), nil
+}
+
+// ScanDir builds a structured directory tree.
+func (w *Workspace) ScanDir(path string, opts fs.Options) (*fs.Node, error) {
+	target, err := w.treeTarget(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Scan(target, opts)
+}
+
+// EditorMark marks path for a directory tree: "*" when it is open, plus
+// "[modified]" when its buffer has unsaved changes.
+func (w *Workspace) EditorMark(path string) string {
+	ed, ok := w.editors[path]
+	if !ok {
+		return ""
+	}
+	if ed.IsModified() {
+		return "* [modified]"
+	}
+	return "*"
+}
+
+// treeTarget resolves the directory a tree lists: path against the project
+// root, or the project root itself.
+func (w *Workspace) treeTarget(path string) (string, error) {
+	if path == "" {
+		return w.ProjectRoot(), nil
 	}
-	return fs.Tree(target)
+	return w.resolvePath(path)
 }
 
-// Undo reverts an edit.
+// Undo reverts the active editor's last edit.
 func (w *Workspace) Undo() error {
+	_, err := w.UndoN(1)
+	return err
+}
+
+// UndoN reverts up to n edits of the active editor and reports how many were reverted.
+func (w *Workspace) UndoN(n int) (int, error) {
 	ed, err := w.ActiveEditor()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return ed.Undo()
+	desc := ed.UndoDescription()
+	done, err := ed.UndoN(n)
+	w.recordSteps(ed, "undo", desc, done)
+	return done, err
 }
 
 // Redo reapplies an edit.
 func (w *Workspace) Redo() error {
+	_, err := w.RedoN(1)
+	return err
+}
+
+// RedoN reapplies up to n edits of the active editor and reports how many were reapplied.
+func (w *Workspace) RedoN(n int) (int, error) {
+	ed, err := w.ActiveEditor()
+	if err != nil {
+		return 0, err
+	}
+	desc := ed.RedoDescription()
+	done, err := ed.RedoN(n)
+	w.recordSteps(ed, "redo", desc, done)
+	return done, err
+}
+
+func (w *Workspace) recordSteps(ed editor.Editor, cmd, desc string, done int) {
+	switch {
+	case done == 1:
+		w.lastCommand[ed.Path()] = fmt.Sprintf("%s (%s)", cmd, desc)
+	case done > 1:
+		w.lastCommand[ed.Path()] = fmt.Sprintf("%s %d", cmd, done)
+	}
+}
+
+// RedoStashed recovers the active editor's stashed redo branch.
+func (w *Workspace) RedoStashed() error {
 	ed, err := w.ActiveEditor()
 	if err != nil {
 		return err
 	}
-	return ed.Redo()
+	r, ok := ed.(editor.RedoStashingEditor)
+	if !ok {
+		return errors.New("当前编辑器不支持暂存重做分支")
+	}
+	if err := r.RedoStashed(); err != nil {
+		return err
+	}
+	w.lastCommand[ed.Path()] = fmt.Sprintf("redo --stashed (%s)", ed.UndoDescription())
+	return nil
 }
 
 // ActiveEditor returns the current editor.
@@ -349,25 +1177,87 @@ func (w *Workspace) SpellCheck(path string) (string, error) {
 	if !ok {
 		return "", fmt.Errorf("文件未打开: %s", target)
 	}
+	speller := w.speller
+	var warnings []string
+	if dict := w.dictionaries[abs]; dict != "" {
+		words, err := w.dictCache.Load(dict)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			warnings = append(warnings, "警告: 词典文件不存在: "+dict)
+		case err != nil:
+			warnings = append(warnings, fmt.Sprintf("警告: 词典文件读取失败: %v", err))
+		default:
+			speller = speller.WithIgnored(words)
+		}
+	}
 	switch doc := ed.(type) {
 	case editor.TextDocument:
-		issues := w.speller.CheckLines(doc.Lines())
-		return formatTextIssues(issues), nil
+		lines := doc.Lines()
+		if len(lines) > 0 && parseDictDirective(lines[0]) != "" {
+			lines[0] = ""
+		}
+		issues := speller.CheckLinesWith(speller.Extractors().ForPath(abs), lines)
+		return formatTextIssues(issues, warnings), nil
+	case *editor.LargeTextEditor:
+		issues, err := spellCheckLarge(speller, abs, doc)
+		if err != nil {
+			return "", err
+		}
+		return formatTextIssues(issues, warnings), nil
 	case editor.XMLTreeEditor:
 		raw := doc.TextNodes()
 		entries := make([]spellcheck.XMLText, len(raw))
 		for i, entry := range raw {
 			entries[i] = spellcheck.XMLText{ElementID: entry.ElementID, Text: entry.Text}
 		}
-		issues := w.speller.CheckXMLText(entries)
-		return formatXMLIssues(issues), nil
+		issues := speller.CheckXMLText(entries)
+		return formatXMLIssues(issues, warnings), nil
 	default:
 		return "", errors.New("当前文件不支持拼写检查")
 	}
 }
 
+// SpellCheckResult is the spell check report of one file.
+type SpellCheckResult struct {
+	Path   string
+	Report string
+}
+
+// SpellCheckAll checks every open file in path order, reporting progress as
+// a spell-check-all operation. It stops at the first file that cannot be checked.
+func (w *Workspace) SpellCheckAll() (results []SpellCheckResult, err error) {
+	paths := w.openPaths()
+	op := w.StartOperation("spell-check-all", paths, len(paths))
+	defer func() { op.Finish(err) }()
+	for _, path := range paths {
+		report, err := w.SpellCheck(path)
+		if err != nil {
+			return results, fmt.Errorf("%s: %v", path, err)
+		}
+		results = append(results, SpellCheckResult{Path: path, Report: report})
+		op.Step(path)
+	}
+	return results, nil
+}
+
 // PublishCommand notifies observers about a command.
 func (w *Workspace) PublishCommand(name, raw, file string) {
+	w.PublishCommandWith(name, raw, file, nil)
+}
+
+// PublishCommandWith notifies observers about a command with extra metadata.
+func (w *Workspace) PublishCommandWith(name, raw, file string, extra map[string]string) {
+	if file != "" && IsMutating(name) && name != "undo" && name != "redo" && extra["noop"] != "true" {
+		if _, open := w.editors[file]; open {
+			w.lastCommand[file] = raw
+		}
+	}
+	if file != "" && file != w.active {
+		if _, open := w.editors[file]; open {
+			w.stats.Credit(file, w.creditSlice)
+		}
+	}
+	w.ledger.CountCommand(file)
 	if w.bus == nil {
 		return
 	}
@@ -375,6 +1265,12 @@ func (w *Workspace) PublishCommand(name, raw, file string) {
 	if w.active != "" {
 		metadata["active"] = w.active
 	}
+	if file != "" {
+		metadata["target"] = file
+	}
+	for key, value := range extra {
+		metadata[key] = value
+	}
 	w.bus.Publish(events.Event{
 		Type:      events.EventCommandExecuted,
 		Timestamp: time.Now(),
@@ -385,19 +1281,60 @@ func (w *Workspace) PublishCommand(name, raw, file string) {
 	})
 }
 
-// Persist saves workspace metadata.
+// PublishHistoryTruncated notifies observers that an edit discarded count redo
+// entries of file, noting whether they were stashed for redo --stashed.
+func (w *Workspace) PublishHistoryTruncated(file string, count int, stashed bool) {
+	if w.bus == nil {
+		return
+	}
+	w.bus.Publish(events.Event{
+		Type:      events.EventHistoryTruncated,
+		Timestamp: time.Now(),
+		File:      file,
+		Metadata:  map[string]string{"discarded": strconv.Itoa(count), "stashed": strconv.FormatBool(stashed)},
+	})
+}
+
+// Persist stops autosave and the watcher and saves workspace metadata.
 func (w *Workspace) Persist() error {
+	w.StopAutosave()
+	w.StopWatch()
 	state := WorkspaceState{
 		Active: w.active,
 	}
 	for path, ed := range w.editors {
-		state.Editors = append(state.Editors, EditorState{
-			Path:     path,
-			Modified: ed.IsModified(),
-		})
+		entry := EditorState{
+			Path:       path,
+			Modified:   ed.IsModified(),
+			DirMissing: w.missingDir(path) != "",
+			ReadOnly:   ed.IsReadOnly() && !w.xmlAsText[path],
+		}
+		if enc := encodingOf(ed); enc != charset.UTF8 {
+			entry.Encoding = enc
+		}
+		if doc, ok := ed.(editor.Bookmarker); ok {
+			for _, mark := range doc.Marks() {
+				entry.Bookmarks = append(entry.Bookmarks, BookmarkState{Name: mark.Name, Line: mark.Line, Col: mark.Col})
+			}
+		}
+		state.Editors = append(state.Editors, entry)
+	}
+	state.Logging, state.LogOff = w.logger.ExplicitPaths()
+	state.Settings = w.settings.Persisted()
+	state.Recent = w.history.Paths()
+	state.Closed = w.closed.Paths()
+	state.ProjectRoot = w.projectRoot
+	if len(w.macros) > 0 {
+		state.Macros = w.macros
 	}
-	state.Logging = w.logger.ActivePaths()
+	state.Version = version.Get().Version
 	w.stats.StopAll()
+	state.Activity = w.ledger.Entries()
+	if w.saveCommands {
+		if err := w.keeper.SaveHistory(w.commands.Commands()); err != nil {
+			return err
+		}
+	}
 	return w.keeper.Save(state)
 }
 
@@ -410,32 +1347,97 @@ func (w *Workspace) Restore() error {
 		}
 		return err
 	}
+	// Saved decisions go first so auto-log markers only apply to files they do not mention.
+	w.logger.Restore(state.Logging, state.LogOff)
+	w.ledger.Restore(state.Activity)
+	for name, steps := range state.Macros {
+		w.macros[name] = steps
+	}
+	w.restoreNotes = nil
+	// Settings go before the files so documents are parsed under the saved
+	// XML ID policy.
+	settingErrs := w.settings.Restore(state.Settings)
+	if state.ProjectRoot != "" {
+		if info, statErr := os.Stat(state.ProjectRoot); statErr == nil && info.IsDir() {
+			w.projectRoot = state.ProjectRoot
+		} else {
+			w.restoreNotes = append(w.restoreNotes, fmt.Sprintf("项目目录已不存在, 改用工作区目录: %s", state.ProjectRoot))
+		}
+	}
 	for _, entry := range state.Editors {
 		if _, statErr := os.Stat(entry.Path); statErr != nil {
+			w.noteSkipped(entry, statErr)
 			continue
 		}
-		ed, loadErr := w.Load(entry.Path)
+		ed, loadErr := w.LoadEncoded(entry.Path, entry.Encoding)
 		if loadErr != nil {
+			w.noteSkipped(entry, loadErr)
 			continue
 		}
 		ed.SetModified(entry.Modified)
+		ed.SetReadOnly(entry.ReadOnly)
+		w.restoreMarks(ed, entry.Bookmarks)
+	}
+	for i := len(state.Recent) - 1; i >= 0; i-- {
+		if _, ok := w.editors[state.Recent[i]]; ok {
+			w.history.Touch(state.Recent[i])
+		}
+	}
+	for i := len(state.Closed) - 1; i >= 0; i-- {
+		w.closed.Touch(state.Closed[i])
 	}
 	if state.Active != "" {
 		if _, ok := w.editors[state.Active]; ok {
 			w.setActive(state.Active)
+			w.history.Touch(state.Active)
 		}
 	}
-	w.logger.Restore(state.Logging)
+	if len(settingErrs) > 0 {
+		return settingErrs[0]
+	}
 	return nil
 }
 
+// RestoreNotes explains why files recorded in the saved state were not reopened
+// by the last Restore.
+func (w *Workspace) RestoreNotes() []string {
+	return w.restoreNotes
+}
+
+// restoreMarks reapplies saved bookmarks, noting those the file no longer has room for.
+func (w *Workspace) restoreMarks(ed editor.Editor, marks []BookmarkState) {
+	doc, ok := ed.(editor.Bookmarker)
+	if !ok {
+		return
+	}
+	for _, mark := range marks {
+		if err := doc.SetMark(mark.Name, mark.Line, mark.Col); err != nil {
+			w.restoreNotes = append(w.restoreNotes, fmt.Sprintf("已丢弃 %s 的书签 %s: %v", ed.Path(), mark.Name, err))
+		}
+	}
+}
+
+func (w *Workspace) noteSkipped(entry EditorState, err error) {
+	reason := err.Error()
+	dir := filepath.Dir(entry.Path)
+	if _, statErr := os.Stat(dir); errors.Is(statErr, os.ErrNotExist) {
+		reason = "目录已不存在: " + dir
+		if entry.DirMissing {
+			reason += " (上次退出时已删除)"
+		}
+	} else if errors.Is(err, os.ErrNotExist) {
+		reason = "文件不存在"
+	}
+	w.restoreNotes = append(w.restoreNotes, fmt.Sprintf("未重新打开 %s: %s", entry.Path, reason))
+}
+
 func (w *Workspace) resolvePath(path string) (string, error) {
 	if path == "" {
 		return "", errors.New("路径不能为空")
 	}
 	expanded := path
 	if !filepath.IsAbs(path) {
-		expanded = filepath.Join(w.baseDir, path)
+		expanded = filepath.Join(w.ProjectRoot(), path)
 	}
 	return filepath.Abs(expanded)
 }
@@ -447,38 +1449,481 @@ func (w *Workspace) setActive(path string) {
 	}
 	w.active = path
 	w.stats.Switch(prev, path)
-	if path != "" {
-		w.touchHistory(path)
+	w.history.Touch(path)
+}
+
+// History lists the open files by recent use, most recent first.
+func (w *Workspace) History() []string {
+	return w.history.Paths()
+}
+
+func (w *Workspace) confirmSave(path string) (bool, error) {
+	if answer, preset := w.PresetAnswer(); preset {
+		return answer, nil
+	}
+	save, err := w.decider.ConfirmSave(path)
+	if err == nil {
+		return save, nil
+	}
+	if !errors.Is(err, io.EOF) {
+		return false, err
 	}
+	return w.SaveWhenUnanswered(path)
 }
 
-func (w *Workspace) touchHistory(path string) {
-	if path == "" {
-		return
+// SaveWhenUnanswered applies the close policy to a save prompt for path that
+// could not be answered because input has ended.
+func (w *Workspace) SaveWhenUnanswered(path string) (bool, error) {
+	switch w.policy {
+	case ClosePolicySave:
+		return true, nil
+	case ClosePolicyDiscard:
+		return false, nil
+	default:
+		return false, fmt.Errorf("无法回答文件 %s 的保存提示: 输入已结束", path)
+	}
+}
+
+// MissingDirError reports that the directory of a file read from disk has
+// since been removed, so saving would silently recreate it.
+type MissingDirError struct {
+	Path string
+	Dir  string
+}
+
+func (e *MissingDirError) Error() string {
+	return "目录已不存在: " + e.Dir
+}
+
+// missingDir returns the directory of an on-disk file if it no longer exists.
+func (w *Workspace) missingDir(abs string) string {
+	if !w.onDisk[abs] {
+		return ""
+	}
+	dir := filepath.Dir(abs)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return dir
+	}
+	return ""
+}
+
+func (w *Workspace) missingFile(abs string) bool {
+	if !w.onDisk[abs] {
+		return false
+	}
+	_, err := os.Stat(abs)
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// RecreateDir creates the missing directory of an open file so it can be saved again.
+func (w *Workspace) RecreateDir(path string) error {
+	abs, err := w.ResolveOpen(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return err
+	}
+	// The file went with its directory; recreating it is not an external
+	// deletion to confirm again.
+	if _, err := os.Stat(abs); errors.Is(err, os.ErrNotExist) {
+		delete(w.baselines, abs)
+	}
+	return nil
+}
+
+// SavedLines reads the on-disk version of an open file as lines, split the
+// way files are loaded. exists is false when the file has not been saved yet.
+func (w *Workspace) SavedLines(path string) (lines []string, exists bool, err error) {
+	abs, err := w.ResolveOpen(path)
+	if err != nil {
+		return nil, false, err
+	}
+	lines, err = readLines(abs, encodingOf(w.editors[abs]))
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return lines, true, nil
+}
+
+// FileLines returns a file's lines from its editor when it is open, or from
+// disk otherwise, together with its absolute path.
+func (w *Workspace) FileLines(path string) (abs string, lines []string, open bool, err error) {
+	abs, err = w.resolvePath(path)
+	if err != nil {
+		return "", nil, false, err
+	}
+	if ed, ok := w.editors[abs]; ok {
+		lines, err = ContentLines(ed)
+		return abs, lines, true, err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil, false, fmt.Errorf("文件不存在: %s", abs)
+		}
+		return "", nil, false, err
+	}
+	return abs, splitLines(string(data)), false, nil
+}
+
+// ContentLines splits an editor's current content the same way as SavedLines.
+func ContentLines(ed editor.Editor) ([]string, error) {
+	if doc, ok := ed.(editor.TextDocument); ok {
+		return doc.Lines(), nil
+	}
+	content, err := ed.Content()
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(content), nil
+}
+
+// SaveCopy writes an open file's content to target, which must not exist yet.
+// The editor keeps its path and its unsaved state.
+func (w *Workspace) SaveCopy(path, target string) (string, error) {
+	abs, err := w.ResolveOpen(path)
+	if err != nil {
+		return "", err
+	}
+	dest, err := w.resolvePath(target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return "", fmt.Errorf("文件已存在: %s", dest)
+	}
+	data, _, err := fileData(w.editors[abs])
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(dest, data, w.fileMode); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// SaveAs writes the active editor to target and rebinds the editor to it.
+// The old file is left as it is on disk.
+func (w *Workspace) SaveAs(target string) (string, error) {
+	if w.active == "" {
+		return "", errors.New("没有活动文件")
+	}
+	abs := w.active
+	ed := w.editors[abs]
+	dest, err := w.resolvePath(target)
+	if err != nil {
+		return "", err
+	}
+	if dest == abs {
+		return dest, w.Save(abs)
+	}
+	if _, lazy := ed.(*editor.LargeTextEditor); lazy {
+		return "", editor.ErrLargeFile
+	}
+	if err := w.checkTarget(abs, dest); err != nil {
+		return "", err
+	}
+	op := &saveAsOperation{from: abs, to: dest, modified: ed.IsModified(), onDisk: w.onDisk[abs],
+		baseline: w.baselines[abs], initialized: w.initialized[abs]}
+	ed.Rename(dest)
+	if err := w.writeEditor(ed); err != nil {
+		ed.Rename(abs)
+		return "", err
+	}
+	ed.SetModified(false)
+	w.rebind(abs, dest)
+	w.journal(op)
+	_ = w.logger.Rename(abs, dest)
+	w.ledger.CountSave(dest)
+	return dest, nil
+}
+
+// Rename renames an open file on disk, or only its buffer when it was never
+// saved, and rebinds its editor. Unsaved changes stay in the buffer.
+func (w *Workspace) Rename(path, target string) (string, error) {
+	abs, err := w.ResolveOpen(path)
+	if err != nil {
+		return "", err
+	}
+	dest, err := w.resolvePath(target)
+	if err != nil {
+		return "", err
+	}
+	if dest == abs {
+		return dest, nil
+	}
+	if err := w.checkTarget(abs, dest); err != nil {
+		return "", err
+	}
+	if err := w.moveOpen(abs, dest); err != nil {
+		return "", err
 	}
-	w.removeFromHistory(path)
-	w.history = append([]string{path}, w.history...)
+	w.journal(&renameOperation{from: abs, to: dest})
+	return dest, nil
 }
 
-func (w *Workspace) removeFromHistory(path string) {
-	next := w.history[:0]
-	for _, item := range w.history {
-		if item != path {
-			next = append(next, item)
+// moveOpen moves the open file abs to dest on disk, if it was ever saved,
+// and rebinds its editor. The caller has checked dest with checkTarget.
+func (w *Workspace) moveOpen(abs, dest string) error {
+	_, statErr := os.Stat(abs)
+	if statErr == nil {
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(abs, dest); err != nil {
+			return err
+		}
+		if err := w.logger.Move(abs, dest); err != nil {
+			return err
 		}
+	} else if !errors.Is(statErr, os.ErrNotExist) {
+		return statErr
+	}
+	w.editors[abs].Rename(dest)
+	moveKey(w.onDisk, abs, dest)
+	moveKey(w.baselines, abs, dest)
+	moveKey(w.initialized, abs, dest)
+	w.rebind(abs, dest)
+	return nil
+}
+
+// checkTarget refuses to move the open file abs onto dest when dest is open
+// or exists, or when it would change between XML and text.
+func (w *Workspace) checkTarget(abs, dest string) error {
+	if _, ok := w.editors[dest]; ok {
+		return fmt.Errorf("文件已打开: %s", dest)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("文件已存在: %s", dest)
+	}
+	isXML := strings.ToLower(filepath.Ext(dest)) == ".xml"
+	if isXML != (w.editors[abs].Type() == editor.TypeXML || w.xmlAsText[abs]) {
+		return fmt.Errorf("不能改变文件类型: %s", dest)
+	}
+	return nil
+}
+
+// rebind moves everything the workspace tracks for an open file from
+// oldPath to newPath.
+func (w *Workspace) rebind(oldPath, newPath string) {
+	moveKey(w.editors, oldPath, newPath)
+	moveKey(w.xmlAsText, oldPath, newPath)
+	moveKey(w.sizeWarned, oldPath, newPath)
+	moveKey(w.historyWarned, oldPath, newPath)
+	moveKey(w.dictionaries, oldPath, newPath)
+	moveKey(w.lastCommand, oldPath, newPath)
+	delete(w.onDisk, oldPath)
+	delete(w.baselines, oldPath)
+	delete(w.initialized, oldPath)
+	w.history.Rename(oldPath, newPath)
+	if w.active == oldPath {
+		w.active = newPath
+	}
+	w.stats.Rename(oldPath, newPath)
+}
+
+func moveKey[V any](m map[string]V, oldKey, newKey string) {
+	if value, ok := m[oldKey]; ok {
+		m[newKey] = value
+		delete(m, oldKey)
 	}
-	w.history = next
 }
 
+// saveEditor writes ed unless its file changed on disk since it was read.
 func (w *Workspace) saveEditor(ed editor.Editor) error {
+	if err := w.checkExternal(ed); err != nil {
+		return err
+	}
+	return w.writeEditor(ed)
+}
+
+func (w *Workspace) writeEditor(ed editor.Editor) error {
+	if ed.IsReadOnly() {
+		return editor.ErrReadOnly
+	}
+	if _, lazy := ed.(*editor.LargeTextEditor); lazy {
+		// A large-file editor cannot change, so the file already holds it.
+		return nil
+	}
+	if dir := w.missingDir(ed.Path()); dir != "" {
+		return &MissingDirError{Path: ed.Path(), Dir: dir}
+	}
 	if err := os.MkdirAll(filepath.Dir(ed.Path()), 0o755); err != nil {
 		return err
 	}
-	content, err := ed.Content()
+	data, lines, err := fileData(ed)
+	if err != nil {
+		return err
+	}
+	mode := w.fileMode
+	if info, statErr := os.Stat(ed.Path()); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := w.backupBeforeSave(ed.Path()); err != nil {
+		return err
+	}
+	err = fs.WriteAtomic(ed.Path(), mode, func(out io.Writer) error {
+		_, err := out.Write(data)
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(ed.Path(), []byte(content), 0o644)
+	w.onDisk[ed.Path()] = true
+	w.setBaseline(ed.Path(), lines)
+	if l, ok := ed.(editor.LineEndingEditor); ok && l.LineStyle().Mixed {
+		style := l.LineStyle()
+		style.Mixed = false
+		l.SetLineStyle(style)
+	}
+	return nil
+}
+
+// fileData renders ed as the bytes saved to disk, in its line style and
+// encoding, along with its lines.
+func fileData(ed editor.Editor) ([]byte, []string, error) {
+	content, err := ed.Content()
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := splitLines(content)
+	if l, ok := ed.(editor.LineEndingEditor); ok {
+		content = l.LineStyle().Join(lines)
+	}
+	data, err := charset.Encode(content, encodingOf(ed))
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, lines, nil
+}
+
+// openEditor reads abs from disk into an editor chosen by its extension,
+// decoding text files from enc or, when enc is empty, the detected encoding.
+func openEditor(abs string, policy editor.IDPolicy, enc charset.Encoding) (editor.Editor, error) {
+	ext := strings.ToLower(filepath.Ext(abs))
+	var ed editor.Editor
+	switch ext {
+	case ".xml":
+		if enc != "" && enc != charset.UTF8 {
+			return nil, errXMLEncoding
+		}
+		info, statErr := os.Stat(abs)
+		if statErr != nil {
+			if errors.Is(statErr, os.ErrNotExist) {
+				return nil, fmt.Errorf("XML 文件不存在: %s", abs)
+			}
+			return nil, statErr
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("无法打开目录: %s", abs)
+		}
+		data, readErr := os.ReadFile(abs)
+		if readErr != nil {
+			return nil, readErr
+		}
+		parsed, parseErr := editor.ParseXMLEditorWithPolicy(abs, data, policy)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		ed = parsed
+	default:
+		lines := []string{}
+		modified := false
+		var style editor.LineStyle
+		info, statErr := os.Stat(abs)
+		if statErr != nil {
+			if errors.Is(statErr, os.ErrNotExist) {
+				modified = true
+			} else {
+				return nil, statErr
+			}
+		} else if info.IsDir() {
+			return nil, fmt.Errorf("无法打开目录: %s", abs)
+		} else {
+			data, readErr := os.ReadFile(abs)
+			if readErr != nil {
+				return nil, readErr
+			}
+			detected := enc == ""
+			if detected {
+				enc = charset.Detect(data)
+			}
+			text, decodeErr := charset.Decode(data, enc)
+			if decodeErr != nil && detected && enc == charset.UTF8 {
+				// Latin-1 reads any bytes and writes them back unchanged.
+				enc = charset.Latin1
+				text, decodeErr = charset.Decode(data, enc)
+			}
+			if decodeErr != nil {
+				return nil, fmt.Errorf("%s: %v (可用 load --encoding 指定编码)", abs, decodeErr)
+			}
+			lines = splitLines(text)
+			style = editor.DetectLineStyle(text)
+		}
+		text := editor.NewTextEditor(abs, lines, modified)
+		text.SetEncoding(enc)
+		text.SetLineStyle(style)
+		ed = text
+	}
+	return ed, nil
+}
+
+func (w *Workspace) configureEditor(ed editor.Editor) {
+	if c, ok := ed.(editor.CoalescingEditor); ok {
+		c.SetCoalescing(w.coalesce)
+	}
+	if r, ok := ed.(editor.RedoStashingEditor); ok {
+		r.SetPreserveRedo(w.preserveRedo)
+	}
+	if l, ok := ed.(editor.UndoLimitingEditor); ok {
+		l.SetUndoLimit(w.undoLimit)
+	}
+	if p, ok := ed.(editor.IDPolicyEditor); ok {
+		// Documents are parsed under the policy, so this cannot collide.
+		_ = p.SetIDPolicy(w.idPolicy)
+	}
+}
+
+// applyDictDirective records the per-file dictionary named by a first line
+// "# dict: <file>" in text files or a dict attribute on the XML root. The
+// file is resolved against the document's directory.
+func (w *Workspace) applyDictDirective(ed editor.Editor) {
+	var name string
+	switch doc := ed.(type) {
+	case editor.TextDocument:
+		if lines := doc.Lines(); len(lines) > 0 {
+			name = parseDictDirective(lines[0])
+		}
+	case editor.XMLTreeEditor:
+		name = strings.TrimSpace(doc.RootAttributes()["dict"])
+	}
+	if name == "" {
+		delete(w.dictionaries, ed.Path())
+		return
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(ed.Path()), name)
+	}
+	w.dictionaries[ed.Path()] = name
+}
+
+func parseDictDirective(line string) string {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "#")
+	if !ok {
+		return ""
+	}
+	rest, ok = strings.CutPrefix(strings.TrimSpace(rest), "dict:")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(rest)
 }
 
 func (w *Workspace) applyAutoLog(ed editor.Editor) {
@@ -486,19 +1931,20 @@ func (w *Workspace) applyAutoLog(ed editor.Editor) {
 	case editor.TextDocument:
 		lines := doc.Lines()
 		if len(lines) > 0 && strings.TrimSpace(lines[0]) == "# log" {
-			_ = w.logger.Enable(ed.Path())
+			_ = w.logger.AutoEnable(ed.Path())
 		}
 	case editor.XMLTreeEditor:
 		attrs := doc.RootAttributes()
 		if strings.EqualFold(attrs["log"], "true") {
-			_ = w.logger.Enable(ed.Path())
+			_ = w.logger.AutoEnable(ed.Path())
 		}
 	}
 }
 
-func formatTextIssues(issues []spellcheck.TextIssue) string {
+func formatTextIssues(issues []spellcheck.TextIssue, warnings []string) string {
 	var builder strings.Builder
 	builder.WriteString("拼写检查结果:\n")
+	writeWarnings(&builder, warnings)
 	if len(issues) == 0 {
 		builder.WriteString("未发现拼写错误")
 		return builder.String()
@@ -516,9 +1962,10 @@ func formatTextIssues(issues []spellcheck.TextIssue) string {
 	return builder.String()
 }
 
-func formatXMLIssues(issues []spellcheck.XMLIssue) string {
+func formatXMLIssues(issues []spellcheck.XMLIssue, warnings []string) string {
 	var builder strings.Builder
 	builder.WriteString("拼写检查结果:\n")
+	writeWarnings(&builder, warnings)
 	if len(issues) == 0 {
 		builder.WriteString("未发现拼写错误")
 		return builder.String()
@@ -528,7 +1975,7 @@ func formatXMLIssues(issues []spellcheck.XMLIssue) string {
 		if len(issue.Suggestions) > 0 {
 			suggestions = strings.Join(issue.Suggestions, ", ")
 		}
-		builder.WriteString(fmt.Sprintf("元素 %s: \"%s\" -> 建议: %s", issue.ElementID, issue.Word, suggestions))
+		builder.WriteString(fmt.Sprintf("元素 %s 第%d处 \"%s\" (offset %d) -> 建议: %s", issue.ElementID, issue.Occurrence, issue.Word, issue.Offset, suggestions))
 		if i != len(issues)-1 {
 			builder.WriteString("\n")
 		}
@@ -536,6 +1983,13 @@ func formatXMLIssues(issues []spellcheck.XMLIssue) string {
 	return builder.String()
 }
 
+func writeWarnings(builder *strings.Builder, warnings []string) {
+	for _, warning := range warnings {
+		builder.WriteString(warning)
+		builder.WriteString("\n")
+	}
+}
+
 func splitLines(data string) []string {
 	if data == "" {
 		return []string{}
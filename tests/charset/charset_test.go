@@ -0,0 +1,103 @@
+package charset_test
+
+import (
+	"bytes"
+	"testing"
+
+	"softwaredesign/src/charset"
+)
+
+var fixtures = []struct {
+	enc  charset.Encoding
+	data []byte
+}{
+	{charset.UTF8, []byte{0xE4, 0xB8, 0xAD, 0xE6, 0x96, 0x87, 'a', '\n'}},
+	{charset.GBK, []byte{0xD6, 0xD0, 0xCE, 0xC4, 'a', '\n'}},
+	{charset.UTF16LE, []byte{0xFF, 0xFE, 0x2D, 0x4E, 0x87, 0x65, 'a', 0x00, '\n', 0x00}},
+	{charset.UTF16BE, []byte{0xFE, 0xFF, 0x4E, 0x2D, 0x65, 0x87, 0x00, 'a', 0x00, '\n'}},
+}
+
+func TestDecodeAndEncodeFixtures(t *testing.T) {
+	for _, fx := range fixtures {
+		text, err := charset.Decode(fx.data, fx.enc)
+		if err != nil || text != "中文a\n" {
+			t.Fatalf("%s: decode = %q, %v", fx.enc, text, err)
+		}
+		data, err := charset.Encode(text, fx.enc)
+		if err != nil || !bytes.Equal(data, fx.data) {
+			t.Fatalf("%s: encode = % x, %v", fx.enc, data, err)
+		}
+	}
+}
+
+func TestDetectByteOrderMark(t *testing.T) {
+	cases := map[string]charset.Encoding{
+		"\xFF\xFEa\x00":  charset.UTF16LE,
+		"\xFE\xFF\x00a":  charset.UTF16BE,
+		"\xEF\xBB\xBFab": charset.UTF8BOM,
+		"plain":          charset.UTF8,
+	}
+	for data, want := range cases {
+		if got := charset.Detect([]byte(data)); got != want {
+			t.Fatalf("Detect(%q) = %s, want %s", data, got, want)
+		}
+	}
+	if text, err := charset.Decode([]byte("\xEF\xBB\xBFab"), charset.UTF8); err != nil || text != "ab" {
+		t.Fatalf("a UTF-8 BOM should be dropped: %q, %v", text, err)
+	}
+}
+
+func TestInvalidInputFails(t *testing.T) {
+	if _, err := charset.Decode([]byte{0xD6}, charset.GBK); err == nil {
+		t.Fatalf("a truncated GBK character should fail")
+	}
+	if _, err := charset.Decode([]byte{0xFF, 0xFE, 'a'}, charset.UTF16LE); err == nil {
+		t.Fatalf("an odd UTF-16 length should fail")
+	}
+	if _, err := charset.Decode([]byte{0xD6, 0xD0}, charset.UTF8); err == nil {
+		t.Fatalf("GBK bytes are not valid UTF-8")
+	}
+	if _, err := charset.Encode("😀", charset.GBK); err == nil {
+		t.Fatalf("characters outside GBK should fail to encode")
+	}
+}
+
+func TestParseAcceptsAliases(t *testing.T) {
+	for name, want := range map[string]charset.Encoding{"UTF-8": charset.UTF8, "utf-8-bom": charset.UTF8BOM, "Latin1": charset.Latin1, "gbk": charset.GBK, "utf-16le": charset.UTF16LE, "UTF16BE": charset.UTF16BE} {
+		if got, err := charset.Parse(name); err != nil || got != want {
+			t.Fatalf("Parse(%q) = %s, %v", name, got, err)
+		}
+	}
+	if _, err := charset.Parse("ebcdic"); err == nil {
+		t.Fatalf("unknown encodings should be rejected")
+	}
+}
+
+func TestUTF8BOMRoundTrips(t *testing.T) {
+	data := []byte("\xEF\xBB\xBFone\n")
+	enc := charset.Detect(data)
+	text, err := charset.Decode(data, enc)
+	if err != nil || text != "one\n" {
+		t.Fatalf("decode = %q, %v", text, err)
+	}
+	if out, err := charset.Encode(text+"two\n", enc); err != nil || string(out) != "\xEF\xBB\xBFone\ntwo\n" {
+		t.Fatalf("the BOM should be written back: %q, %v", out, err)
+	}
+}
+
+func TestLatin1IsLossless(t *testing.T) {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	text, err := charset.Decode(data, charset.Latin1)
+	if err != nil || text[len(text)-2:] != "ÿ" {
+		t.Fatalf("decode = %q, %v", text, err)
+	}
+	if out, err := charset.Encode(text, charset.Latin1); err != nil || !bytes.Equal(out, data) {
+		t.Fatalf("every byte should round-trip: % x, %v", out, err)
+	}
+	if _, err := charset.Encode("中", charset.Latin1); err == nil {
+		t.Fatalf("characters outside Latin-1 should fail to encode")
+	}
+}
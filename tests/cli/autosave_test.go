@@ -0,0 +1,72 @@
+package cli_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/cli"
+	"softwaredesign/src/events"
+)
+
+func TestAutosaveListenerWarnsOnFailure(t *testing.T) {
+	stderr := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), bytes.NewBuffer(nil), stderr)
+	listener := cli.NewAutosaveListener(console)
+	listener.Handle(events.Event{Type: events.EventAutosaved, File: "/w/a.txt", Metadata: map[string]string{}})
+	listener.Handle(events.Event{Type: events.EventAutosaved, File: "/w/b.txt", Metadata: map[string]string{"error": "权限不足"}})
+	if want := "[autosave] 警告: 自动保存 /w/b.txt 失败: 权限不足\n"; stderr.String() != want {
+		t.Fatalf("unexpected warning output: %q", stderr.String())
+	}
+}
+
+func TestDispatcherAutosaveCommand(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "autosave", "autosave on 5", "autosave", "autosave off", "autosave on", "exit")
+	want := "自动保存: 关闭\n已开启自动保存, 每 5 秒保存已修改的文件\n自动保存: 开启 (每 5 秒)\n已关闭自动保存\n已开启自动保存, 每 30 秒保存已修改的文件\n"
+	if got := output.String(); !strings.HasPrefix(got, want) {
+		t.Fatalf("unexpected output: %q", got)
+	}
+	for _, bad := range []string{"autosave on 0", "autosave on x", "autosave maybe"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestWatchNoticesWaitForThePrompt(t *testing.T) {
+	stderr := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), bytes.NewBuffer(nil), stderr)
+	listener := cli.NewWatchListener(console)
+	listener.Handle(events.Event{Type: events.EventFileChangedOnDisk, File: "/w/a.txt", Metadata: map[string]string{"state": "modified"}})
+	listener.Handle(events.Event{Type: events.EventFileChangedOnDisk, File: "/w/b.txt", Metadata: map[string]string{"state": "deleted"}})
+	listener.Handle(events.Event{Type: events.EventAutosaved, File: "/w/c.txt", Metadata: map[string]string{}})
+	if stderr.Len() != 0 {
+		t.Fatalf("notices should wait for the next prompt: %q", stderr.String())
+	}
+	console.FlushNotices()
+	want := "[watch] /w/a.txt 已在磁盘上被修改, 可用 reload 重新加载\n[watch] /w/b.txt 已在磁盘上被删除\n"
+	if stderr.String() != want {
+		t.Fatalf("unexpected notices: %q", stderr.String())
+	}
+	stderr.Reset()
+	console.FlushNotices()
+	if stderr.Len() != 0 {
+		t.Fatalf("notices should be shown once: %q", stderr.String())
+	}
+}
+
+func TestDispatcherWatchCommand(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "watch", "watch on 5", "watch", "watch off", "watch on")
+	defer dispatcher.Execute("watch off")
+	want := "文件监视: 关闭\n已开启文件监视, 每 5 秒检查打开的文件是否在磁盘上变化\n文件监视: 开启 (每 5 秒)\n已关闭文件监视\n已开启文件监视, 每 2 秒检查打开的文件是否在磁盘上变化\n"
+	if got := output.String(); got != want {
+		t.Fatalf("unexpected output: %q", got)
+	}
+	for _, bad := range []string{"watch on 0", "watch on x", "watch maybe"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
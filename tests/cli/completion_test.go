@@ -0,0 +1,81 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"softwaredesign/src/cli"
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func newCompletionDispatcher(t *testing.T) (*cli.Dispatcher, string) {
+	t.Helper()
+	dir := t.TempDir()
+	logger := logging.NewManager()
+	console := cli.NewConsole(bytes.NewBufferString(""), bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logger, console)
+	return cli.NewDispatcher(ws, console, logger), dir
+}
+
+func TestCompleteCommandNames(t *testing.T) {
+	dispatcher, _ := newCompletionDispatcher(t)
+	got := dispatcher.Complete("ed", 2)
+	want := []string{"edit", "edit-id", "edit-text", "editor-list"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected command completions: %v", got)
+	}
+}
+
+func TestCompleteUndoCommands(t *testing.T) {
+	dispatcher, _ := newCompletionDispatcher(t)
+	got := dispatcher.Complete("undo-", 5)
+	want := []string{"undo-list", "undo-status"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected undo completions: %v", got)
+	}
+}
+
+func TestCompletePathsAndSubcommands(t *testing.T) {
+	dispatcher, dir := newCompletionDispatcher(t)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write fixture failed: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "nested"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	got := dispatcher.Complete("load n", 6)
+	want := []string{"nested" + string(filepath.Separator), "notes.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected path completions: %v", got)
+	}
+	if err := dispatcher.Execute("load notes.txt"); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	got = dispatcher.Complete("save a", 6)
+	if !reflect.DeepEqual(got, []string{"all"}) {
+		t.Fatalf("save should offer all: %v", got)
+	}
+}
+
+func TestCompleteXMLElementIDs(t *testing.T) {
+	dispatcher, _ := newCompletionDispatcher(t)
+	if err := dispatcher.Execute("init xml doc.xml"); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if err := dispatcher.Execute("append-child book book1 root"); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	got := dispatcher.Complete("edit-text b", 11)
+	if !reflect.DeepEqual(got, []string{"book1"}) {
+		t.Fatalf("unexpected id completions: %v", got)
+	}
+	got = dispatcher.Complete("append-child title t1 ", 22)
+	if !reflect.DeepEqual(got, []string{"book1", "root"}) {
+		t.Fatalf("unexpected parent completions: %v", got)
+	}
+}
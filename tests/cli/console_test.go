@@ -0,0 +1,64 @@
+package cli_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"softwaredesign/src/cli"
+)
+
+func TestConfirmTimeoutWithSilentInput(t *testing.T) {
+	in, writer := io.Pipe()
+	errs := bytes.NewBuffer(nil)
+	console := cli.NewConsole(in, bytes.NewBuffer(nil), errs)
+	console.SetPromptTimeout(20*time.Millisecond, true)
+
+	save, err := console.ConfirmSave("a.txt")
+	if err != nil || !save {
+		t.Fatalf("expected the default answer, got %v, %v", save, err)
+	}
+	if !strings.Contains(errs.String(), "已自动选择: y") {
+		t.Fatalf("auto-selected choice not reported: %q", errs.String())
+	}
+	// Closing the input ends the background read; the next read sees it.
+	writer.Close()
+	if _, err := console.ReadLine(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF after close, got %v", err)
+	}
+}
+
+func TestConfirmTimeoutKeepsLateLine(t *testing.T) {
+	in, writer := io.Pipe()
+	console := cli.NewConsole(in, bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	console.SetPromptTimeout(20*time.Millisecond, false)
+
+	save, err := console.Confirm("continue? ")
+	if err != nil || save {
+		t.Fatalf("expected the default answer, got %v, %v", save, err)
+	}
+	go func() {
+		_, _ = io.WriteString(writer, "show\nundo\n")
+	}()
+	for _, want := range []string{"show", "undo"} {
+		line, err := console.ReadLine()
+		if err != nil || line != want {
+			t.Fatalf("late input lost: got %q, %v, want %q", line, err, want)
+		}
+	}
+}
+
+func TestConfirmAnsweredBeforeTimeout(t *testing.T) {
+	console := cli.NewConsole(strings.NewReader("maybe\ny\nnext\n"), bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	console.SetPromptTimeout(time.Second, false)
+	save, err := console.Confirm("continue? ")
+	if err != nil || !save {
+		t.Fatalf("expected the typed answer, got %v, %v", save, err)
+	}
+	if line, _ := console.ReadLine(); line != "next" {
+		t.Fatalf("unexpected next line: %q", line)
+	}
+}
@@ -0,0 +1,19 @@
+package cli_test
+
+import (
+	"testing"
+
+	"softwaredesign/src/cli"
+)
+
+func TestSelfTestPasses(t *testing.T) {
+	results := cli.RunSelfTest()
+	if len(results) == 0 {
+		t.Fatalf("self test produced no steps")
+	}
+	for _, result := range results {
+		if !result.Passed() {
+			t.Errorf("step %s failed: %v", result.Step, result.Err)
+		}
+	}
+}
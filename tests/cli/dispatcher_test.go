@@ -2,10 +2,16 @@ package cli_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"softwaredesign/src/cli"
+	"softwaredesign/src/editor"
 	"softwaredesign/src/events"
 	"softwaredesign/src/logging"
 	"softwaredesign/src/workspace"
@@ -17,7 +23,7 @@ func TestDispatcherLoadCommand(t *testing.T) {
 	logger := logging.NewManager()
 	keeper := workspace.NewStateKeeper(dir)
 	output := bytes.NewBuffer(nil)
-	console := cli.NewConsole(bytes.NewBufferString(""), output)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, bytes.NewBuffer(nil))
 	ws := workspace.NewWorkspace(dir, bus, keeper, logger, console)
 	dispatcher := cli.NewDispatcher(ws, console, logger)
 
@@ -38,7 +44,7 @@ func TestDispatcherEditorList(t *testing.T) {
 	logger := logging.NewManager()
 	keeper := workspace.NewStateKeeper(dir)
 	output := bytes.NewBuffer(nil)
-	console := cli.NewConsole(bytes.NewBufferString(""), output)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, bytes.NewBuffer(nil))
 	ws := workspace.NewWorkspace(dir, bus, keeper, logger, console)
 	dispatcher := cli.NewDispatcher(ws, console, logger)
 
@@ -53,3 +59,2018 @@ func TestDispatcherEditorList(t *testing.T) {
 		t.Fatalf("editor-list should contain test.txt, output: %s", outputStr)
 	}
 }
+
+func TestDispatcherXMLIDs(t *testing.T) {
+	dir := t.TempDir()
+	logger := logging.NewManager()
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, bytes.NewBuffer(nil))
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logger, console)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+
+	for _, cmd := range []string{"init xml ids.xml", "append-child book b1 root", "append-child title t1 b1"} {
+		if err := dispatcher.Execute(cmd); err != nil {
+			t.Fatalf("%s failed: %v", cmd, err)
+		}
+	}
+	output.Reset()
+	if err := dispatcher.Execute("xml-ids --tag title"); err != nil {
+		t.Fatalf("xml-ids failed: %v", err)
+	}
+	if strings.TrimSpace(output.String()) != "t1 (title)" {
+		t.Fatalf("unexpected xml-ids output: %q", output.String())
+	}
+	output.Reset()
+	if err := dispatcher.Execute("xml-ids ids.xml --tag author"); err != nil {
+		t.Fatalf("xml-ids with file failed: %v", err)
+	}
+	if strings.TrimSpace(output.String()) != "无匹配元素" {
+		t.Fatalf("expected empty notice, got %q", output.String())
+	}
+}
+
+func TestDispatcherXMLSelectors(t *testing.T) {
+	dir := t.TempDir()
+	logger := logging.NewManager()
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, bytes.NewBuffer(nil))
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logger, console)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+
+	for _, cmd := range []string{
+		"init xml sel.xml",
+		"append-child book b1 root",
+		"append-child book b2 @tag=root",
+		"append-child title t1 @tag=book[1]",
+		"append-child title t2 @tag=book[2]",
+		"edit-text @tag=title[2] \"Second\"",
+	} {
+		if err := dispatcher.Execute(cmd); err != nil {
+			t.Fatalf("%s failed: %v", cmd, err)
+		}
+	}
+	output.Reset()
+	if err := dispatcher.Execute("xml-path @tag=title[2]"); err != nil {
+		t.Fatalf("xml-path failed: %v", err)
+	}
+	if got := strings.TrimSpace(output.String()); got != "root#root > book#b2 > title#t2" {
+		t.Fatalf("unexpected xml-path output: %q", got)
+	}
+	if err := dispatcher.Execute("delete-element @tag=title"); err == nil || !strings.Contains(err.Error(), "t1, t2") {
+		t.Fatalf("an ambiguous selector should list candidates, got %v", err)
+	}
+	if err := dispatcher.Execute("edit-id @tag=title[1] first"); err != nil {
+		t.Fatalf("edit-id failed: %v", err)
+	}
+	if err := dispatcher.Execute("delete-element first"); err != nil {
+		t.Fatalf("plain IDs should keep working: %v", err)
+	}
+}
+
+func TestDispatcherSeparatesOutputStreams(t *testing.T) {
+	dir := t.TempDir()
+	logger := logging.NewManager()
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	input := bytes.NewBufferString("init text notes.txt\nappend \"data line\"\nshow\nbogus\nexit\nn\n")
+	console := cli.NewConsole(input, stdout, stderr)
+	logger.SetErrorWriter(console.ErrWriter())
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logger, console)
+	cli.NewDispatcher(ws, console, logger).Run()
+
+	if !strings.Contains(stdout.String(), "1: data line") {
+		t.Fatalf("stdout missing show output: %q", stdout.String())
+	}
+	for _, noise := range []string{"未知命令", "> ", "是否保存"} {
+		if strings.Contains(stdout.String(), noise) {
+			t.Fatalf("stdout should not contain %q: %q", noise, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), noise) {
+			t.Fatalf("stderr should contain %q: %q", noise, stderr.String())
+		}
+	}
+}
+
+type recordingListener struct {
+	received []events.Event
+}
+
+func (r *recordingListener) Handle(evt events.Event) {
+	r.received = append(r.received, evt)
+}
+
+func newTestDispatcher(t *testing.T) (*cli.Dispatcher, *workspace.Workspace, *bytes.Buffer, *recordingListener) {
+	t.Helper()
+	dir := t.TempDir()
+	bus := events.NewBus()
+	listener := &recordingListener{}
+	bus.Subscribe(listener)
+	logger := logging.NewManager()
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, bytes.NewBuffer(nil))
+	ws := workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logger, nil)
+	return cli.NewDispatcher(ws, console, logger), ws, output, listener
+}
+
+func mustExecute(t *testing.T, dispatcher *cli.Dispatcher, commands ...string) {
+	t.Helper()
+	for _, cmd := range commands {
+		if err := dispatcher.Execute(cmd); err != nil {
+			t.Fatalf("%s failed: %v", cmd, err)
+		}
+	}
+}
+
+func TestDispatcherScriptedCloseDiscard(t *testing.T) {
+	dir := t.TempDir()
+	bus := events.NewBus()
+	listener := &recordingListener{}
+	bus.Subscribe(listener)
+	logger := logging.NewManager()
+	output := bytes.NewBuffer(nil)
+	// The console doubles as the decider; its input is already exhausted.
+	console := cli.NewConsole(bytes.NewBufferString(""), output, bytes.NewBuffer(nil))
+	ws := workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logger, console)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("original"), 0o644); err != nil {
+		t.Fatalf("write fixture failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "load notes.txt", `append "scratch"`, "load other.txt", `append "x"`)
+	if err := dispatcher.Execute("close notes.txt --save --discard"); err == nil {
+		t.Fatalf("combined flags should be rejected")
+	}
+	mustExecute(t, dispatcher, "close notes.txt --discard")
+	last := listener.received[len(listener.received)-1]
+	if last.Metadata["disposition"] != "discard" {
+		t.Fatalf("disposition not recorded: %+v", last.Metadata)
+	}
+	mustExecute(t, dispatcher, "close all --discard")
+
+	if data, _ := os.ReadFile(file); string(data) != "original" {
+		t.Fatalf("disk file changed: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("discarded new file was written: %v", err)
+	}
+	if len(ws.List()) != 0 {
+		t.Fatalf("editors left open: %+v", ws.List())
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	state, err := workspace.NewStateKeeper(dir).Load()
+	if err != nil {
+		t.Fatalf("load state failed: %v", err)
+	}
+	if len(state.Editors) != 0 || state.Active != "" {
+		t.Fatalf("state not clean: %+v", state)
+	}
+}
+
+func TestDispatcherCloseReportsFocusChange(t *testing.T) {
+	dispatcher, _, output, listener := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "load a.txt", "load b.txt", "load c.txt")
+
+	output.Reset()
+	mustExecute(t, dispatcher, "close a.txt")
+	if strings.TrimSpace(output.String()) != "已关闭" {
+		t.Fatalf("background close should not report focus: %q", output.String())
+	}
+
+	output.Reset()
+	mustExecute(t, dispatcher, "close")
+	if strings.TrimSpace(output.String()) != "已关闭, 当前活动文件: b.txt" {
+		t.Fatalf("unexpected active close output: %q", output.String())
+	}
+	last := listener.received[len(listener.received)-1]
+	if !strings.HasSuffix(last.Metadata["focus_from"], "c.txt") || !strings.HasSuffix(last.Metadata["focus_to"], "b.txt") {
+		t.Fatalf("event should record focus change: %v", last.Metadata)
+	}
+
+	output.Reset()
+	mustExecute(t, dispatcher, "close")
+	if strings.TrimSpace(output.String()) != "已关闭, 无打开文件" {
+		t.Fatalf("unexpected last close output: %q", output.String())
+	}
+}
+
+func TestDispatcherInitValidatesWithLog(t *testing.T) {
+	dispatcher, ws, output, listener := newTestDispatcher(t)
+	err := dispatcher.Execute("init text a.txt withlog")
+	if err == nil || !strings.Contains(err.Error(), "withlog") {
+		t.Fatalf("typo should be rejected naming the token, got %v", err)
+	}
+	if _, activeErr := ws.ActiveEditor(); activeErr == nil {
+		t.Fatalf("no buffer should be created on typo")
+	}
+	if err := dispatcher.Execute("init text a.txt with-log extra"); err == nil {
+		t.Fatalf("too many arguments should fail")
+	}
+
+	mustExecute(t, dispatcher, "init text a.txt with-log")
+	if !strings.Contains(output.String(), "(日志已开启)") {
+		t.Fatalf("success message should mention logging: %q", output.String())
+	}
+	var sawLogOn bool
+	for _, evt := range listener.received {
+		if evt.Command == "log-on" && evt.Metadata["source"] == "init" {
+			sawLogOn = true
+		}
+	}
+	if !sawLogOn {
+		t.Fatalf("init with-log should publish a log-on event")
+	}
+}
+
+func TestDispatcherEditorListFullShowsLastCommand(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher,
+		"load a.txt", "append \"alpha\"", "show",
+		"load b.txt", "append \"beta\"", "append \"a very long line that goes past the forty rune limit\"",
+		"edit a.txt", "insert 1:1 \"x\"", "undo",
+	)
+	infos := ws.List()
+	last := map[string]string{}
+	for _, info := range infos {
+		last[info.Name] = info.LastCommand
+	}
+	if last["a.txt"] != "undo (insert)" {
+		t.Fatalf("unexpected a.txt last command: %q", last["a.txt"])
+	}
+	if !strings.HasPrefix(last["b.txt"], "append \"a very long line") {
+		t.Fatalf("unexpected b.txt last command: %q", last["b.txt"])
+	}
+
+	output.Reset()
+	mustExecute(t, dispatcher, "editor-list --full")
+	if !strings.Contains(output.String(), "last: undo (insert)") {
+		t.Fatalf("editor-list --full missing a.txt entry: %q", output.String())
+	}
+	if !strings.Contains(output.String(), "last: append \"a very long line that goes past ...") {
+		t.Fatalf("long command should be truncated to 40 runes: %q", output.String())
+	}
+
+	mustExecute(t, dispatcher, "close a.txt", "load a.txt")
+	for _, info := range ws.List() {
+		if info.Name == "a.txt" && info.LastCommand != "" {
+			t.Fatalf("close should clear the last command, got %q", info.LastCommand)
+		}
+	}
+}
+
+func TestDispatcherReportsNoOpEdits(t *testing.T) {
+	dispatcher, ws, output, listener := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "hello"`, "save")
+
+	output.Reset()
+	mustExecute(t, dispatcher, `replace 1:1 5 "hello"`)
+	if strings.TrimSpace(output.String()) != "无变化" {
+		t.Fatalf("identical replace should report no change: %q", output.String())
+	}
+	last := listener.received[len(listener.received)-1]
+	if last.Command != "replace" || last.Metadata["noop"] != "true" {
+		t.Fatalf("no-op event should still be published and marked: %+v", last)
+	}
+	ed, _ := ws.ActiveEditor()
+	if ed.IsModified() {
+		t.Fatalf("no-op edit should not dirty the file")
+	}
+
+	output.Reset()
+	mustExecute(t, dispatcher, `replace 1:1 5 "world"`)
+	if strings.TrimSpace(output.String()) != `已替换 (第 1 行: "world", 共 1 行)` || !ed.IsModified() {
+		t.Fatalf("genuine replace should behave normally: %q", output.String())
+	}
+	if _, marked := listener.received[len(listener.received)-1].Metadata["noop"]; marked {
+		t.Fatalf("genuine edits should not carry the noop marker")
+	}
+}
+
+func TestDispatcherRedoListAndDiscardWarning(t *testing.T) {
+	dir := t.TempDir()
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), stdout, stderr)
+	bus := events.NewBus()
+	listener := &recordingListener{}
+	bus.Subscribe(listener)
+	ws := workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	dispatcher := cli.NewDispatcher(ws, console, logging.NewManager())
+	mustExecute(t, dispatcher, "init text a.txt", `append "one"`, `append "two"`, `insert 1:1 "x"`, "undo", "undo")
+	ed, _ := ws.ActiveEditor()
+	if ed.UndoDepth() != 1 || ed.RedoDepth() != 2 {
+		t.Fatalf("unexpected depths: undo %d, redo %d", ed.UndoDepth(), ed.RedoDepth())
+	}
+
+	stdout.Reset()
+	mustExecute(t, dispatcher, "redo-list")
+	if strings.TrimSpace(stdout.String()) != "1. append\n2. insert" {
+		t.Fatalf("unexpected redo listing: %q", stdout.String())
+	}
+
+	mustExecute(t, dispatcher, `append "three"`)
+	if !strings.Contains(stderr.String(), "已丢弃 2 个可重做操作") {
+		t.Fatalf("expected discard warning, got %q", stderr.String())
+	}
+	truncated := listener.received[len(listener.received)-2]
+	if truncated.Type != events.EventHistoryTruncated || truncated.File != ed.Path() ||
+		truncated.Metadata["discarded"] != "2" || truncated.Metadata["stashed"] != "false" {
+		t.Fatalf("expected truncation event before the command event: %+v", truncated)
+	}
+
+	stderr.Reset()
+	mustExecute(t, dispatcher, "undo", "set redo-warn off", `append "four"`)
+	if stderr.Len() != 0 {
+		t.Fatalf("warning should be silenced by the setting: %q", stderr.String())
+	}
+	if last := listener.received[len(listener.received)-2]; last.Type != events.EventHistoryTruncated || last.Metadata["discarded"] != "1" {
+		t.Fatalf("the event should be published even when the warning is off: %+v", last)
+	}
+}
+
+func TestDispatcherRedoStashed(t *testing.T) {
+	dispatcher, ws, _, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "set redo-preserve on", "init text a.txt", `append "one"`, `append "two"`, "undo")
+	mustExecute(t, dispatcher, `append "other"`, "redo --stashed")
+	ed, _ := ws.ActiveEditor()
+	content, _ := ed.Content()
+	if content != "one\ntwo" {
+		t.Fatalf("stashed redo should restore the discarded branch: %q", content)
+	}
+	mustExecute(t, dispatcher, "undo")
+	if content, _ = ed.Content(); content != "one\nother" {
+		t.Fatalf("stashed redo should be undoable: %q", content)
+	}
+	if err := dispatcher.Execute("redo --stashed"); err == nil {
+		t.Fatalf("stash holds a single branch and should now be empty")
+	}
+}
+
+func TestDispatcherFind(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "Alpha beta"`, `append "中文 alpha"`)
+
+	output.Reset()
+	mustExecute(t, dispatcher, `find "alpha" -i`)
+	if strings.TrimSpace(output.String()) != "1:1: Alpha beta\n2:4: 中文 alpha" {
+		t.Fatalf("unexpected find output: %q", output.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, `find "gamma"`)
+	if strings.TrimSpace(output.String()) != "未找到匹配" {
+		t.Fatalf("unexpected empty result: %q", output.String())
+	}
+	if err := dispatcher.Execute(`find "alpha" -x`); err == nil {
+		t.Fatalf("unknown flag should be rejected")
+	}
+}
+
+func TestDispatcherReplaceAll(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "cat and cat"`, "save")
+
+	output.Reset()
+	mustExecute(t, dispatcher, `replace-all "cat" "dog"`)
+	if strings.TrimSpace(output.String()) != `已替换 2 处 (第 1 行: "dog and dog", 共 1 行)` {
+		t.Fatalf("unexpected replace-all output: %q", output.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "save", `replace-all "cat" "dog"`)
+	if !strings.Contains(output.String(), "未找到匹配") {
+		t.Fatalf("expected no-match notice: %q", output.String())
+	}
+	if ed, _ := ws.ActiveEditor(); ed.IsModified() {
+		t.Fatalf("zero replacements should not mark the file modified")
+	}
+}
+
+func TestDispatcherFindRegex(t *testing.T) {
+	dispatcher, _, output, listener := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "v1.2 and v10.0"`)
+
+	output.Reset()
+	mustExecute(t, dispatcher, `find-regex "v\d+\.\d"`)
+	if strings.TrimSpace(output.String()) != "1:1 -> \"v1.2\"\n1:10 -> \"v10.0\"" {
+		t.Fatalf("unexpected find-regex output: %q", output.String())
+	}
+	if last := listener.received[len(listener.received)-1]; last.Command != "find-regex" {
+		t.Fatalf("find-regex should be published, got %s", last.Command)
+	}
+	if err := dispatcher.Execute(`find-regex "[a-"`); err == nil {
+		t.Fatalf("invalid pattern should be reported")
+	}
+}
+
+func TestDispatcherXMLDoctor(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init xml doc.xml", "append-child book book1 root")
+
+	output.Reset()
+	mustExecute(t, dispatcher, "xml-doctor")
+	if strings.TrimSpace(output.String()) != "XML 结构一致" {
+		t.Fatalf("unexpected doctor output: %q", output.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "xml-doctor --repair")
+	if !strings.Contains(output.String(), "已重建索引") {
+		t.Fatalf("unexpected repair output: %q", output.String())
+	}
+	if err := dispatcher.Execute("xml-doctor --fix"); err == nil {
+		t.Fatalf("unknown flag should be rejected")
+	}
+}
+
+func TestDispatcherIDPolicy(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init xml doc.xml", "append-child book Book1 root", "append-child book book1 root")
+
+	output.Reset()
+	mustExecute(t, dispatcher, "xml-doctor")
+	if !strings.Contains(output.String(), "忽略大小写时重复的 ID:\n- Book1, book1") {
+		t.Fatalf("doctor should list near-duplicate IDs: %q", output.String())
+	}
+	if err := dispatcher.Execute("set id-policy case-insensitive"); err == nil {
+		t.Fatalf("colliding IDs should block the policy")
+	}
+
+	mustExecute(t, dispatcher, "delete-element book1", "set id-policy case-insensitive", `edit-text BOOK1 "Go"`)
+	if err := dispatcher.Execute("append-child book BOOK1 root"); err == nil {
+		t.Fatalf("colliding append should fail")
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "xml-doctor")
+	if strings.TrimSpace(output.String()) != "XML 结构一致" {
+		t.Fatalf("unexpected doctor output: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "undo")
+	if err := dispatcher.Execute("undo"); err == nil || !strings.Contains(err.Error(), "重复的元素 ID") {
+		t.Fatalf("undo restoring book1 should be refused, got %v", err)
+	}
+	mustExecute(t, dispatcher, "set id-policy exact", "undo", "xml-doctor")
+}
+
+func TestDispatcherCopyCutPaste(t *testing.T) {
+	dispatcher, ws, _, _ := newTestDispatcher(t)
+	if err := dispatcher.Execute("init text b.txt"); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if err := dispatcher.Execute("paste 1:1"); err == nil || !strings.Contains(err.Error(), "剪贴板为空") {
+		t.Fatalf("paste with an empty register should fail, got %v", err)
+	}
+	mustExecute(t, dispatcher, `append "x"`, `append "y"`,
+		"init text a.txt", `append "one"`, `append "two"`, `append "three"`,
+		"cut-lines 2:3", "edit b.txt", "paste 2:1")
+	a, _ := ws.EditorByPath(filepath.Join(ws.BaseDir(), "a.txt"))
+	b, _ := ws.ActiveEditor()
+	if got, _ := a.Content(); got != "one" {
+		t.Fatalf("cut should remove the lines: %q", got)
+	}
+	if got, _ := b.Content(); got != "x\ntwo\nthree\ny" {
+		t.Fatalf("paste should splice whole lines: %q", got)
+	}
+	if desc := b.UndoDescription(); desc != "insert" || a.UndoDescription() != "delete-lines" {
+		t.Fatalf("cut and paste should each be one undo entry: %q, %q", a.UndoDescription(), desc)
+	}
+
+	mustExecute(t, dispatcher, "copy 2:1 3", "paste 4:2", "undo")
+	if got, _ := b.Content(); got != "x\ntwo\nthree\ny" {
+		t.Fatalf("undo should remove the pasted text: %q", got)
+	}
+	mustExecute(t, dispatcher, "redo", "copy-lines 1", "edit a.txt", "paste 1:4")
+	if got, _ := a.Content(); got != "onex\n" {
+		t.Fatalf("pasting lines mid-line should split it: %q", got)
+	}
+	if err := dispatcher.Execute("copy 1:3 5"); err == nil {
+		t.Fatalf("copy past the end of the line should fail")
+	}
+	if err := dispatcher.Execute("cut-lines 3:4"); err == nil {
+		t.Fatalf("cut beyond the document should fail")
+	}
+	if ws.Register() != "x\n" {
+		t.Fatalf("failed commands should keep the register: %q", ws.Register())
+	}
+}
+
+func TestDispatcherDiff(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "one"`, `append "two"`)
+	path := filepath.Join(ws.BaseDir(), "a.txt")
+
+	output.Reset()
+	mustExecute(t, dispatcher, "diff")
+	want := "--- " + path + " (尚未保存)\n+++ " + path + " (编辑中)\n@@ -0,0 +1,2 @@\n+one\n+two\n"
+	if output.String() != want {
+		t.Fatalf("unsaved file should diff as additions:\n%s", output.String())
+	}
+	mustExecute(t, dispatcher, "save")
+	output.Reset()
+	mustExecute(t, dispatcher, "diff a.txt")
+	if strings.TrimSpace(output.String()) != "无差异" {
+		t.Fatalf("saved file should have no differences: %q", output.String())
+	}
+	mustExecute(t, dispatcher, `replace 2:1 3 "TWO"`)
+	output.Reset()
+	mustExecute(t, dispatcher, "diff")
+	if !strings.Contains(output.String(), "@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n") {
+		t.Fatalf("unexpected text diff:\n%s", output.String())
+	}
+
+	mustExecute(t, dispatcher, "init xml doc.xml", "save", "append-child book b1 root")
+	output.Reset()
+	mustExecute(t, dispatcher, "diff")
+	if !strings.Contains(output.String(), "-<root id=\"root\"></root>\n+<root id=\"root\">\n+    <book id=\"b1\"></book>\n+</root>") {
+		t.Fatalf("XML diff should compare serialized content:\n%s", output.String())
+	}
+}
+
+func TestDispatcherDiffTwoFiles(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "same"`, `append "left"`,
+		"init text b.txt", `append "same"`, `append "right"`)
+	a, b := filepath.Join(ws.BaseDir(), "a.txt"), filepath.Join(ws.BaseDir(), "b.txt")
+
+	output.Reset()
+	mustExecute(t, dispatcher, "diff a.txt b.txt")
+	want := "--- " + a + "\n+++ " + b + "\n@@ -1,2 +1,2 @@\n same\n-left\n+right\n"
+	if output.String() != want {
+		t.Fatalf("unexpected diff:\n%s", output.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "diff -q a.txt b.txt", "diff a.txt a.txt")
+	if output.String() != "有差异\n无差异\n" {
+		t.Fatalf("unexpected quiet output: %q", output.String())
+	}
+
+	other := filepath.Join(ws.BaseDir(), "other.txt")
+	if err := os.WriteFile(other, []byte("same\nright\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "diff -q b.txt other.txt")
+	if output.String() != "无差异\n" {
+		t.Fatalf("open buffer should match the disk file: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "save b.txt", "close b.txt")
+	if err := dispatcher.Execute("diff b.txt other.txt"); err == nil || !strings.Contains(err.Error(), "已打开") {
+		t.Fatalf("diffing two closed files should be refused, got %v", err)
+	}
+	if err := dispatcher.Execute("diff a.txt missing.txt"); err == nil {
+		t.Fatalf("a missing file should be reported")
+	}
+}
+
+func TestDispatcherWorkspaceUndo(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	if err := dispatcher.Execute("workspace-undo"); err == nil {
+		t.Fatalf("an empty journal should be reported")
+	}
+	mustExecute(t, dispatcher, "init text a.txt", `append "draft"`, "close --discard")
+	output.Reset()
+	mustExecute(t, dispatcher, "workspace-undo --list", "workspace-undo")
+	if output.String() != "1. close a.txt\n已撤销文件操作: close a.txt\n" {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	ed, err := ws.ActiveEditor()
+	if err != nil {
+		t.Fatalf("a.txt should be reopened: %v", err)
+	}
+	if got, _ := ed.Content(); got != "draft" {
+		t.Fatalf("discarded text should be back: %q", got)
+	}
+}
+
+func TestDispatcherCursorCommands(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "hello world"`, "goto 1:6", `insert . ","`, "delete . 1")
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "hello,world" {
+		t.Fatalf("dot-relative edits misplaced: %q", content)
+	}
+	if err := dispatcher.Execute("goto 3"); err == nil {
+		t.Fatalf("goto beyond the document should fail")
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "editor-list")
+	if !strings.Contains(output.String(), "[光标 1:7]") {
+		t.Fatalf("editor-list should show the cursor: %q", output.String())
+	}
+}
+
+func TestDispatcherDeleteLines(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "a"`, `append "b"`, `append "c"`)
+
+	output.Reset()
+	mustExecute(t, dispatcher, "delete-line 3", "delete-lines 1:2")
+	if !strings.Contains(output.String(), "已删除 1 行") || !strings.Contains(output.String(), "已删除 2 行") {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "" {
+		t.Fatalf("document should be empty, got %q", content)
+	}
+	mustExecute(t, dispatcher, "show")
+	if err := dispatcher.Execute("delete-line 1"); err == nil {
+		t.Fatalf("deleting from an empty document should fail")
+	}
+}
+
+func TestDispatcherCreditsExplicitFileArgument(t *testing.T) {
+	dispatcher, ws, _, listener := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init xml other.xml", "init text a.txt", "set stats-credit 3")
+
+	listener.received = nil
+	mustExecute(t, dispatcher, "xml-tree other.xml")
+	evt := listener.received[len(listener.received)-1]
+	other := filepath.Join(ws.BaseDir(), "other.xml")
+	if evt.Metadata["target"] != other || evt.Metadata["active"] != filepath.Join(ws.BaseDir(), "a.txt") {
+		t.Fatalf("unexpected metadata: %v", evt.Metadata)
+	}
+	for _, info := range ws.List() {
+		if info.Path == other && info.Duration < 3*time.Second {
+			t.Fatalf("background file should be credited, got %v", info.Duration)
+		}
+	}
+}
+
+func TestDispatcherInsertLine(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "a"`, `append "d"`)
+
+	output.Reset()
+	mustExecute(t, dispatcher, `insert-line 2 "b\nc"`)
+	if !strings.Contains(output.String(), "已插入 2 行") {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "a\nb\nc\nd" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if err := dispatcher.Execute(`insert-line 9 "x"`); err == nil {
+		t.Fatalf("out of range insert-line should fail")
+	}
+}
+
+func TestDispatcherRenameIDs(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init xml a.xml", "append-child book a-book root", "append-child title a-title a-book")
+
+	output.Reset()
+	mustExecute(t, dispatcher, "rename-ids a-book a- ns- --dry-run")
+	if !strings.Contains(output.String(), "a-book -> ns-book") || !strings.Contains(output.String(), "a-title -> ns-title") {
+		t.Fatalf("unexpected dry-run output: %q", output.String())
+	}
+	ed, _ := ws.ActiveEditor()
+	if doc := ed.(editor.XMLTreeEditor); strings.Contains(strings.Join(doc.IDs(), ","), "ns-") {
+		t.Fatalf("dry run should not rename: %v", doc.IDs())
+	}
+
+	output.Reset()
+	mustExecute(t, dispatcher, "rename-ids a-book a- ns-")
+	if !strings.Contains(output.String(), "已重命名 2 个 ID") {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+}
+
+func TestDispatcherDuplicateLines(t *testing.T) {
+	dispatcher, ws, _, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "x"`, `append "y"`, "dup-line 1 2", "dup-lines 4:4")
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "x\nx\nx\ny\ny" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if err := dispatcher.Execute("dup-line 1 0"); err == nil {
+		t.Fatalf("dup-line with zero count should fail")
+	}
+	if err := dispatcher.Execute("dup-line 1 9223372036854775807"); err == nil {
+		t.Fatalf("dup-line with a huge count should fail instead of allocating")
+	}
+}
+
+func TestDispatcherMemoryTable(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "hello"`, "init text longer-name.txt")
+
+	output.Reset()
+	mustExecute(t, dispatcher, "memory")
+	lines := strings.Split(strings.TrimRight(output.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected header, two files and a total: %q", output.String())
+	}
+	if got := strings.Join(strings.Fields(lines[1]), " "); got != "a.txt 5 1 5 1 5" {
+		t.Fatalf("unexpected row: %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[3], "合计") {
+		t.Fatalf("missing total row: %q", lines[3])
+	}
+	width := editor.DisplayWidth(lines[0])
+	for _, line := range lines[1:] {
+		if editor.DisplayWidth(line) != width {
+			t.Fatalf("table is not aligned:\n%s", output.String())
+		}
+	}
+}
+
+func TestDispatcherLoadBrokenXMLAsText(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	path := filepath.Join(ws.BaseDir(), "broken.xml")
+	if err := os.WriteFile(path, []byte("<root id=\"root\">\n<a id=\"a\">\n</root>\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := dispatcher.Execute("load broken.xml"); err == nil {
+		t.Fatalf("declining the fallback should keep the parse error")
+	}
+
+	mustExecute(t, dispatcher, "load broken.xml --as-text")
+	if !strings.Contains(output.String(), "已以只读文本方式打开") || !strings.Contains(output.String(), "第 3 行") {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	if err := dispatcher.Execute("delete-line 2"); err == nil {
+		t.Fatalf("read-only file should refuse edits")
+	}
+	mustExecute(t, dispatcher, "editor-list")
+	if !strings.Contains(output.String(), "[RO]") {
+		t.Fatalf("editor-list should mark the read-only file: %q", output.String())
+	}
+
+	output.Reset()
+	mustExecute(t, dispatcher, "readonly off", "delete-line 2", "save", "reload")
+	if !strings.Contains(output.String(), "已切换为 XML 编辑器") {
+		t.Fatalf("reload should switch to the XML editor: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "xml-tree")
+}
+
+func TestDispatcherLoadBrokenXMLConfirm(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broken.xml")
+	if err := os.WriteFile(path, []byte("<root>"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString("y\n"), output, bytes.NewBuffer(nil))
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	dispatcher := cli.NewDispatcher(ws, console, logging.NewManager())
+	mustExecute(t, dispatcher, "load broken.xml")
+	if !ws.IsXMLAsText(path) {
+		t.Fatalf("confirming should open the file as text")
+	}
+}
+
+func TestDispatcherJoinAndSplitLines(t *testing.T) {
+	dispatcher, ws, _, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "a"`, `append "b"`, `append "c"`, `join-lines 1:3 "-"`, "split-line 1:3")
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "a-\nb-c" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if err := dispatcher.Execute("join-lines 2:2"); err == nil {
+		t.Fatalf("joining a single line should fail")
+	}
+}
+
+func TestDispatcherSaveUnopenedFile(t *testing.T) {
+	dispatcher, ws, _, listener := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text draft.txt")
+	if err := os.WriteFile(filepath.Join(ws.BaseDir(), "disk.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	listener.received = nil
+	if err := dispatcher.Execute("save disk.txt"); err == nil || !strings.Contains(err.Error(), "load") {
+		t.Fatalf("expected load hint, got %v", err)
+	}
+	if err := dispatcher.Execute("save draft.tx"); err == nil || !strings.Contains(err.Error(), "draft.txt") {
+		t.Fatalf("expected suggestion, got %v", err)
+	}
+	if len(listener.received) != 0 {
+		t.Fatalf("failed saves should not publish events: %v", listener.received)
+	}
+	mustExecute(t, dispatcher, "save ./draft.txt")
+	if evt := listener.received[len(listener.received)-1]; evt.File != filepath.Join(ws.BaseDir(), "draft.txt") {
+		t.Fatalf("unexpected target: %s", evt.File)
+	}
+}
+
+func TestDispatcherStats(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "one two"`)
+	output.Reset()
+	mustExecute(t, dispatcher, "stats")
+	if !strings.Contains(output.String(), "词数: 2") || !strings.Contains(output.String(), "字节数: 7") {
+		t.Fatalf("unexpected text stats: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "init xml b.xml")
+	output.Reset()
+	mustExecute(t, dispatcher, "stats")
+	if !strings.Contains(output.String(), "元素数: 1") {
+		t.Fatalf("unexpected xml stats: %q", output.String())
+	}
+}
+
+func TestDispatcherShowHeadAndTail(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt")
+	ed, _ := ws.ActiveEditor()
+	doc := ed.(editor.TextDocument)
+	for i := 1; i <= 1000; i++ {
+		if err := doc.Append(fmt.Sprintf("line %d", i)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if doc.LineCount() != 1000 {
+		t.Fatalf("unexpected line count: %d", doc.LineCount())
+	}
+
+	output.Reset()
+	mustExecute(t, dispatcher, "show-tail")
+	lines := strings.Split(strings.TrimRight(output.String(), "\n"), "\n")
+	if len(lines) != 10 || lines[0] != "991: line 991" || lines[9] != "1000: line 1000" {
+		t.Fatalf("tail should keep real line numbers: %q", lines)
+	}
+
+	output.Reset()
+	mustExecute(t, dispatcher, "show-head 3")
+	if output.String() != "1: line 1\n2: line 2\n3: line 3\n" {
+		t.Fatalf("unexpected head output: %q", output.String())
+	}
+
+	mustExecute(t, dispatcher, "init text short.txt", `append "only"`)
+	output.Reset()
+	mustExecute(t, dispatcher, "show-tail 50", "show-head 50")
+	if output.String() != "1: only\n1: only\n" {
+		t.Fatalf("oversized requests should print everything: %q", output.String())
+	}
+	if err := dispatcher.Execute("show-head 0"); err == nil {
+		t.Fatalf("zero lines should be rejected")
+	}
+}
+
+func TestDispatcherCaseCommands(t *testing.T) {
+	dispatcher, ws, _, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "go is fun"`, `append "MORE TEXT"`, "upper 1:1 2", "lower 2:1 4", "title-case 2:2")
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "GO is fun\nMore Text" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if err := dispatcher.Execute("upper 1:8 5"); err == nil {
+		t.Fatalf("span past the line end should fail")
+	}
+}
+
+func TestDispatcherReportExport(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "x"`, "save")
+
+	output.Reset()
+	mustExecute(t, dispatcher, "report show")
+	lines := strings.Split(strings.TrimRight(output.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "a.txt") || !strings.HasSuffix(lines[1], "  3       1") {
+		t.Fatalf("unexpected report table: %q", output.String())
+	}
+
+	mustExecute(t, dispatcher, "report export report.csv")
+	data, err := os.ReadFile(filepath.Join(ws.BaseDir(), "report.csv"))
+	if err != nil {
+		t.Fatalf("read export failed: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "file,date,minutes,commands,saves\na.txt,") {
+		t.Fatalf("unexpected csv: %q", data)
+	}
+	if info, _ := os.Stat(filepath.Join(ws.BaseDir(), "report.csv")); info.Mode().Perm() != ws.FileMode() {
+		t.Fatalf("the export should use the file mode setting, got %v", info.Mode().Perm())
+	}
+	if err := dispatcher.Execute("report export report.csv"); err == nil {
+		t.Fatalf("existing file should not be overwritten without confirmation")
+	}
+	entries, _ := os.ReadDir(ws.BaseDir())
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".report.csv") {
+			t.Fatalf("temporary file left behind: %s", entry.Name())
+		}
+	}
+}
+
+func TestDispatcherShowTruncatesLongLines(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	long := strings.Repeat("长", 300)
+	mustExecute(t, dispatcher, "init text a.txt", `append "`+long+`"`, `append "short"`)
+
+	output.Reset()
+	mustExecute(t, dispatcher, "show")
+	want := "1: " + strings.Repeat("长", 200) + "…(共 300 字符)\n2: short\n"
+	if output.String() != want {
+		t.Fatalf("unexpected truncated output: %q", output.String())
+	}
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != long+"\nshort" {
+		t.Fatalf("truncated display must not alter content")
+	}
+
+	output.Reset()
+	mustExecute(t, dispatcher, "show 1:1 --full-lines")
+	if output.String() != "1: "+long+"\n" {
+		t.Fatalf("--full-lines should disable truncation: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "set show-width 0")
+	output.Reset()
+	mustExecute(t, dispatcher, "show-head 1")
+	if output.String() != "1: "+long+"\n" {
+		t.Fatalf("width 0 should disable truncation: %q", output.String())
+	}
+}
+
+func TestDispatcherSortLines(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "b"`, `append "a"`, `append "b"`, `append "c"`)
+	output.Reset()
+	mustExecute(t, dispatcher, "sort-lines -ru")
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "c\nb\na" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if !strings.Contains(output.String(), "删除重复 1 行") {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "sort-lines 1:3 -r")
+	if !strings.Contains(output.String(), "无变化") {
+		t.Fatalf("sorted range should report no change: %q", output.String())
+	}
+	if err := dispatcher.Execute("sort-lines -x"); err == nil {
+		t.Fatalf("unknown flag should be rejected")
+	}
+}
+
+func TestDispatcherTabConversion(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", "append \"\tone\"", `append "two"`)
+	output.Reset()
+	mustExecute(t, dispatcher, "expand-tabs 2")
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "  one\ntwo" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if strings.TrimSpace(output.String()) != `已修改 1 行 (第 1 行: "  one", 共 2 行)` {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "compress-spaces 2")
+	if content, _ := ed.Content(); content != "\tone\ntwo" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+}
+
+func TestDispatcherHistoryWarning(t *testing.T) {
+	dir := t.TempDir()
+	output := bytes.NewBuffer(nil)
+	errs := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, errs)
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	ws.SetHistoryLimit(20)
+
+	mustExecute(t, dispatcher, "init text a.txt", `append "0123456789"`)
+	if errs.Len() != 0 {
+		t.Fatalf("warned below the limit: %q", errs.String())
+	}
+	mustExecute(t, dispatcher, `append "0123456789"`, `append "x"`)
+	if strings.Count(errs.String(), "建议保存后重新打开") != 1 {
+		t.Fatalf("expected exactly one suggestion: %q", errs.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "status")
+	if !strings.Contains(output.String(), "撤销历史: 21 字节, 3 步 (本次会话最多 3 步, 峰值 21 字节)") {
+		t.Fatalf("status should report history: %q", output.String())
+	}
+
+	mustExecute(t, dispatcher, "close a.txt --discard", "init text a.txt")
+	errs.Reset()
+	mustExecute(t, dispatcher, `append "0123456789"`, `append "0123456789"`)
+	if !strings.Contains(errs.String(), "建议保存后重新打开") {
+		t.Fatalf("closing should reset the one-time suggestion: %q", errs.String())
+	}
+}
+
+func TestDispatcherXMLGrepMatchesSavedFile(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init xml books.xml", `append-child book b1 root "Go 语言"`, `append-child book b2 root "Rust"`)
+	output.Reset()
+	mustExecute(t, dispatcher, `xml-grep "Rust"`)
+	got := strings.TrimSpace(output.String())
+	mustExecute(t, dispatcher, "save")
+	data, err := os.ReadFile(filepath.Join(ws.BaseDir(), "books.xml"))
+	if err != nil {
+		t.Fatalf("read saved file failed: %v", err)
+	}
+	lines := strings.Split(string(data), "\n")
+	var line int
+	var text string
+	if _, err := fmt.Sscanf(got, "%d:", &line); err != nil {
+		t.Fatalf("unexpected output: %q", got)
+	}
+	text = lines[line-1]
+	if want := fmt.Sprintf("%d: %s  [b2]", line, text); got != want || !strings.Contains(text, "Rust") {
+		t.Fatalf("xml-grep = %q, saved line %d = %q", got, line, text)
+	}
+}
+
+func TestDispatcherUndoRedoCount(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "a"`, `append "b"`, "delete-line 1")
+	output.Reset()
+	mustExecute(t, dispatcher, "undo-list")
+	if got := strings.TrimSpace(output.String()); got != "1. delete-lines\n2. append\n3. append" {
+		t.Fatalf("unexpected undo list: %q", got)
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "undo 5")
+	if got := strings.TrimSpace(output.String()); got != "已撤销 3 步 (请求 5 步, 已无更多可用)" {
+		t.Fatalf("unexpected undo output: %q", got)
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "redo 2", "undo-list")
+	if got := strings.TrimSpace(output.String()); got != "已重做 2 步\n1. append\n2. append" {
+		t.Fatalf("unexpected redo output: %q", got)
+	}
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "a\nb" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if err := dispatcher.Execute("undo x"); err == nil {
+		t.Fatalf("invalid count should be rejected")
+	}
+}
+
+func TestDispatcherUndoLimit(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "a"`, `append "b"`, `append "c"`, "undo")
+	output.Reset()
+	mustExecute(t, dispatcher, "undo-status")
+	if got := strings.TrimSpace(output.String()); got != "撤销上限: 100\n撤销栈: 2\n重做栈: 1\n暂存重做: 0" {
+		t.Fatalf("unexpected status: %q", got)
+	}
+	mustExecute(t, dispatcher, "set undo-limit 1")
+	output.Reset()
+	mustExecute(t, dispatcher, "undo-status")
+	if got := strings.TrimSpace(output.String()); got != "撤销上限: 1\n撤销栈: 1\n重做栈: 1\n暂存重做: 0" {
+		t.Fatalf("lowering the limit should truncate at once: %q", got)
+	}
+	if err := dispatcher.Execute("set undo-limit -1"); err == nil {
+		t.Fatalf("negative limit should be rejected")
+	}
+	mustExecute(t, dispatcher, "set undo-limit 0", "init text b.txt")
+	output.Reset()
+	mustExecute(t, dispatcher, "undo-status")
+	if !strings.HasPrefix(output.String(), "撤销上限: 不限") {
+		t.Fatalf("new editors should pick up the limit: %q", output.String())
+	}
+}
+
+func TestDispatcherEditSummary(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	long := strings.Repeat("x", 70)
+	mustExecute(t, dispatcher, "init text a.txt", `append "one"`, `append "two"`, `append "three"`, `append "`+long+`"`)
+	output.Reset()
+	mustExecute(t, dispatcher, "delete-lines 2:3")
+	if got := strings.TrimSpace(output.String()); got != `已删除 2 行 (第 2 行: "`+strings.Repeat("x", 60)+`...", 共 2 行)` {
+		t.Fatalf("unexpected text summary: %q", got)
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "delete-lines 2:2")
+	if got := strings.TrimSpace(output.String()); got != "已删除 1 行 (共 1 行)" {
+		t.Fatalf("deleting the tail should report the count only: %q", got)
+	}
+
+	mustExecute(t, dispatcher, "init xml b.xml", "append-child book b1 root")
+	output.Reset()
+	mustExecute(t, dispatcher, "append-child book b2 root", `edit-text b2 "Go 语言"`, "delete-element b1")
+	want := "已追加子元素 (root 现有 2 个子元素)\n已更新元素文本 (b2 文本: \"Go 语言\")\n已删除元素 (root 现有 1 个子元素)"
+	if got := strings.TrimSpace(output.String()); got != want {
+		t.Fatalf("unexpected xml summary: %q", got)
+	}
+
+	mustExecute(t, dispatcher, "set output-level quiet")
+	output.Reset()
+	mustExecute(t, dispatcher, "append-child book b3 root")
+	if got := strings.TrimSpace(output.String()); got != "已追加子元素" {
+		t.Fatalf("quiet mode should keep terse confirmations: %q", got)
+	}
+}
+
+func TestDispatcherSaveIntoRemovedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "notes")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "a.txt"), []byte("one"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString("y\nn\ncopy.txt\n"), stdout, stderr)
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	dispatcher := cli.NewDispatcher(ws, console, logging.NewManager())
+	mustExecute(t, dispatcher, "load notes/a.txt", `append "two"`)
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+
+	stdout.Reset()
+	mustExecute(t, dispatcher, "editor-list")
+	if !strings.Contains(stdout.String(), "a.txt [modified] [missing] [目录已不存在]") {
+		t.Fatalf("editor-list should flag the file: %q", stdout.String())
+	}
+	mustExecute(t, dispatcher, "save")
+	if !strings.Contains(stderr.String(), "目录已不存在: "+sub) {
+		t.Fatalf("save should explain the missing directory: %q", stderr.String())
+	}
+	if data, err := os.ReadFile(filepath.Join(sub, "a.txt")); err != nil || string(data) != "one\ntwo" {
+		t.Fatalf("answering y should recreate the directory and save: %q, %v", data, err)
+	}
+
+	mustExecute(t, dispatcher, `append "three"`)
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	stdout.Reset()
+	mustExecute(t, dispatcher, "save")
+	copyPath := filepath.Join(dir, "copy.txt")
+	if data, err := os.ReadFile(copyPath); err != nil || string(data) != "one\ntwo\nthree" {
+		t.Fatalf("save-as should write the copy: %q, %v", data, err)
+	}
+	if !strings.Contains(stdout.String(), "已另存为: "+copyPath) {
+		t.Fatalf("unexpected output: %q", stdout.String())
+	}
+	if ed, _ := ws.ActiveEditor(); !ed.IsModified() {
+		t.Fatalf("the original file is still unsaved")
+	}
+	if err := dispatcher.Execute("save"); err == nil || err.Error() != "目录已不存在: "+sub {
+		t.Fatalf("without input the error should surface: %v", err)
+	}
+}
+
+func TestDispatcherBookmarks(t *testing.T) {
+	dispatcher, _, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "one"`, `append "two"`, `append "three"`, "goto 2:2", "mark here", "mark top 1:1")
+	mustExecute(t, dispatcher, `insert-line 1 "zero"`, "goto 1")
+	output.Reset()
+	mustExecute(t, dispatcher, "marks", "goto-mark here")
+	want := "书签  位置\ntop    2:1\nhere   3:2\n光标: 3:2"
+	if got := strings.TrimSpace(output.String()); got != want {
+		t.Fatalf("unexpected output:\n%s", got)
+	}
+	if err := dispatcher.Execute("goto-mark nowhere"); err == nil || err.Error() != "书签不存在: nowhere" {
+		t.Fatalf("unknown mark should be rejected: %v", err)
+	}
+}
+
+func TestDispatcherScriptedAssertions(t *testing.T) {
+	dispatcher, ws, output, listener := newTestDispatcher(t)
+	script := []string{
+		"init text notes.txt",
+		`append "first"`,
+		`append "second"`,
+		`assert line 2 "second"`,
+		"assert modified true",
+		"save",
+		"assert modified false",
+		"init xml books.xml",
+		`append-child book b1 root "Go 语言"`,
+		`assert element-text b1 "Go 语言"`,
+		"assert open notes.txt",
+	}
+	mustExecute(t, dispatcher, script...)
+	if passed := strings.Count(output.String(), "断言通过"); passed != 5 {
+		t.Fatalf("expected 5 passing assertions, got %d:\n%s", passed, output.String())
+	}
+	for _, evt := range listener.received {
+		if evt.Command == "assert" {
+			t.Fatalf("assertions must not be published: %+v", evt)
+		}
+	}
+
+	failures := []struct {
+		cmd  string
+		want string
+	}{
+		{`assert element-text b1 "Go"`, `断言失败: 元素 b1 的文本: 期望 "Go", 实际 "Go 语言"`},
+		{`assert element-text b9 "x"`, `断言失败: 元素 b9 的文本: 期望 "x", 实际 "<元素不存在>"`},
+		{"assert modified false", `断言失败: 修改状态: 期望 "false", 实际 "true"`},
+		{"assert open missing.txt", `断言失败: 文件 missing.txt: 期望 "已打开", 实际 "未打开"`},
+	}
+	for _, tc := range failures {
+		err := dispatcher.Execute(tc.cmd)
+		if err == nil || err.Error() != tc.want {
+			t.Fatalf("%s: unexpected result %v", tc.cmd, err)
+		}
+	}
+	mustExecute(t, dispatcher, "edit notes.txt", "set output-level quiet")
+	output.Reset()
+	if err := dispatcher.Execute(`assert line 1 "first "`); err == nil {
+		t.Fatalf("comparison must be exact")
+	}
+	if err := dispatcher.Execute(`assert line 3 "third"`); err == nil || !strings.Contains(err.Error(), "<不存在, 共 2 行>") {
+		t.Fatalf("missing line should fail: %v", err)
+	}
+	mustExecute(t, dispatcher, `assert line 1 "first"`)
+	if output.Len() != 0 {
+		t.Fatalf("quiet mode should silence passing assertions: %q", output.String())
+	}
+	if got := dispatcher.AssertionFailures(); got != 6 {
+		t.Fatalf("expected 6 recorded failures, got %d", got)
+	}
+	if err := dispatcher.Execute("assert line x"); err == nil || dispatcher.AssertionFailures() != 6 {
+		t.Fatalf("usage errors should not count as failed assertions")
+	}
+	if ed, _ := ws.ActiveEditor(); ed.IsModified() {
+		t.Fatalf("assertions must not modify the document")
+	}
+}
+
+func TestDispatcherSaveExternalChange(t *testing.T) {
+	dir := t.TempDir()
+	input := bytes.NewBufferString("m\nc\no\n")
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(input, output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "load a.txt", `append "three"`)
+	if err := os.WriteFile(file, []byte("zero\none\ntwo\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "save")
+	if !strings.Contains(output.String(), "已合并外部修改, 文件尚未保存") {
+		t.Fatalf("merge should be reported: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "save")
+	if data, _ := os.ReadFile(file); string(data) != "zero\none\ntwo\nthree\n" {
+		t.Fatalf("unexpected merged file: %q", data)
+	}
+
+	if err := os.WriteFile(file, []byte("other"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := dispatcher.Execute("save"); err == nil || !strings.Contains(err.Error(), "已取消") {
+		t.Fatalf("cancel should abort the save, got %v", err)
+	}
+	mustExecute(t, dispatcher, "save")
+	if data, _ := os.ReadFile(file); string(data) != "zero\none\ntwo\nthree\n" {
+		t.Fatalf("overwrite should write the buffer: %q", data)
+	}
+}
+
+func TestDispatcherExitOffersExternalChangePrompt(t *testing.T) {
+	dir := t.TempDir()
+	input := bytes.NewBufferString("m\ny\no\n")
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(input, output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "load a.txt", `append "three"`)
+	if err := os.WriteFile(file, []byte("zero\none\ntwo\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := dispatcher.Execute("exit -y"); err == nil || !strings.Contains(err.Error(), "已取消退出") {
+		t.Fatalf("a merge should keep the workspace open, got %v", err)
+	}
+	if ed, _ := ws.ActiveEditor(); ed == nil || !ed.IsModified() {
+		t.Fatalf("the merged buffer should stay open and unsaved")
+	}
+	if err := os.WriteFile(file, []byte("other"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "exit")
+	if data, _ := os.ReadFile(file); string(data) != "zero\none\ntwo\nthree\n" {
+		t.Fatalf("overwrite should write the buffer on exit: %q", data)
+	}
+}
+
+func TestDispatcherCheckExternalAndRecreate(t *testing.T) {
+	dir := t.TempDir()
+	input := bytes.NewBufferString("n\ny\n")
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(input, output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	file := filepath.Join(dir, "a.xml")
+	if err := os.WriteFile(file, []byte(`<root id="root"/>`), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "load a.xml", "append-child item i1 root", "init text b.txt")
+	output.Reset()
+	mustExecute(t, dispatcher, "check-external")
+	if got := output.String(); got != "a.xml: 未变化\nb.txt: 尚未保存到磁盘\n" {
+		t.Fatalf("unexpected check-external output: %q", got)
+	}
+	if err := os.Remove(file); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "check-external")
+	if !strings.Contains(output.String(), "a.xml: 已被外部删除") {
+		t.Fatalf("the deletion should be reported: %q", output.String())
+	}
+	if err := dispatcher.Execute("save a.xml"); err == nil || !strings.Contains(err.Error(), "已取消") {
+		t.Fatalf("declining should cancel the save, got %v", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("a cancelled save should not recreate the file")
+	}
+	mustExecute(t, dispatcher, "save a.xml")
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), `id="i1"`) {
+		t.Fatalf("a confirmed save should recreate the file: %q", data)
+	}
+}
+
+func TestDispatcherClean(t *testing.T) {
+	dir := t.TempDir()
+	input := bytes.NewBufferString("n\ny\n")
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(input, output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	old := time.Now().Add(-48 * time.Hour)
+	for name, content := range map[string]string{".gone.txt.log": "session start at 20240102 03:04:05\n", ".a.txt.tmp-1": "1234", ".b.txt.swp": "1234"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("chtimes failed: %v", err)
+		}
+	}
+	mustExecute(t, dispatcher, "clean")
+	if got := output.String(); got != "没有需要清理的文件\n" {
+		t.Fatalf("nothing is a week old yet: %q", got)
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "clean --older-than 24h --dry-run")
+	want := "孤立日志 (1 个, 35 字节):\n  .gone.txt.log (35 字节)\n临时文件 (1 个, 4 字节):\n  .a.txt.tmp-1 (4 字节)\n共 2 个文件, 39 字节 (未删除)\n"
+	if got := output.String(); got != want {
+		t.Fatalf("unexpected dry run output: %q", got)
+	}
+	mustExecute(t, dispatcher, "clean --older-than 24h")
+	if _, err := os.Stat(filepath.Join(dir, ".a.txt.tmp-1")); err != nil {
+		t.Fatalf("a declined clean should keep files: %v", err)
+	}
+	mustExecute(t, dispatcher, "clean --older-than 24h")
+	if !strings.HasSuffix(output.String(), "已删除 2 个文件\n") {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".b.txt.swp")); err != nil {
+		t.Fatalf("swap files of other editors should be left alone: %v", err)
+	}
+	for _, bad := range []string{"clean --older-than", "clean --older-than 7x", "clean --force"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherLoadReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.xml"), []byte(`<root id="root"><item id="i1">text</item></root>`), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "load a.txt --readonly")
+	for _, cmd := range []string{`append "two"`, "insert 1:1 x", "delete 1:1 1", "replace 1:1 1 x", "save"} {
+		if err := dispatcher.Execute(cmd); err == nil || err.Error() != "文件为只读模式" {
+			t.Fatalf("%s should be refused, got %v", cmd, err)
+		}
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "show", "spell-check", "editor-list")
+	if !strings.Contains(output.String(), "one") || !strings.Contains(output.String(), "a.txt [RO]") {
+		t.Fatalf("read commands should work: %q", output.String())
+	}
+
+	mustExecute(t, dispatcher, "load-readonly b.xml", "xml-tree")
+	if err := dispatcher.Execute(`edit-text i1 "new"`); err == nil || err.Error() != "文件为只读模式" {
+		t.Fatalf("XML edits should be refused, got %v", err)
+	}
+	mustExecute(t, dispatcher, "readonly off", `edit-text i1 "new"`, "save")
+	if data, _ := os.ReadFile(filepath.Join(dir, "b.xml")); !strings.Contains(string(data), "new") {
+		t.Fatalf("an unlocked file should save: %q", data)
+	}
+	for _, bad := range []string{"load-readonly", "load-readonly a.txt --readonly", "load a.txt --bogus"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherRevert(t *testing.T) {
+	dir := t.TempDir()
+	input := bytes.NewBufferString("n\ny\n")
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(input, output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("one\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "load a.txt", `append "two"`, `append "three"`, "undo")
+	output.Reset()
+	mustExecute(t, dispatcher, "revert")
+	if !strings.Contains(output.String(), "已取消还原") {
+		t.Fatalf("declining should keep the edits: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "revert a.txt")
+	ed, _ := ws.ActiveEditor()
+	if lines := ed.(editor.TextDocument).Lines(); len(lines) != 1 || ed.IsModified() {
+		t.Fatalf("revert should reload the saved file: %q", lines)
+	}
+	if err := dispatcher.Execute("undo"); err == nil {
+		t.Fatalf("revert should clear the undo history")
+	}
+	// An unmodified file reverts without asking.
+	mustExecute(t, dispatcher, "revert")
+}
+
+func TestDispatcherDoctorState(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	keeper := workspace.NewStateKeeper(ws.BaseDir())
+	gone := filepath.Join(ws.BaseDir(), "gone.txt")
+	if err := keeper.Save(workspace.WorkspaceState{Editors: []workspace.EditorState{{Path: gone}}}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "doctor --state")
+	if !strings.Contains(output.String(), "[missing-file] "+gone) || !strings.Contains(output.String(), "doctor --state --fix") {
+		t.Fatalf("unexpected report: %q", output.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "doctor --state --fix", "doctor --state")
+	if !strings.Contains(output.String(), "已修复 1 个问题") || !strings.HasSuffix(output.String(), "工作区状态无问题\n") {
+		t.Fatalf("unexpected fix output: %q", output.String())
+	}
+	if err := dispatcher.Execute("doctor --fix"); err == nil {
+		t.Fatalf("doctor without a scope should print usage")
+	}
+}
+
+func TestDispatcherSaveAs(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "x"`, "save-as b.txt")
+	dest := filepath.Join(ws.BaseDir(), "b.txt")
+	if !strings.Contains(output.String(), "已另存为: "+dest) {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	if _, err := os.Stat(filepath.Join(ws.BaseDir(), "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("the unsaved original should not be written")
+	}
+	if err := dispatcher.Execute("save-as"); err == nil {
+		t.Fatalf("missing target should print usage")
+	}
+}
+
+func TestDispatcherNumberedTreePeekAndLoad(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	base := ws.BaseDir()
+	if err := os.WriteFile(filepath.Join(base, "a.txt"), []byte("1\n2\n3\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "c.txt"), []byte("c\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := dispatcher.Execute("peek 1"); err == nil || !strings.Contains(err.Error(), "dir-tree --numbered") {
+		t.Fatalf("peek before a numbered tree should fail, got %v", err)
+	}
+	mustExecute(t, dispatcher, "dir-tree --numbered")
+	if !strings.Contains(output.String(), "[1] a.txt") || !strings.Contains(output.String(), "[2] c.txt") {
+		t.Fatalf("unexpected tree: %q", output.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "peek 1 2")
+	if output.String() != "== "+filepath.Join(base, "a.txt")+" ==\n1\n2\n... (使用 load 1 打开完整文件)\n" {
+		t.Fatalf("unexpected peek: %q", output.String())
+	}
+	if _, err := ws.EditorByPath("a.txt"); err == nil {
+		t.Fatalf("peek should not open an editor")
+	}
+	if err := dispatcher.Execute("peek 3"); err == nil || !strings.Contains(err.Error(), "超出范围") {
+		t.Fatalf("an out-of-range index should fail, got %v", err)
+	}
+
+	// A new file shifts the numbering once the tree is re-run.
+	if err := os.WriteFile(filepath.Join(base, "b.txt"), []byte("b\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "dir-tree --numbered", "load 2")
+	if ed, _ := ws.ActiveEditor(); ed == nil || ed.Path() != filepath.Join(base, "b.txt") {
+		t.Fatalf("load should follow the new numbering")
+	}
+	mustExecute(t, dispatcher, "dir-tree")
+	if err := dispatcher.Execute("peek 1"); err == nil {
+		t.Fatalf("a plain dir-tree should drop the numbering")
+	}
+}
+
+func TestDispatcherRename(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "x"`, "save", "rename a.txt sub/b.txt")
+	dest := filepath.Join(ws.BaseDir(), "sub", "b.txt")
+	if !strings.Contains(output.String(), "已重命名: "+filepath.Join(ws.BaseDir(), "a.txt")+" -> "+dest) {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "x" {
+		t.Fatalf("the file should be moved: %q", data)
+	}
+	if err := dispatcher.Execute("rename missing.txt c.txt"); err == nil {
+		t.Fatalf("renaming a file that is not open should fail")
+	}
+}
+
+func TestDispatcherRestoreBackup(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "set backup on", "init text a.txt", `append "good"`, "save", `replace-all "good" "bad"`, "save")
+	output.Reset()
+	mustExecute(t, dispatcher, "restore-backup a.txt")
+	restored := filepath.Join(ws.BaseDir(), "a.restored.txt")
+	if !strings.Contains(output.String(), restored) {
+		t.Fatalf("unexpected output: %q", output.String())
+	}
+	ed, _ := ws.ActiveEditor()
+	if lines := ed.(editor.TextDocument).Lines(); len(lines) != 1 || lines[0] != "good" {
+		t.Fatalf("the backup should be active: %q", lines)
+	}
+	if err := dispatcher.Execute("restore-backup a.txt x"); err == nil {
+		t.Fatalf("a bad index should fail")
+	}
+}
+
+func TestDispatcherEncoding(t *testing.T) {
+	dir := t.TempDir()
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	file := filepath.Join(dir, "gbk.txt")
+	if err := os.WriteFile(file, []byte{0xD6, 0xD0, 0xCE, 0xC4}, 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "load gbk.txt")
+	if !strings.Contains(output.String(), "已按 latin1 原样打开") {
+		t.Fatalf("invalid UTF-8 should open as latin1 with a notice: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "set-encoding GBK --reinterpret", "editor-list", "show")
+	if !strings.Contains(output.String(), "gbk.txt [gbk]") || !strings.Contains(output.String(), "中文") {
+		t.Fatalf("editor-list should show the encoding: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "set-encoding utf-16be", "save")
+	if data, _ := os.ReadFile(file); !bytes.Equal(data, []byte{0xFE, 0xFF, 0x4E, 0x2D, 0x65, 0x87}) {
+		t.Fatalf("save should convert to UTF-16BE: % x", data)
+	}
+	for _, bad := range []string{"load gbk.txt --encoding", "load gbk.txt --encoding ebcdic", "set-encoding", "set-encoding gbk --bogus"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherLineEndings(t *testing.T) {
+	dir := t.TempDir()
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("one\r\ntwo\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "load a.txt", "line-endings")
+	if !strings.Contains(output.String(), "换行符: mixed (保存时统一为 lf), 文件末尾有换行") {
+		t.Fatalf("line-endings should report mixed endings: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "set-line-endings crlf", "save")
+	if data, _ := os.ReadFile(file); string(data) != "one\r\ntwo\r\n" {
+		t.Fatalf("save should write CRLF: %q", data)
+	}
+	mustExecute(t, dispatcher, "undo", "save")
+	if data, _ := os.ReadFile(file); string(data) != "one\ntwo\n" {
+		t.Fatalf("undo should restore the majority ending: %q", data)
+	}
+	for _, bad := range []string{"set-line-endings", "set-line-endings cr", "line-endings x"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherLargeFileMode(t *testing.T) {
+	dir := t.TempDir()
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString("n\ny\n"), output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	var content strings.Builder
+	for i := 1; content.Len() < 1<<20; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "big.log"), []byte(content.String()), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	mustExecute(t, dispatcher, "set large-file 1", "load big.log", "editor-list", "show 2:3", `find "line 77777"`)
+	for _, want := range []string{"big.log [large]", "2: line 2", "77777:1: line 77777"} {
+		if !strings.Contains(output.String(), want) {
+			t.Fatalf("expected %q in output: %q", want, output.String())
+		}
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "mark here 3:2", "marks")
+	if !strings.Contains(output.String(), "here") || !ws.IsLarge("big.log") {
+		t.Fatalf("bookmarks should not need the full content: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "copy 3:1 4")
+	if ws.Register() != "line" || !ws.IsLarge("big.log") {
+		t.Fatalf("copy should not need the full content: %q", ws.Register())
+	}
+	mustExecute(t, dispatcher, "copy-lines 2:3")
+	if ws.Register() != "line 2\nline 3\n" || !ws.IsLarge("big.log") {
+		t.Fatalf("copy-lines should not need the full content: %q", ws.Register())
+	}
+	if err := dispatcher.Execute(`append "more"`); !errors.Is(err, editor.ErrLargeFile) {
+		t.Fatalf("a declined promotion should refuse the edit, got %v", err)
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, `append "more"`, "show-tail 1", "marks")
+	if !strings.Contains(output.String(), "more") || ws.IsLarge("big.log") {
+		t.Fatalf("a confirmed promotion should allow the edit: %q", output.String())
+	}
+	if !strings.Contains(output.String(), "here") {
+		t.Fatalf("bookmarks should survive promotion: %q", output.String())
+	}
+	if err := dispatcher.Execute("promote"); err == nil {
+		t.Fatalf("promote should fail once the file is fully loaded")
+	}
+}
+
+func TestDispatcherHistoryRecall(t *testing.T) {
+	dispatcher, ws, output, listener := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "one"`, "history")
+	if !strings.Contains(output.String(), "    2  append \"one\"") {
+		t.Fatalf("history should list numbered commands: %q", output.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "!!")
+	if !strings.Contains(output.String(), "append \"one\"\n") {
+		t.Fatalf("recall should echo the expanded command: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "!2")
+	doc, _ := ws.ActiveEditor()
+	if lines, _ := doc.Content(); lines != "one\none\none" {
+		t.Fatalf("recalled commands should run: %q", lines)
+	}
+	for _, entry := range ws.CommandHistory().Entries() {
+		if entry.Command == "history" || strings.HasPrefix(entry.Command, "!") {
+			t.Fatalf("history and recall should not be recorded: %+v", ws.CommandHistory().Entries())
+		}
+	}
+	if last := listener.received[len(listener.received)-1]; last.Raw != `append "one"` {
+		t.Fatalf("events should carry the expanded command: %+v", last)
+	}
+	for _, bad := range []string{"!99", "!x", "history all"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherMacroRecordAndPlay(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	mustExecute(t, dispatcher,
+		"init xml doc.xml",
+		"macro record item",
+		`append-child item item-{n} root "x"`,
+		"undo",
+		`append-child item item-{n} root "x"`,
+		"macro stop",
+		"undo",
+	)
+	if !strings.Contains(output.String(), "宏 item 已录制 (3 条命令)") {
+		t.Fatalf("stop should report the recorded steps: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "macro play item 3", "macro list")
+	doc, _ := ws.ActiveEditor()
+	ids := doc.(editor.XMLTreeEditor).IDs()
+	if strings.Join(ids, ",") != "root,item-1,item-2,item-3" {
+		t.Fatalf("each pass should create its own element: %v", ids)
+	}
+	if !strings.Contains(output.String(), "item (3 条命令)") {
+		t.Fatalf("macro list should show the macro: %q", output.String())
+	}
+	// item-1 exists now, so the first step fails.
+	err := dispatcher.Execute("macro play item")
+	if err == nil || !strings.Contains(err.Error(), "第 1 步失败") {
+		t.Fatalf("expected the failing step to be reported, got %v", err)
+	}
+	steps, _ := ws.Macro("item")
+	for _, step := range steps {
+		if strings.HasPrefix(step, "macro") {
+			t.Fatalf("macro commands should not be recorded: %q", steps)
+		}
+	}
+	for _, bad := range []string{"macro", "macro stop", "macro play missing", "macro play item 0", "macro record"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherAnswerFlagsOnCloseAndExit(t *testing.T) {
+	dir := t.TempDir()
+	output := bytes.NewBuffer(nil)
+	prompts := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, prompts)
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, console)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	kept := filepath.Join(dir, "kept.txt")
+	dropped := filepath.Join(dir, "dropped.txt")
+	mustExecute(t, dispatcher,
+		"load kept.txt", `append "x"`, "close kept.txt -y",
+		"load dropped.txt", `append "x"`, "close -n",
+	)
+	if data, _ := os.ReadFile(kept); string(data) != "x" {
+		t.Fatalf("close -y should save: %q", data)
+	}
+	if _, err := os.Stat(dropped); !os.IsNotExist(err) {
+		t.Fatalf("close -n should discard: %v", err)
+	}
+	// The flag answers one invocation only; the next close asks again.
+	mustExecute(t, dispatcher, "load dropped.txt", `append "x"`)
+	if err := dispatcher.Execute("close"); err == nil {
+		t.Fatalf("close without a flag should ask, and fail without input")
+	}
+	for _, bad := range []string{"close -y -n", "exit -x", "exit -y -n"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+	mustExecute(t, dispatcher, "exit -n")
+	if _, err := os.Stat(dropped); !os.IsNotExist(err) {
+		t.Fatalf("exit -n should discard: %v", err)
+	}
+	if strings.Count(prompts.String(), "是否保存") != 1 {
+		t.Fatalf("only the unflagged close should prompt: %q", prompts.String())
+	}
+}
+
+func TestDispatcherConfirmOffSkipsPrompt(t *testing.T) {
+	dir := t.TempDir()
+	prompts := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), bytes.NewBuffer(nil), prompts)
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, console)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	mustExecute(t, dispatcher, "set confirm off", "set prompt-default yes", "load a.txt", `append "x"`, "exit")
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "x" {
+		t.Fatalf("exit should save with the preset answer: %q", data)
+	}
+	if strings.Contains(prompts.String(), "是否保存") {
+		t.Fatalf("no prompt should be shown: %q", prompts.String())
+	}
+}
+
+func TestDispatcherCloseOthers(t *testing.T) {
+	dir := t.TempDir()
+	output := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString("c\nn\n"), output, bytes.NewBuffer(nil))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, console)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		mustExecute(t, dispatcher, "load "+name, `append "x"`)
+	}
+	mustExecute(t, dispatcher, "close others")
+	if !strings.Contains(output.String(), "已关闭 1 个文件, 1 个已取消仍保持打开") {
+		t.Fatalf("close others should report closed and cancelled files: %q", output.String())
+	}
+	if infos := ws.List(); len(infos) != 2 {
+		t.Fatalf("the active and the cancelled file should stay open: %+v", infos)
+	}
+	if active, _ := ws.ActiveEditor(); active.Name() != "c.txt" {
+		t.Fatalf("the active file should stay active: %s", active.Name())
+	}
+	mustExecute(t, dispatcher, "close all -n")
+	if len(ws.List()) != 0 || !strings.Contains(output.String(), "已关闭 2 个文件\n") {
+		t.Fatalf("close all -n should close everything: %q", output.String())
+	}
+}
+
+func TestDispatcherEditorListIndexes(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	if err := dispatcher.Execute("edit #1"); err == nil || !strings.Contains(err.Error(), "editor-list") {
+		t.Fatalf("an index before editor-list should fail, got %v", err)
+	}
+	mustExecute(t, dispatcher, "init text c.txt", "init text a.txt", "init text b.txt", "editor-list")
+	if !strings.Contains(output.String(), "  [1] a.txt") || !strings.Contains(output.String(), "* [2] b.txt") {
+		t.Fatalf("editor-list should number files by path: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "edit #3")
+	if active, _ := ws.ActiveEditor(); active.Name() != "c.txt" {
+		t.Fatalf("edit #3 should switch to c.txt: %s", active.Name())
+	}
+	mustExecute(t, dispatcher, "close #1 -n")
+	for _, info := range ws.List() {
+		if info.Name == "a.txt" {
+			t.Fatalf("close #1 should close a.txt")
+		}
+	}
+	err := dispatcher.Execute("edit #2")
+	if err == nil || err.Error() != "索引已失效，请重新执行 editor-list" {
+		t.Fatalf("indexes should be stale after a close, got %v", err)
+	}
+	mustExecute(t, dispatcher, "editor-list", "edit #1")
+	if active, _ := ws.ActiveEditor(); active.Name() != "b.txt" {
+		t.Fatalf("a fresh listing should renumber: %s", active.Name())
+	}
+	for _, bad := range []string{"edit #0", "edit #9", "close #x"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherRecentAndReopen(t *testing.T) {
+	dispatcher, ws, output, listener := newTestDispatcher(t)
+	if err := dispatcher.Execute("reopen"); err == nil {
+		t.Fatalf("reopen without closed files should fail")
+	}
+	dir := ws.BaseDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	mustExecute(t, dispatcher, "load a.txt", "load b.txt", "close a.txt", "close b.txt", "recent")
+	if !strings.Contains(output.String(), "[1] "+filepath.Join(dir, "b.txt")+"\n[2] "+filepath.Join(dir, "a.txt")) {
+		t.Fatalf("recent should list the closed files, latest first: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "reopen 2")
+	if active, _ := ws.ActiveEditor(); active == nil || active.Name() != "a.txt" {
+		t.Fatalf("reopen 2 should load a.txt")
+	}
+	load, last := listener.received[len(listener.received)-2], listener.received[len(listener.received)-1]
+	if load.Command != "load" || load.File != filepath.Join(dir, "a.txt") || last.Command != "reopen" || last.File != "" {
+		t.Fatalf("reopen should be logged against the file as a load: %+v %+v", load, last)
+	}
+	mustExecute(t, dispatcher, "close a.txt", "macro record again", "reopen", "macro stop")
+	if steps, _ := ws.Macro("again"); len(steps) != 1 || steps[0] != "reopen" {
+		t.Fatalf("reopen should be recorded into a macro: %q", steps)
+	}
+	mustExecute(t, dispatcher, "reopen")
+	if len(ws.List()) != 2 {
+		t.Fatalf("reopen should load the latest closed file: %+v", ws.List())
+	}
+	for _, bad := range []string{"reopen", "reopen x", "recent 1"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherLoadGlob(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	dir := filepath.Join(ws.BaseDir(), "src")
+	if err := os.MkdirAll(filepath.Join(dir, "sub.xml"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	files := map[string]string{"a.xml": "<root id=\"root\"/>", "b.xml": "<root", "c.xml": "<root id=\"root\"/>", "d.txt": "x"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	// b.xml fails to parse; the prompt to open it as text gets no answer.
+	mustExecute(t, dispatcher, "load-glob src/*.xml")
+	if !strings.Contains(output.String(), "跳过目录") || !strings.Contains(output.String(), "已打开 2 个文件, 1 个失败") {
+		t.Fatalf("load-glob should skip directories and summarise: %q", output.String())
+	}
+	if active, _ := ws.ActiveEditor(); active == nil || active.Name() != "c.xml" {
+		t.Fatalf("the last loaded file should be active")
+	}
+	if len(ws.List()) != 2 {
+		t.Fatalf("only the parsed files should be open: %+v", ws.List())
+	}
+	for _, entry := range ws.CommandHistory().Entries() {
+		if strings.HasPrefix(entry.Command, "load ") {
+			t.Fatalf("the loads behind load-glob should stay out of the history: %+v", ws.CommandHistory().Entries())
+		}
+	}
+	for _, bad := range []string{"load-glob", "load-glob src/*.md", "load-glob [", "load-glob src/b.xml"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherOpenDirAndFiles(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	project := filepath.Join(ws.BaseDir(), "hw")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.xml"} {
+		if err := os.WriteFile(filepath.Join(project, name), []byte("x"), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	mustExecute(t, dispatcher, "open-dir hw", "files")
+	if len(ws.List()) != 0 {
+		t.Fatalf("open-dir should not load files: %+v", ws.List())
+	}
+	if !strings.Contains(output.String(), "[1] a.txt\n[2] b.xml") {
+		t.Fatalf("files should list project files: %q", output.String())
+	}
+	mustExecute(t, dispatcher, "files .txt", "load 1")
+	if active, _ := ws.ActiveEditor(); active == nil || active.Path() != filepath.Join(project, "a.txt") {
+		t.Fatalf("load should take the index from files")
+	}
+	mustExecute(t, dispatcher, "open-dir ..")
+	if err := dispatcher.Execute("load 1"); err == nil {
+		t.Fatalf("indexes should not survive a project change")
+	}
+	if err := dispatcher.Execute("open-dir missing"); err == nil {
+		t.Fatalf("a missing directory should fail")
+	}
+}
+
+func TestDispatcherDirTreeDepthAndHidden(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	dir := ws.BaseDir()
+	if err := os.MkdirAll(filepath.Join(dir, "deep", "er"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	for _, name := range []string{".hidden", "deep/er/x.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	mustExecute(t, dispatcher, "dir-tree --depth 1")
+	if strings.TrimSpace(output.String()) != "└── deep/..." {
+		t.Fatalf("unexpected limited tree: %q", output.String())
+	}
+	output.Reset()
+	mustExecute(t, dispatcher, "dir-tree --all")
+	if !strings.Contains(output.String(), ".hidden") || !strings.Contains(output.String(), "x.txt") {
+		t.Fatalf("--all should list hidden files: %q", output.String())
+	}
+	for _, bad := range []string{"dir-tree --depth 0", "dir-tree --depth", "dir-tree --bogus"} {
+		if err := dispatcher.Execute(bad); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
+
+func TestDispatcherDirTreeSizeMarksOpenFiles(t *testing.T) {
+	dispatcher, ws, output, _ := newTestDispatcher(t)
+	dir := ws.BaseDir()
+	for name, content := range map[string]string{"a.txt": "aaa", "b.txt": "bb", "c.txt": "c"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	mustExecute(t, dispatcher, "load b.txt")
+	mustExecute(t, dispatcher, "load a.txt")
+	mustExecute(t, dispatcher, "append \"more\"")
+	output.Reset()
+	mustExecute(t, dispatcher, "dir-tree --size")
+	want := strings.Join([]string{
+		"├── a.txt (3B) * [modified]",
+		"├── b.txt (2B) *",
+		"└── c.txt (1B)",
+	}, "\n")
+	if strings.TrimSpace(output.String()) != want {
+		t.Fatalf("unexpected tree:\n%s\nwant:\n%s", output.String(), want)
+	}
+}
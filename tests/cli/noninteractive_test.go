@@ -0,0 +1,84 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/cli"
+	"softwaredesign/src/editor"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+// runWithoutInput opens a.txt with an unsaved edit, then runs the REPL on
+// input that is closed from the start.
+func runWithoutInput(t *testing.T, policy string, markClosed bool) (string, *workspace.StateKeeper, string) {
+	t.Helper()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("one\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	stderr := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), bytes.NewBuffer(nil), stderr)
+	if markClosed {
+		console.MarkClosed()
+	}
+	keeper := workspace.NewStateKeeper(dir)
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, keeper, logger, console)
+	if err := ws.Settings().Set("close-policy", policy); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("two"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	cli.NewDispatcher(ws, console, logger).Run()
+	return file, keeper, stderr.String()
+}
+
+func TestRunWithoutInputFollowsClosePolicy(t *testing.T) {
+	cases := []struct {
+		policy     string
+		markClosed bool
+		content    string
+		warning    string
+	}{
+		{"save", true, "one\ntwo\n", ""},
+		{"discard", true, "one\n", ""},
+		{"ask", false, "one\n", "未保存的修改已写入"},
+	}
+	for _, tc := range cases {
+		file, keeper, stderr := runWithoutInput(t, tc.policy, tc.markClosed)
+		if data, _ := os.ReadFile(file); string(data) != tc.content {
+			t.Fatalf("%s: unexpected file content %q", tc.policy, data)
+		}
+		if strings.Count(stderr, "输入已结束或不可用") != 1 {
+			t.Fatalf("%s: the notice should appear exactly once: %q", tc.policy, stderr)
+		}
+		if strings.Contains(stderr, "是否保存") {
+			t.Fatalf("%s: no prompt should be shown without input: %q", tc.policy, stderr)
+		}
+		if tc.warning != "" && !strings.Contains(stderr, tc.warning) {
+			t.Fatalf("%s: expected warning %q in %q", tc.policy, tc.warning, stderr)
+		}
+		recovered, err := os.ReadFile(filepath.Join(filepath.Dir(file), "a.recovered.txt"))
+		if tc.policy == "ask" && string(recovered) != "one\ntwo\n" {
+			t.Fatalf("ask: the unanswered changes should be kept in a recovery copy: %q %v", recovered, err)
+		}
+		if tc.policy != "ask" && err == nil {
+			t.Fatalf("%s: no recovery copy is needed: %q", tc.policy, recovered)
+		}
+		state, err := keeper.Load()
+		if err != nil || len(state.Editors) != 1 || state.Editors[0].Path != file {
+			t.Fatalf("%s: the workspace state should be persisted: %+v %v", tc.policy, state, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cli_test
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/cli"
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/spellcheck"
+	"softwaredesign/src/workspace"
+)
+
+func TestProgressListenerRendersOperations(t *testing.T) {
+	stderr := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), bytes.NewBuffer(nil), stderr)
+	bus := events.NewBus()
+	bus.Subscribe(cli.NewProgressListener(console))
+
+	op := bus.StartOperation("save-all", []string{"/w/a.txt", "/w/b.txt"}, 2)
+	op.Step("/w/a.txt")
+	op.Finish(errors.New("权限不足"))
+	want := "[save-all] 1/2 a.txt\n[save-all] 已中止 (1/2): 权限不足\n"
+	if stderr.String() != want {
+		t.Fatalf("unexpected progress output: %q", stderr.String())
+	}
+}
+
+func TestDispatcherLongOperationsPublishProgress(t *testing.T) {
+	dir := t.TempDir()
+	bus := events.NewBus()
+	listener := &recordingListener{}
+	bus.Subscribe(listener)
+	output, stderr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), output, stderr)
+	bus.Subscribe(cli.NewProgressListener(console))
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logger, nil)
+	ws.SetSpellService(spellcheck.NewService(spellcheck.NewSimpleChecker()))
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+
+	mustExecute(t, dispatcher, "init text a.txt", `append "teh"`, "init text b.txt", `append "fine"`,
+		"spell-check all", "save all", "report export report.csv")
+	if !strings.Contains(output.String(), "== "+filepath.Join(dir, "a.txt")+" ==") || !strings.Contains(output.String(), "== "+filepath.Join(dir, "b.txt")+" ==") {
+		t.Fatalf("spell-check all should report each file:\n%s", output.String())
+	}
+	want := "[spell-check-all] 1/2 a.txt\n[spell-check-all] 2/2 b.txt\n" +
+		"[save-all] 1/2 a.txt\n[save-all] 2/2 b.txt\n[report-export] 1/1 report.csv\n"
+	if stderr.String() != want {
+		t.Fatalf("unexpected progress output:\n%s", stderr.String())
+	}
+	var finished []string
+	for _, evt := range listener.received {
+		if evt.Type == events.EventOperationFinished {
+			finished = append(finished, evt.Command)
+		}
+	}
+	if strings.Join(finished, ",") != "spell-check-all,save-all,report-export" {
+		t.Fatalf("each operation should finish once: %v", finished)
+	}
+}
@@ -0,0 +1,59 @@
+package cli_test
+
+import (
+	"reflect"
+	"testing"
+
+	"softwaredesign/src/cli"
+)
+
+func TestTokenizeCanonicalRoundTrip(t *testing.T) {
+	cases := [][]string{
+		{"hello"},
+		{""},
+		{"she said \"hi\""},
+		{"line1\nline2", "crlf\r\n"},
+		{`C:\new dir\file.txt`, `trailing\`},
+		{`\"already escaped\"`},
+		{"你好 世界", "引号\"中文\""},
+		{"1:1", "5", "  padded  "},
+		{"tab\there", "\"", "\\"},
+	}
+	for _, args := range cases {
+		canonical := cli.CanonicalCommand("append", args)
+		tokens, err := cli.Tokenize(canonical)
+		if err != nil {
+			t.Fatalf("tokenize %q failed: %v", canonical, err)
+		}
+		if tokens[0] != "append" || !reflect.DeepEqual(tokens[1:], args) {
+			t.Fatalf("round trip of %q via %q gave %q", args, canonical, tokens[1:])
+		}
+	}
+}
+
+func TestTokenizeKeepsUnknownEscapes(t *testing.T) {
+	tokens, err := cli.Tokenize(`load "C:\docs\a.txt" plain\path`)
+	if err != nil {
+		t.Fatalf("tokenize failed: %v", err)
+	}
+	want := []string{"load", `C:\docs\a.txt`, `plain\path`}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("unexpected tokens: %q", tokens)
+	}
+	if got := cli.QuoteArgs([]string{"simple", "two words"}); got != `simple "two words"` {
+		t.Fatalf("unexpected quoting: %s", got)
+	}
+}
+
+func TestDispatcherPublishesCanonicalCommand(t *testing.T) {
+	dispatcher, _, _, listener := newTestDispatcher(t)
+	mustExecute(t, dispatcher, "init text a.txt", `append "she said \"hi\""`)
+	last := listener.received[len(listener.received)-1]
+	if last.Raw != `append "she said \"hi\""` {
+		t.Fatalf("raw input should be kept: %q", last.Raw)
+	}
+	tokens, err := cli.Tokenize(last.Metadata["canonical"])
+	if err != nil || !reflect.DeepEqual(tokens, []string{"append", `she said "hi"`}) {
+		t.Fatalf("canonical form should replay to the same arguments: %q (%v)", tokens, err)
+	}
+}
@@ -0,0 +1,192 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/cli"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+// runScript writes script into a fresh workspace directory holding a.txt and
+// runs it with answer assumed for every confirmation.
+func runScript(t *testing.T, script string, opts cli.ScriptOptions, answer bool) (string, string, *workspace.StateKeeper, error) {
+	t.Helper()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("one\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	path := filepath.Join(dir, "script.txt")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	out := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), out, out)
+	console.AssumeAnswer(answer)
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), console)
+	err := cli.RunScript(ws, console, path, opts)
+	return file, out.String(), keeper, err
+}
+
+func TestRunScriptEchoesCommandsAndSavesOnExit(t *testing.T) {
+	script := "# set up\n\nload a.txt\n  # indented comment\nappend \"two\"\n"
+	file, out, keeper, err := runScript(t, script, cli.ScriptOptions{}, true)
+	if err != nil {
+		t.Fatalf("script failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "> load a.txt") || !strings.Contains(out, "> append \"two\"") {
+		t.Fatalf("commands should be echoed: %q", out)
+	}
+	if strings.Contains(out, "set up") || strings.Contains(out, "indented comment") {
+		t.Fatalf("comments should be skipped: %q", out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\ntwo\n" {
+		t.Fatalf("the assumed answer should save the file: %q", data)
+	}
+	state, err := keeper.Load()
+	if err != nil || len(state.Editors) != 1 || state.Editors[0].Path != file {
+		t.Fatalf("the workspace state should be persisted: %+v %v", state, err)
+	}
+}
+
+func TestRunScriptAssumeNoDiscards(t *testing.T) {
+	file, out, _, err := runScript(t, "load a.txt\nappend \"two\"\n", cli.ScriptOptions{}, false)
+	if err != nil {
+		t.Fatalf("script failed: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\n" {
+		t.Fatalf("answering no should leave the file unsaved: %q", data)
+	}
+}
+
+func TestRunScriptStopsAtFirstError(t *testing.T) {
+	script := "load a.txt\nno-such-command\nappend \"two\"\n"
+	file, out, _, err := runScript(t, script, cli.ScriptOptions{}, true)
+	if err == nil || !strings.Contains(err.Error(), "第 2 行") {
+		t.Fatalf("expected an error naming line 2, got %v", err)
+	}
+	if strings.Contains(out, "> append") {
+		t.Fatalf("commands after the failure should not run: %q", out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\n" {
+		t.Fatalf("the file should be untouched: %q", data)
+	}
+}
+
+func TestRunScriptFailureStillExits(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("one\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	path := filepath.Join(dir, "script.txt")
+	if err := os.WriteFile(path, []byte("load a.txt\nappend \"two\"\nno-such-command\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	out := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), out, out)
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), console)
+	err := cli.RunScript(ws, console, path, cli.ScriptOptions{})
+	if err == nil || !strings.Contains(err.Error(), "第 3 行") {
+		t.Fatalf("expected an error naming line 3, got %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\n" {
+		t.Fatalf("nobody answered, so the file should be unsaved: %q", data)
+	}
+	if recovered, err := os.ReadFile(filepath.Join(dir, "a.recovered.txt")); string(recovered) != "one\ntwo\n" {
+		t.Fatalf("the unsaved changes should be kept in a recovery copy: %q %v\n%s", recovered, err, out)
+	}
+	if state, err := keeper.Load(); err != nil || len(state.Editors) != 1 || state.Editors[0].Path != file {
+		t.Fatalf("the workspace state should be persisted after the failure: %+v %v", state, err)
+	}
+}
+
+func TestRunScriptContinueOnError(t *testing.T) {
+	script := "load a.txt\nno-such-command\nappend \"two\"\n"
+	file, out, keeper, err := runScript(t, script, cli.ScriptOptions{ContinueOnError: true}, true)
+	if err == nil || !strings.Contains(err.Error(), "1 条命令失败") {
+		t.Fatalf("a run with failures should still fail, got %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\ntwo\n" {
+		t.Fatalf("commands after the failure should run: %q\n%s", data, out)
+	}
+	if state, err := keeper.Load(); err != nil || len(state.Editors) != 1 {
+		t.Fatalf("the workspace state should be persisted before failing: %+v %v", state, err)
+	}
+}
+
+func TestRunScriptStopsAtExit(t *testing.T) {
+	_, out, _, err := runScript(t, "load a.txt\nexit\nappend \"two\"\n", cli.ScriptOptions{}, true)
+	if err != nil {
+		t.Fatalf("script failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "> append") {
+		t.Fatalf("nothing should run after exit: %q", out)
+	}
+}
+
+func TestRunScriptMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	console := cli.NewConsole(bytes.NewBufferString(""), bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), console)
+	if err := cli.RunScript(ws, console, filepath.Join(dir, "missing.txt"), cli.ScriptOptions{}); err == nil {
+		t.Fatalf("expected an error for a missing script")
+	}
+}
+
+func TestAssumeAnswerSkipsInput(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString("n\n"), out, out)
+	console.AssumeAnswer(true)
+	ok, err := console.Confirm("继续吗?")
+	if err != nil || !ok {
+		t.Fatalf("expected the assumed answer, got %v %v", ok, err)
+	}
+	if !strings.Contains(out.String(), "继续吗?") {
+		t.Fatalf("the prompt should still be shown: %q", out.String())
+	}
+	if answer, preset := console.PresetSave(); !preset || !answer {
+		t.Fatalf("an assumed answer should need no save prompt: %v %v", answer, preset)
+	}
+}
+
+func TestRunCommandsWithoutEcho(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("one\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	out := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(""), out, out)
+	keeper := workspace.NewStateKeeper(dir)
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, keeper, logger, console)
+	dispatcher := cli.NewDispatcher(ws, console, logger)
+	if err := dispatcher.RunCommands([]string{"load a.txt", "append \"two\"", "save"}, cli.ScriptOptions{}); err != nil {
+		t.Fatalf("commands failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out.String(), "> ") {
+		t.Fatalf("commands should not be echoed: %q", out)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\ntwo\n" {
+		t.Fatalf("unexpected file content %q", data)
+	}
+	if state, err := keeper.Load(); err != nil || len(state.Editors) != 1 {
+		t.Fatalf("the workspace state should be persisted: %+v %v", state, err)
+	}
+
+	err := dispatcher.RunCommands([]string{"load a.txt", "bogus", "append \"three\""}, cli.ScriptOptions{})
+	if err == nil || !strings.Contains(err.Error(), "第 2 条命令") {
+		t.Fatalf("expected an error naming the second command, got %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\ntwo\n" {
+		t.Fatalf("commands after the failure should not run: %q", data)
+	}
+}
@@ -0,0 +1,70 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/cli"
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func runTutorial(t *testing.T, script string) (string, string) {
+	t.Helper()
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	dir := t.TempDir()
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	console := cli.NewConsole(bytes.NewBufferString(script), stdout, stderr)
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), console)
+	if err := cli.NewDispatcher(ws, console, logging.NewManager()).Execute("tutorial"); err != nil {
+		t.Fatalf("tutorial failed: %v", err)
+	}
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatalf("read temp dir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("sandbox should be cleaned up, found %v", entries)
+	}
+	return stdout.String(), stderr.String()
+}
+
+func TestTutorialCompletes(t *testing.T) {
+	script := strings.Join([]string{
+		"init text demo.txt",
+		`append Hello`,
+		"help",
+		`append   "World"`,
+		"show",
+		"undo",
+		"save",
+		"init xml book.xml",
+		`append-child title t1 root "Go"`,
+		"xml-tree",
+		"log-on",
+		"save book.xml",
+		"exit",
+	}, "\n") + "\n"
+	stdout, _ := runTutorial(t, script)
+	if !strings.Contains(stdout, "教程完成!") {
+		t.Fatalf("tutorial should complete: %s", stdout)
+	}
+	if !strings.Contains(stdout, "与预期不符") {
+		t.Fatalf("unexpected input should be rejected: %s", stdout)
+	}
+	if !strings.Contains(stdout, "2: World") {
+		t.Fatalf("sandbox commands should show results: %s", stdout)
+	}
+}
+
+func TestTutorialQuit(t *testing.T) {
+	stdout, _ := runTutorial(t, "init text demo.txt\nquit\n")
+	if !strings.Contains(stdout, "已退出教程") || strings.Contains(stdout, "教程完成") {
+		t.Fatalf("quit should abandon the tutorial: %s", stdout)
+	}
+}
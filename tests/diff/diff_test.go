@@ -0,0 +1,64 @@
+package diff_test
+
+import (
+	"strings"
+	"testing"
+
+	"softwaredesign/src/diff"
+)
+
+func TestUnifiedHunks(t *testing.T) {
+	old := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	changed := []string{"a", "B", "c", "d", "e", "f", "g", "h", "i", "j", "k"}
+	got := strings.Join(diff.Unified(old, changed, 1), "\n")
+	want := strings.Join([]string{
+		"@@ -1,3 +1,3 @@", " a", "-b", "+B", " c",
+		"@@ -10,1 +10,2 @@", " j", "+k",
+	}, "\n")
+	if got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+	// Changes closer than twice the context share one hunk.
+	if hunks := diff.Hunks(diff.Lines(old, changed), 4); len(hunks) != 1 || hunks[0].Header() != "@@ -1,10 +1,11 @@" {
+		t.Fatalf("unexpected merged hunks: %+v", hunks)
+	}
+}
+
+func TestUnifiedEdgeCases(t *testing.T) {
+	if out := diff.Unified([]string{"x", "y"}, []string{"x", "y"}, 3); out != nil {
+		t.Fatalf("equal input should produce no hunks: %q", out)
+	}
+	got := strings.Join(diff.Unified(nil, []string{"x", "y"}, 3), "\n")
+	if got != "@@ -0,0 +1,2 @@\n+x\n+y" {
+		t.Fatalf("unexpected diff against an empty file:\n%s", got)
+	}
+	got = strings.Join(diff.Unified([]string{"a", "b", "c"}, []string{"a", "c"}, 0), "\n")
+	if got != "@@ -2,1 +1,0 @@\n-b" {
+		t.Fatalf("unexpected deletion hunk:\n%s", got)
+	}
+}
+
+func TestLinesIsMinimal(t *testing.T) {
+	old := strings.Split("the quick brown fox jumps over the lazy dog", " ")
+	changed := strings.Split("the brown fox quickly jumps over a lazy dog", " ")
+	edits := diff.Lines(old, changed)
+	var rebuiltOld, rebuiltNew []string
+	changes := 0
+	for _, edit := range edits {
+		if edit.Op != diff.Insert {
+			rebuiltOld = append(rebuiltOld, edit.Text)
+		}
+		if edit.Op != diff.Delete {
+			rebuiltNew = append(rebuiltNew, edit.Text)
+		}
+		if edit.Op != diff.Equal {
+			changes++
+		}
+	}
+	if strings.Join(rebuiltOld, " ") != strings.Join(old, " ") || strings.Join(rebuiltNew, " ") != strings.Join(changed, " ") {
+		t.Fatalf("edits do not reproduce both versions: %+v", edits)
+	}
+	if changes != 4 {
+		t.Fatalf("expected 4 changed lines, got %d: %+v", changes, edits)
+	}
+}
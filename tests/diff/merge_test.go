@@ -0,0 +1,53 @@
+package diff_test
+
+import (
+	"strings"
+	"testing"
+
+	"softwaredesign/src/diff"
+)
+
+func TestMergeCombinesSeparateChanges(t *testing.T) {
+	base := []string{"a", "b", "c", "d", "e"}
+	ours := []string{"a", "B", "c", "d", "e"}
+	theirs := []string{"a", "b", "c", "d", "E", "f"}
+	result := diff.Merge(base, ours, theirs, "ours", "theirs")
+	if result.Conflicts != 0 || strings.Join(result.Lines, ",") != "a,B,c,d,E,f" {
+		t.Fatalf("unexpected merge: %+v", result)
+	}
+}
+
+func TestMergeCases(t *testing.T) {
+	cases := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflicts          int
+	}{
+		{"unchanged", "a,b", "a,b", "a,b", "a,b", 0},
+		{"only theirs", "a,b", "a,b", "a,x,b", "a,x,b", 0},
+		{"only ours deletes", "a,b,c", "a,c", "a,b,c", "a,c", 0},
+		{"same change twice", "a,b,c", "a,x,c", "a,x,c", "a,x,c", 0},
+		{"both delete", "a,b,c", "a,c", "a,c", "a,c", 0},
+		{"insert at start and end", "a", "s,a", "a,e", "s,a,e", 0},
+		{"from empty", "", "x", "", "x", 0},
+		{"conflicting edit", "a,b,c", "a,x,c", "a,y,c", "a,<<<<<<< ours,x,=======,y,>>>>>>> theirs,c", 1},
+		{"edit against delete", "a,b,c", "a,x,c", "a,c", "a,<<<<<<< ours,x,=======,>>>>>>> theirs,c", 1},
+		{"two conflicts", "a,b,c,d,e", "a,1,c,3,e", "a,2,c,4,e", "a,<<<<<<< ours,1,=======,2,>>>>>>> theirs,c,<<<<<<< ours,3,=======,4,>>>>>>> theirs,e", 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := diff.Merge(split(tc.base), split(tc.ours), split(tc.theirs), "ours", "theirs")
+			if got := strings.Join(result.Lines, ","); got != tc.want || result.Conflicts != tc.conflicts {
+				t.Fatalf("got %q with %d conflicts, want %q with %d", got, result.Conflicts, tc.want, tc.conflicts)
+			}
+		})
+	}
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
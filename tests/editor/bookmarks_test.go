@@ -0,0 +1,57 @@
+package editor_test
+
+import (
+	"fmt"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+func markList(ed *editor.TextEditor) string {
+	return fmt.Sprint(ed.Marks())
+}
+
+func TestBookmarksFollowLineEdits(t *testing.T) {
+	ed := editor.NewTextEditor("marks.txt", []string{"alpha", "beta", "gamma", "delta"}, false)
+	for _, m := range []editor.Bookmark{{Name: "top", Line: 1, Col: 3}, {Name: "mid", Line: 3, Col: 6}, {Name: "end", Line: 4, Col: 1}} {
+		if err := ed.SetMark(m.Name, m.Line, m.Col); err != nil {
+			t.Fatalf("set mark failed: %v", err)
+		}
+	}
+	if err := ed.InsertLines(2, []string{"new one", "new two"}); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if got := markList(ed); got != "[{top 1 3} {mid 5 6} {end 6 1}]" {
+		t.Fatalf("marks below an insert should shift: %s", got)
+	}
+	if err := ed.DeleteLines(5, 5); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if got := markList(ed); got != "[{top 1 3} {end 5 1}]" {
+		t.Fatalf("a deleted line should drop its mark: %s", got)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := markList(ed); got != "[{top 1 3} {end 6 1}]" {
+		t.Fatalf("undo should shift marks back: %s", got)
+	}
+	if err := ed.Replace(1, 1, 5, "a"); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	if got := markList(ed); got != "[{top 1 2} {end 6 1}]" {
+		t.Fatalf("columns should be clamped to the shortened line: %s", got)
+	}
+	if _, err := ed.GotoMark("end"); err != nil {
+		t.Fatalf("goto mark failed: %v", err)
+	}
+	if line, col := ed.Cursor(); line != 6 || col != 1 {
+		t.Fatalf("unexpected cursor %d:%d", line, col)
+	}
+	if _, err := ed.GotoMark("mid"); err == nil {
+		t.Fatalf("removed mark should be gone")
+	}
+	if err := ed.SetMark("bad", 9, 1); err == nil {
+		t.Fatalf("out-of-range mark should be rejected")
+	}
+}
@@ -0,0 +1,118 @@
+package editor_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+func openLarge(t *testing.T, content string) *editor.LargeTextEditor {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	ed, err := editor.OpenLargeText(path)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	return ed
+}
+
+func TestLargeTextIndexesLines(t *testing.T) {
+	cases := map[string][]string{
+		"":                            {},
+		"one":                         {"one"},
+		"one\n":                       {"one"},
+		"one\r\ntwo\n\nfour":          {"one", "two", "", "four"},
+		"\xEF\xBB\xBFbom\r\nline\r\n": {"bom", "line"},
+	}
+	for content, want := range cases {
+		ed := openLarge(t, content)
+		if ed.LineCount() != len(want) {
+			t.Fatalf("%q: expected %d lines, got %d", content, len(want), ed.LineCount())
+		}
+		lines, err := ed.Show(1, 0)
+		if err != nil || strings.Join(lines, "|") != strings.Join(want, "|") {
+			t.Fatalf("%q: unexpected lines %q, %v", content, lines, err)
+		}
+		if text, _ := ed.Content(); text != strings.Join(want, "\n") {
+			t.Fatalf("%q: unexpected content %q", content, text)
+		}
+	}
+}
+
+func TestLargeTextShowFindAndRefuseEdits(t *testing.T) {
+	ed := openLarge(t, "alpha\nbeta Alpha\ngamma\n")
+	if lines, err := ed.Show(2, 3); err != nil || len(lines) != 2 || lines[0] != "beta Alpha" {
+		t.Fatalf("unexpected range: %q, %v", lines, err)
+	}
+	for _, bad := range [][2]int{{0, 1}, {4, 0}, {3, 2}, {1, 4}} {
+		if _, err := ed.Show(bad[0], bad[1]); err == nil {
+			t.Fatalf("show %d:%d should fail", bad[0], bad[1])
+		}
+	}
+	matches := ed.Find("alpha", true)
+	if len(matches) != 2 || matches[1].Line != 2 || matches[1].Col != 6 || matches[1].Matched != "Alpha" {
+		t.Fatalf("unexpected matches: %+v", matches)
+	}
+	var seen []int
+	if err := ed.EachLine(func(n int, line string) bool {
+		seen = append(seen, n)
+		return n < 2
+	}); err != nil || len(seen) != 2 {
+		t.Fatalf("EachLine should stop when asked: %v, %v", seen, err)
+	}
+	if err := ed.Undo(); err == nil || ed.UndoDepth() != 0 {
+		t.Fatalf("large-file mode keeps no history")
+	}
+	if stats := ed.MemoryStats(); stats.ContentBytes != 8*4 {
+		t.Fatalf("only the line index should be counted: %+v", stats)
+	}
+	var _ editor.LineReader = ed
+	if _, ok := editor.Editor(ed).(editor.TextDocument); ok {
+		t.Fatalf("a large-file editor must not accept text edits")
+	}
+	if !strings.Contains(editor.ErrLargeFile.Error(), "promote") {
+		t.Fatalf("the error should point at promote: %v", editor.ErrLargeFile)
+	}
+}
+
+func TestLargeTextKeepsBookmarks(t *testing.T) {
+	ed := openLarge(t, "alpha\nbeta\n")
+	var _ editor.Bookmarker = ed
+	if err := ed.SetMark("end", 2, 5); err != nil {
+		t.Fatalf("a mark just past the line end should be allowed: %v", err)
+	}
+	if err := ed.SetMark("start", 1, 1); err != nil {
+		t.Fatalf("set mark failed: %v", err)
+	}
+	marks := ed.Marks()
+	if len(marks) != 2 || marks[0].Name != "start" || marks[1] != (editor.Bookmark{Name: "end", Line: 2, Col: 5}) {
+		t.Fatalf("marks should be listed in document order: %+v", marks)
+	}
+	for _, bad := range [][2]int{{0, 1}, {3, 1}, {2, 6}, {1, 0}} {
+		if err := ed.SetMark("bad", bad[0], bad[1]); err == nil {
+			t.Fatalf("mark at %d:%d should fail", bad[0], bad[1])
+		}
+	}
+	if err := ed.SetMark("two words", 1, 1); err == nil {
+		t.Fatalf("a mark name with spaces should fail")
+	}
+}
+
+func TestLargeTextSpan(t *testing.T) {
+	ed := openLarge(t, "alpha\n长长的行\n")
+	var _ editor.SpanReader = ed
+	if text, err := ed.Span(2, 2, 2); err != nil || text != "长的" {
+		t.Fatalf("unexpected span: %q, %v", text, err)
+	}
+	for _, bad := range [][3]int{{0, 1, 1}, {3, 1, 1}, {1, 6, 1}, {1, 5, 2}, {1, 1, 0}} {
+		if _, err := ed.Span(bad[0], bad[1], bad[2]); err == nil {
+			t.Fatalf("span %v should fail", bad)
+		}
+	}
+}
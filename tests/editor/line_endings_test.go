@@ -0,0 +1,72 @@
+package editor_test
+
+import (
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+func TestDetectLineStyle(t *testing.T) {
+	cases := []struct {
+		text string
+		want editor.LineStyle
+	}{
+		{"a\nb", editor.LineStyle{Ending: editor.LineEndingLF}},
+		{"a\r\nb\r\n", editor.LineStyle{Ending: editor.LineEndingCRLF, TrailingNewline: true}},
+		{"a\r\nb\r\nc\n", editor.LineStyle{Ending: editor.LineEndingCRLF, Mixed: true, TrailingNewline: true}},
+		{"a\r\nb\n", editor.LineStyle{Ending: editor.LineEndingLF, Mixed: true, TrailingNewline: true}},
+		{"", editor.LineStyle{Ending: editor.LineEndingLF}},
+	}
+	for _, tc := range cases {
+		if got := editor.DetectLineStyle(tc.text); got != tc.want {
+			t.Fatalf("DetectLineStyle(%q) = %+v, want %+v", tc.text, got, tc.want)
+		}
+	}
+	if name := editor.DetectLineStyle("a\r\nb\n").Name(); name != "mixed" {
+		t.Fatalf("mixed endings should be named mixed, got %s", name)
+	}
+}
+
+func TestLineStyleJoin(t *testing.T) {
+	style := editor.LineStyle{Ending: editor.LineEndingCRLF, TrailingNewline: true}
+	if got := style.Join([]string{"a", "b"}); got != "a\r\nb\r\n" {
+		t.Fatalf("unexpected CRLF content: %q", got)
+	}
+	if got := style.Join(nil); got != "" {
+		t.Fatalf("an empty file should stay empty: %q", got)
+	}
+	if got := (editor.LineStyle{}).Join([]string{"a", "b"}); got != "a\nb" {
+		t.Fatalf("the zero style should write LF without a trailing newline: %q", got)
+	}
+}
+
+func TestConvertLineEndingsIsUndoable(t *testing.T) {
+	ed := editor.NewTextEditor("a.txt", []string{"one", "two"}, false)
+	ed.SetLineStyle(editor.LineStyle{Ending: editor.LineEndingLF, Mixed: true, TrailingNewline: true})
+	if err := ed.ConvertLineEndings(editor.LineEndingCRLF); err != nil {
+		t.Fatalf("convert failed: %v", err)
+	}
+	if style := ed.LineStyle(); style.Ending != editor.LineEndingCRLF || style.Mixed || !style.TrailingNewline || !ed.IsModified() {
+		t.Fatalf("convert should switch to CRLF and mark the buffer modified: %+v", style)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if style := ed.LineStyle(); style.Ending != editor.LineEndingLF || !style.Mixed {
+		t.Fatalf("undo should restore the detected style: %+v", style)
+	}
+	if err := ed.Redo(); err != nil {
+		t.Fatalf("redo failed: %v", err)
+	}
+	if ed.LineStyle().Ending != editor.LineEndingCRLF || ed.UndoDescription() != "set-line-endings" {
+		t.Fatalf("redo should reapply CRLF: %+v", ed.LineStyle())
+	}
+	depth := ed.UndoDepth()
+	if err := ed.ConvertLineEndings(editor.LineEndingCRLF); err != nil || ed.UndoDepth() != depth {
+		t.Fatalf("converting to the current ending should be a no-op: %v", err)
+	}
+	ed.SetReadOnly(true)
+	if err := ed.ConvertLineEndings(editor.LineEndingLF); err != editor.ErrReadOnly {
+		t.Fatalf("read-only editors should refuse conversion, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package editor_test
+
+import (
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+const hugeLineRunes = 10 << 20
+
+func hugeLineEditor() *editor.TextEditor {
+	return editor.NewTextEditor("huge.log", []string{strings.Repeat("日", 16) + strings.Repeat("x", hugeLineRunes-16)}, false)
+}
+
+func TestSpanEditsOnHugeLine(t *testing.T) {
+	ed := hugeLineEditor()
+	if err := ed.Insert(1, 3, "ab"); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if err := ed.Delete(1, 3, 2); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := ed.Replace(1, 16, 2, "Y"); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	line := ed.Lines()[0]
+	if !strings.HasPrefix(line, strings.Repeat("日", 15)+"Yxx") || len([]rune(line)) != hugeLineRunes-1 {
+		t.Fatalf("unexpected line prefix %q", line[:60])
+	}
+	assertSize(t, ed)
+	if err := ed.Delete(1, hugeLineRunes-2, 5); err == nil {
+		t.Fatalf("span past the line end should fail")
+	}
+}
+
+func BenchmarkDeleteNearStartOfHugeLine(b *testing.B) {
+	ed := hugeLineEditor()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ed.Delete(1, 2, 1); err != nil {
+			b.Fatalf("delete failed: %v", err)
+		}
+		if err := ed.Undo(); err != nil {
+			b.Fatalf("undo failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkInsertNearStartOfHugeLine(b *testing.B) {
+	ed := hugeLineEditor()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ed.Insert(1, 2, "z"); err != nil {
+			b.Fatalf("insert failed: %v", err)
+		}
+		if err := ed.Undo(); err != nil {
+			b.Fatalf("undo failed: %v", err)
+		}
+	}
+}
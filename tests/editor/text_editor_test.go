@@ -1,7 +1,11 @@
 package editor_test
 
 import (
+	"errors"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
 	"softwaredesign/src/editor"
 )
@@ -93,3 +97,744 @@ func TestShowRange(t *testing.T) {
 		t.Fatalf("unexpected show range: %v", lines)
 	}
 }
+
+func TestSizeCounterTracksEdits(t *testing.T) {
+	ed := editor.NewTextEditor("size.txt", []string{"héllo"}, false)
+	steps := []func() error{
+		func() error { return ed.Append("second line") },
+		func() error { return ed.Insert(1, 3, "中文\nsplit") },
+		func() error { return ed.Delete(2, 1, 3) },
+		func() error { return ed.Replace(1, 1, 2, "ab\ncd\nef") },
+		func() error { return ed.Delete(9, 1, 1) },
+	}
+	for i, step := range steps {
+		err := step()
+		if i == len(steps)-1 {
+			if err == nil {
+				t.Fatalf("out-of-range delete should fail")
+			}
+		} else if err != nil {
+			t.Fatalf("step %d failed: %v", i, err)
+		}
+		assertSize(t, ed)
+	}
+	for ed.Undo() == nil {
+		assertSize(t, ed)
+	}
+	for ed.Redo() == nil {
+		assertSize(t, ed)
+	}
+}
+
+func assertSize(t *testing.T, ed *editor.TextEditor) {
+	t.Helper()
+	content, _ := ed.Content()
+	if ed.Size() != len(content) {
+		t.Fatalf("size counter %d, content length %d", ed.Size(), len(content))
+	}
+}
+
+type stepClock struct {
+	now time.Time
+}
+
+func (c *stepClock) Now() time.Time { return c.now }
+
+func TestUndoCoalescingWindow(t *testing.T) {
+	clock := &stepClock{now: time.Unix(0, 0)}
+	ed := editor.NewTextEditor("merge.txt", []string{"start"}, false)
+	ed.WithClock(clock)
+	ed.ConfigureCoalescing(2*time.Second, 100)
+	ed.SetCoalescing(true)
+
+	for _, line := range []string{"a", "b", "c"} {
+		clock.now = clock.now.Add(time.Second)
+		if err := ed.Append(line); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	// Exactly at the window edge still merges; one nanosecond past it does not.
+	clock.now = clock.now.Add(2 * time.Second)
+	ed.Append("d")
+	clock.now = clock.now.Add(2*time.Second + time.Nanosecond)
+	ed.Append("e")
+
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "start,a,b,c,d" {
+		t.Fatalf("first undo should only revert e: %s", got)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "start" {
+		t.Fatalf("merged undo should restore pre-sequence content: %s", got)
+	}
+}
+
+func TestUndoCoalescingBoundaries(t *testing.T) {
+	ed := editor.NewTextEditor("merge.txt", []string{}, false)
+	ed.ConfigureCoalescing(0, 2)
+	ed.SetCoalescing(true)
+
+	ed.Append("1")
+	ed.Append("2")
+	ed.Append("3") // exceeds the 2-line limit, starts a new entry
+	ed.BreakCoalescing()
+	ed.Append("4") // read command in between, starts a new entry
+	ed.Insert(1, 1, "x")
+
+	var snapshots []string
+	for ed.Undo() == nil {
+		snapshots = append(snapshots, strings.Join(ed.Lines(), ","))
+	}
+	want := []string{"1,2,3,4", "1,2,3", "1,2", ""}
+	if strings.Join(snapshots, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected undo boundaries: %q", snapshots)
+	}
+}
+
+func TestReplaceWordAt(t *testing.T) {
+	ed := editor.NewTextEditor("spell.txt", []string{"café helo wörld"}, false)
+	if err := ed.ReplaceWordAt(1, 6, "helo", "hello"); err != nil {
+		t.Fatalf("replace word failed: %v", err)
+	}
+	if got := ed.Lines()[0]; got != "café hello wörld" {
+		t.Fatalf("unexpected content: %s", got)
+	}
+
+	var mismatch *editor.WordMismatchError
+	err := ed.ReplaceWordAt(1, 6, "helo", "hello")
+	if !errors.As(err, &mismatch) || mismatch.Found != "hello" {
+		t.Fatalf("stale report should yield a mismatch, got %v", err)
+	}
+	// Column 3 is inside "café", so no word starts there.
+	if err := ed.ReplaceWordAt(1, 3, "fé", "fe"); !errors.As(err, &mismatch) {
+		t.Fatalf("mid-word position should mismatch, got %v", err)
+	}
+	if got := ed.Lines()[0]; got != "café hello wörld" {
+		t.Fatalf("failed replacements must not change content: %s", got)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := ed.Lines()[0]; got != "café helo wörld" {
+		t.Fatalf("undo should restore the word: %s", got)
+	}
+}
+
+func TestIdenticalReplaceIsNoOp(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"hello world"}, false)
+	if err := ed.Replace(1, 1, 5, "hello"); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	if !ed.LastEditNoOp() || ed.IsModified() || ed.UndoDescription() != "" {
+		t.Fatalf("identical replace should leave no trace")
+	}
+	if err := ed.Replace(1, 1, 5, "howdy"); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	if ed.LastEditNoOp() || !ed.IsModified() || ed.UndoDescription() == "" {
+		t.Fatalf("genuine replace should be recorded")
+	}
+}
+
+func TestRedoStashedText(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", nil, false)
+	ed.SetPreserveRedo(true)
+	for _, line := range []string{"a", "b", "c"} {
+		if err := ed.Append(line); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	ed.Undo()
+	ed.Undo()
+	if descs := ed.RedoDescriptions(); len(descs) != 2 {
+		t.Fatalf("expected two redo entries, got %v", descs)
+	}
+	if err := ed.Append("z"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if ed.StashedRedoDepth() != 2 || len(ed.RedoDescriptions()) != 0 {
+		t.Fatalf("diverging edit should stash the redo branch")
+	}
+	if err := ed.RedoStashed(); err != nil {
+		t.Fatalf("redo stashed failed: %v", err)
+	}
+	if err := ed.Redo(); err != nil {
+		t.Fatalf("remaining branch should be redoable: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "a,b,c" {
+		t.Fatalf("unexpected recovered content: %s", got)
+	}
+	if err := ed.RedoStashed(); err == nil {
+		t.Fatalf("stash should be consumed")
+	}
+}
+
+func TestFind(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"Hello hello", "你好 hello", "none"}, false)
+	matches := ed.Find("hello", false)
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 case-sensitive matches, got %+v", matches)
+	}
+	if matches[0].Line != 1 || matches[0].Col != 7 || matches[1].Line != 2 || matches[1].Col != 4 {
+		t.Fatalf("unexpected positions: %+v", matches)
+	}
+	if matches[1].Text != "你好 hello" {
+		t.Fatalf("match should carry the line content: %+v", matches[1])
+	}
+	if got := ed.Find("HELLO", true); len(got) != 3 || got[0].Col != 1 {
+		t.Fatalf("unexpected case-insensitive matches: %+v", got)
+	}
+	if got := ed.Find("aa", false); got != nil {
+		t.Fatalf("expected no matches, got %+v", got)
+	}
+	overlap := editor.NewTextEditor("test.txt", []string{"aaaa"}, false)
+	if got := overlap.Find("aa", false); len(got) != 2 || got[1].Col != 3 {
+		t.Fatalf("matches should not overlap: %+v", got)
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"foo bar foo", "bar", "foofoo"}, false)
+	count, err := ed.ReplaceAll("foo", "baz")
+	if err != nil || count != 4 {
+		t.Fatalf("expected 4 replacements, got %d (%v)", count, err)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "baz bar baz|bar|bazbaz" {
+		t.Fatalf("unexpected content: %s", got)
+	}
+	assertSize(t, ed)
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "foo bar foo|bar|foofoo" {
+		t.Fatalf("single undo should revert every replacement: %s", got)
+	}
+
+	ed.SetModified(false)
+	if count, _ := ed.ReplaceAll("missing", "x"); count != 0 || ed.IsModified() {
+		t.Fatalf("no match should leave the document untouched")
+	}
+	if _, err := ed.ReplaceAll("", "x"); err == nil {
+		t.Fatalf("empty pattern should be rejected")
+	}
+	if count, _ := ed.ReplaceAll("bar", "b\nr"); count != 2 || len(ed.Lines()) != 5 {
+		t.Fatalf("newline replacements should split lines: %v", ed.Lines())
+	}
+	assertSize(t, ed)
+}
+
+func TestFindRegex(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"id=12, 中文 id=345", "none"}, false)
+	matches, err := ed.FindRegex(`id=\d+`)
+	if err != nil {
+		t.Fatalf("find regex failed: %v", err)
+	}
+	if len(matches) != 2 || matches[1].Col != 11 || matches[1].Matched != "id=345" {
+		t.Fatalf("unexpected matches: %+v", matches)
+	}
+	ends, err := ed.FindRegex(`$`)
+	if err != nil {
+		t.Fatalf("find regex failed: %v", err)
+	}
+	if len(ends) != 2 || ends[0].Col != 17 || ends[1].Col != 5 || ends[0].Matched != "" {
+		t.Fatalf("end-of-line matches should sit after the last rune: %+v", ends)
+	}
+	if _, err := ed.FindRegex(`(`); err == nil || !strings.Contains(err.Error(), "正则表达式无效") {
+		t.Fatalf("expected compile error, got %v", err)
+	}
+}
+
+func TestCursorFollowsEdits(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"hello", "world"}, false)
+	if line, col := ed.Cursor(); line != 1 || col != 1 {
+		t.Fatalf("cursor should start at 1:1, got %d:%d", line, col)
+	}
+	if err := ed.MoveCursor(2, 9); err == nil {
+		t.Fatalf("cursor beyond line end should be rejected")
+	}
+	if err := ed.Insert(1, 6, ", 你好\nnew"); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if line, col := ed.Cursor(); line != 2 || col != 4 {
+		t.Fatalf("cursor should sit after inserted text, got %d:%d", line, col)
+	}
+	if err := ed.Delete(1, 1, 2); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if line, col := ed.Cursor(); line != 1 || col != 1 {
+		t.Fatalf("cursor should sit at the deletion point, got %d:%d", line, col)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if line, col := ed.Cursor(); line != 2 || col != 4 {
+		t.Fatalf("undo should restore the cursor, got %d:%d", line, col)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if line, col := ed.Cursor(); line != 1 || col != 1 {
+		t.Fatalf("undo should restore the initial cursor, got %d:%d", line, col)
+	}
+	ed.MoveCursor(2, 6)
+	ed.SetLines([]string{"ab"})
+	if line, col := ed.Cursor(); line != 1 || col != 3 {
+		t.Fatalf("cursor should be clamped to content, got %d:%d", line, col)
+	}
+}
+
+func TestDeleteLines(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"one", "two", "three", "four"}, false)
+	if err := ed.DeleteLines(2, 3); err != nil {
+		t.Fatalf("delete lines failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "one,four" {
+		t.Fatalf("unexpected content: %s", got)
+	}
+	assertSize(t, ed)
+	if err := ed.DeleteLines(2, 5); err == nil {
+		t.Fatalf("out of range delete should fail")
+	}
+	if err := ed.DeleteLines(1, 2); err != nil {
+		t.Fatalf("deleting every line failed: %v", err)
+	}
+	if len(ed.Lines()) != 0 || ed.Size() != 0 {
+		t.Fatalf("document should be empty: %v", ed.Lines())
+	}
+	if lines, err := ed.Show(1, 0); err != nil || len(lines) != 0 {
+		t.Fatalf("show on empty document should succeed: %v %v", lines, err)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "one,four" {
+		t.Fatalf("undo should restore lines in one step: %s", got)
+	}
+}
+
+func TestInsertLines(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"one", "four"}, false)
+	if err := ed.InsertLines(2, []string{"two\nthree"}); err != nil {
+		t.Fatalf("insert lines failed: %v", err)
+	}
+	if err := ed.InsertLines(5, []string{"five"}); err != nil {
+		t.Fatalf("insert after last line failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "one,two,three,four,five" {
+		t.Fatalf("unexpected content: %s", got)
+	}
+	assertSize(t, ed)
+	if err := ed.InsertLines(7, []string{"x"}); err == nil {
+		t.Fatalf("out of range insert should fail")
+	}
+	if err := ed.InsertLines(0, []string{"x"}); err == nil {
+		t.Fatalf("line 0 should be rejected")
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "one,four" {
+		t.Fatalf("each insert should undo in one step: %s", got)
+	}
+
+	empty := editor.NewTextEditor("empty.txt", nil, false)
+	if err := empty.InsertLines(1, []string{"first"}); err != nil {
+		t.Fatalf("insert into empty document failed: %v", err)
+	}
+	if got := strings.Join(empty.Lines(), ","); got != "first" {
+		t.Fatalf("unexpected content: %s", got)
+	}
+}
+
+func TestMoveAndSwapLines(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"a", "b", "c", "d"}, false)
+	if err := ed.MoveLine(1, 3); err != nil {
+		t.Fatalf("move down failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "b,c,a,d" {
+		t.Fatalf("moving down should land on the target line: %s", got)
+	}
+	if err := ed.MoveLine(4, 1); err != nil {
+		t.Fatalf("move up failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "d,b,c,a" {
+		t.Fatalf("unexpected content after move up: %s", got)
+	}
+	if err := ed.SwapLines(2, 4); err != nil {
+		t.Fatalf("swap failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "d,a,c,b" {
+		t.Fatalf("unexpected content after swap: %s", got)
+	}
+	if err := ed.MoveLine(1, 5); err == nil {
+		t.Fatalf("out of range move should fail")
+	}
+	if err := ed.SwapLines(0, 1); err == nil {
+		t.Fatalf("out of range swap should fail")
+	}
+
+	depth := ed.UndoDescription()
+	if err := ed.MoveLine(2, 2); err != nil {
+		t.Fatalf("self move failed: %v", err)
+	}
+	if !ed.LastEditNoOp() || ed.UndoDescription() != depth {
+		t.Fatalf("moving a line onto itself should not push an undo entry")
+	}
+	for _, want := range []string{"d,b,c,a", "b,c,a,d", "a,b,c,d"} {
+		if err := ed.Undo(); err != nil {
+			t.Fatalf("undo failed: %v", err)
+		}
+		if got := strings.Join(ed.Lines(), ","); got != want {
+			t.Fatalf("undo mismatch: want %s, got %s", want, got)
+		}
+	}
+
+	clean := editor.NewTextEditor("clean.txt", []string{"a", "b"}, false)
+	if err := clean.SwapLines(1, 1); err != nil || clean.IsModified() {
+		t.Fatalf("swapping a line with itself should leave the document clean: %v", err)
+	}
+	if err := clean.SwapLines(1, 2); err != nil || !clean.IsModified() {
+		t.Fatalf("swap should mark the document modified: %v", err)
+	}
+}
+
+func TestDuplicateLines(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"a", "b", "c"}, false)
+	if err := ed.DuplicateLines(1, 2, 2); err != nil {
+		t.Fatalf("duplicate failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "a,b,a,b,a,b,c" {
+		t.Fatalf("unexpected content: %s", got)
+	}
+	assertSize(t, ed)
+	if err := ed.DuplicateLines(1, 1, 0); err == nil {
+		t.Fatalf("zero copies should be rejected")
+	}
+	if err := ed.DuplicateLines(7, 8, 1); err == nil {
+		t.Fatalf("out of range duplicate should fail")
+	}
+	if err := ed.DuplicateLines(1, 2, math.MaxInt); err == nil {
+		t.Fatalf("a huge repeat count should be rejected")
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "a,b,c" {
+		t.Fatalf("undo should remove every copy at once: %s", got)
+	}
+}
+
+func TestTextMemoryStats(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"abc"}, false)
+	if err := ed.Append("de"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	stats := ed.MemoryStats()
+	// Only the appended line is retained.
+	if stats.ContentBytes != 6 || stats.UndoEntries != 1 || stats.HistoryBytes != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if stats := ed.MemoryStats(); stats.UndoEntries != 0 || stats.HistoryBytes != 2 {
+		t.Fatalf("redo entries should still count as history: %+v", stats)
+	}
+}
+
+func TestTextHistoryHighWaterMark(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"0123456789"}, false)
+	for i := 0; i < 4; i++ {
+		if err := ed.Replace(1, 1, 1, string(rune('a'+i))); err != nil {
+			t.Fatalf("replace failed: %v", err)
+		}
+	}
+	// Each replace retains the old and new 10-byte line.
+	if stats := ed.MemoryStats(); stats.HistoryBytes != 80 || stats.PeakUndoDepth != 4 || stats.PeakHistoryBytes != 80 {
+		t.Fatalf("unexpected stats after edits: %+v", stats)
+	}
+	for i := 0; i < 3; i++ {
+		if err := ed.Undo(); err != nil {
+			t.Fatalf("undo failed: %v", err)
+		}
+	}
+	if stats := ed.MemoryStats(); stats.UndoEntries != 1 || stats.HistoryBytes != 80 || stats.PeakUndoDepth != 4 {
+		t.Fatalf("undo should move entries to redo: %+v", stats)
+	}
+	if err := ed.Append("y"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	// The new edit clears three redo entries and retains the 1-byte line it added.
+	stats := ed.MemoryStats()
+	if stats.UndoEntries != 2 || stats.HistoryBytes != 21 || stats.PeakUndoDepth != 4 || stats.PeakHistoryBytes != 80 {
+		t.Fatalf("redo clear should release history but keep peaks: %+v", stats)
+	}
+}
+
+func TestReadOnlyRefusesEdits(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"a"}, false)
+	if err := ed.Append("b"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	ed.SetReadOnly(true)
+	if err := ed.Append("c"); !errors.Is(err, editor.ErrReadOnly) {
+		t.Fatalf("append should be refused, got %v", err)
+	}
+	if err := ed.Undo(); !errors.Is(err, editor.ErrReadOnly) {
+		t.Fatalf("undo should be refused, got %v", err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "a,b" {
+		t.Fatalf("read-only editor changed: %s", got)
+	}
+	ed.SetReadOnly(false)
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo after clearing read-only failed: %v", err)
+	}
+}
+
+func TestJoinAndSplitLines(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"你好", "世界", "!"}, false)
+	if err := ed.JoinLines(1, 3, ", "); err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "你好, 世界, !" {
+		t.Fatalf("unexpected join result: %s", got)
+	}
+	assertSize(t, ed)
+	if err := ed.JoinLines(1, 1, " "); err == nil {
+		t.Fatalf("joining a single line should fail")
+	}
+	if err := ed.SplitLine(1, 3); err != nil {
+		t.Fatalf("split failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "你好|, 世界, !" {
+		t.Fatalf("split should be rune aware: %s", got)
+	}
+	if err := ed.SplitLine(1, 1); err != nil {
+		t.Fatalf("split at column 1 failed: %v", err)
+	}
+	if err := ed.SplitLine(3, 8); err != nil {
+		t.Fatalf("split at line end failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "|你好|, 世界, !|" {
+		t.Fatalf("edge splits should leave empty lines: %q", got)
+	}
+	if err := ed.SplitLine(3, 9); err == nil {
+		t.Fatalf("split beyond line end should fail")
+	}
+	for i := 0; i < 4; i++ {
+		if err := ed.Undo(); err != nil {
+			t.Fatalf("undo failed: %v", err)
+		}
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "你好|世界|!" {
+		t.Fatalf("each step should undo at once: %s", got)
+	}
+}
+
+func TestTextStats(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"hello world", "你好，go-lang!"}, false)
+	got := ed.Stats()
+	want := editor.TextStats{Lines: 2, Words: 5, Chars: 22, Bytes: len("hello world\n你好，go-lang!")}
+	if got != want {
+		t.Fatalf("stats mismatch: want %+v, got %+v", want, got)
+	}
+	empty := editor.NewTextEditor("empty.txt", nil, false)
+	if got := empty.Stats(); got != (editor.TextStats{}) {
+		t.Fatalf("empty document should have zero stats: %+v", got)
+	}
+}
+
+func TestTransformSpanAndLines(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"δέλτα émile", "hello WORLD, it's 3rd"}, false)
+	if err := ed.TransformSpan(1, 1, 5, strings.ToUpper); err != nil {
+		t.Fatalf("upper failed: %v", err)
+	}
+	if got := ed.Lines()[0]; got != "ΔΈΛΤΑ émile" {
+		t.Fatalf("upper should be unicode aware: %s", got)
+	}
+	assertSize(t, ed)
+	if err := ed.TransformSpan(1, 7, 5, strings.ToUpper); err != nil {
+		t.Fatalf("upper on accented word failed: %v", err)
+	}
+	if got := ed.Lines()[0]; got != "ΔΈΛΤΑ ÉMILE" {
+		t.Fatalf("unexpected content: %s", got)
+	}
+	deleteErr := ed.Delete(1, 7, 6)
+	spanErr := ed.TransformSpan(1, 7, 6, strings.ToLower)
+	if spanErr == nil || deleteErr == nil || spanErr.Error() != deleteErr.Error() {
+		t.Fatalf("crossing the line end should fail like delete: %v / %v", spanErr, deleteErr)
+	}
+	if err := ed.TransformLines(2, 2, editor.TitleCase); err != nil {
+		t.Fatalf("title-case failed: %v", err)
+	}
+	if got := ed.Lines()[1]; got != "Hello World, It's 3rd" {
+		t.Fatalf("unexpected title case: %s", got)
+	}
+	for i := 0; i < 3; i++ {
+		if err := ed.Undo(); err != nil {
+			t.Fatalf("undo failed: %v", err)
+		}
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "δέλτα émile|hello WORLD, it's 3rd" {
+		t.Fatalf("each transform should undo in one step: %s", got)
+	}
+}
+
+func TestTextEditorSortLines(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"header", "10 b", "9 a", "x", "10 b", "-3"}, false)
+	if err := ed.SortLines(2, 6, editor.SortOptions{}); err != nil {
+		t.Fatalf("sort failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "header|-3|10 b|10 b|9 a|x" {
+		t.Fatalf("unexpected lexicographic order: %s", got)
+	}
+	if err := ed.SortLines(2, 6, editor.SortOptions{Numeric: true, Unique: true}); err != nil {
+		t.Fatalf("numeric sort failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "header|-3|9 a|10 b|x" {
+		t.Fatalf("unexpected numeric order: %s", got)
+	}
+	assertSize(t, ed)
+	if err := ed.SortLines(2, 5, editor.SortOptions{Numeric: true, Reverse: true}); err != nil {
+		t.Fatalf("reverse sort failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "header|x|10 b|9 a|-3" {
+		t.Fatalf("unexpected reverse order: %s", got)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "header|-3|9 a|10 b|x" {
+		t.Fatalf("sort should undo in one step: %s", got)
+	}
+
+	depth := ed.UndoDescription()
+	if err := ed.SortLines(2, 5, editor.SortOptions{Numeric: true}); err != nil {
+		t.Fatalf("sort of sorted range failed: %v", err)
+	}
+	if !ed.LastEditNoOp() || ed.RedoDescription() == "" || ed.UndoDescription() != depth {
+		t.Fatalf("sorting a sorted range should not record an undo entry")
+	}
+	if err := ed.SortLines(3, 9, editor.SortOptions{}); err == nil {
+		t.Fatalf("out-of-range sort should fail")
+	}
+}
+
+func TestTextEditorTabConversion(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"\tfoo(\"a\tb\")", "  \tbar", "plain", "      baz"}, false)
+	changed, err := ed.ExpandTabs(4)
+	if err != nil {
+		t.Fatalf("expand failed: %v", err)
+	}
+	if changed != 2 {
+		t.Fatalf("expected 2 changed lines, got %d", changed)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "    foo(\"a\tb\")|    bar|plain|      baz" {
+		t.Fatalf("unexpected expanded content: %q", got)
+	}
+	assertSize(t, ed)
+	changed, err = ed.CompressSpaces(4)
+	if err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	if changed != 3 {
+		t.Fatalf("expected 3 changed lines, got %d", changed)
+	}
+	if got := strings.Join(ed.Lines(), "|"); got != "\tfoo(\"a\tb\")|\tbar|plain|\t  baz" {
+		t.Fatalf("unexpected compressed content: %q", got)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := ed.Lines()[3]; got != "      baz" {
+		t.Fatalf("compress should undo in one step: %q", got)
+	}
+	if changed, err := ed.ExpandTabs(4); err != nil || changed != 0 || !ed.LastEditNoOp() {
+		t.Fatalf("expanding without tabs should be a no-op: %d, %v", changed, err)
+	}
+	if _, err := ed.ExpandTabs(0); err == nil {
+		t.Fatalf("zero width should be rejected")
+	}
+}
+
+func TestTextEditorUndoNRedoN(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{}, false)
+	for _, text := range []string{"a", "b", "c"} {
+		if err := ed.Append(text); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if got := strings.Join(ed.UndoDescriptions(), ","); got != "append,append,append" {
+		t.Fatalf("unexpected undo list: %s", got)
+	}
+	done, err := ed.UndoN(2)
+	if err != nil || done != 2 {
+		t.Fatalf("undo 2 = %d, %v", done, err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "a" {
+		t.Fatalf("unexpected content after undo 2: %s", got)
+	}
+	done, err = ed.UndoN(5)
+	if err != nil || done != 1 {
+		t.Fatalf("undo beyond the stack should stop early: %d, %v", done, err)
+	}
+	if _, err := ed.UndoN(1); err == nil {
+		t.Fatalf("undo with an empty stack should fail")
+	}
+	done, err = ed.RedoN(10)
+	if err != nil || done != 3 {
+		t.Fatalf("redo 10 = %d, %v", done, err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "a,b,c" {
+		t.Fatalf("unexpected content after redo: %s", got)
+	}
+	if _, err := ed.RedoN(0); err == nil {
+		t.Fatalf("zero steps should be rejected")
+	}
+}
+
+func TestTextEditorUndoLimit(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{}, false)
+	ed.SetUndoLimit(3)
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		if err := ed.Append(text); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if len(ed.UndoDescriptions()) != 3 {
+		t.Fatalf("expected 3 undo entries, got %d", len(ed.UndoDescriptions()))
+	}
+	if done, _ := ed.UndoN(10); done != 3 {
+		t.Fatalf("only the retained entries should undo: %d", done)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "a,b" {
+		t.Fatalf("unexpected content after undo: %s", got)
+	}
+	if err := ed.Redo(); err != nil {
+		t.Fatalf("redo failed: %v", err)
+	}
+	ed.SetUndoLimit(1)
+	if len(ed.UndoDescriptions()) != 1 || len(ed.RedoDescriptions()) != 2 {
+		t.Fatalf("lowering the limit should truncate only the undo stack: %d/%d", len(ed.UndoDescriptions()), len(ed.RedoDescriptions()))
+	}
+	if done, err := ed.RedoN(2); err != nil || done != 2 {
+		t.Fatalf("redo after truncation = %d, %v", done, err)
+	}
+	if got := strings.Join(ed.Lines(), ","); got != "a,b,c,d,e" {
+		t.Fatalf("redo should restore the full content: %s", got)
+	}
+	if len(ed.UndoDescriptions()) != 1 {
+		t.Fatalf("redo should respect the limit: %d", len(ed.UndoDescriptions()))
+	}
+	if stats := ed.MemoryStats(); stats.HistoryBytes != 1 {
+		t.Fatalf("evicted entries should not count as history: %+v", stats)
+	}
+}
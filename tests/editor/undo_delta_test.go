@@ -0,0 +1,128 @@
+package editor_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+const syntheticLines = 50000
+
+func syntheticEditor() *editor.TextEditor {
+	lines := make([]string, syntheticLines)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %05d: the quick brown fox jumps over the lazy dog", i+1)
+	}
+	return editor.NewTextEditor("synthetic.txt", lines, false)
+}
+
+func BenchmarkReplaceOn50kLines(b *testing.B) {
+	ed := syntheticEditor()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ed.Replace(syntheticLines/2, 1, 4, fmt.Sprintf("L%03d", i%1000)); err != nil {
+			b.Fatalf("replace failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkInsertUndoRedoOn50kLines(b *testing.B) {
+	ed := syntheticEditor()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ed.Insert(syntheticLines/2, 1, "new\nlines\n"); err != nil {
+			b.Fatalf("insert failed: %v", err)
+		}
+		if err := ed.Undo(); err != nil {
+			b.Fatalf("undo failed: %v", err)
+		}
+		if err := ed.Redo(); err != nil {
+			b.Fatalf("redo failed: %v", err)
+		}
+	}
+}
+
+func TestDeltaUndoReplaysEveryState(t *testing.T) {
+	for _, coalesce := range []bool{false, true} {
+		t.Run(fmt.Sprintf("coalesce=%v", coalesce), func(t *testing.T) {
+			ed := editor.NewTextEditor("mix.txt", []string{"alpha", "beta", "gamma", "delta"}, false)
+			ed.SetCoalescing(coalesce)
+			rng := rand.New(rand.NewSource(7))
+			states := []string{content(ed)}
+			for i := 0; i < 200; i++ {
+				n := len(ed.Lines())
+				line := rng.Intn(n) + 1
+				var err error
+				switch rng.Intn(5) {
+				case 0:
+					err = ed.Insert(line, 1, fmt.Sprintf("i%d\n", i))
+				case 1:
+					err = ed.Append(fmt.Sprintf("a%d", i))
+				case 2:
+					if n > 1 {
+						err = ed.DeleteLines(line, line)
+					}
+				case 3:
+					err = ed.InsertLines(line, []string{"x", "y"})
+				case 4:
+					err = ed.Insert(line, 1, "z")
+				}
+				if err != nil {
+					t.Fatalf("edit %d failed: %v", i, err)
+				}
+				if !ed.LastEditNoOp() {
+					states = append(states, content(ed))
+				}
+			}
+			final := content(ed)
+			if coalesce && len(ed.UndoDescriptions()) >= len(states)-1 {
+				t.Fatalf("expected some edits to coalesce")
+			}
+			if !coalesce {
+				for i := len(states) - 2; i >= 0; i-- {
+					if err := ed.Undo(); err != nil {
+						t.Fatalf("undo failed: %v", err)
+					}
+					if got := content(ed); got != states[i] {
+						t.Fatalf("undo to state %d mismatch:\n%s\nwant\n%s", i, got, states[i])
+					}
+				}
+			} else if _, err := ed.UndoN(len(states)); err != nil {
+				t.Fatalf("undo all failed: %v", err)
+			}
+			if got := content(ed); got != states[0] {
+				t.Fatalf("undo all should restore the original: %q", got)
+			}
+			assertSize(t, ed)
+			if _, err := ed.RedoN(len(states)); err != nil {
+				t.Fatalf("redo all failed: %v", err)
+			}
+			if got := content(ed); got != final {
+				t.Fatalf("redo all should restore the final content")
+			}
+			assertSize(t, ed)
+		})
+	}
+}
+
+func TestDeltaHistoryOn50kLines(t *testing.T) {
+	ed := syntheticEditor()
+	for i := 0; i < 100; i++ {
+		if err := ed.Replace(i+1, 1, 4, "LINE"); err != nil {
+			t.Fatalf("replace failed: %v", err)
+		}
+	}
+	// Each entry keeps one line before and after, not the document.
+	if stats := ed.MemoryStats(); stats.UndoEntries != 100 || stats.HistoryBytes > 100*2*64 {
+		t.Fatalf("history should scale with the edits: %+v", stats)
+	}
+}
+
+func content(ed *editor.TextEditor) string {
+	text, _ := ed.Content()
+	return text
+}
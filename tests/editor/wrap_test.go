@@ -0,0 +1,71 @@
+package editor_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+func TestWrapLatinParagraphs(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{
+		"title",
+		"the quick brown fox jumps over",
+		"the lazy dog",
+		"",
+		"supercalifragilistic word",
+	}, false)
+	if err := ed.Wrap(2, 5, 10); err != nil {
+		t.Fatalf("wrap failed: %v", err)
+	}
+	want := []string{
+		"title",
+		"the quick", "brown fox", "jumps over", "the lazy", "dog",
+		"",
+		"supercalifragilistic", "word",
+	}
+	if !reflect.DeepEqual(ed.Lines(), want) {
+		t.Fatalf("unexpected wrap:\n%s", strings.Join(ed.Lines(), "\n"))
+	}
+	if err := ed.Undo(); err != nil || len(ed.Lines()) != 5 {
+		t.Fatalf("wrap should be a single undoable edit")
+	}
+}
+
+func TestWrapMixedCJK(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{"软件设计课程 project 文档编辑器实现"}, false)
+	if err := ed.Wrap(1, 1, 12); err != nil {
+		t.Fatalf("wrap failed: %v", err)
+	}
+	for _, line := range ed.Lines() {
+		if editor.DisplayWidth(line) > 12 {
+			t.Fatalf("line exceeds width: %q", line)
+		}
+	}
+	want := []string{"软件设计课程", "project 文档", "编辑器实现"}
+	if !reflect.DeepEqual(ed.Lines(), want) {
+		t.Fatalf("unexpected CJK wrap: %q", ed.Lines())
+	}
+}
+
+func TestWrapIsIdempotent(t *testing.T) {
+	ed := editor.NewTextEditor("test.txt", []string{
+		"中文段落需要按照显示宽度折行, mixed with English words here",
+		"",
+		"second paragraph that is fairly long and needs wrapping too",
+	}, false)
+	if err := ed.Wrap(1, 3, 16); err != nil {
+		t.Fatalf("first wrap failed: %v", err)
+	}
+	once := ed.Lines()
+	if err := ed.Wrap(1, len(once), 16); err != nil {
+		t.Fatalf("second wrap failed: %v", err)
+	}
+	if !reflect.DeepEqual(ed.Lines(), once) || !ed.LastEditNoOp() {
+		t.Fatalf("wrapping twice changed output:\n%s\n--\n%s", strings.Join(once, "\n"), strings.Join(ed.Lines(), "\n"))
+	}
+	if err := ed.Wrap(1, 99, 16); err == nil {
+		t.Fatalf("out of range wrap should fail")
+	}
+}
@@ -1,6 +1,8 @@
 package editor_test
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -14,16 +16,20 @@ func TestXMLEditorCommands(t *testing.T) {
 	if err := ed.AppendChild("book", "book1", "root", nil); err != nil {
 		t.Fatalf("append-child failed: %v", err)
 	}
+	assertInvariants(t, ed)
 	text := "Everyday Italian"
 	if err := ed.AppendChild("title", "title1", "book1", &text); err != nil {
 		t.Fatalf("append-child title failed: %v", err)
 	}
+	assertInvariants(t, ed)
 	if err := ed.EditText("title1", "Everyday Italian Updated"); err != nil {
 		t.Fatalf("edit-text failed: %v", err)
 	}
+	assertInvariants(t, ed)
 	if err := ed.EditID("title1", "title-main"); err != nil {
 		t.Fatalf("edit-id failed: %v", err)
 	}
+	assertInvariants(t, ed)
 	tree := ed.TreeString()
 	if !strings.Contains(tree, "book [id=\"book1\"]") {
 		t.Fatalf("tree missing book node: %s", tree)
@@ -34,6 +40,7 @@ func TestXMLEditorCommands(t *testing.T) {
 	if err := ed.DeleteElement("title-main"); err != nil {
 		t.Fatalf("delete-element failed: %v", err)
 	}
+	assertInvariants(t, ed)
 	tree = ed.TreeString()
 	if strings.Contains(tree, "title") {
 		t.Fatalf("title should be removed: %s", tree)
@@ -50,6 +57,7 @@ func TestXMLEditorUndoRedo(t *testing.T) {
 	if err := ed.Undo(); err != nil {
 		t.Fatalf("undo failed: %v", err)
 	}
+	assertInvariants(t, ed)
 	tree := ed.TreeString()
 	if strings.Contains(tree, "item") {
 		t.Fatalf("undo should remove child")
@@ -57,8 +65,446 @@ func TestXMLEditorUndoRedo(t *testing.T) {
 	if err := ed.Redo(); err != nil {
 		t.Fatalf("redo failed: %v", err)
 	}
+	assertInvariants(t, ed)
 	tree = ed.TreeString()
 	if !strings.Contains(tree, "item [id=\"item1\"]") {
 		t.Fatalf("redo should restore child: %s", tree)
 	}
 }
+
+func TestXMLEditorIDsDocumentOrder(t *testing.T) {
+	ed := editor.NewXMLEditor("order.xml", editor.NewDefaultXMLDocument(false), true)
+	if err := ed.AppendChild("book", "b1", "root", nil); err != nil {
+		t.Fatalf("append b1 failed: %v", err)
+	}
+	if err := ed.AppendChild("book", "b3", "root", nil); err != nil {
+		t.Fatalf("append b3 failed: %v", err)
+	}
+	title := "Title"
+	if err := ed.AppendChild("title", "t1", "b1", &title); err != nil {
+		t.Fatalf("append t1 failed: %v", err)
+	}
+	if err := ed.InsertBefore("book", "b2", "b3", nil); err != nil {
+		t.Fatalf("insert-before failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	assertIDs(t, ed.IDs(), "root", "b1", "t1", "b2", "b3")
+	assertIDs(t, ed.IDsByTag("book"), "b1", "b2", "b3")
+
+	// Move b1 to the end by deleting and re-appending it.
+	if err := ed.DeleteElement("b1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := ed.AppendChild("book", "b1", "root", nil); err != nil {
+		t.Fatalf("re-append failed: %v", err)
+	}
+	assertIDs(t, ed.IDs(), "root", "b2", "b3", "b1")
+
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	assertIDs(t, ed.IDs(), "root", "b1", "t1", "b2", "b3")
+	if ids := ed.IDsByTag("author"); len(ids) != 0 {
+		t.Fatalf("unexpected ids for missing tag: %v", ids)
+	}
+}
+
+func assertInvariants(t *testing.T, ed *editor.XMLEditor) {
+	t.Helper()
+	if err := ed.CheckInvariants(); err != nil {
+		t.Fatalf("invariants violated: %v", err)
+	}
+}
+
+func assertIDs(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("ids mismatch: got %v, want %v", got, want)
+	}
+}
+
+func TestParseXMLErrorPositions(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		line    int
+		column  int
+		element string
+	}{
+		{"syntax", "<root id=\"root\">\n  <a id=\"a\">\n</root>", 3, 8, ""},
+		{"missing id", "<root id=\"root\">\n  <book></book>\n</root>", 2, 3, "book"},
+		{"duplicate id", "<root id=\"root\">\n  <a id=\"x\"></a>\n  <b id=\"x\"></b>\n</root>", 3, 3, "b"},
+		{"text then child", "<root id=\"root\">\n  <a id=\"a\">text<b id=\"b\"></b></a>\n</root>", 2, 17, "a"},
+		{"child then text", "<root id=\"root\">\n  <b id=\"b\"></b>\n  trailing\n</root>", 3, 3, "root"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := editor.ParseXMLEditor("broken.xml", []byte(tc.data))
+			var parseErr *editor.XMLParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected XMLParseError, got %v", err)
+			}
+			if parseErr.Line != tc.line || parseErr.Column != tc.column || parseErr.Element != tc.element {
+				t.Fatalf("unexpected position: %+v", parseErr)
+			}
+			if !strings.Contains(err.Error(), "第") {
+				t.Fatalf("error should mention the position: %v", err)
+			}
+		})
+	}
+}
+
+func TestXMLEditorSizeCounter(t *testing.T) {
+	ed := editor.NewXMLEditor("size.xml", editor.NewDefaultXMLDocument(false), true)
+	initial := ed.Size()
+	text := "Harry Potter"
+	if err := ed.AppendChild("title", "t1", "root", &text); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	grown := ed.Size()
+	if grown <= initial {
+		t.Fatalf("size should grow: %d -> %d", initial, grown)
+	}
+	if err := ed.EditText("t1", "Harry Potter and the Goblet of Fire"); err != nil {
+		t.Fatalf("edit-text failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if ed.Size() != grown+len(" and the Goblet of Fire") {
+		t.Fatalf("edit-text size mismatch: %d", ed.Size())
+	}
+	if err := ed.DeleteElement("t1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if ed.Size() != initial {
+		t.Fatalf("delete should restore size: %d != %d", ed.Size(), initial)
+	}
+	ed.Undo()
+	ed.Undo()
+	if ed.Size() != grown {
+		t.Fatalf("undo should restore size: %d != %d", ed.Size(), grown)
+	}
+}
+
+func TestReplaceWordInText(t *testing.T) {
+	ed := editor.NewXMLEditor("spell.xml", editor.NewDefaultXMLDocument(false), true)
+	text := "helo, helo again; unhelo"
+	if err := ed.AppendChild("p", "p1", "root", &text); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ed.ReplaceWordInText("p1", "helo", "hello", 2); err != nil {
+		t.Fatalf("replace second occurrence failed: %v", err)
+	}
+	nodes := ed.TextNodes()
+	if nodes[0].Text != "helo, hello again; unhelo" {
+		t.Fatalf("unexpected text: %s", nodes[0].Text)
+	}
+	var mismatch *editor.WordMismatchError
+	if err := ed.ReplaceWordInText("p1", "helo", "hello", 2); !errors.As(err, &mismatch) {
+		t.Fatalf("stale occurrence should mismatch, got %v", err)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if ed.TextNodes()[0].Text != text {
+		t.Fatalf("undo should restore original text")
+	}
+}
+
+func TestIdenticalEditTextIsNoOp(t *testing.T) {
+	root := editor.NewDefaultXMLDocument(false)
+	text := "Everyday Italian"
+	ed := editor.NewXMLEditor("test.xml", root, false)
+	if err := ed.AppendChild("title", "title1", "root", &text); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	ed.SetModified(false)
+	if err := ed.EditText("title1", text); err != nil {
+		t.Fatalf("edit-text failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if !ed.LastEditNoOp() || ed.IsModified() {
+		t.Fatalf("identical edit-text should not mark the document modified")
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo should target the append-child: %v", err)
+	}
+	if len(ed.IDs()) != 1 {
+		t.Fatalf("undo should have removed title1: %v", ed.IDs())
+	}
+}
+
+func TestRedoStashedXML(t *testing.T) {
+	ed := editor.NewXMLEditor("test.xml", editor.NewDefaultXMLDocument(false), false)
+	ed.SetPreserveRedo(true)
+	if err := ed.AppendChild("book", "book1", "root", nil); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	ed.Undo()
+	if err := ed.AppendChild("book", "book2", "root", nil); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if ed.StashedRedoDepth() != 1 {
+		t.Fatalf("expected stashed branch, got depth %d", ed.StashedRedoDepth())
+	}
+	if err := ed.RedoStashed(); err != nil {
+		t.Fatalf("redo stashed failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if ids := strings.Join(ed.IDs(), ","); ids != "root,book1" {
+		t.Fatalf("unexpected ids after recovery: %s", ids)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if ids := strings.Join(ed.IDs(), ","); ids != "root,book2" {
+		t.Fatalf("undo should return to the diverged branch: %s", ids)
+	}
+}
+
+func TestXMLInvariantsDetectAndRepair(t *testing.T) {
+	root := editor.NewDefaultXMLDocument(false)
+	ed := editor.NewXMLEditor("test.xml", root, false)
+	if err := ed.AppendChild("book", "book1", "root", nil); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if err := ed.EditID("book1", "book2"); err != nil {
+		t.Fatalf("edit-id failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if err := ed.EditID("book1", "book3"); err != nil {
+		t.Fatalf("edit-id after undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+
+	// Attach an element behind the editor's back: it is neither indexed nor parented.
+	tampered := editor.NewDefaultXMLDocument(false)
+	victim := editor.NewXMLEditor("bad.xml", tampered, false)
+	stray := editor.NewDefaultXMLDocument(false)
+	stray.ID = "stray"
+	stray.Attributes[0].Value = "stray"
+	tampered.Children = append(tampered.Children, stray)
+	err := victim.CheckInvariants()
+	var invariantErr *editor.InvariantError
+	if !errors.As(err, &invariantErr) || len(invariantErr.Problems) != 2 {
+		t.Fatalf("expected missing index entry and parent pointer problems, got %v", err)
+	}
+	if err := victim.RepairIndex(); err != nil {
+		t.Fatalf("repair should restore consistency: %v", err)
+	}
+	if ids := strings.Join(victim.IDs(), ","); ids != "root,stray" {
+		t.Fatalf("repaired index should expose the stray element: %s", ids)
+	}
+}
+
+func newRenameFixture(t *testing.T) *editor.XMLEditor {
+	t.Helper()
+	ed := editor.NewXMLEditor("rename.xml", editor.NewDefaultXMLDocument(false), false)
+	for _, step := range [][3]string{
+		{"book", "a-book", "root"},
+		{"title", "a-title", "a-book"},
+		{"note", "note", "a-book"},
+		{"book", "b-book", "root"},
+	} {
+		if err := ed.AppendChild(step[0], step[1], step[2], nil); err != nil {
+			t.Fatalf("append-child %s failed: %v", step[1], err)
+		}
+	}
+	return ed
+}
+
+func TestRenameIDsByPrefix(t *testing.T) {
+	ed := newRenameFixture(t)
+	before := strings.Join(ed.IDs(), ",")
+	count, err := ed.RenameIDs("a-book", "a-", "ns-")
+	if err != nil {
+		t.Fatalf("rename-ids failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if count != 2 {
+		t.Fatalf("expected 2 renames, got %d", count)
+	}
+	if got := strings.Join(ed.IDs(), ","); got != "root,ns-book,ns-title,note,b-book" {
+		t.Fatalf("unexpected ids: %s", got)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if got := strings.Join(ed.IDs(), ","); got != before {
+		t.Fatalf("undo should restore every id in one step: %s", got)
+	}
+}
+
+func TestRenameIDsRefusesCollisions(t *testing.T) {
+	ed := newRenameFixture(t)
+	before := ed.Size()
+	if _, err := ed.RenameIDs("a-book", "a-", "b-"); err == nil {
+		t.Fatalf("collision with b-book should be refused")
+	}
+	if _, err := ed.PlanIDRenames("a-book", "a-", "b-"); err == nil {
+		t.Fatalf("dry run should report the collision too")
+	}
+	assertInvariants(t, ed)
+	if got := strings.Join(ed.IDs(), ","); got != "root,a-book,a-title,note,b-book" || ed.Size() != before {
+		t.Fatalf("refused rename should change nothing: %s", got)
+	}
+	if ed.UndoDescription() != "append-child" {
+		t.Fatalf("refused rename should not be undoable: %s", ed.UndoDescription())
+	}
+}
+
+func TestRenameIDsEmptyMatch(t *testing.T) {
+	ed := newRenameFixture(t)
+	plan, err := ed.PlanIDRenames("b-book", "a-", "x-")
+	if err != nil || len(plan) != 0 {
+		t.Fatalf("expected empty plan, got %v %v", plan, err)
+	}
+	count, err := ed.RenameIDs("b-book", "a-", "x-")
+	if err != nil || count != 0 {
+		t.Fatalf("expected no renames, got %d %v", count, err)
+	}
+	if !ed.LastEditNoOp() {
+		t.Fatalf("empty rename should be a no-op")
+	}
+}
+
+func TestXMLMemoryStats(t *testing.T) {
+	ed := editor.NewXMLEditor("mem.xml", editor.NewDefaultXMLDocument(false), false)
+	initial := ed.MemoryStats()
+	if initial.ContentBytes != ed.Size() || initial.UndoEntries != 0 || initial.HistoryBytes != 0 {
+		t.Fatalf("unexpected initial stats: %+v", initial)
+	}
+	if err := ed.AppendChild("book", "b1", "root", nil); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	stats := ed.MemoryStats()
+	if stats.UndoEntries != 1 || stats.HistoryBytes != stats.ContentBytes-initial.ContentBytes {
+		t.Fatalf("unexpected stats after edit: %+v", stats)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if err := ed.AppendChild("book", "b2", "root", nil); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	after := ed.MemoryStats()
+	if after.HistoryBytes != stats.HistoryBytes || after.PeakUndoDepth != 1 || after.PeakHistoryBytes != stats.HistoryBytes {
+		t.Fatalf("redo clear should release the undone entry: %+v", after)
+	}
+}
+
+func TestXMLStats(t *testing.T) {
+	ed := editor.NewXMLEditor("stats.xml", editor.NewDefaultXMLDocument(false), false)
+	if got := ed.Stats(); got != (editor.XMLStats{Elements: 1, MaxDepth: 1}) {
+		t.Fatalf("unexpected stats for a bare root: %+v", got)
+	}
+	title := "你好 Go"
+	if err := ed.AppendChild("book", "b1", "root", nil); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	if err := ed.AppendChild("title", "t1", "b1", &title); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	if got := ed.Stats(); got != (editor.XMLStats{Elements: 3, MaxDepth: 3, TextLength: 5}) {
+		t.Fatalf("unexpected stats: %+v", got)
+	}
+}
+
+func TestXMLGrepSerialized(t *testing.T) {
+	fixture := `<?xml version="1.0" encoding="UTF-8"?>
+<bookstore id="root">
+    <book id="b1" category="go">
+        <title id="t1">Go Basics</title>
+        <note id="n1"></note>
+    </book>
+    <book id="b2" category="xml">
+        <title id="t2">XML &amp; Go</title>
+    </book>
+</bookstore>
+`
+	ed, err := editor.ParseXMLEditor("grep.xml", []byte(fixture))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	matches, err := ed.GrepSerialized("Go")
+	if err != nil {
+		t.Fatalf("grep failed: %v", err)
+	}
+	var got []string
+	for _, m := range matches {
+		got = append(got, fmt.Sprintf("%d:%s", m.Line, m.ElementID))
+	}
+	if strings.Join(got, ",") != "4:t1,8:t2" {
+		t.Fatalf("unexpected hits: %v", got)
+	}
+	tags, _ := ed.GrepSerialized("book")
+	got = nil
+	for _, m := range tags {
+		got = append(got, fmt.Sprintf("%d:%s", m.Line, m.ElementID))
+	}
+	if strings.Join(got, ",") != "2:root,3:b1,6:b1,7:b2,9:b2,10:root" {
+		t.Fatalf("opening and closing tags should be attributed: %v", got)
+	}
+	if matches, _ := ed.GrepSerialized("&amp;"); len(matches) != 1 || matches[0].Text != `        <title id="t2">XML &amp; Go</title>` {
+		t.Fatalf("search should run on the escaped output: %+v", matches)
+	}
+	content, _ := ed.Content()
+	lines := strings.Split(content, "\n")
+	for _, m := range append(matches, tags...) {
+		if lines[m.Line-1] != m.Text {
+			t.Fatalf("line %d differs from Content(): %q", m.Line, lines[m.Line-1])
+		}
+	}
+	if _, err := ed.GrepSerialized(""); err == nil {
+		t.Fatalf("empty pattern should be rejected")
+	}
+}
+
+func TestXMLReadOnlyRefusesEdits(t *testing.T) {
+	ed := editor.NewXMLEditor("ro.xml", editor.NewDefaultXMLDocument(false), false)
+	if err := ed.AppendChild("item", "i1", "root", nil); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	before := ed.TreeString()
+	ed.SetReadOnly(true)
+	text := "x"
+	refused := map[string]error{
+		"append-child":   ed.AppendChild("item", "i2", "root", &text),
+		"insert-before":  ed.InsertBefore("item", "i2", "i1", nil),
+		"edit-id":        ed.EditID("i1", "i2"),
+		"edit-text":      ed.EditText("i1", "x"),
+		"delete-element": ed.DeleteElement("i1"),
+		"undo":           ed.Undo(),
+		"redo":           ed.Redo(),
+	}
+	for name, err := range refused {
+		if !errors.Is(err, editor.ErrReadOnly) {
+			t.Fatalf("%s should be refused, got %v", name, err)
+		}
+	}
+	if _, err := ed.RenameIDs("root", "i", "j"); !errors.Is(err, editor.ErrReadOnly) {
+		t.Fatalf("rename-ids should be refused, got %v", err)
+	}
+	if ed.TreeString() != before || !ed.IsReadOnly() {
+		t.Fatalf("a read-only document changed:\n%s", ed.TreeString())
+	}
+	ed.SetReadOnly(false)
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo after clearing read-only failed: %v", err)
+	}
+}
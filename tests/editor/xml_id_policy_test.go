@@ -0,0 +1,166 @@
+package editor_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+const legacyXML = `<root id="root"><book id="Book1">A</book><book id="book1">B</book><book id="b2">C</book></root>`
+
+func TestParseDuplicateIDsUnderPolicy(t *testing.T) {
+	ed, err := editor.ParseXMLEditorWithPolicy("legacy.xml", []byte(legacyXML), editor.IDExact)
+	if err != nil {
+		t.Fatalf("exact policy should accept IDs differing in case: %v", err)
+	}
+	groups := ed.IDCollisions(editor.IDCaseInsensitive)
+	if len(groups) != 1 || strings.Join(groups[0], ",") != "Book1,book1" {
+		t.Fatalf("unexpected near-duplicate groups: %v", groups)
+	}
+
+	_, err = editor.ParseXMLEditorWithPolicy("legacy.xml", []byte(legacyXML), editor.IDCaseInsensitive)
+	var parseErr *editor.XMLParseError
+	if !errors.As(err, &parseErr) || !strings.Contains(parseErr.Reason, "book1 (与 Book1 冲突)") {
+		t.Fatalf("case-insensitive policy should reject the second ID, got %v", err)
+	}
+
+	var collision *editor.IDCollisionError
+	if err := ed.SetIDPolicy(editor.IDCaseInsensitive); !errors.As(err, &collision) {
+		t.Fatalf("switching policy should report the collision, got %v", err)
+	}
+	if ed.IDPolicy() != editor.IDExact {
+		t.Fatalf("failed switch should keep the exact policy")
+	}
+	assertInvariants(t, ed)
+}
+
+func TestCaseInsensitiveLookupAndCollisions(t *testing.T) {
+	data := `<root id="root"><book id="Book1">A</book></root>`
+	ed, err := editor.ParseXMLEditorWithPolicy("books.xml", []byte(data), editor.IDCaseInsensitive)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if err := ed.EditText("BOOK1", "B"); err != nil {
+		t.Fatalf("lookup should ignore case: %v", err)
+	}
+	if text, _ := ed.ElementText("book1"); text != "B" {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if err := ed.AppendChild("book", "BOOK1", "ROOT", nil); err == nil || !strings.Contains(err.Error(), "BOOK1 (与 Book1 冲突)") {
+		t.Fatalf("colliding append should fail, got %v", err)
+	}
+	if err := ed.AppendChild("book", "b2", "root", nil); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ed.EditID("b2", "book1"); err == nil {
+		t.Fatalf("renaming onto a colliding ID should fail")
+	}
+	if err := ed.EditID("book1", "BOOK1"); err != nil {
+		t.Fatalf("an element may change the case of its own ID: %v", err)
+	}
+	assertIDs(t, ed.IDs(), "root", "BOOK1", "b2")
+	assertInvariants(t, ed)
+
+	if err := ed.SetIDPolicy(editor.IDExact); err != nil {
+		t.Fatalf("switching to exact cannot collide: %v", err)
+	}
+	if err := ed.EditText("book1", "C"); err == nil {
+		t.Fatalf("exact policy should not resolve book1 to BOOK1")
+	}
+	if err := ed.AppendChild("book", "book1", "root", nil); err != nil {
+		t.Fatalf("exact policy should accept book1: %v", err)
+	}
+	assertInvariants(t, ed)
+}
+
+func TestCaseInsensitiveUndoKeepsIndex(t *testing.T) {
+	ed, _ := buildLibrary(t)
+	if err := ed.SetIDPolicy(editor.IDCaseInsensitive); err != nil {
+		t.Fatalf("set policy failed: %v", err)
+	}
+	want, _ := ed.Content()
+	if err := ed.EditID("B1", "Book-1"); err != nil {
+		t.Fatalf("edit-id failed: %v", err)
+	}
+	if err := ed.DeleteElement("S2"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := ed.AppendChild("shelf", "s2", "root", nil); err != nil {
+		t.Fatalf("ID freed by delete should be reusable: %v", err)
+	}
+	if n, err := ed.RenameIDs("ROOT", "Book-", "bk-"); err != nil || n != 1 {
+		t.Fatalf("rename-ids failed: %d, %v", n, err)
+	}
+	assertInvariants(t, ed)
+	if err := ed.AppendChild("note", "n1", "BK-1", nil); err != nil {
+		t.Fatalf("lookup after rename-ids failed: %v", err)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+
+	if _, err := ed.UndoN(4); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if got, _ := ed.Content(); got != want {
+		t.Fatalf("undo should restore the document:\n%s", got)
+	}
+	if err := ed.EditText("T1", "x"); err != nil {
+		t.Fatalf("lookup after undo failed: %v", err)
+	}
+	if err := ed.AppendChild("shelf", "S2", "root", nil); err == nil {
+		t.Fatalf("restored s2 should collide with S2")
+	}
+}
+
+func TestStricterPolicyRefusesCollidingHistory(t *testing.T) {
+	ed, _ := buildLibrary(t)
+	if err := ed.AppendChild("shelf", "S1", "root", nil); err != nil {
+		t.Fatalf("exact policy should accept S1: %v", err)
+	}
+	if err := ed.DeleteElement("s1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := ed.SetIDPolicy(editor.IDCaseInsensitive); err != nil {
+		t.Fatalf("set policy failed: %v", err)
+	}
+	want, _ := ed.Content()
+
+	if err := ed.Undo(); err == nil || !strings.Contains(err.Error(), "case-insensitive") {
+		t.Fatalf("restoring s1 next to S1 should be refused, got %v", err)
+	}
+	assertInvariants(t, ed)
+	if got, _ := ed.Content(); got != want || ed.UndoDepth() != 7 || ed.RedoDepth() != 0 {
+		t.Fatalf("refused undo should leave document and history intact:\n%s", got)
+	}
+	if err := ed.EditText("s1", "x"); err != nil {
+		t.Fatalf("s1 should resolve to S1: %v", err)
+	}
+	if text, _ := ed.ElementText("S1"); text != "x" {
+		t.Fatalf("unexpected S1 text %q", text)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+
+	if err := ed.SetIDPolicy(editor.IDExact); err != nil {
+		t.Fatalf("set policy failed: %v", err)
+	}
+	if _, err := ed.UndoN(2); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if err := ed.SetIDPolicy(editor.IDCaseInsensitive); err != nil {
+		t.Fatalf("set policy failed: %v", err)
+	}
+	if err := ed.Redo(); err == nil {
+		t.Fatalf("redoing the S1 append should be refused")
+	}
+	assertInvariants(t, ed)
+	assertIDs(t, ed.IDs(), "root", "s1", "b1", "t1", "a1", "s2")
+	if err := ed.EditText("T1", "Go"); err != nil {
+		t.Fatalf("lookup after refused redo failed: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package editor_test
+
+import (
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+const selectorFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<bookstore id="root">
+  <book id="b1" category="web">
+    <title id="t1">Learning XML</title>
+  </book>
+  <book id="b2" category="cooking">
+    <title id="t2">Everyday Italian</title>
+  </book>
+  <book id="b3" category="cooking">
+    <title id="t3">Harry Potter</title>
+  </book>
+</bookstore>
+`
+
+func newSelectorEditor(t *testing.T) *editor.XMLEditor {
+	t.Helper()
+	ed, err := editor.ParseXMLEditor("books.xml", []byte(selectorFixture))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	return ed
+}
+
+func TestParseSelector(t *testing.T) {
+	cases := []struct {
+		text string
+		want editor.Selector
+	}{
+		{"@tag=title", editor.Selector{Tag: "title"}},
+		{"@tag=title[2]", editor.Selector{Tag: "title", Index: 2}},
+		{"@attr:category=web", editor.Selector{Attr: "category", Value: "web"}},
+		{"@attr:lang=", editor.Selector{Attr: "lang"}},
+		{"@attr:href=a=b[3]", editor.Selector{Attr: "href", Value: "a=b", Index: 3}},
+	}
+	for _, tc := range cases {
+		got, err := editor.ParseSelector(tc.text)
+		if err != nil || got != tc.want {
+			t.Fatalf("%s: got %+v, %v", tc.text, got, err)
+		}
+		if got.String() != tc.text {
+			t.Fatalf("%s should round-trip, got %s", tc.text, got.String())
+		}
+	}
+
+	invalid := []struct {
+		text, message string
+	}{
+		{"@tag=", "选择器格式无效"},
+		{"@attr:category", "选择器格式无效"},
+		{"@attr:=web", "选择器格式无效"},
+		{"@id=b1", "选择器格式无效"},
+		{"@tag=title]", "选择器格式无效"},
+		{"@tag=title[0]", "选择器序号无效"},
+		{"@tag=title[x]", "选择器序号无效"},
+	}
+	for _, tc := range invalid {
+		if _, err := editor.ParseSelector(tc.text); err == nil || !strings.Contains(err.Error(), tc.message) {
+			t.Fatalf("%s: expected %q, got %v", tc.text, tc.message, err)
+		}
+	}
+	if editor.IsSelector("b1") || editor.IsSelector("@b1") || !editor.IsSelector("@tag=book") {
+		t.Fatalf("only @tag= and @attr: references are selectors")
+	}
+}
+
+func TestResolveSelectors(t *testing.T) {
+	ed := newSelectorEditor(t)
+	cases := map[string]string{
+		"t2":                        "t2",
+		"@tag=title[2]":             "t2",
+		"@tag=bookstore":            "root",
+		"@attr:category=web":        "b1",
+		"@attr:category=cooking[2]": "b3",
+		"@attr:id=t3":               "t3",
+	}
+	for ref, want := range cases {
+		node, err := ed.Resolve(ref)
+		if err != nil || node.ID != want {
+			t.Fatalf("%s: expected %s, got %v, %v", ref, want, node, err)
+		}
+	}
+}
+
+func TestResolveSelectorErrors(t *testing.T) {
+	ed := newSelectorEditor(t)
+	cases := []struct {
+		ref, message string
+	}{
+		{"missing", "元素不存在: missing"},
+		{"@tag=author", "没有匹配选择器的元素: @tag=author"},
+		{"@tag=title[4]", "选择器 @tag=title[4] 超出范围: 仅有 3 个匹配元素"},
+		{"@tag=book", "选择器 @tag=book 匹配多个元素: b1, b2, b3"},
+		{"@attr:category=cooking", "选择器 @attr:category=cooking 匹配多个元素: b2, b3"},
+		{"@attr:category", "选择器格式无效"},
+	}
+	for _, tc := range cases {
+		if _, err := ed.Resolve(tc.ref); err == nil || !strings.Contains(err.Error(), tc.message) {
+			t.Fatalf("%s: expected %q, got %v", tc.ref, tc.message, err)
+		}
+	}
+}
+
+func TestEditCommandsAcceptSelectors(t *testing.T) {
+	ed := newSelectorEditor(t)
+	if err := ed.EditText("@tag=title[2]", "Italian Cooking"); err != nil {
+		t.Fatalf("edit-text failed: %v", err)
+	}
+	if text, _ := ed.ElementText("t2"); text != "Italian Cooking" {
+		t.Fatalf("selector should edit the second title, got %q", text)
+	}
+	if err := ed.EditID("@attr:category=web", "web1"); err != nil {
+		t.Fatalf("edit-id failed: %v", err)
+	}
+	if err := ed.AppendChild("author", "a1", "@attr:id=web1", nil); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	if err := ed.DeleteElement("@attr:category=cooking[2]"); err != nil {
+		t.Fatalf("delete-element failed: %v", err)
+	}
+	if ids := strings.Join(ed.IDs(), ","); ids != "root,web1,t1,a1,b2,t2" {
+		t.Fatalf("unexpected ids after edits: %s", ids)
+	}
+	if err := ed.DeleteElement("@tag=book"); err == nil || !strings.Contains(err.Error(), "匹配多个元素") {
+		t.Fatalf("an ambiguous selector should be refused, got %v", err)
+	}
+	if err := ed.AppendChild("x", "x1", "nope", nil); err == nil || err.Error() != "父元素不存在: nope" {
+		t.Fatalf("plain ID errors should be unchanged, got %v", err)
+	}
+	assertInvariants(t, ed)
+
+	path, err := ed.ElementPath("@tag=title[1]")
+	if err != nil || len(path) != 3 || path[0].ElementID != "root" || path[1].ElementID != "web1" || path[2].Tag != "title" {
+		t.Fatalf("unexpected path: %+v, %v", path, err)
+	}
+}
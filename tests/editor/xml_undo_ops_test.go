@@ -0,0 +1,126 @@
+package editor_test
+
+import (
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+func buildLibrary(t *testing.T) (*editor.XMLEditor, *editor.XMLNode) {
+	t.Helper()
+	root := editor.NewDefaultXMLDocument(false)
+	ed := editor.NewXMLEditor("library.xml", root, false)
+	title, author := "Go 语言", "Donovan"
+	steps := []func() error{
+		func() error { return ed.AppendChild("shelf", "s1", "root", nil) },
+		func() error { return ed.AppendChild("book", "b1", "s1", nil) },
+		func() error { return ed.AppendChild("title", "t1", "b1", &title) },
+		func() error { return ed.AppendChild("author", "a1", "b1", &author) },
+		func() error { return ed.AppendChild("shelf", "s2", "root", nil) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("building library failed: %v", err)
+		}
+	}
+	return ed, root
+}
+
+func TestUndoDeleteRestoresSubtree(t *testing.T) {
+	ed, root := buildLibrary(t)
+	want, _ := ed.Content()
+	wantSize := ed.Size()
+	shelf := root.Children[0]
+	book := shelf.Children[0]
+	title := book.Children[0]
+
+	if err := ed.DeleteElement("s1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	assertIDs(t, ed.IDs(), "root", "s2")
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if got, _ := ed.Content(); got != want || ed.Size() != wantSize {
+		t.Fatalf("undo should restore the subtree:\n%s", got)
+	}
+	if root.Children[0] != shelf || shelf.Children[0] != book || book.Children[0] != title || title.Parent != book {
+		t.Fatalf("undo should reattach the original nodes")
+	}
+
+	if err := ed.Redo(); err != nil {
+		t.Fatalf("redo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	assertIDs(t, ed.IDs(), "root", "s2")
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if err := ed.EditText("t1", "Go 程序设计语言"); err != nil {
+		t.Fatalf("edit-text after undo failed: %v", err)
+	}
+	if title.Text != "Go 程序设计语言" {
+		t.Fatalf("edits after undo should reach the restored node")
+	}
+}
+
+func TestXMLUndoKeepsIndexAcrossRenames(t *testing.T) {
+	ed, root := buildLibrary(t)
+	book := root.Children[0].Children[0]
+	if _, err := ed.RenameIDs("s1", "", "old-"); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if err := ed.EditID("old-b1", "b1"); err != nil {
+		t.Fatalf("edit-id failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if _, err := ed.UndoN(2); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	assertIDs(t, ed.IDs(), "root", "s1", "b1", "t1", "a1", "s2")
+	if _, err := ed.RedoN(2); err != nil {
+		t.Fatalf("redo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	assertIDs(t, ed.IDs(), "root", "old-s1", "b1", "old-t1", "old-a1", "s2")
+	if book.ID != "b1" {
+		t.Fatalf("renames should apply to the original node, got %s", book.ID)
+	}
+}
+
+func TestRedoStashedXMLSurvivesLaterEdits(t *testing.T) {
+	ed, _ := buildLibrary(t)
+	ed.SetPreserveRedo(true)
+	steps := []func() error{
+		func() error { return ed.EditText("t1", "draft") },
+		ed.Undo,
+		func() error { return ed.EditText("t1", "other") },
+		func() error { return ed.DeleteElement("b1") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step failed: %v", err)
+		}
+		assertInvariants(t, ed)
+	}
+	if err := ed.RedoStashed(); err != nil {
+		t.Fatalf("redo stashed failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	if nodes := ed.TextNodes(); len(nodes) != 2 || nodes[0].Text != "draft" {
+		t.Fatalf("stashed edit should apply to the tree it was recorded on: %+v", nodes)
+	}
+	if err := ed.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	assertIDs(t, ed.IDs(), "root", "s1", "s2")
+	if err := ed.Redo(); err != nil {
+		t.Fatalf("redo failed: %v", err)
+	}
+	assertInvariants(t, ed)
+	assertIDs(t, ed.IDs(), "root", "s1", "b1", "t1", "a1", "s2")
+}
@@ -0,0 +1,76 @@
+package editor_test
+
+import (
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+func TestElementViewIsSnapshot(t *testing.T) {
+	ed := newSelectorEditor(t)
+	before, _ := ed.Content()
+
+	view, ok := ed.Element("b1")
+	if !ok {
+		t.Fatalf("b1 should exist")
+	}
+	if view.Tag != "book" || view.Depth != 2 || strings.Join(view.Children, ",") != "t1" {
+		t.Fatalf("unexpected view: %+v", view)
+	}
+	if category, ok := view.Attr("category"); !ok || category != "web" {
+		t.Fatalf("attribute lookup failed: %q, %v", category, ok)
+	}
+	view.Attributes[1].Value = "tampered"
+	view.Attributes = append(view.Attributes, editor.XMLAttribute{Name: "extra", Value: "x"})
+	view.Children[0] = "ghost"
+	view.Text = "tampered"
+	view.ID = "ghost"
+
+	resolved, err := ed.Resolve("@attr:category=web")
+	if err != nil || resolved.ID != "b1" {
+		t.Fatalf("the document should not see view changes: %+v, %v", resolved, err)
+	}
+	resolved.Attributes[0].Value = "tampered"
+	if after, _ := ed.Content(); after != before {
+		t.Fatalf("mutating views changed the document:\n%s", after)
+	}
+	if _, ok := ed.Element("ghost"); ok {
+		t.Fatalf("a renamed view should not create an element")
+	}
+	if ed.IsModified() || ed.UndoDepth() != 0 {
+		t.Fatalf("views should not record edits")
+	}
+	assertInvariants(t, ed)
+}
+
+func TestWalkVisitsDocumentOrder(t *testing.T) {
+	ed := newSelectorEditor(t)
+	var ids []string
+	ed.Walk(func(view editor.ElementView) bool {
+		ids = append(ids, view.ID)
+		return true
+	})
+	if strings.Join(ids, ",") != "root,b1,t1,b2,t2,b3,t3" {
+		t.Fatalf("unexpected walk order: %v", ids)
+	}
+	if strings.Join(ed.IDs(), ",") != strings.Join(ids, ",") {
+		t.Fatalf("IDs should agree with Walk: %v", ed.IDs())
+	}
+
+	ids = nil
+	ed.Walk(func(view editor.ElementView) bool {
+		ids = append(ids, view.ID)
+		return view.ID != "t2"
+	})
+	if strings.Join(ids, ",") != "root,b1,t1,b2,t2" {
+		t.Fatalf("walk should stop when fn returns false: %v", ids)
+	}
+
+	if stats := ed.Stats(); stats.Elements != 7 || stats.MaxDepth != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if _, ok := ed.Element("missing"); ok {
+		t.Fatalf("missing elements should report false")
+	}
+}
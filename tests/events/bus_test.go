@@ -52,3 +52,25 @@ func TestBusMultipleObservers(t *testing.T) {
 	}
 }
 
+func TestBusStampsIncreasingSequence(t *testing.T) {
+	bus := events.NewBus()
+	obs1 := &mockObserver{}
+	obs2 := &mockObserver{}
+	bus.Subscribe(obs1)
+	bus.Subscribe(obs2)
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(events.Event{Type: events.EventCommandExecuted, Command: "burst"})
+	}
+	for i := range obs1.received {
+		if obs1.received[i].Seq != obs2.received[i].Seq {
+			t.Fatalf("listeners should observe the same sequence for event %d", i)
+		}
+		if i > 0 && obs1.received[i].Seq <= obs1.received[i-1].Seq {
+			t.Fatalf("sequence not strictly increasing: %d then %d", obs1.received[i-1].Seq, obs1.received[i].Seq)
+		}
+	}
+	if last := obs1.received[len(obs1.received)-1].Seq; events.CurrentSeq() != last {
+		t.Fatalf("current sequence %d should match last published %d", events.CurrentSeq(), last)
+	}
+}
@@ -0,0 +1,51 @@
+package events_test
+
+import (
+	"errors"
+	"testing"
+
+	"softwaredesign/src/events"
+)
+
+func TestOperationEventOrder(t *testing.T) {
+	bus := events.NewBus()
+	obs := &mockObserver{}
+	bus.Subscribe(obs)
+
+	files := []string{"/a.txt", "/b.txt"}
+	op := bus.StartOperation("save-all", files, 2)
+	op.Step("/a.txt")
+	op.Step("/b.txt")
+	op.Finish(nil)
+	op.Finish(errors.New("late"))
+
+	want := []events.EventType{events.EventOperationStarted, events.EventOperationProgress, events.EventOperationProgress, events.EventOperationFinished}
+	if len(obs.received) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(obs.received))
+	}
+	for i, evt := range obs.received {
+		if evt.Type != want[i] || evt.Operation != op.ID() || evt.Command != "save-all" || evt.Total != 2 || len(evt.Files) != 2 {
+			t.Fatalf("event %d unexpected: %+v", i, evt)
+		}
+		if i > 0 && evt.Seq <= obs.received[i-1].Seq {
+			t.Fatalf("events should be published in order")
+		}
+	}
+	if obs.received[2].Done != 2 || obs.received[2].File != "/b.txt" || obs.received[3].Metadata["error"] != "" {
+		t.Fatalf("unexpected progress or finish: %+v", obs.received[2:])
+	}
+
+	other := bus.StartOperation("save-all", nil, 0)
+	other.Finish(errors.New("磁盘已满"))
+	last := obs.received[len(obs.received)-1]
+	if other.ID() == op.ID() || last.Metadata["error"] != "磁盘已满" {
+		t.Fatalf("failed operation should carry its error under its own ID: %+v", last)
+	}
+}
+
+func TestOperationOnNilBus(t *testing.T) {
+	var bus *events.Bus
+	op := bus.StartOperation("spell-check-all", nil, 1)
+	op.Step("")
+	op.Finish(nil)
+}
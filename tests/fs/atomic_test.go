@@ -0,0 +1,58 @@
+package fs_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/fs"
+)
+
+func TestWriteAtomicFailureKeepsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, []byte("original"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	err := fs.WriteAtomic(path, 0o644, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("序列化失败")
+	})
+	if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), "序列化失败") {
+		t.Fatalf("the error should name the target and the cause: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "original" {
+		t.Fatalf("the original should be untouched: %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("the temporary file should be removed: %v", entries)
+	}
+}
+
+func TestWriteAtomicReplacesSymlinkTarget(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "real.txt")
+	link := filepath.Join(dir, "link.txt")
+	if err := os.WriteFile(real, []byte("old"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	err := fs.WriteAtomic(link, 0o644, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("the link should stay a link")
+	}
+	if data, _ := os.ReadFile(real); string(data) != "new" {
+		t.Fatalf("the link target should be replaced: %q", data)
+	}
+}
@@ -17,7 +17,7 @@ func TestDirTree(t *testing.T) {
 	os.WriteFile(filepath.Join(dir, "file1.txt"), []byte("content"), 0o644)
 	os.WriteFile(filepath.Join(dir, "subdir", "file2.txt"), []byte("content"), 0o644)
 
-	tree, err := fs.Tree(dir)
+	tree, err := fs.Tree(dir, fs.Options{})
 	if err != nil {
 		t.Fatalf("dir tree failed: %v", err)
 	}
@@ -35,7 +35,7 @@ func TestDirTree(t *testing.T) {
 
 func TestDirTreeEmpty(t *testing.T) {
 	dir := t.TempDir()
-	tree, err := fs.Tree(dir)
+	tree, err := fs.Tree(dir, fs.Options{})
 	if err != nil {
 		t.Fatalf("dir tree failed: %v", err)
 	}
@@ -45,3 +45,169 @@ func TestDirTreeEmpty(t *testing.T) {
 	}
 }
 
+func TestRenderMatchesLegacyOutput(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "B", "inner"), 0o755)
+	os.MkdirAll(filepath.Join(dir, "a"), 0o755)
+	os.WriteFile(filepath.Join(dir, "z.txt"), []byte("z"), 0o644)
+	os.WriteFile(filepath.Join(dir, "Y.txt"), []byte("y"), 0o644)
+	os.WriteFile(filepath.Join(dir, "B", "b.txt"), []byte("b"), 0o644)
+	os.WriteFile(filepath.Join(dir, "B", "inner", "deep.txt"), []byte("d"), 0o644)
+
+	want := strings.Join([]string{
+		"├── a",
+		"├── B",
+		"│   ├── inner",
+		"│   │   └── deep.txt",
+		"│   └── b.txt",
+		"├── Y.txt",
+		"└── z.txt",
+	}, "\n")
+	tree, err := fs.Tree(dir, fs.Options{})
+	if err != nil {
+		t.Fatalf("dir tree failed: %v", err)
+	}
+	if tree != want {
+		t.Fatalf("tree output changed:\n%s", tree)
+	}
+
+	node, err := fs.Scan(dir, fs.Options{Stat: true})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if rendered := fs.Render(node, fs.Options{Stat: true}); rendered != want {
+		t.Fatalf("render differs from tree:\n%s", rendered)
+	}
+	if len(node.Children) != 4 || !node.Children[1].IsDir || node.Children[3].Size != 1 {
+		t.Fatalf("unexpected node structure: %+v", node.Children)
+	}
+}
+
+func TestNumberedTreeMatchesFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "B", "inner"), 0o755)
+	os.WriteFile(filepath.Join(dir, "z.txt"), []byte("z"), 0o644)
+	os.WriteFile(filepath.Join(dir, "B", "b.txt"), []byte("b"), 0o644)
+	os.WriteFile(filepath.Join(dir, "B", "inner", "deep.txt"), []byte("d"), 0o644)
+
+	opts := fs.Options{Numbered: true}
+	node, err := fs.Scan(dir, opts)
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	want := strings.Join([]string{
+		"├── B",
+		"│   ├── inner",
+		"│   │   └── [1] deep.txt",
+		"│   └── [2] b.txt",
+		"└── [3] z.txt",
+	}, "\n")
+	if tree := fs.Render(node, opts); tree != want {
+		t.Fatalf("unexpected numbered tree:\n%s", tree)
+	}
+	files := fs.Files(node, dir)
+	if len(files) != 3 || files[0] != filepath.Join(dir, "B", "inner", "deep.txt") || files[2] != filepath.Join(dir, "z.txt") {
+		t.Fatalf("files should follow the numbering: %q", files)
+	}
+}
+
+func TestHeadStopsAfterLimit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	os.WriteFile(path, []byte("one\r\ntwo\nthree\n"), 0o644)
+	lines, more, err := fs.Head(path, 2)
+	if err != nil || !more || strings.Join(lines, ",") != "one,two" {
+		t.Fatalf("unexpected head: %q more=%v err=%v", lines, more, err)
+	}
+	lines, more, err = fs.Head(path, 3)
+	if err != nil || more || len(lines) != 3 {
+		t.Fatalf("an exact fit has nothing more: %q more=%v err=%v", lines, more, err)
+	}
+	if _, _, err := fs.Head(dir, 1); err == nil {
+		t.Fatalf("a directory should be refused")
+	}
+}
+
+func TestTreeDepthLimitMarksTruncatedDirs(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "a", "b", "c"), 0o755)
+	os.WriteFile(filepath.Join(dir, "a", "one.txt"), []byte("1"), 0o644)
+	os.WriteFile(filepath.Join(dir, "a", "b", "two.txt"), []byte("2"), 0o644)
+
+	tree, err := fs.Tree(dir, fs.Options{MaxDepth: 2})
+	if err != nil {
+		t.Fatalf("dir tree failed: %v", err)
+	}
+	want := strings.Join([]string{
+		"└── a",
+		"    ├── b/...",
+		"    └── one.txt",
+	}, "\n")
+	if tree != want {
+		t.Fatalf("unexpected tree:\n%s\nwant:\n%s", tree, want)
+	}
+	node, err := fs.Scan(dir, fs.Options{MaxDepth: 1})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if !node.Children[0].Truncated || len(node.Children[0].Children) != 0 {
+		t.Fatalf("a directory at the limit should be truncated: %+v", node.Children[0])
+	}
+}
+
+func TestTreeSkipHidden(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".git", "objects"), 0o755)
+	os.WriteFile(filepath.Join(dir, ".editor_workspace"), []byte("{}"), 0o644)
+	os.WriteFile(filepath.Join(dir, ".notes.txt.log"), []byte("log"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("n"), 0o644)
+
+	tree, err := fs.Tree(dir, fs.Options{SkipHidden: true})
+	if err != nil {
+		t.Fatalf("dir tree failed: %v", err)
+	}
+	if tree != "└── notes.txt" {
+		t.Fatalf("hidden entries should be skipped: %q", tree)
+	}
+	all, err := fs.Tree(dir, fs.Options{})
+	if err != nil {
+		t.Fatalf("dir tree failed: %v", err)
+	}
+	for _, name := range []string{".git", "objects", ".editor_workspace", ".notes.txt.log"} {
+		if !strings.Contains(all, name) {
+			t.Fatalf("default options should list %s: %q", name, all)
+		}
+	}
+}
+
+func TestTreeSizesAndAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(dir, "B.txt"), make([]byte, 1229), 0o644)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644)
+	os.WriteFile(filepath.Join(dir, "sub", "c.txt"), nil, 0o644)
+
+	marks := map[string]string{filepath.Join(dir, "a.txt"): "* [modified]"}
+	tree, err := fs.Tree(dir, fs.Options{Sizes: true, Annotate: func(path string) string { return marks[path] }})
+	if err != nil {
+		t.Fatalf("dir tree failed: %v", err)
+	}
+	want := strings.Join([]string{
+		"├── sub",
+		"│   └── c.txt (0B)",
+		"├── a.txt (5B) * [modified]",
+		"└── B.txt (1.2KB)",
+	}, "\n")
+	if tree != want {
+		t.Fatalf("unexpected tree:\n%s\nwant:\n%s", tree, want)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{0: "0B", 1023: "1023B", 1024: "1.0KB", 3565158: "3.4MB", 5 << 30: "5.0GB"}
+	for size, want := range cases {
+		if got := fs.FormatSize(size); got != want {
+			t.Fatalf("FormatSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/server"
+	"softwaredesign/src/workspace"
+)
+
+func newScratchServer(t *testing.T) (*httptest.Server, *workspace.Workspace, string) {
+	t.Helper()
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	ed, err := ws.Init("text", "notes.txt", false)
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("hello"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	srv := httptest.NewServer(server.New(ws).Handler())
+	t.Cleanup(srv.Close)
+	return srv, ws, filepath.Join(dir, "notes.txt")
+}
+
+func getJSON(t *testing.T, target string, wantStatus int, into any) {
+	t.Helper()
+	resp, err := http.Get(target)
+	if err != nil {
+		t.Fatalf("get %s failed: %v", target, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("get %s: expected status %d, got %d", target, wantStatus, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		t.Fatalf("decode %s failed: %v", target, err)
+	}
+}
+
+func TestStatusAndFiles(t *testing.T) {
+	srv, _, path := newScratchServer(t)
+
+	var status map[string]any
+	getJSON(t, srv.URL+"/status", http.StatusOK, &status)
+	if status["open"] != float64(1) || status["modified"] != float64(1) || status["active"] != path {
+		t.Fatalf("unexpected status: %v", status)
+	}
+
+	var files []map[string]any
+	getJSON(t, srv.URL+"/files", http.StatusOK, &files)
+	if len(files) != 1 || files[0]["path"] != path || files[0]["modified"] != true {
+		t.Fatalf("unexpected file list: %v", files)
+	}
+}
+
+func TestFileContent(t *testing.T) {
+	srv, _, path := newScratchServer(t)
+
+	var content map[string]string
+	getJSON(t, srv.URL+"/files/notes.txt/content", http.StatusOK, &content)
+	if content["content"] != "hello" || content["path"] != path {
+		t.Fatalf("unexpected content: %v", content)
+	}
+	getJSON(t, srv.URL+"/files/"+url.PathEscape(path)+"/content", http.StatusOK, &content)
+	if content["content"] != "hello" {
+		t.Fatalf("absolute path lookup failed: %v", content)
+	}
+
+	var failure map[string]string
+	getJSON(t, srv.URL+"/files/missing.txt/content", http.StatusNotFound, &failure)
+	if !strings.Contains(failure["error"], "文件未打开") {
+		t.Fatalf("unexpected error body: %v", failure)
+	}
+}
+
+func TestServerIsReadOnly(t *testing.T) {
+	srv, ws, _ := newScratchServer(t)
+	resp, err := http.Post(srv.URL+"/files/notes.txt/content", "text/plain", strings.NewReader("bye"))
+	if err != nil {
+		t.Fatalf("post failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", resp.StatusCode)
+	}
+	ed, _ := ws.ActiveEditor()
+	if content, _ := ed.Content(); content != "hello" {
+		t.Fatalf("content must not change: %q", content)
+	}
+}
@@ -1,7 +1,11 @@
 package spellcheck_test
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"softwaredesign/src/spellcheck"
 )
@@ -31,6 +35,9 @@ func TestSpellCheckXML(t *testing.T) {
 	if issues[0].ElementID != "title1" {
 		t.Fatalf("unexpected element id: %s", issues[0].ElementID)
 	}
+	if issues[0].Offset != 0 || issues[0].Occurrence != 1 {
+		t.Fatalf("unexpected position: %+v", issues[0])
+	}
 	if len(issues[0].Suggestions) == 0 {
 		t.Fatalf("expected suggestions for misspelling")
 	}
@@ -70,3 +77,106 @@ func TestSpellCheckWithMock(t *testing.T) {
 		t.Errorf("expected suggestion 'mistake', got '%s'", issues[0].Suggestions[0])
 	}
 }
+
+func TestSpellCheckXMLPositions(t *testing.T) {
+	service := spellcheck.NewService(spellcheck.NewSimpleChecker())
+	entries := []spellcheck.XMLText{{ElementID: "desc1", Text: "Please recieve, then recieve again"}}
+	issues := service.CheckXMLText(entries)
+	var recieve []spellcheck.XMLIssue
+	for _, issue := range issues {
+		if issue.Word == "recieve" {
+			recieve = append(recieve, issue)
+		}
+	}
+	if len(recieve) != 2 {
+		t.Fatalf("expected two recieve issues, got %+v", issues)
+	}
+	if recieve[0].Offset != 7 || recieve[0].Occurrence != 1 {
+		t.Fatalf("unexpected first position: %+v", recieve[0])
+	}
+	if recieve[1].Offset != 21 || recieve[1].Occurrence != 2 {
+		t.Fatalf("unexpected second position: %+v", recieve[1])
+	}
+}
+
+func TestMarkdownExtractorSkipsCode(t *testing.T) {
+	service := spellcheck.NewService(spellcheck.NewSimpleChecker())
+	lines := []string{
+		"# Hello wrold",
+		"",
+		"```go",
+		"func recieve() {}",
+		"```",
+		"Please `recieve` the [updatez](https://exmaple.com/recieve) now",
+		"See <https://exmaple.org> for data",
+		"[docs]: https://exmaple.net/recieve",
+	}
+	x := service.Extractors().ForPath("README.MD")
+	reported := map[string]string{}
+	var words []string
+	for _, issue := range service.CheckLinesWith(x, lines) {
+		reported[issue.Word] = fmt.Sprintf("%d:%d", issue.Line, issue.Column)
+		words = append(words, issue.Word)
+	}
+	if reported["wrold"] != "1:9" || reported["updatez"] != "6:23" {
+		t.Fatalf("prose misspellings should be reported with positions: %v", reported)
+	}
+	for _, hidden := range []string{"recieve", "exmaple", "func", "https"} {
+		if _, ok := reported[hidden]; ok {
+			t.Fatalf("%s comes from code or a link target and should be skipped: %v", hidden, reported)
+		}
+	}
+
+	plain := service.CheckLinesWith(service.Extractors().ForPath("notes.txt"), lines)
+	if len(plain) <= len(words) {
+		t.Fatalf("plain extraction should still report words inside code: %v", plain)
+	}
+}
+
+func TestDictionaryCacheReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terms.dict")
+	if err := os.WriteFile(path, []byte("Alpha\n# comment\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	cache := spellcheck.NewDictionaryCache()
+	words, err := cache.Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, ok := words["alpha"]; !ok || len(words) != 1 {
+		t.Fatalf("unexpected words: %v", words)
+	}
+	if again, _ := cache.Load(path); fmt.Sprintf("%p", again) != fmt.Sprintf("%p", words) {
+		t.Fatalf("unchanged file should come from the cache")
+	}
+	if err := os.WriteFile(path, []byte("alpha\nbeta\n"), 0o644); err != nil {
+		t.Fatalf("rewrite failed: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("chtimes failed: %v", err)
+	}
+	if words, _ := cache.Load(path); len(words) != 2 {
+		t.Fatalf("changed file should be re-read: %v", words)
+	}
+	service := spellcheck.NewService(spellcheck.NewSimpleChecker()).WithIgnored(spellcheck.WordSet{"beta": {}})
+	if issues := service.CheckLines([]string{"Beta gamma"}); len(issues) != 1 || issues[0].Word != "gamma" {
+		t.Fatalf("ignored words should pass: %+v", issues)
+	}
+}
+
+func TestCheckChunkWithCarriesFence(t *testing.T) {
+	service := spellcheck.NewService(spellcheck.NewSimpleChecker())
+	x := service.Extractors().ForPath("notes.md")
+	issues, state := service.CheckChunkWith(x, []string{"Hello wrold", "~~~~"}, "")
+	if len(issues) != 1 || state != "~~~~" {
+		t.Fatalf("the open fence should be returned: %v %q", issues, state)
+	}
+	issues, state = service.CheckChunkWith(x, []string{"recieve", "~~~~", "wrold"}, state)
+	if len(issues) != 1 || issues[0].Word != "wrold" || issues[0].Line != 3 || state != "" {
+		t.Fatalf("code before the closing fence should be skipped: %v %q", issues, state)
+	}
+	if issues, _ := service.CheckChunkWith(service.Extractors().ForPath("notes.txt"), []string{"recieve"}, "~~~~"); len(issues) != 1 {
+		t.Fatalf("extractors without chunk state should check every chunk: %v", issues)
+	}
+}
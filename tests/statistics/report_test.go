@@ -0,0 +1,70 @@
+package statistics_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"softwaredesign/src/statistics"
+)
+
+func TestLedgerSplitsSpansAtMidnight(t *testing.T) {
+	ledger := statistics.NewLedger()
+	start := time.Date(2025, 10, 1, 23, 30, 0, 0, time.Local)
+	ledger.AddSpan("a.txt", start, start.Add(45*time.Minute))
+
+	rows := statistics.Aggregate(ledger.Entries())
+	if len(rows) != 2 {
+		t.Fatalf("expected one row per day, got %+v", rows)
+	}
+	if rows[0].Day != "2025-10-01" || rows[0].Duration != 30*time.Minute {
+		t.Fatalf("unexpected first day: %+v", rows[0])
+	}
+	if rows[1].Day != "2025-10-02" || rows[1].Duration != 15*time.Minute {
+		t.Fatalf("unexpected second day: %+v", rows[1])
+	}
+}
+
+func TestReportCSVGolden(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 10, 1, 9, 0, 0, 0, time.Local)}
+	ledger := statistics.NewLedger()
+	ledger.WithClock(clock)
+	tracker := statistics.NewTracker()
+	tracker.WithClock(clock)
+	tracker.WithLedger(ledger)
+
+	tracker.Switch("", "notes.txt")
+	ledger.CountCommand("notes.txt")
+	clock.Advance(25 * time.Minute)
+	ledger.CountCommand("notes.txt")
+	ledger.CountSave("notes.txt")
+	tracker.Switch("notes.txt", "book.xml")
+	ledger.CountCommand("book.xml")
+	clock.Advance(90 * time.Second)
+	tracker.Credit("notes.txt", 30*time.Second)
+	clock.Advance(24 * time.Hour)
+	ledger.CountSave("book.xml")
+	tracker.StopAll()
+	// Entries persisted by an earlier session merge with the new ones.
+	ledger.Restore([]statistics.DayActivity{{File: "notes.txt", Day: "2025-10-01", Duration: 5 * time.Minute, Commands: 3}})
+
+	var buf bytes.Buffer
+	if err := statistics.WriteCSV(&buf, statistics.Aggregate(ledger.Entries())); err != nil {
+		t.Fatalf("write csv failed: %v", err)
+	}
+	golden := filepath.Join("testdata", "report.golden.csv")
+	if os.Getenv("UPDATE_GOLDEN") != "" {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("update golden failed: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden failed: %v", err)
+	}
+	if buf.String() != string(want) {
+		t.Fatalf("csv mismatch:\n--- got\n%s--- want\n%s", buf.String(), want)
+	}
+}
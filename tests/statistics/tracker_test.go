@@ -49,3 +49,38 @@ func TestFormatDuration(t *testing.T) {
 		}
 	}
 }
+
+func TestTrackerCreditKeepsActiveFile(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	tracker := statistics.NewTracker()
+	tracker.WithClock(clock)
+
+	tracker.Switch("", "a.txt")
+	tracker.Credit("b.txt", 5*time.Second)
+	tracker.Credit("b.txt", 0)
+	clock.Advance(10 * time.Second)
+
+	if got := tracker.Duration("b.txt"); got != 5*time.Second {
+		t.Fatalf("credited duration mismatch: %v", got)
+	}
+	if got := tracker.Duration("a.txt"); got != 10*time.Second {
+		t.Fatalf("active file should keep accruing, got %v", got)
+	}
+}
+
+func TestTrackerRenameCarriesDuration(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	tracker := statistics.NewTracker()
+	tracker.WithClock(clock)
+
+	tracker.Switch("", "a.txt")
+	clock.Advance(30 * time.Second)
+	tracker.Rename("a.txt", "b.txt")
+	clock.Advance(30 * time.Second)
+	if got := tracker.Duration("b.txt"); got != time.Minute {
+		t.Fatalf("the renamed file should keep its time and stay active: %s", got)
+	}
+	if got := tracker.Duration("a.txt"); got != 0 {
+		t.Fatalf("the old name should be cleared: %s", got)
+	}
+}
@@ -0,0 +1,32 @@
+package version_test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/version"
+)
+
+func TestFallbackValues(t *testing.T) {
+	info := version.Get()
+	if info.Version != "dev" || info.Commit != "dev" || info.Date != "dev" {
+		t.Fatalf("unset build variables should fall back to dev: %+v", info)
+	}
+	if info.GoVersion != runtime.Version() {
+		t.Fatalf("unexpected go version: %s", info.GoVersion)
+	}
+}
+
+func TestInjectedValues(t *testing.T) {
+	saved := version.Commit
+	defer func() { version.Commit = saved }()
+	version.Commit = "abc1234"
+	if got := version.Get().String(); !strings.Contains(got, "commit abc1234") {
+		t.Fatalf("injected commit missing: %s", got)
+	}
+	version.Commit = ""
+	if version.Get().Commit != "dev" {
+		t.Fatalf("empty commit should fall back to dev")
+	}
+}
@@ -0,0 +1,134 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/workspace"
+)
+
+func TestParseAge(t *testing.T) {
+	valid := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"24h": 24 * time.Hour,
+		"30m": 30 * time.Minute,
+		"0d":  0,
+	}
+	for text, want := range valid {
+		if got, err := workspace.ParseAge(text); err != nil || got != want {
+			t.Fatalf("%s: got %v, %v", text, got, err)
+		}
+	}
+	for _, text := range []string{"", "d", "7", "7w", "-1d", "1.5h", "h7"} {
+		if _, err := workspace.ParseAge(text); err == nil {
+			t.Fatalf("%q should be refused", text)
+		}
+	}
+}
+
+// logHeader is the first line the logging manager writes to a log file.
+const logHeader = "session start at 20240102 03:04:05\n"
+
+func TestMatchArtifact(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, filepath.Join(dir, "kept.txt"), "x")
+	writeFixture(t, filepath.Join(dir, ".gone.txt.log"), logHeader+"append \"x\"\n")
+	writeFixture(t, filepath.Join(dir, ".build.log"), "make: all\n")
+	writeFixture(t, filepath.Join(dir, ".bash_history.log"), "session start at noon\n")
+	cases := []struct {
+		name  string
+		kind  workspace.ArtifactKind
+		owner string
+	}{
+		{".backup/a.txt.20240102-030405.000000006", workspace.ArtifactBackup, "a.txt"},
+		{".backup/v1.2.xml.20240102-030405.000000006", workspace.ArtifactBackup, "v1.2.xml"},
+		{".gone.txt.log", workspace.ArtifactOrphanLog, "gone.txt"},
+		{".a.txt.tmp-12345", workspace.ArtifactTemp, "a.txt"},
+	}
+	for _, tc := range cases {
+		kind, owner, ok := workspace.MatchArtifact(filepath.Join(dir, tc.name))
+		if !ok || kind != tc.kind || owner != filepath.Join(dir, tc.owner) {
+			t.Fatalf("%s: got %s, %s, %v", tc.name, kind, owner, ok)
+		}
+	}
+	for _, name := range []string{"a.txt", ".kept.txt.log", ".backup/a.txt", ".backup/a.txt.yesterday", "notes.swp", ".a.txt.log.x", ".editor_workspace",
+		".notes.txt.swp", ".bash_history.log.1", ".build.log", ".bash_history.log", ".missing.txt.log"} {
+		if kind, _, ok := workspace.MatchArtifact(filepath.Join(dir, name)); ok {
+			t.Fatalf("%s should not match, got %s", name, kind)
+		}
+	}
+}
+
+func TestStaleArtifactsSkipsFreshAndOpenFiles(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	old := time.Now().Add(-10 * 24 * time.Hour)
+	stale := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+		writeFixture(t, path, content)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("chtimes failed: %v", err)
+		}
+		return path
+	}
+	writeFixture(t, filepath.Join(dir, "a.txt"), "a")
+	writeFixture(t, filepath.Join(dir, "open.txt"), "open")
+	backup := stale(".backup/a.txt.20240102-030405.000000006", "old a")
+	orphan := stale("sub/.gone.txt.log", logHeader)
+	temp := stale(".a.txt.tmp-1", "partial save")
+	stale(".open.txt.tmp-2", "temp of an open file")
+	stale(".b.txt.log.1", "rotated by another tool")
+	stale(".vim.txt.swp", "swap of another editor")
+	stale(".build.log", "foreign log")
+	stale(".backup/open.txt.20240102-030405.000000006", "backup of an open file")
+	stale("plain.txt", "not an artifact")
+	stale(".a.txt.log", logHeader)
+	writeFixture(t, filepath.Join(dir, ".a.txt.tmp-3"), "fresh temp")
+	ed, err := ws.Load(filepath.Join(dir, "open.txt"))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("unsaved"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	artifacts, err := ws.StaleArtifacts(7 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	want := []string{backup, orphan, temp}
+	if len(artifacts) != len(want) {
+		t.Fatalf("unexpected artifacts: %+v", artifacts)
+	}
+	for i, artifact := range artifacts {
+		if artifact.Path != want[i] {
+			t.Fatalf("artifact %d: expected %s, got %s", i, want[i], artifact.Path)
+		}
+	}
+	if artifacts[0].Size != int64(len("old a")) {
+		t.Fatalf("size should be recorded: %+v", artifacts[0])
+	}
+	if fresh, _ := ws.StaleArtifacts(0); len(fresh) != 4 {
+		t.Fatalf("a zero age should include the fresh temp file: %+v", fresh)
+	}
+
+	removed, err := ws.RemoveArtifacts(artifacts)
+	if err != nil || removed != 3 {
+		t.Fatalf("remove failed: %d, %v", removed, err)
+	}
+	for _, path := range want {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed", path)
+		}
+	}
+	for _, name := range []string{".open.txt.tmp-2", "plain.txt", ".a.txt.log", ".a.txt.tmp-3", ".b.txt.log.1", ".vim.txt.swp", ".build.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("%s should be kept: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+// session simulates one process: a fresh logger and workspace over dir.
+func session(dir string) (*workspace.Workspace, *logging.Manager) {
+	logger := logging.NewManager()
+	bus := events.NewBus()
+	bus.Subscribe(logger)
+	return workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logger, nil), logger
+}
+
+func sessionStarts(t *testing.T, file string) int {
+	t.Helper()
+	logPath, _ := logging.LogFilePath(file)
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0
+		}
+		t.Fatalf("read log failed: %v", err)
+	}
+	return strings.Count(string(data), "session start at")
+}
+
+func TestRestoreAppliesAddedMarker(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	os.WriteFile(file, []byte("plain"), 0o644)
+	first, _ := session(dir)
+	if _, err := first.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := first.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	os.WriteFile(file, []byte("# log\nplain"), 0o644)
+	second, logger := session(dir)
+	if err := second.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if !logger.Enabled(file) || sessionStarts(t, file) != 1 {
+		t.Fatalf("new marker should enable logging once")
+	}
+}
+
+func TestRestoreDropsRemovedMarker(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	os.WriteFile(file, []byte("# log\nplain"), 0o644)
+	first, firstLogger := session(dir)
+	if _, err := first.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !firstLogger.Enabled(file) {
+		t.Fatalf("marker should enable logging")
+	}
+	if err := first.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	os.WriteFile(file, []byte("plain"), 0o644)
+	second, logger := session(dir)
+	if err := second.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if logger.Enabled(file) {
+		t.Fatalf("logging enabled only by a removed marker should not survive restore")
+	}
+}
+
+func TestRestoreExplicitDecisionsWin(t *testing.T) {
+	dir := t.TempDir()
+	agreed := filepath.Join(dir, "agreed.txt")
+	silenced := filepath.Join(dir, "silenced.txt")
+	os.WriteFile(agreed, []byte("# log\na"), 0o644)
+	os.WriteFile(silenced, []byte("# log\nb"), 0o644)
+	first, firstLogger := session(dir)
+	first.Load(agreed)
+	first.Load(silenced)
+	firstLogger.Enable(agreed)
+	firstLogger.Disable(silenced)
+	if sessionStarts(t, agreed) != 1 {
+		t.Fatalf("marker and log-on together should write one session line")
+	}
+	if err := first.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	second, logger := session(dir)
+	if err := second.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if !logger.Enabled(agreed) || sessionStarts(t, agreed) != 2 {
+		t.Fatalf("agreed file should log with one session line per process")
+	}
+	if logger.Enabled(silenced) || sessionStarts(t, silenced) != 1 {
+		t.Fatalf("explicit log-off should override the marker without a new session line")
+	}
+}
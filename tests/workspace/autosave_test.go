@@ -0,0 +1,165 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+type manualTicker struct {
+	ch      chan time.Time
+	stopped chan struct{}
+}
+
+func (m *manualTicker) C() <-chan time.Time { return m.ch }
+
+func (m *manualTicker) Stop() { close(m.stopped) }
+
+type autosaveEvents chan events.Event
+
+func (a autosaveEvents) Handle(evt events.Event) {
+	if evt.Type == events.EventAutosaved {
+		a <- evt
+	}
+}
+
+func newAutosaveWorkspace(t *testing.T) (*workspace.Workspace, *manualTicker, autosaveEvents, *logging.Manager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	bus := events.NewBus()
+	saved := make(autosaveEvents, 10)
+	bus.Subscribe(saved)
+	logger := logging.NewManager()
+	bus.Subscribe(logger)
+	ws := workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logger, nil)
+	ticker := &manualTicker{ch: make(chan time.Time), stopped: make(chan struct{})}
+	ws.SetTickerFactory(func(time.Duration) workspace.Ticker { return ticker })
+	return ws, ticker, saved, logger, dir
+}
+
+func nextAutosave(t *testing.T, saved autosaveEvents) events.Event {
+	t.Helper()
+	select {
+	case evt := <-saved:
+		return evt
+	case <-time.After(2 * time.Second):
+		t.Fatalf("autosave did not run")
+		return events.Event{}
+	}
+}
+
+func TestAutosaveSavesModifiedEditors(t *testing.T) {
+	ws, ticker, saved, logger, dir := newAutosaveWorkspace(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "one\n")
+	clean := filepath.Join(dir, "clean.txt")
+	writeFixture(t, clean, "clean\n")
+	if _, err := ws.Load(clean); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := logger.Enable(file); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("two"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ws.StartAutosave(time.Minute); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if interval, on := ws.AutosaveInterval(); !on || interval != time.Minute {
+		t.Fatalf("unexpected autosave state: %v %v", interval, on)
+	}
+	ticker.ch <- time.Now()
+	evt := nextAutosave(t, saved)
+	if evt.File != file || evt.Metadata["error"] != "" {
+		t.Fatalf("unexpected autosave event: %+v", evt)
+	}
+	ws.Lock()
+	modified := ed.IsModified()
+	ws.Unlock()
+	if modified {
+		t.Fatalf("the saved editor should be clean")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\ntwo\n" {
+		t.Fatalf("unexpected saved content: %q", data)
+	}
+	if content, _ := logger.Show(file); !strings.Contains(content, " autosave\n") {
+		t.Fatalf("the log should record the autosave: %q", content)
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	select {
+	case <-ticker.stopped:
+	default:
+		t.Fatalf("persist should stop autosave")
+	}
+	if _, on := ws.AutosaveInterval(); on {
+		t.Fatalf("autosave should be off after persist")
+	}
+}
+
+func TestAutosaveFailureIsReported(t *testing.T) {
+	ws, ticker, saved, _, dir := newAutosaveWorkspace(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "one\n")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("two"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	writeFixture(t, file, "changed elsewhere\n")
+	if err := ws.StartAutosave(time.Second); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer ws.StopAutosave()
+	ticker.ch <- time.Now()
+	if evt := nextAutosave(t, saved); evt.Metadata["error"] == "" {
+		t.Fatalf("the external change should fail the autosave: %+v", evt)
+	}
+	ws.Lock()
+	modified := ed.IsModified()
+	ws.Unlock()
+	if !modified {
+		t.Fatalf("a failed autosave should keep the buffer modified")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "changed elsewhere\n" {
+		t.Fatalf("the external change should not be overwritten: %q", data)
+	}
+}
+
+func TestStopAutosaveWhileLocked(t *testing.T) {
+	ws, ticker, _, _, _ := newAutosaveWorkspace(t)
+	if err := ws.StartAutosave(0); err == nil {
+		t.Fatalf("a zero interval should be refused")
+	}
+	if err := ws.StartAutosave(time.Second); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	ws.Lock()
+	ticker.ch <- time.Now()
+	stopped := make(chan struct{})
+	go func() {
+		ws.StopAutosave()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("stopping autosave under the workspace lock should not deadlock")
+	}
+	ws.Unlock()
+}
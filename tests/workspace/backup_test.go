@@ -0,0 +1,152 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/workspace"
+)
+
+func TestBackupRotation(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	if err := ws.Settings().Set("backup", "on"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := ws.Settings().Set("backup-count", "2"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	ed, err := ws.Init("text", "a.txt", false)
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	file := ed.Path()
+	doc := ed.(editor.TextDocument)
+	for _, text := range []string{"v1", "v2", "v3", "v4"} {
+		doc.SetLines([]string{text})
+		if err := ws.Save(""); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+	backups, err := workspace.Backups(file)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("only the newest backups should be kept: %q", backups)
+	}
+	for i, want := range []string{"v3", "v2"} {
+		if data, _ := os.ReadFile(backups[i]); string(data) != want {
+			t.Fatalf("backup %d should hold %s, got %q", i+1, want, data)
+		}
+	}
+	if filepath.Dir(backups[0]) != filepath.Join(dir, ".backup") {
+		t.Fatalf("backups should live in .backup: %s", backups[0])
+	}
+}
+
+func TestBackupOffByDefault(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "one\n")
+	if _, err := ws.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".backup")); !os.IsNotExist(err) {
+		t.Fatalf("no backup should be written unless enabled")
+	}
+}
+
+func TestRestoreBackupOpensBuffer(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	if err := ws.Settings().Set("backup", "on"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "original\n")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := ws.RestoreBackup(file, 1); err == nil {
+		t.Fatalf("restoring without backups should fail")
+	}
+	if _, err := ed.(editor.TextDocument).ReplaceAll("original", "broken"); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	restored, err := ws.RestoreBackup("a.txt", 1)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if restored.Path() != filepath.Join(dir, "a.restored.txt") || !restored.IsModified() {
+		t.Fatalf("the backup should open in a new unsaved buffer: %s", restored.Path())
+	}
+	if lines := restored.(editor.TextDocument).Lines(); len(lines) != 1 || lines[0] != "original" {
+		t.Fatalf("unexpected restored content: %q", lines)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "broken\n" {
+		t.Fatalf("the file itself should be untouched: %q", data)
+	}
+	again, err := ws.RestoreBackup(file, 1)
+	if err != nil || again.Path() != filepath.Join(dir, "a.restored-2.txt") {
+		t.Fatalf("a second restore should pick a free name: %v", err)
+	}
+	if _, err := ws.RestoreBackup(file, 2); err == nil {
+		t.Fatalf("an out-of-range index should fail")
+	}
+}
+
+func TestWriteRecoveryKeepsFileAndBuffer(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "one\n")
+	writeFixture(t, filepath.Join(dir, "a.recovered.txt"), "taken")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("two"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	target, err := ws.WriteRecovery("a.txt")
+	if err != nil || target != filepath.Join(dir, "a.recovered-2.txt") {
+		t.Fatalf("recovery should pick a free name: %s %v", target, err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "one\ntwo\n" {
+		t.Fatalf("unexpected recovery content: %q", data)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\n" || !ed.IsModified() {
+		t.Fatalf("the file and the buffer should be left alone: %q", data)
+	}
+}
+
+func TestRestoreBackupKeepsLineEndings(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	if err := ws.Settings().Set("backup", "on"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "one\r\ntwo\r\n")
+	if _, err := ws.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if _, err := ws.RestoreBackup(file, 1); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.restored.txt")); string(data) != "one\r\ntwo\r\n" {
+		t.Fatalf("the restored copy should keep CRLF and the final newline: %q", data)
+	}
+}
@@ -0,0 +1,70 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestCommandHistoryKeepsNumbersPastTheLimit(t *testing.T) {
+	history := workspace.NewCommandHistory(2)
+	if _, err := history.Last(); err == nil {
+		t.Fatalf("an empty history has no last command")
+	}
+	for _, command := range []string{"load a.txt", "append x", "save"} {
+		history.Add(command)
+	}
+	entries := history.Entries()
+	if len(entries) != 2 || entries[0].Number != 2 || entries[1].Command != "save" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if _, err := history.Entry(1); err == nil {
+		t.Fatalf("an evicted entry should not be found")
+	}
+	if command, err := history.Entry(2); err != nil || command != "append x" {
+		t.Fatalf("entry 2 should keep its number: %q %v", command, err)
+	}
+	history.SetLimit(1)
+	if command, _ := history.Last(); command != "save" || history.Len() != 1 {
+		t.Fatalf("lowering the limit should evict: %+v", history.Entries())
+	}
+}
+
+func TestCommandHistoryFileSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	if err := ws.Settings().Set("command-history-file", "on"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	ws.CommandHistory().Add("load a.txt")
+	ws.CommandHistory().Add("show")
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".editor_history")); err != nil {
+		t.Fatalf("history file should be written: %v", err)
+	}
+
+	restored := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if command, err := restored.CommandHistory().Entry(2); err != nil || command != "show" {
+		t.Fatalf("history should be restored: %+v", restored.CommandHistory().Entries())
+	}
+}
+
+func TestCommandHistoryFileOffByDefault(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	ws.CommandHistory().Add("show")
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".editor_history")); !os.IsNotExist(err) {
+		t.Fatalf("no history file should be written by default: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/spellcheck"
+	"softwaredesign/src/workspace"
+)
+
+func newDictWorkspace(t *testing.T) (*workspace.Workspace, string) {
+	t.Helper()
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	ws.SetSpellService(spellcheck.NewService(spellcheck.NewSimpleChecker()))
+	return ws, dir
+}
+
+func writeFixture(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write fixture failed: %v", err)
+	}
+}
+
+func TestSpellCheckTextDictDirective(t *testing.T) {
+	ws, dir := newDictWorkspace(t)
+	writeFixture(t, filepath.Join(dir, "notes", "potions.dict"), "# brewing terms\nPolyjuice\n\nbezoar\n")
+	file := filepath.Join(dir, "notes", "lesson.txt")
+	writeFixture(t, file, "# dict: potions.dict\npolyjuice bezoar wolfsbane\n")
+	if _, err := ws.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	report, err := ws.SpellCheck("")
+	if err != nil {
+		t.Fatalf("spell check failed: %v", err)
+	}
+	if strings.Contains(report, "polyjuice") || strings.Contains(report, "bezoar") || strings.Contains(report, "potions") {
+		t.Fatalf("dictionary words and the directive should be accepted:\n%s", report)
+	}
+	if !strings.Contains(report, "wolfsbane") {
+		t.Fatalf("other words should still be checked:\n%s", report)
+	}
+
+	other := filepath.Join(dir, "other.txt")
+	writeFixture(t, other, "bezoar\n")
+	if _, err := ws.Load(other); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if report, _ := ws.SpellCheck(""); !strings.Contains(report, "bezoar") {
+		t.Fatalf("the dictionary should apply only to its document:\n%s", report)
+	}
+}
+
+func TestSpellCheckXMLDictDirectiveAndReload(t *testing.T) {
+	ws, dir := newDictWorkspace(t)
+	file := filepath.Join(dir, "shop.xml")
+	writeFixture(t, file, `<?xml version="1.0" encoding="UTF-8"?>
+<bookstore id="root" dict="shop.dict">
+    <book id="b1">mandrake root</book>
+</bookstore>
+`)
+	if _, err := ws.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	report, err := ws.SpellCheck("")
+	if err != nil {
+		t.Fatalf("spell check failed: %v", err)
+	}
+	if !strings.Contains(report, "警告: 词典文件不存在: "+filepath.Join(dir, "shop.dict")) || !strings.Contains(report, "mandrake") {
+		t.Fatalf("missing dictionary should warn, not fail:\n%s", report)
+	}
+	if lines := strings.Split(report, "\n"); !strings.HasPrefix(lines[1], "警告") {
+		t.Fatalf("warning belongs in the report header:\n%s", report)
+	}
+
+	writeFixture(t, filepath.Join(dir, "shop.dict"), "mandrake\n")
+	if report, _ := ws.SpellCheck(""); strings.Contains(report, "mandrake") || strings.Contains(report, "警告") {
+		t.Fatalf("dictionary created later should be picked up:\n%s", report)
+	}
+
+	writeFixture(t, file, `<?xml version="1.0" encoding="UTF-8"?>
+<bookstore id="root">
+    <book id="b1">mandrake root</book>
+</bookstore>
+`)
+	if _, err := ws.Reload(""); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if report, _ := ws.SpellCheck(""); !strings.Contains(report, "mandrake") {
+		t.Fatalf("reload should drop the removed directive:\n%s", report)
+	}
+}
@@ -0,0 +1,176 @@
+package workspace_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"softwaredesign/src/charset"
+	"softwaredesign/src/editor"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+// gbkFixture is "中文\n第二行" in GBK.
+var gbkFixture = []byte{0xD6, 0xD0, 0xCE, 0xC4, '\n', 0xB5, 0xDA, 0xB6, 0xFE, 0xD0, 0xD0}
+
+func TestGBKFileRoundTrips(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	file := filepath.Join(dir, "gbk.txt")
+	writeFixture(t, file, string(gbkFixture))
+	ed, err := ws.LoadEncoded(file, charset.GBK)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	doc := ed.(editor.TextDocument)
+	if lines := doc.Lines(); len(lines) != 2 || lines[0] != "中文" || lines[1] != "第二行" {
+		t.Fatalf("GBK content should be decoded: %q", lines)
+	}
+	if err := doc.Append("三"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ws.Save(file); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	want := append(append([]byte{}, gbkFixture...), '\n', 0xC8, 0xFD)
+	if data, _ := os.ReadFile(file); !bytes.Equal(data, want) {
+		t.Fatalf("save should write GBK: % x", data)
+	}
+	if changes, err := ws.ExternalChanges(); err != nil || len(changes) != 1 || changes[0].State != workspace.DiskUnchanged {
+		t.Fatalf("a saved GBK file should match its baseline: %+v", changes)
+	}
+	if err := doc.Append("😀"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ws.Save(file); err == nil {
+		t.Fatalf("characters outside GBK should fail to save")
+	}
+	if data, _ := os.ReadFile(file); !bytes.Equal(data, want) {
+		t.Fatalf("a failed save should leave the file alone: % x", data)
+	}
+}
+
+func TestUTF16BOMIsDetectedAndKept(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	file := filepath.Join(dir, "wide.txt")
+	fixture := []byte{0xFE, 0xFF, 0x4E, 0x2D, 0x00, '\n', 0x00, 'b'}
+	writeFixture(t, file, string(fixture))
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if enc := ed.(editor.EncodingEditor).Encoding(); enc != charset.UTF16BE {
+		t.Fatalf("the BOM should select UTF-16BE, got %s", enc)
+	}
+	if lines, _, _ := ws.SavedLines(file); len(lines) != 2 || lines[0] != "中" {
+		t.Fatalf("saved lines should be decoded: %q", lines)
+	}
+	ed.SetModified(true)
+	if err := ws.Save(file); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); !bytes.Equal(data, fixture) {
+		t.Fatalf("save should keep UTF-16BE with its BOM: % x", data)
+	}
+	if _, err := ws.LoadEncoded(file, charset.GBK); err == nil {
+		t.Fatalf("an open file should not be reopened in another encoding")
+	}
+}
+
+func TestSetEncodingConvertsOrReinterprets(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, string(gbkFixture))
+	fallback, err := ws.Load(file)
+	if err != nil || fallback.(editor.EncodingEditor).Encoding() != charset.Latin1 {
+		t.Fatalf("bytes that are not UTF-8 should open as latin1: %v", err)
+	}
+	fallback.SetModified(true)
+	if err := ws.Save(file); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); !bytes.Equal(data, gbkFixture) {
+		t.Fatalf("a latin1 save should write the bytes back unchanged: % x", data)
+	}
+	if _, err := ws.CloseWith(file, workspace.CloseDiscard); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	writeFixture(t, file, "中文")
+	if _, err := ws.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	ed, err := ws.SetEncoding(file, charset.UTF16LE, false)
+	if err != nil || !ed.IsModified() {
+		t.Fatalf("converting should mark the buffer modified: %v", err)
+	}
+	if err := ws.Save(file); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); !bytes.Equal(data, []byte{0xFF, 0xFE, 0x2D, 0x4E, 0x87, 0x65}) {
+		t.Fatalf("save should convert to UTF-16LE: % x", data)
+	}
+
+	writeFixture(t, file, string(gbkFixture))
+	if _, err := ws.Reload(file); err == nil {
+		t.Fatalf("GBK bytes should not reload as UTF-16LE")
+	}
+	ed, err = ws.SetEncoding(file, charset.GBK, true)
+	if err != nil {
+		t.Fatalf("reinterpret failed: %v", err)
+	}
+	if lines := ed.(editor.TextDocument).Lines(); lines[0] != "中文" || ed.IsModified() {
+		t.Fatalf("reinterpret should decode the disk bytes: %q", lines)
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	restored := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	reopened, err := restored.EditorByPath(file)
+	if err != nil || reopened.(editor.EncodingEditor).Encoding() != charset.GBK {
+		t.Fatalf("restore should keep the encoding: %v", err)
+	}
+}
+
+func TestXMLRequiresUTF8(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	file := filepath.Join(dir, "a.xml")
+	writeFixture(t, file, `<root id="root"/>`)
+	if _, err := ws.LoadEncoded(file, charset.GBK); err == nil || err.Error() != "XML 文件仅支持 UTF-8 编码" {
+		t.Fatalf("XML files should refuse other encodings, got %v", err)
+	}
+	if _, err := ws.LoadEncoded(file, charset.UTF8); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := ws.SetEncoding(file, charset.UTF16LE, false); err == nil {
+		t.Fatalf("XML files should not switch encoding")
+	}
+}
+
+func TestLoadSaveKeepsUTF8BOM(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "\xEF\xBB\xBFone\n")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if lines := ed.(editor.TextDocument).Lines(); lines[0] != "one" {
+		t.Fatalf("the BOM should not show in the buffer: %q", lines)
+	}
+	if err := ed.(editor.TextDocument).Append("two"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ws.Save(file); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "\xEF\xBB\xBFone\ntwo\n" {
+		t.Fatalf("save should write the BOM back: %q", data)
+	}
+}
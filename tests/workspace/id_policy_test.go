@@ -0,0 +1,67 @@
+package workspace_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestIDPolicySettingAppliesAndPersists(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	legacy := filepath.Join(dir, "legacy.xml")
+	clean := filepath.Join(dir, "clean.xml")
+	writeFixture(t, legacy, `<root id="root"><book id="Book1"/><book id="book1"/></root>`)
+	writeFixture(t, clean, `<root id="root"><book id="Book1">A</book></root>`)
+
+	if _, err := ws.Load(legacy); err != nil {
+		t.Fatalf("exact policy should load the legacy file: %v", err)
+	}
+	err := ws.Settings().Set("id-policy", "case-insensitive")
+	if err == nil || !strings.Contains(err.Error(), "Book1/book1") {
+		t.Fatalf("open legacy file should block the policy, got %v", err)
+	}
+	if ws.IDPolicy() != editor.IDExact {
+		t.Fatalf("failed setting should keep the exact policy")
+	}
+	if _, err := ws.Close(legacy); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	if err := ws.Settings().Set("id-policy", "case-insensitive"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	ed, err := ws.Load(clean)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.XMLTreeEditor).EditText("BOOK1", "B"); err != nil {
+		t.Fatalf("lookup should ignore case: %v", err)
+	}
+	if _, err := ws.Load(legacy); err == nil || !strings.Contains(err.Error(), "book1 (与 Book1 冲突)") {
+		t.Fatalf("legacy file should be rejected, got %v", err)
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	restored := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if restored.IDPolicy() != editor.IDCaseInsensitive {
+		t.Fatalf("policy should be restored, got %s", restored.IDPolicy())
+	}
+	reopened, err := restored.EditorByPath(clean)
+	if err != nil {
+		t.Fatalf("file should be reopened: %v", err)
+	}
+	if text, err := reopened.(editor.XMLTreeEditor).ElementText("book1"); err != nil || text != "A" {
+		t.Fatalf("reopened file should use the restored policy: %q, %v", text, err)
+	}
+}
@@ -0,0 +1,200 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func newJournalWorkspace(t *testing.T) (*workspace.Workspace, string) {
+	t.Helper()
+	dir := t.TempDir()
+	return workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil), dir
+}
+
+func TestUndoCloseDiscardRestoresBuffer(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	writeFixture(t, a, "one\n")
+	writeFixture(t, b, "two\n")
+	if _, err := ws.Load(b); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	ed, err := ws.Load(a)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("unsaved"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if _, err := ws.CloseWith(a, workspace.CloseDiscard); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if active, _ := ws.ActiveEditor(); active == nil || active.Path() != b {
+		t.Fatalf("closing should activate b.txt")
+	}
+
+	desc, err := ws.UndoFileOperation()
+	if err != nil || desc != "close a.txt" {
+		t.Fatalf("undo close failed: %q, %v", desc, err)
+	}
+	reopened, err := ws.ActiveEditor()
+	if err != nil || reopened != ed {
+		t.Fatalf("the closed editor should be active again")
+	}
+	if got, _ := reopened.Content(); got != "one\nunsaved" || !reopened.IsModified() {
+		t.Fatalf("unsaved changes should survive: %q", got)
+	}
+	if err := reopened.Undo(); err != nil {
+		t.Fatalf("document history should survive: %v", err)
+	}
+	if _, err := ws.UndoFileOperation(); err == nil {
+		t.Fatalf("the journal should be empty")
+	}
+}
+
+func TestUndoCloseRefusals(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	a := filepath.Join(dir, "a.txt")
+	writeFixture(t, a, "one\n")
+	if _, err := ws.Load(a); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := ws.Close(a); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	reloaded, err := ws.Load(a)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if _, err := ws.UndoFileOperation(); err == nil || !strings.Contains(err.Error(), "已重新打开") {
+		t.Fatalf("undo should refuse while the path is open, got %v", err)
+	}
+	if active, _ := ws.ActiveEditor(); active != reloaded || len(ws.FileOperations()) != 1 {
+		t.Fatalf("a refused undo should change nothing: %q", ws.FileOperations())
+	}
+
+	if _, err := ws.Close(a); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if err := os.WriteFile(a, []byte("changed\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := ws.UndoFileOperation(); err == nil || !strings.Contains(err.Error(), "已被修改") {
+		t.Fatalf("undo should refuse a stale clean buffer, got %v", err)
+	}
+	if len(ws.List()) != 0 {
+		t.Fatalf("refused undo should not reopen anything")
+	}
+}
+
+func TestUndoCloseAllAndJournalLimit(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	paths := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")}
+	for _, path := range paths {
+		writeFixture(t, path, filepath.Base(path)+"\n")
+		if _, err := ws.Load(path); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+	}
+	if err := ws.Edit(paths[1]); err != nil {
+		t.Fatalf("edit failed: %v", err)
+	}
+	if _, err := ws.CloseAll(workspace.CloseDiscard, ""); err != nil {
+		t.Fatalf("close all failed: %v", err)
+	}
+	if ops := ws.FileOperations(); len(ops) != 1 || ops[0] != "close a.txt, b.txt, c.txt" {
+		t.Fatalf("close all should be one journal entry: %q", ops)
+	}
+	if _, err := ws.UndoFileOperation(); err != nil {
+		t.Fatalf("undo close all failed: %v", err)
+	}
+	if len(ws.List()) != 3 {
+		t.Fatalf("every file should be reopened")
+	}
+	if active, _ := ws.ActiveEditor(); active.Path() != paths[1] {
+		t.Fatalf("the previously active file should be active again, got %s", active.Path())
+	}
+
+	for i := 0; i < 12; i++ {
+		if _, err := ws.Close(paths[0]); err != nil {
+			t.Fatalf("close failed: %v", err)
+		}
+		if _, err := ws.Load(paths[0]); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+	}
+	if got := len(ws.FileOperations()); got != 10 {
+		t.Fatalf("journal should keep 10 entries, got %d", got)
+	}
+}
+
+func TestUndoRenameMovesFileBack(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	old := filepath.Join(dir, "a.txt")
+	writeFixture(t, old, "one\n")
+	ed, err := ws.Load(old)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("unsaved"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	dest, err := ws.Rename(old, "sub/b.txt")
+	if err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	desc, err := ws.UndoFileOperation()
+	if err != nil || desc != "rename a.txt -> b.txt" {
+		t.Fatalf("undo rename failed: %q, %v", desc, err)
+	}
+	if ed.Path() != old || !ed.IsModified() {
+		t.Fatalf("the editor should point at the old path with its changes: %s", ed.Path())
+	}
+	if data, _ := os.ReadFile(old); string(data) != "one\n" {
+		t.Fatalf("the file should be back on disk: %q", data)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Fatalf("the renamed file should be gone: %v", err)
+	}
+	if active, _ := ws.ActiveEditor(); active != ed {
+		t.Fatalf("the editor should stay active")
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(old); string(data) != "one\nunsaved\n" {
+		t.Fatalf("save should write the old path again: %q", data)
+	}
+}
+
+func TestUndoRenameRefusesTakenPath(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	old := filepath.Join(dir, "a.txt")
+	writeFixture(t, old, "one\n")
+	if _, err := ws.Load(old); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	dest, err := ws.Rename(old, "b.txt")
+	if err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	writeFixture(t, old, "someone else\n")
+	if _, err := ws.UndoFileOperation(); err == nil || !strings.Contains(err.Error(), "已存在") {
+		t.Fatalf("undo should refuse a taken old path, got %v", err)
+	}
+	if data, _ := os.ReadFile(old); string(data) != "someone else\n" {
+		t.Fatalf("the file now at the old path should be untouched: %q", data)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Fatalf("the renamed file should stay: %v", err)
+	}
+	if ops := ws.FileOperations(); len(ops) != 1 {
+		t.Fatalf("a refused undo should stay in the journal: %q", ops)
+	}
+}
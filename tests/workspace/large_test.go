@@ -0,0 +1,182 @@
+package workspace_test
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/spellcheck"
+	"softwaredesign/src/workspace"
+)
+
+// writeSynthetic writes numbered log lines until the file reaches size bytes.
+func writeSynthetic(tb testing.TB, path string, size int) int {
+	tb.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		tb.Fatalf("create failed: %v", err)
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+	lines, written := 0, 0
+	for written < size {
+		lines++
+		n, _ := fmt.Fprintf(out, "%08d load log data content\n", lines)
+		written += n
+	}
+	if err := out.Flush(); err != nil {
+		tb.Fatalf("write failed: %v", err)
+	}
+	return lines
+}
+
+func appendFixture(t *testing.T, path, content string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+}
+
+func TestLargeFileLoadsLazilyAndPromotes(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	ws.SetSpellService(spellcheck.NewService(spellcheck.NewSimpleChecker()))
+	if err := ws.Settings().Set("large-file", "1"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	file := filepath.Join(dir, "big.log")
+	lines := writeSynthetic(t, file, 1<<20) + 1
+	appendFixture(t, file, "wrokr\n")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	large, ok := ed.(*editor.LargeTextEditor)
+	if !ok || !ws.IsLarge(file) || large.LineCount() != lines {
+		t.Fatalf("a file over the threshold should open in large-file mode: %T", ed)
+	}
+	if warning := ws.SizeWarning(); warning != "" {
+		t.Fatalf("large-file mode should not warn about size: %s", warning)
+	}
+	report, err := ws.SpellCheck(file)
+	if err != nil || !strings.Contains(report, fmt.Sprintf("第%d行，第1列", lines)) || !strings.Contains(report, "wrokr") {
+		t.Fatalf("spell-check should reach the last line: %v\n%.200s", err, report)
+	}
+	if err := ws.Save(file); err != nil {
+		t.Fatalf("saving an unchanged large file should succeed: %v", err)
+	}
+	if changes, _ := ws.ExternalChanges(); len(changes) != 1 || changes[0].State != workspace.DiskUnchanged {
+		t.Fatalf("the stat baseline should match: %+v", changes)
+	}
+
+	promoted, err := ws.Promote(file)
+	if err != nil {
+		t.Fatalf("promote failed: %v", err)
+	}
+	doc, ok := promoted.(editor.TextDocument)
+	if !ok || ws.IsLarge(file) || doc.LineCount() != lines {
+		t.Fatalf("promote should load the full text: %T", promoted)
+	}
+	if err := doc.Append("tail"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ws.Save(file); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if _, err := ws.Promote(file); err == nil {
+		t.Fatalf("promoting a full editor should fail")
+	}
+	if _, err := ws.Reload(file); err != nil || !ws.IsLarge(file) {
+		t.Fatalf("reload should index the file again: %v", err)
+	}
+}
+
+func TestLargeFileThresholdSkipsSmallFilesAndZero(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	if err := ws.Settings().Set("large-file", "1"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	small := filepath.Join(dir, "small.txt")
+	writeFixture(t, small, "one\n")
+	if _, err := ws.Load(small); err != nil || ws.IsLarge(small) {
+		t.Fatalf("a small file should load fully: %v", err)
+	}
+	if err := ws.Settings().Set("large-file", "0"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	big := filepath.Join(dir, "big.log")
+	writeSynthetic(t, big, 1<<20)
+	if _, err := ws.Load(big); err != nil || ws.IsLarge(big) {
+		t.Fatalf("0 should disable large-file mode: %v", err)
+	}
+}
+
+func benchmarkLoad(b *testing.B, largeFileMB string) {
+	dir := b.TempDir()
+	file := filepath.Join(dir, "big.log")
+	writeSynthetic(b, file, 100<<20)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+		if err := ws.Settings().Set("large-file", largeFileMB); err != nil {
+			b.Fatalf("set failed: %v", err)
+		}
+		if _, err := ws.Load(file); err != nil {
+			b.Fatalf("load failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkLoad100MBLazy indexes a synthetic 100MB file in large-file mode.
+func BenchmarkLoad100MBLazy(b *testing.B) {
+	benchmarkLoad(b, "10")
+}
+
+// BenchmarkLoad100MBFull reads the same file fully into memory.
+func BenchmarkLoad100MBFull(b *testing.B) {
+	benchmarkLoad(b, "0")
+}
+
+func TestLargeMarkdownFenceSpansChunks(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	ws.SetSpellService(spellcheck.NewService(spellcheck.NewSimpleChecker()))
+	if err := ws.Settings().Set("large-file", "1"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	// The fence opens a few lines before the first 4096-line chunk ends.
+	prose := strings.Repeat("load log data content ", 12)
+	var b strings.Builder
+	for i := 0; i < 4090; i++ {
+		b.WriteString(prose + "\n")
+	}
+	b.WriteString("```\n")
+	for i := 0; i < 10; i++ {
+		b.WriteString("wrokr\n")
+	}
+	b.WriteString("```\nqwzx\n")
+	file := filepath.Join(dir, "big.md")
+	writeFixture(t, file, b.String())
+	if _, err := ws.Load(file); err != nil || !ws.IsLarge(file) {
+		t.Fatalf("the file should open in large-file mode: %v", err)
+	}
+	report, err := ws.SpellCheck(file)
+	if err != nil {
+		t.Fatalf("spell-check failed: %v", err)
+	}
+	if strings.Contains(report, "wrokr") {
+		t.Fatalf("code inside a fence crossing a chunk should be skipped:\n%.300s", report)
+	}
+	if !strings.Contains(report, "qwzx") {
+		t.Fatalf("prose after the fence should still be checked:\n%.300s", report)
+	}
+}
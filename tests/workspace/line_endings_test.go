@@ -0,0 +1,57 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+func TestSaveKeepsLineEndings(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	crlf, mixed := filepath.Join(dir, "crlf.txt"), filepath.Join(dir, "mixed.txt")
+	writeFixture(t, crlf, "one\r\ntwo\r\n")
+	writeFixture(t, mixed, "a\r\nb\r\nc\n")
+	ed, err := ws.Load(crlf)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("three"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ws.Save(crlf); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(crlf); string(data) != "one\r\ntwo\r\nthree\r\n" {
+		t.Fatalf("save should keep CRLF and the trailing newline: %q", data)
+	}
+
+	ed, err = ws.Load(mixed)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	doc := ed.(editor.LineEndingEditor)
+	if style := doc.LineStyle(); style.Name() != "mixed" || style.Ending != editor.LineEndingCRLF {
+		t.Fatalf("mixed endings should default to the majority: %+v", style)
+	}
+	ed.SetModified(true)
+	if err := ws.Save(mixed); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(mixed); string(data) != "a\r\nb\r\nc\r\n" {
+		t.Fatalf("save should normalize to the majority ending: %q", data)
+	}
+	if doc.LineStyle().Mixed {
+		t.Fatalf("the saved file no longer has mixed endings")
+	}
+	if err := doc.ConvertLineEndings(editor.LineEndingLF); err != nil {
+		t.Fatalf("convert failed: %v", err)
+	}
+	if err := ws.Save(mixed); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(mixed); string(data) != "a\nb\nc\n" {
+		t.Fatalf("save should write the converted ending: %q", data)
+	}
+}
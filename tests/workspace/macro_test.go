@@ -0,0 +1,40 @@
+package workspace_test
+
+import (
+	"testing"
+
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestMacrosArePersisted(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	if _, _, err := ws.StopMacro(); err == nil {
+		t.Fatalf("stop without recording should fail")
+	}
+	if err := ws.StartMacro("m"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if err := ws.StartMacro("other"); err == nil {
+		t.Fatalf("only one macro can be recorded at a time")
+	}
+	ws.RecordMacroStep("append \"x\"")
+	ws.RecordMacroStep("save")
+	if name, steps, err := ws.StopMacro(); err != nil || name != "m" || steps != 2 {
+		t.Fatalf("unexpected stop result: %s %d %v", name, steps, err)
+	}
+	ws.RecordMacroStep("ignored")
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	restored := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	steps, err := restored.Macro("m")
+	if err != nil || len(steps) != 2 || steps[1] != "save" {
+		t.Fatalf("macro should be restored: %q %v", steps, err)
+	}
+}
@@ -0,0 +1,185 @@
+package workspace_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestSaveDetectsExternalChange(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "one\ntwo\n")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("three"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("an unchanged file should save: %v", err)
+	}
+	writeFixture(t, file, "ONE\ntwo\nthree\n")
+	var external *workspace.ExternalChangeError
+	if err := ws.Save(""); !errors.As(err, &external) || external.Path != file {
+		t.Fatalf("the external change should be reported, got %v", err)
+	}
+	if err := ws.Overwrite(""); err != nil {
+		t.Fatalf("overwrite failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "one\ntwo\nthree\n" {
+		t.Fatalf("overwrite should write the buffer: %q", data)
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("saving after overwrite should pass: %v", err)
+	}
+}
+
+func TestMergeExternalChanges(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "one\ntwo\nthree\n")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	doc := ed.(editor.TextDocument)
+	if err := doc.Replace(1, 1, 3, "ONE"); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	writeFixture(t, file, "one\ntwo\nthree\nfour\n")
+	conflicts, err := ws.MergeExternal(file)
+	if err != nil || conflicts != 0 {
+		t.Fatalf("merge failed: %d %v", conflicts, err)
+	}
+	if got := strings.Join(doc.Lines(), ","); got != "ONE,two,three,four" {
+		t.Fatalf("unexpected merged buffer: %q", got)
+	}
+	if !ed.IsModified() {
+		t.Fatalf("the merged buffer should stay unsaved")
+	}
+	if err := ws.Save(file); err != nil {
+		t.Fatalf("saving the merge should pass: %v", err)
+	}
+	if err := doc.Replace(2, 1, 3, "mine"); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	writeFixture(t, file, "ONE\ntheirs\nthree\nfour\n")
+	conflicts, err = ws.MergeExternal(file)
+	if err != nil || conflicts != 1 {
+		t.Fatalf("expected one conflict: %d %v", conflicts, err)
+	}
+	if got := strings.Join(doc.Lines(), ","); !strings.Contains(got, "<<<<<<< 编辑器,mine,=======,theirs,>>>>>>> 磁盘") {
+		t.Fatalf("the conflict should be marked: %q", got)
+	}
+	if err := doc.Undo(); err != nil || strings.Join(doc.Lines(), ",") != "ONE,mine,three,four" {
+		t.Fatalf("the merge should undo in one step: %v %q", err, doc.Lines())
+	}
+}
+
+func TestMergeExternalRejectsXML(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	file := filepath.Join(dir, "a.xml")
+	writeFixture(t, file, `<root id="r"></root>`)
+	if _, err := ws.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := ws.MergeExternal(file); err == nil {
+		t.Fatalf("xml merge should be refused")
+	}
+}
+
+type overwriteDecider struct{ overwrite bool }
+
+func (d overwriteDecider) ConfirmSave(string) (bool, error) { return true, nil }
+
+func (d overwriteDecider) ConfirmOverwrite(string) (bool, error) { return d.overwrite, nil }
+
+func TestExternalChangesTrackStatAndDeletion(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	writeFixture(t, a, "one\n")
+	writeFixture(t, b, "two\n")
+	for _, path := range []string{a, b} {
+		if _, err := ws.Load(path); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+	}
+	if _, err := ws.Init("text", filepath.Join(dir, "c.txt"), false); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(a, later, later); err != nil {
+		t.Fatalf("chtimes failed: %v", err)
+	}
+	if err := os.Remove(b); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	statuses, err := ws.ExternalChanges()
+	if err != nil {
+		t.Fatalf("external changes failed: %v", err)
+	}
+	want := map[string]workspace.DiskState{
+		a:                           workspace.DiskModified,
+		b:                           workspace.DiskDeleted,
+		filepath.Join(dir, "c.txt"): workspace.DiskUntracked,
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("unexpected statuses: %+v", statuses)
+	}
+	for _, status := range statuses {
+		if want[status.Path] != status.State {
+			t.Fatalf("%s: expected %s, got %s", status.Path, want[status.Path], status.State)
+		}
+	}
+
+	var external *workspace.ExternalChangeError
+	if err := ws.Save(a); !errors.As(err, &external) || external.Deleted {
+		t.Fatalf("a touched file should count as modified, got %v", err)
+	}
+	if err := ws.Save(b); !errors.As(err, &external) || !external.Deleted || !strings.Contains(err.Error(), "删除") {
+		t.Fatalf("a deleted file should be reported, got %v", err)
+	}
+	if err := ws.Overwrite(b); err != nil {
+		t.Fatalf("overwrite failed: %v", err)
+	}
+	if data, _ := os.ReadFile(b); string(data) != "two\n" {
+		t.Fatalf("overwrite should recreate the file: %q", data)
+	}
+	if statuses, _ := ws.ExternalChanges(); statuses[1].State != workspace.DiskUnchanged {
+		t.Fatalf("a saved file should be unchanged: %+v", statuses)
+	}
+}
+
+func TestCloseAsksBeforeOverwritingExternalChange(t *testing.T) {
+	for _, overwrite := range []bool{false, true} {
+		dir := t.TempDir()
+		ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), overwriteDecider{overwrite})
+		file := filepath.Join(dir, "a.txt")
+		writeFixture(t, file, "one\n")
+		ed, err := ws.Load(file)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if err := ed.(editor.TextDocument).Append("mine"); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+		writeFixture(t, file, "theirs\n")
+		_, err = ws.Close(file)
+		data, _ := os.ReadFile(file)
+		if overwrite && (err != nil || string(data) != "one\nmine\n") {
+			t.Fatalf("a confirmed overwrite should save and close: %q, %v", data, err)
+		}
+		if !overwrite && (err == nil || string(data) != "theirs\n" || len(ws.List()) != 1) {
+			t.Fatalf("a refused overwrite should keep the file open: %q, %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package workspace_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestSaveDetectsRemovedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, events.NewBus(), keeper, logging.NewManager(), nil)
+	sub := filepath.Join(dir, "notes")
+	file := filepath.Join(sub, "a.txt")
+	writeFixture(t, file, "hello\n")
+	if _, err := ws.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := ws.Init("text", "drafts/new.txt", false); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+
+	err := ws.Save(file)
+	var missing *workspace.MissingDirError
+	if !errors.As(err, &missing) || err.Error() != "目录已不存在: "+sub {
+		t.Fatalf("expected missing directory error, got %v", err)
+	}
+	if _, statErr := os.Stat(sub); !os.IsNotExist(statErr) {
+		t.Fatalf("save must not recreate the directory silently")
+	}
+	if err := ws.Save("drafts/new.txt"); err != nil {
+		t.Fatalf("a new file may still create its directory: %v", err)
+	}
+	for _, info := range ws.List() {
+		if want := info.Path == file; info.Missing != want || info.DirMissing != want {
+			t.Fatalf("unexpected markers for %s: %+v", info.Path, info)
+		}
+	}
+
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	state, err := keeper.Load()
+	if err != nil {
+		t.Fatalf("load state failed: %v", err)
+	}
+	flagged := 0
+	for _, entry := range state.Editors {
+		if entry.DirMissing {
+			flagged++
+			if entry.Path != file {
+				t.Fatalf("wrong entry flagged: %+v", entry)
+			}
+		}
+	}
+	if len(state.Editors) != 2 || flagged != 1 {
+		t.Fatalf("persist should keep and flag the entry: %+v", state.Editors)
+	}
+	restored := workspace.NewWorkspace(dir, events.NewBus(), keeper, logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	notes := restored.RestoreNotes()
+	if len(notes) != 1 || !strings.Contains(notes[0], file) || !strings.Contains(notes[0], "目录已不存在: "+sub) {
+		t.Fatalf("restore should explain the skipped file: %q", notes)
+	}
+
+	if err := ws.RecreateDir(file); err != nil {
+		t.Fatalf("recreate failed: %v", err)
+	}
+	if err := ws.Save(file); err != nil {
+		t.Fatalf("save after recreating failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "hello\n" {
+		t.Fatalf("unexpected content: %q", data)
+	}
+}
@@ -0,0 +1,124 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/spellcheck"
+	"softwaredesign/src/workspace"
+)
+
+type operationRecorder struct {
+	received []events.Event
+}
+
+func (r *operationRecorder) Handle(evt events.Event) {
+	if evt.Operation != "" {
+		r.received = append(r.received, evt)
+	}
+}
+
+func (r *operationRecorder) types() string {
+	var names []string
+	for _, evt := range r.received {
+		names = append(names, string(evt.Type))
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSaveAllPublishesOperation(t *testing.T) {
+	dir := t.TempDir()
+	bus := events.NewBus()
+	recorder := &operationRecorder{}
+	bus.Subscribe(recorder)
+	logger := logging.NewManager()
+	bus.Subscribe(logger)
+	ws := workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logger, nil)
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "sub", "b.txt")
+	writeFixture(t, a, "one\n")
+	writeFixture(t, b, "two\n")
+	for _, path := range []string{a, b} {
+		ed, err := ws.Load(path)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if err := ed.(editor.TextDocument).Append("more"); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if err := logger.Enable(a); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	if err := ws.Settings().Set("log-operations", "on"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+
+	if err := ws.SaveAll(); err != nil {
+		t.Fatalf("save all failed: %v", err)
+	}
+	want := "operation_started,operation_progress,operation_progress,operation_finished"
+	if got := recorder.types(); got != want {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	if last := recorder.received[3]; last.Done != 2 || last.Metadata["error"] != "" {
+		t.Fatalf("unexpected finish: %+v", last)
+	}
+
+	recorder.received = nil
+	if err := os.RemoveAll(filepath.Join(dir, "sub")); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if err := ws.SaveAll(); err == nil {
+		t.Fatalf("saving into a removed directory should fail")
+	}
+	if got := recorder.types(); got != "operation_started,operation_progress,operation_finished" {
+		t.Fatalf("finish should be published on error: %s", got)
+	}
+	if reason := recorder.received[2].Metadata["error"]; reason == "" {
+		t.Fatalf("finish should carry the error")
+	}
+
+	log, err := logger.Show(a)
+	if err != nil {
+		t.Fatalf("show failed: %v", err)
+	}
+	if strings.Count(log, "开始 (2 项)") != 2 || !strings.Contains(log, "完成 (2/2 项)") || !strings.Contains(log, "失败 (1/2 项)") {
+		t.Fatalf("log should hold start and finish lines:\n%s", log)
+	}
+	if got := strings.Count(log, "[save-all-"); got != 4 {
+		t.Fatalf("only start and finish should be logged, got %d lines:\n%s", got, log)
+	}
+}
+
+func TestSpellCheckAllReportsEveryFile(t *testing.T) {
+	dir := t.TempDir()
+	bus := events.NewBus()
+	recorder := &operationRecorder{}
+	bus.Subscribe(recorder)
+	ws := workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	ws.SetSpellService(spellcheck.NewService(spellcheck.NewSimpleChecker()))
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.xml")
+	writeFixture(t, a, "teh cat\n")
+	writeFixture(t, b, `<root id="root"><p id="p1">recieve</p></root>`)
+	for _, path := range []string{b, a} {
+		if _, err := ws.Load(path); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+	}
+	results, err := ws.SpellCheckAll()
+	if err != nil || len(results) != 2 {
+		t.Fatalf("spell check all failed: %v, %+v", err, results)
+	}
+	if results[0].Path != a || results[1].Path != b {
+		t.Fatalf("results should be in path order: %+v", results)
+	}
+	if got := recorder.types(); got != "operation_started,operation_progress,operation_progress,operation_finished" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+}
@@ -0,0 +1,67 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestProjectRootResolvesRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "hw")
+	if err := os.MkdirAll(filepath.Join(project, "src"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	for _, name := range []string{"notes.txt", "src/a.xml", "src/b.XML", "src/readme.md"} {
+		if err := os.WriteFile(filepath.Join(project, name), []byte("x"), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	outside := filepath.Join(dir, "outside.txt")
+	if _, err := ws.Load("outside.txt"); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := ws.SetProjectRoot("hw/notes.txt"); err == nil {
+		t.Fatalf("a file should not become the project root")
+	}
+	root, err := ws.SetProjectRoot("hw")
+	if err != nil || root != project || ws.ProjectRoot() != project {
+		t.Fatalf("unexpected root %s %v", root, err)
+	}
+	if ws.BaseDir() != dir {
+		t.Fatalf("the workspace directory should not change: %s", ws.BaseDir())
+	}
+	ed, err := ws.Load("notes.txt")
+	if err != nil || ed.Path() != filepath.Join(project, "notes.txt") {
+		t.Fatalf("relative loads should resolve in the project: %v", err)
+	}
+	if _, err := ws.EditorByPath(outside); err != nil {
+		t.Fatalf("files opened before should stay reachable by absolute path: %v", err)
+	}
+
+	files, err := ws.ProjectFiles("*.xml")
+	if err != nil || len(files) != 1 || filepath.Base(files[0]) != "a.xml" {
+		t.Fatalf("glob should match names at any depth: %v %v", files, err)
+	}
+	if files, _ := ws.ProjectFiles("SRC/"); len(files) != 3 {
+		t.Fatalf("substring matching should ignore case: %v", files)
+	}
+	if _, err := ws.ProjectFiles("["); err == nil {
+		t.Fatalf("a bad pattern should fail")
+	}
+
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	restored := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if restored.ProjectRoot() != project {
+		t.Fatalf("the project root should be restored: %s", restored.ProjectRoot())
+	}
+}
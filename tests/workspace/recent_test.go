@@ -0,0 +1,158 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestRecentListOrderingAndEviction(t *testing.T) {
+	recent := workspace.NewRecentList(3)
+	for _, path := range []string{"a", "b", "c", "a"} {
+		recent.Touch(path)
+	}
+	if got := strings.Join(recent.Paths(), ","); got != "a,c,b" {
+		t.Fatalf("touch should move to the front: %s", got)
+	}
+	recent.Touch("d")
+	if got := strings.Join(recent.Paths(), ","); got != "d,a,c" || recent.Contains("b") {
+		t.Fatalf("the oldest entry should be evicted: %s", got)
+	}
+	recent.Remove("a")
+	recent.Remove("missing")
+	if got := strings.Join(recent.Paths(), ","); got != "d,c" || recent.Len() != 2 {
+		t.Fatalf("unexpected list after removal: %s", got)
+	}
+	recent.Rename("c", "e")
+	if got := strings.Join(recent.Paths(), ","); got != "d,e" || recent.Contains("c") {
+		t.Fatalf("rename should keep the position: %s", got)
+	}
+	recent.SetLimit(1)
+	if recent.Front() != "d" || recent.Len() != 1 {
+		t.Fatalf("lowering the limit should evict: %q", recent.Paths())
+	}
+	paths := recent.Paths()
+	paths[0] = "changed"
+	if recent.Front() != "d" {
+		t.Fatalf("Paths should return a copy")
+	}
+}
+
+func TestHistorySurvivesRestore(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	var paths []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(dir, name)
+		writeFixture(t, path, name+"\n")
+		paths = append(paths, path)
+	}
+	for _, path := range []string{paths[2], paths[0], paths[1], paths[0]} {
+		if _, err := ws.Load(path); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+	}
+	want := []string{paths[0], paths[1], paths[2]}
+	if got := ws.History(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected history: %q", got)
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	restored := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if got := restored.History(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("history should survive restore: %q", got)
+	}
+	if _, err := restored.Close(""); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if active, _ := restored.ActiveEditor(); active == nil || active.Path() != paths[1] {
+		t.Fatalf("closing should activate the previous file")
+	}
+}
+
+func TestRecentLimitSetting(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	if err := ws.Settings().Set("recent-limit", "0"); err == nil {
+		t.Fatalf("a zero limit should be refused")
+	}
+	if err := ws.Settings().Set("recent-limit", "2"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeFixture(t, filepath.Join(dir, name), "x\n")
+		if _, err := ws.Load(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+	}
+	if got := ws.History(); len(got) != 2 || got[0] != filepath.Join(dir, "c.txt") {
+		t.Fatalf("history should be capped: %q", got)
+	}
+	// Files beyond the cap are still open and take over when the rest close.
+	for i := 0; i < 2; i++ {
+		if _, err := ws.Close(""); err != nil {
+			t.Fatalf("close failed: %v", err)
+		}
+	}
+	if active, _ := ws.ActiveEditor(); active == nil || active.Path() != filepath.Join(dir, "a.txt") {
+		t.Fatalf("the evicted open file should become active")
+	}
+}
+
+func TestClosedFilesPersistAndSkipMissing(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	paths := map[string]string{}
+	for _, name := range []string{"a.txt", "b.txt", "gone.txt"} {
+		paths[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[name], []byte(name), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	for _, name := range []string{"a.txt", "b.txt", "a.txt", "gone.txt"} {
+		if _, err := ws.Load(paths[name]); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if _, err := ws.CloseWith(paths[name], workspace.CloseDiscard); err != nil {
+			t.Fatalf("close failed: %v", err)
+		}
+	}
+	if err := os.Remove(paths["gone.txt"]); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, err := ws.Load(paths["b.txt"]); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := strings.Join(ws.ClosedFiles(), ","); got != paths["a.txt"] {
+		t.Fatalf("open and missing files should be left out: %s", got)
+	}
+	if _, err := ws.CloseWith(paths["b.txt"], workspace.CloseDiscard); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	restored := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if got := strings.Join(restored.ClosedFiles(), ","); got != paths["b.txt"]+","+paths["a.txt"] {
+		t.Fatalf("closed files should be restored most recent first: %s", got)
+	}
+	if path, err := restored.ClosedFile(2); err != nil || path != paths["a.txt"] {
+		t.Fatalf("entry 2 should be a.txt: %s %v", path, err)
+	}
+	if _, err := restored.ClosedFile(3); err == nil {
+		t.Fatalf("an out of range entry should fail")
+	}
+}
@@ -0,0 +1,86 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestRenameMovesFileAndLog(t *testing.T) {
+	dir := t.TempDir()
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, workspace.NewStateKeeper(dir), logger, nil)
+	old := filepath.Join(dir, "a.txt")
+	writeFixture(t, old, "one\n")
+	ed, err := ws.Load(old)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := logger.Enable(old); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("two"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	dest, err := ws.Rename(old, "moved/deeper/b.txt")
+	if err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if dest != filepath.Join(dir, "moved", "deeper", "b.txt") || ed.Path() != dest {
+		t.Fatalf("the editor should follow the file: %s", ed.Path())
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("the old file should be gone: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "one\n" {
+		t.Fatalf("rename should not save the buffer: %q", data)
+	}
+	if !ed.IsModified() {
+		t.Fatalf("unsaved changes should stay in the buffer")
+	}
+	logPath, _ := logging.LogFilePath(dest)
+	if data, err := os.ReadFile(logPath); err != nil || strings.Count(string(data), "session start") != 1 {
+		t.Fatalf("the log should move with the file: %q %v", data, err)
+	}
+	if !logger.Enabled(dest) {
+		t.Fatalf("logging should stay on for the new path")
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save after rename failed: %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "one\ntwo\n" {
+		t.Fatalf("save should write the new path: %q", data)
+	}
+}
+
+func TestRenameUnsavedBufferAndRefusals(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	if _, err := ws.Init("text", "b.txt", false); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	ed, err := ws.Init("text", "a.txt", false)
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if _, err := ws.Rename("a.txt", "b.txt"); err == nil || !strings.Contains(err.Error(), "已打开") {
+		t.Fatalf("renaming onto an open file should fail, got %v", err)
+	}
+	dest, err := ws.Rename("a.txt", "c.txt")
+	if err != nil {
+		t.Fatalf("renaming an unsaved buffer failed: %v", err)
+	}
+	if ed.Path() != dest {
+		t.Fatalf("the buffer should be renamed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c.txt")); !os.IsNotExist(err) {
+		t.Fatalf("renaming an unsaved buffer should not write it")
+	}
+	if _, err := ws.EditorByPath("a.txt"); err == nil {
+		t.Fatalf("the old name should no longer be open")
+	}
+}
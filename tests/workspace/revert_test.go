@@ -0,0 +1,79 @@
+package workspace_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/editor"
+)
+
+func TestRevertDiscardsEditsAndHistory(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "one\ntwo\n")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	doc := ed.(editor.TextDocument)
+	for _, text := range []string{"three", "four"} {
+		if err := doc.Append(text); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if err := doc.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if err := doc.Replace(1, 1, 3, "ONE"); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	reverted, err := ws.Revert("")
+	if err != nil {
+		t.Fatalf("revert failed: %v", err)
+	}
+	got := reverted.(editor.TextDocument)
+	if strings.Join(got.Lines(), ",") != "one,two" || reverted.IsModified() {
+		t.Fatalf("revert should restore the saved content: %q modified=%v", got.Lines(), reverted.IsModified())
+	}
+	if reverted.UndoDepth() != 0 || reverted.RedoDepth() != 0 {
+		t.Fatalf("revert should clear history: undo=%d redo=%d", reverted.UndoDepth(), reverted.RedoDepth())
+	}
+	if current, _ := ws.ActiveEditor(); current != reverted {
+		t.Fatalf("the reverted editor should replace the old one")
+	}
+}
+
+func TestRevertResetsInitBuffers(t *testing.T) {
+	ws, _ := newJournalWorkspace(t)
+	ed, err := ws.Init("text", "notes.txt", true)
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("draft"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	reverted, err := ws.Revert(ed.Path())
+	if err != nil {
+		t.Fatalf("revert failed: %v", err)
+	}
+	if lines := reverted.(editor.TextDocument).Lines(); len(lines) != 1 || lines[0] != "# log" {
+		t.Fatalf("an init buffer should reset to its initial content: %q", lines)
+	}
+
+	xml, err := ws.Init("xml", "tree.xml", false)
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	initial, _ := xml.Content()
+	if err := xml.(editor.XMLTreeEditor).AppendChild("item", "c1", "root", nil); err != nil {
+		t.Fatalf("append-child failed: %v", err)
+	}
+	reverted, err = ws.Revert("")
+	if err != nil {
+		t.Fatalf("revert failed: %v", err)
+	}
+	if content, _ := reverted.Content(); content != initial || reverted.UndoDepth() != 0 {
+		t.Fatalf("an xml buffer should reset to the default document: %q", content)
+	}
+}
@@ -0,0 +1,137 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestSaveAsRebindsEditor(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	logger := logging.NewManager()
+	ws := workspace.NewWorkspace(dir, nil, keeper, logger, nil)
+	old := filepath.Join(dir, "a.txt")
+	writeFixture(t, old, "one\n")
+	ed, err := ws.Load(old)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := logger.Enable(old); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("two"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	dest, err := ws.SaveAs("sub/b.txt")
+	if err != nil {
+		t.Fatalf("save-as failed: %v", err)
+	}
+	if dest != filepath.Join(dir, "sub", "b.txt") || ed.Path() != dest || ed.IsModified() {
+		t.Fatalf("the editor should be bound to the new file: %s modified=%v", ed.Path(), ed.IsModified())
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "one\ntwo\n" {
+		t.Fatalf("unexpected new file: %q", data)
+	}
+	if data, _ := os.ReadFile(old); string(data) != "one\n" {
+		t.Fatalf("the old file should be untouched: %q", data)
+	}
+	if active, _ := ws.ActiveEditor(); active != ed {
+		t.Fatalf("the renamed editor should stay active")
+	}
+	if _, err := ws.EditorByPath(old); err == nil {
+		t.Fatalf("the old path should no longer be open")
+	}
+	if !logger.Enabled(dest) || logger.Enabled(old) {
+		t.Fatalf("logging should follow the editor")
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	state, _ := keeper.Load()
+	if len(state.Editors) != 1 || state.Editors[0].Path != dest || state.Active != dest {
+		t.Fatalf("the state should record the new path: %+v", state)
+	}
+	if len(state.Logging) != 1 || state.Logging[0] != dest {
+		t.Fatalf("the state should record logging for the new path: %q", state.Logging)
+	}
+}
+
+func TestSaveAsRefusals(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	writeFixture(t, filepath.Join(dir, "exists.txt"), "x\n")
+	if _, err := ws.Init("text", "b.txt", false); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if _, err := ws.Init("text", "a.txt", false); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	for _, target := range []string{"b.txt", "exists.txt", "a.xml"} {
+		if _, err := ws.SaveAs(target); err == nil {
+			t.Fatalf("save-as %s should be refused", target)
+		}
+	}
+	if _, err := ws.Init("xml", "tree.xml", false); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if _, err := ws.SaveAs("tree.txt"); err == nil {
+		t.Fatalf("an xml editor should not be saved as text")
+	}
+	dest, err := ws.SaveAs("copy.xml")
+	if err != nil {
+		t.Fatalf("save-as failed: %v", err)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Fatalf("the xml file should be written: %v", err)
+	}
+}
+
+func TestUndoSaveAsPointsEditorBack(t *testing.T) {
+	ws, dir := newJournalWorkspace(t)
+	old := filepath.Join(dir, "a.txt")
+	writeFixture(t, old, "one\n")
+	ed, err := ws.Load(old)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("two"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	dest, err := ws.SaveAs("b.txt")
+	if err != nil {
+		t.Fatalf("save-as failed: %v", err)
+	}
+	desc, err := ws.UndoFileOperation()
+	if err != nil || desc != "save-as a.txt -> b.txt" {
+		t.Fatalf("undo save-as failed: %q, %v", desc, err)
+	}
+	if ed.Path() != old || !ed.IsModified() {
+		t.Fatalf("the editor should be back on a.txt with its changes unsaved: %s", ed.Path())
+	}
+	if _, err := ws.EditorByPath(dest); err == nil {
+		t.Fatalf("b.txt should no longer be open")
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "one\ntwo\n" {
+		t.Fatalf("the file written by save-as should stay: %q", data)
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(old); string(data) != "one\ntwo\n" {
+		t.Fatalf("save should write a.txt again: %q", data)
+	}
+
+	if _, err := ws.SaveAs("c.txt"); err != nil {
+		t.Fatalf("save-as failed: %v", err)
+	}
+	if _, err := ws.Load(old); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := ws.UndoFileOperation(); err == nil {
+		t.Fatalf("undo should refuse while the old path is open again")
+	}
+}
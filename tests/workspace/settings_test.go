@@ -0,0 +1,148 @@
+package workspace_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestSettingsParseAndNormalize(t *testing.T) {
+	settings := workspace.NewSettings()
+	defs := []workspace.SettingDef{
+		{Name: "flag", Kind: workspace.SettingBool, Default: "off"},
+		{Name: "limit", Kind: workspace.SettingInt, Default: "100"},
+		{Name: "mode", Kind: workspace.SettingOctal, Default: "644"},
+		{Name: "level", Kind: workspace.SettingEnum, Default: "info", Options: []string{"debug", "info"}},
+	}
+	for _, def := range defs {
+		if err := settings.Register(def); err != nil {
+			t.Fatalf("register %s failed: %v", def.Name, err)
+		}
+	}
+	cases := []struct{ name, input, want string }{
+		{"flag", "TRUE", "on"},
+		{"limit", " 42 ", "42"},
+		{"mode", "0600", "0600"},
+		{"level", "DEBUG", "debug"},
+	}
+	for _, c := range cases {
+		if err := settings.Set(c.name, c.input); err != nil {
+			t.Fatalf("set %s=%s failed: %v", c.name, c.input, err)
+		}
+		if got, _ := settings.Get(c.name); got != c.want {
+			t.Fatalf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+	if !settings.Bool("flag") || settings.Int("limit") != 42 {
+		t.Fatalf("typed accessors disagree with stored values")
+	}
+	views := settings.List()
+	if len(views) != 4 || views[0].Name != "flag" || views[0].Source != workspace.SourceUser {
+		t.Fatalf("unexpected listing: %+v", views)
+	}
+}
+
+func TestSettingsRejectInvalidValues(t *testing.T) {
+	settings := workspace.NewSettings()
+	settings.Register(workspace.SettingDef{Name: "flag", Kind: workspace.SettingBool, Default: "off"})
+	settings.Register(workspace.SettingDef{Name: "level", Kind: workspace.SettingEnum, Default: "info", Options: []string{"info"}})
+	settings.Register(workspace.SettingDef{
+		Name: "width", Kind: workspace.SettingInt, Default: "80",
+		Validate: func(value string) error {
+			if value == "0" {
+				return errors.New("不能为 0")
+			}
+			return nil
+		},
+	})
+
+	if err := settings.Set("missing", "1"); err == nil || !strings.Contains(err.Error(), "未知设置项") {
+		t.Fatalf("expected unknown setting error, got %v", err)
+	}
+	if _, err := settings.Get("missing"); err == nil {
+		t.Fatalf("get of unknown setting should fail")
+	}
+	for name, value := range map[string]string{"flag": "maybe", "level": "trace", "width": "0"} {
+		if err := settings.Set(name, value); err == nil || !strings.Contains(err.Error(), name) {
+			t.Fatalf("expected error naming %s for %q, got %v", name, value, err)
+		}
+	}
+	if got, _ := settings.Get("width"); got != "80" {
+		t.Fatalf("invalid value must not be stored, got %s", got)
+	}
+	if err := settings.Register(workspace.SettingDef{Name: "bad", Kind: workspace.SettingInt, Default: "x"}); err == nil {
+		t.Fatalf("invalid default should be rejected")
+	}
+}
+
+func TestSettingsChangeNotification(t *testing.T) {
+	settings := workspace.NewSettings()
+	settings.Register(workspace.SettingDef{Name: "limit", Kind: workspace.SettingInt, Default: "10"})
+	var seen []string
+	settings.OnChange("limit", func(value string) error {
+		seen = append(seen, value)
+		if value == "13" {
+			return errors.New("unlucky")
+		}
+		return nil
+	})
+	if err := settings.Set("limit", "20"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := settings.Set("limit", "13"); err == nil {
+		t.Fatalf("hook error should fail the change")
+	}
+	if got, _ := settings.Get("limit"); got != "20" {
+		t.Fatalf("failed change should keep previous value, got %s", got)
+	}
+	want := []string{"20", "13", "20"}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected notifications: %v", seen)
+	}
+}
+
+func TestWorkspaceSettingsPersistAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, events.NewBus(), keeper, logging.NewManager(), nil)
+	settings := ws.Settings()
+	if err := settings.Set("file-mode", "600"); err != nil {
+		t.Fatalf("set file-mode failed: %v", err)
+	}
+	if err := settings.Set("close-policy", "discard"); err != nil {
+		t.Fatalf("set close-policy failed: %v", err)
+	}
+	if ws.FileMode() != 0o600 || ws.ClosePolicy() != workspace.ClosePolicyDiscard {
+		t.Fatalf("hooks did not reach the workspace")
+	}
+	if err := settings.Set("size-thresholds", "10,abc"); err == nil {
+		t.Fatalf("expected invalid thresholds to be rejected")
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	state, err := keeper.Load()
+	if err != nil {
+		t.Fatalf("load state failed: %v", err)
+	}
+	if len(state.Settings) != 2 || state.Settings["file-mode"] != "0600" {
+		t.Fatalf("only changed settings should persist: %+v", state.Settings)
+	}
+
+	restored := workspace.NewWorkspace(dir, events.NewBus(), keeper, logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if restored.FileMode() != 0o600 || restored.ClosePolicy() != workspace.ClosePolicyDiscard {
+		t.Fatalf("restored workspace did not apply saved settings")
+	}
+	for _, view := range restored.Settings().List() {
+		if view.Name == "file-mode" && view.Source != workspace.SourceState {
+			t.Fatalf("restored setting should report state source: %+v", view)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+func TestDoctorStateReportsAndFixes(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	a, gone := filepath.Join(dir, "a.txt"), filepath.Join(dir, "gone.txt")
+	writeFixture(t, a, "one\n")
+	upper := filepath.Join(dir, "A.TXT")
+	corrupt := workspace.WorkspaceState{
+		Editors: []workspace.EditorState{
+			{Path: a, Bookmarks: []workspace.BookmarkState{
+				{Name: "ok", Line: 1, Col: 1},
+				{Name: "ok", Line: 1, Col: 2},
+				{Name: "bad", Line: 0, Col: 1},
+			}},
+			{Path: upper, Modified: true},
+			{Path: gone},
+			{Path: filepath.Join(dir, "nodir", "b.txt"), DirMissing: true},
+		},
+		Active:   gone,
+		Recent:   []string{gone, a, a},
+		Logging:  []string{a, a, gone},
+		LogOff:   []string{gone},
+		Settings: map[string]string{"undo-limit": "abc", "no-such": "1", "undo-coalesce": "on"},
+	}
+	if err := keeper.Save(corrupt); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+
+	report, err := ws.DoctorState(false)
+	if err != nil {
+		t.Fatalf("doctor failed: %v", err)
+	}
+	checks := map[string]int{}
+	for _, issue := range report.Issues {
+		checks[issue.Check]++
+	}
+	want := map[string]int{"duplicate-editor": 1, "missing-file": 2, "active": 1, "logging": 3, "bookmark": 2, "setting": 2, "recent": 2}
+	for name, count := range want {
+		if checks[name] != count {
+			t.Fatalf("check %s reported %d issues, want %d: %+v", name, checks[name], count, report.Issues)
+		}
+	}
+	if unchanged, _ := keeper.Load(); len(unchanged.Editors) != 4 {
+		t.Fatalf("a dry run should not write the state")
+	}
+
+	report, err = ws.DoctorState(true)
+	if err != nil {
+		t.Fatalf("fix failed: %v", err)
+	}
+	if data, err := os.ReadFile(report.Backup); err != nil || !strings.Contains(string(data), "gone.txt") {
+		t.Fatalf("the backup should hold the original state: %v", err)
+	}
+	fixed, err := keeper.Load()
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(fixed.Editors) != 1 || fixed.Editors[0].Path != a || !fixed.Editors[0].Modified {
+		t.Fatalf("unexpected editors: %+v", fixed.Editors)
+	}
+	if marks := fixed.Editors[0].Bookmarks; len(marks) != 1 || marks[0].Col != 1 {
+		t.Fatalf("unexpected bookmarks: %+v", marks)
+	}
+	if len(fixed.Recent) != 1 || fixed.Recent[0] != a {
+		t.Fatalf("unexpected recent files: %q", fixed.Recent)
+	}
+	if fixed.Active != "" || len(fixed.Logging) != 1 || len(fixed.LogOff) != 0 {
+		t.Fatalf("unexpected active or logging: %+v", fixed)
+	}
+	if len(fixed.Settings) != 1 || fixed.Settings["undo-coalesce"] != "on" {
+		t.Fatalf("unexpected settings: %+v", fixed.Settings)
+	}
+
+	report, err = ws.DoctorState(false)
+	if err != nil || len(report.Issues) != 0 {
+		t.Fatalf("the fixed state should be clean: %+v %v", report.Issues, err)
+	}
+}
+
+func TestDoctorStateActiveCasing(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	a := filepath.Join(dir, "a.txt")
+	writeFixture(t, a, "one\n")
+	if err := keeper.Save(workspace.WorkspaceState{Editors: []workspace.EditorState{{Path: a}}, Active: filepath.Join(dir, "A.txt")}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	if _, err := ws.DoctorState(true); err != nil {
+		t.Fatalf("fix failed: %v", err)
+	}
+	if fixed, _ := keeper.Load(); fixed.Active != a {
+		t.Fatalf("the active path should match its editor entry: %q", fixed.Active)
+	}
+}
+
+func TestDoctorStateWithoutStateFile(t *testing.T) {
+	ws, _ := newJournalWorkspace(t)
+	if _, err := ws.DoctorState(false); err == nil {
+		t.Fatalf("a missing state file should be reported")
+	}
+}
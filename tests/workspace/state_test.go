@@ -1,8 +1,15 @@
 package workspace_test
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"softwaredesign/src/editor"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/version"
 	"softwaredesign/src/workspace"
 )
 
@@ -50,3 +57,134 @@ func TestStateKeeperEmptyState(t *testing.T) {
 	}
 }
 
+func TestPersistEmbedsVersion(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	state, err := keeper.Load()
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if state.Version != version.Get().Version {
+		t.Fatalf("state should record the writing version, got %q", state.Version)
+	}
+}
+
+func TestActivitySurvivesRestore(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	ed, err := ws.Init("text", "a.txt", false)
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	ws.PublishCommand("append", `append "x"`, ed.Path())
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	restored := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	rows := restored.Activity()
+	if len(rows) != 1 || rows[0].File != ed.Path() || rows[0].Commands != 1 || rows[0].Saves != 1 {
+		t.Fatalf("activity should be restored: %+v", rows)
+	}
+}
+
+func TestBookmarksSurviveRestore(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("one\ntwo\nthree"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	doc := ed.(editor.TextDocument)
+	if err := doc.SetMark("second", 2, 3); err != nil {
+		t.Fatalf("set mark failed: %v", err)
+	}
+	if err := doc.SetMark("last", 3, 6); err != nil {
+		t.Fatalf("set mark failed: %v", err)
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("one\ntwo"), 0o644); err != nil {
+		t.Fatalf("rewrite failed: %v", err)
+	}
+
+	restored := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	reopened, err := restored.EditorByPath(file)
+	if err != nil {
+		t.Fatalf("file should be reopened: %v", err)
+	}
+	marks := reopened.(editor.TextDocument).Marks()
+	if len(marks) != 1 || marks[0] != (editor.Bookmark{Name: "second", Line: 2, Col: 3}) {
+		t.Fatalf("unexpected restored marks: %+v", marks)
+	}
+	if notes := restored.RestoreNotes(); len(notes) != 1 || !strings.Contains(notes[0], "书签 last") {
+		t.Fatalf("the stale mark should be reported: %q", notes)
+	}
+}
+
+func TestReadOnlySurvivesReloadAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	keeper := workspace.NewStateKeeper(dir)
+	ws := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	locked, open := filepath.Join(dir, "locked.xml"), filepath.Join(dir, "open.txt")
+	if err := os.WriteFile(locked, []byte(`<root id="root"/>`), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := os.WriteFile(open, []byte("one"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := ws.Load(open); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	ed, err := ws.Load(locked)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	ed.SetReadOnly(true)
+	ed.SetModified(true)
+	if err := ws.Save(locked); !errors.Is(err, editor.ErrReadOnly) || err.Error() != "文件为只读模式" {
+		t.Fatalf("saving a read-only file should be refused, got %v", err)
+	}
+	reloaded, err := ws.Reload(locked)
+	if err == nil || reloaded != nil {
+		t.Fatalf("a modified buffer should not reload")
+	}
+	ed.SetModified(false)
+	if reloaded, err = ws.Reload(locked); err != nil || !reloaded.IsReadOnly() {
+		t.Fatalf("reload should keep the read-only flag: %v", err)
+	}
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	restored := workspace.NewWorkspace(dir, nil, keeper, logging.NewManager(), nil)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	for path, want := range map[string]bool{locked: true, open: false} {
+		reopened, err := restored.EditorByPath(path)
+		if err != nil || reopened.IsReadOnly() != want {
+			t.Fatalf("%s: read-only should be %v after restore: %v", path, want, err)
+		}
+	}
+}
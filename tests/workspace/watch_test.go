@@ -0,0 +1,164 @@
+package workspace_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"softwaredesign/src/editor"
+	"softwaredesign/src/events"
+	"softwaredesign/src/logging"
+	"softwaredesign/src/workspace"
+)
+
+type diskEvents chan events.Event
+
+func (d diskEvents) Handle(evt events.Event) {
+	if evt.Type == events.EventFileChangedOnDisk {
+		d <- evt
+	}
+}
+
+// watchTicker is a manualTicker that reports when the watcher has handled
+// each tick.
+type watchTicker struct {
+	manualTicker
+	handled chan struct{}
+}
+
+func (w *watchTicker) Handled() { w.handled <- struct{}{} }
+
+func newWatchWorkspace(t *testing.T) (*workspace.Workspace, *watchTicker, diskEvents, string) {
+	t.Helper()
+	dir := t.TempDir()
+	bus := events.NewBus()
+	changed := make(diskEvents, 10)
+	bus.Subscribe(changed)
+	ws := workspace.NewWorkspace(dir, bus, workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	ticker := &watchTicker{
+		manualTicker: manualTicker{ch: make(chan time.Time), stopped: make(chan struct{})},
+		handled:      make(chan struct{}, 1),
+	}
+	ws.SetTickerFactory(func(time.Duration) workspace.Ticker { return ticker })
+	return ws, ticker, changed, dir
+}
+
+// tick delivers a tick and waits until the watcher has handled it.
+func tick(ticker *watchTicker) {
+	ticker.ch <- time.Now()
+	<-ticker.handled
+}
+
+func drainDiskEvents(changed diskEvents) []events.Event {
+	var result []events.Event
+	for {
+		select {
+		case evt := <-changed:
+			result = append(result, evt)
+		default:
+			return result
+		}
+	}
+}
+
+func TestWatchReportsChangedUnmodifiedFiles(t *testing.T) {
+	ws, ticker, changed, dir := newWatchWorkspace(t)
+	clean, dirty := filepath.Join(dir, "clean.txt"), filepath.Join(dir, "dirty.txt")
+	writeFixture(t, clean, "one\n")
+	writeFixture(t, dirty, "two\n")
+	if _, err := ws.Load(clean); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	ed, err := ws.Load(dirty)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("mine"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if _, on := ws.WatchInterval(); on {
+		t.Fatalf("watching should be off by default")
+	}
+	if err := ws.StartWatch(0); err == nil {
+		t.Fatalf("a zero interval should be refused")
+	}
+	if err := ws.StartWatch(time.Second); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	tick(ticker)
+	if got := drainDiskEvents(changed); len(got) != 0 {
+		t.Fatalf("unchanged files should not be reported: %+v", got)
+	}
+
+	writeFixture(t, clean, "changed elsewhere\n")
+	writeFixture(t, dirty, "changed elsewhere\n")
+	tick(ticker)
+	got := drainDiskEvents(changed)
+	if len(got) != 1 || got[0].File != clean || got[0].Metadata["state"] != "modified" {
+		t.Fatalf("only the unmodified file should be reported: %+v", got)
+	}
+	tick(ticker)
+	if got := drainDiskEvents(changed); len(got) != 0 {
+		t.Fatalf("a change should be reported once: %+v", got)
+	}
+	ws.Lock()
+	content, _ := ed.Content()
+	ws.Unlock()
+	if content != "two\nmine" {
+		t.Fatalf("a modified buffer must not be reloaded: %q", content)
+	}
+
+	if err := os.Remove(clean); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	tick(ticker)
+	if got := drainDiskEvents(changed); len(got) != 1 || got[0].Metadata["state"] != "deleted" {
+		t.Fatalf("the deletion should be reported: %+v", got)
+	}
+
+	if err := ws.Persist(); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	select {
+	case <-ticker.stopped:
+	default:
+		t.Fatalf("persist should stop the watcher")
+	}
+	if _, on := ws.WatchInterval(); on {
+		t.Fatalf("watching should be off after persist")
+	}
+}
+
+func TestWatchReportsAgainAfterReload(t *testing.T) {
+	ws, ticker, changed, dir := newWatchWorkspace(t)
+	file := filepath.Join(dir, "a.txt")
+	writeFixture(t, file, "one\n")
+	if _, err := ws.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ws.StartWatch(time.Second); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer ws.StopWatch()
+	writeFixture(t, file, "two\n")
+	tick(ticker)
+	if got := drainDiskEvents(changed); len(got) != 1 {
+		t.Fatalf("the change should be reported: %+v", got)
+	}
+	ws.Lock()
+	_, err := ws.Reload(file)
+	ws.Unlock()
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	tick(ticker)
+	if got := drainDiskEvents(changed); len(got) != 0 {
+		t.Fatalf("a reloaded file is up to date: %+v", got)
+	}
+	writeFixture(t, file, "three and more\n")
+	tick(ticker)
+	if got := drainDiskEvents(changed); len(got) != 1 {
+		t.Fatalf("a later change should be reported again: %+v", got)
+	}
+}
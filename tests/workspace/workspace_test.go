@@ -1,10 +1,17 @@
 package workspace_test
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
 
+	"softwaredesign/src/cli"
 	"softwaredesign/src/editor"
 	"softwaredesign/src/events"
 	"softwaredesign/src/logging"
@@ -117,10 +124,435 @@ func TestWorkspaceClose(t *testing.T) {
 		t.Fatalf("active editor should exist")
 	}
 
-	if err := ws.Close(""); err != nil {
+	if _, err := ws.Close(""); err != nil {
 		t.Fatalf("close failed: %v", err)
 	}
 	if _, err := ws.ActiveEditor(); err == nil {
 		t.Fatalf("active editor should be nil after close")
 	}
 }
+
+func TestWorkspaceSavePreservesFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("chmod is not meaningful on windows")
+	}
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+
+	file := filepath.Join(dir, "script.sh")
+	if err := os.WriteFile(file, []byte("echo hi"), 0o644); err != nil {
+		t.Fatalf("write fixture failed: %v", err)
+	}
+	if err := os.Chmod(file, 0o751); err != nil {
+		t.Fatalf("chmod failed: %v", err)
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0o751 {
+		t.Skip("filesystem ignores chmod")
+	}
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("echo bye"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o751 {
+		t.Fatalf("mode not preserved: %o", info.Mode().Perm())
+	}
+
+	if err := ws.SetFileMode(0o600); err != nil {
+		t.Fatalf("set file mode failed: %v", err)
+	}
+	fresh := filepath.Join(dir, "fresh.txt")
+	if _, err := ws.Load(fresh); err != nil {
+		t.Fatalf("load new file failed: %v", err)
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save new file failed: %v", err)
+	}
+	info, err = os.Stat(fresh)
+	if err != nil {
+		t.Fatalf("stat new file failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("configured mode not applied: %o", info.Mode().Perm())
+	}
+}
+
+func TestWorkspaceCloseWithExhaustedInput(t *testing.T) {
+	cases := []struct {
+		policy    workspace.ClosePolicy
+		wantErr   bool
+		wantSaved bool
+	}{
+		{workspace.ClosePolicyAsk, true, false},
+		{workspace.ClosePolicySave, false, true},
+		{workspace.ClosePolicyDiscard, false, false},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			dir := t.TempDir()
+			console := cli.NewConsole(bytes.NewBufferString(""), bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+			ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), console)
+			ws.SetClosePolicy(tc.policy)
+
+			file := filepath.Join(dir, "draft.txt")
+			if _, err := ws.Load(file); err != nil {
+				t.Fatalf("load failed: %v", err)
+			}
+			_, err := ws.Close("")
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), file) {
+					t.Fatalf("expected error naming the file, got %v", err)
+				}
+				if _, activeErr := ws.ActiveEditor(); activeErr != nil {
+					t.Fatalf("editor should stay open after failed close")
+				}
+			} else if err != nil {
+				t.Fatalf("close failed: %v", err)
+			}
+			_, statErr := os.Stat(file)
+			if saved := statErr == nil; saved != tc.wantSaved {
+				t.Fatalf("saved=%v, want %v", saved, tc.wantSaved)
+			}
+		})
+	}
+}
+
+type failingDecider struct {
+	t *testing.T
+}
+
+func (d failingDecider) ConfirmSave(path string) (bool, error) {
+	d.t.Fatalf("decider consulted for %s", path)
+	return false, nil
+}
+
+func TestWorkspaceCloseDispositionBypassesDecider(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), failingDecider{t})
+
+	saved := filepath.Join(dir, "saved.txt")
+	discarded := filepath.Join(dir, "discarded.txt")
+	for _, file := range []string{saved, discarded} {
+		ed, err := ws.Load(file)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if err := ed.(editor.TextDocument).Append("draft"); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if _, err := ws.CloseWith(saved, workspace.CloseSave); err != nil {
+		t.Fatalf("close --save failed: %v", err)
+	}
+	if data, err := os.ReadFile(saved); err != nil || string(data) != "draft" {
+		t.Fatalf("saved content = %q, %v", data, err)
+	}
+	if _, err := ws.CloseWith(discarded, workspace.CloseDiscard); err != nil {
+		t.Fatalf("close --discard failed: %v", err)
+	}
+	if _, err := os.Stat(discarded); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("discarded file should not be written: %v", err)
+	}
+	if len(ws.List()) != 0 {
+		t.Fatalf("editors left open: %+v", ws.List())
+	}
+}
+
+func TestWorkspaceCloseAll(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), failingDecider{t})
+	for _, name := range []string{"b.txt", "a.txt"} {
+		ed, err := ws.Load(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if err := ed.(editor.TextDocument).Append(name); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	results, err := ws.CloseAll(workspace.CloseSave, "")
+	if err != nil {
+		t.Fatalf("close all failed: %v", err)
+	}
+	if len(results) != 2 || filepath.Base(results[0].Closed) != "a.txt" || results[1].Active != "" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != name {
+			t.Fatalf("%s content = %q, %v", name, data, err)
+		}
+	}
+}
+
+func TestWorkspaceSizeWarningOncePerThreshold(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	ws.SetSizeThresholds([]int{10, 20})
+	ed, err := ws.Load(filepath.Join(dir, "big.txt"))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	doc := ed.(editor.TextDocument)
+	doc.Append("0123456789ab")
+	if warning := ws.SizeWarning(); warning == "" {
+		t.Fatalf("expected warning after crossing first threshold")
+	}
+	doc.Append("x")
+	if warning := ws.SizeWarning(); warning != "" {
+		t.Fatalf("warning should be one-time, got %q", warning)
+	}
+	doc.Append("0123456789")
+	if warning := ws.SizeWarning(); warning == "" {
+		t.Fatalf("expected warning after crossing second threshold")
+	}
+}
+
+func TestWorkspaceXMLAsTextFixAndReload(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	path := filepath.Join(dir, "broken.xml")
+	if err := os.WriteFile(path, []byte("<root id=\"root\">\n<a id=\"a\">\n</root>\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := ws.Load(path); err == nil {
+		t.Fatalf("broken XML should fail to load")
+	}
+	ed, err := ws.LoadXMLAsText(path)
+	if err != nil {
+		t.Fatalf("fallback load failed: %v", err)
+	}
+	doc := ed.(editor.TextDocument)
+	if !ws.IsXMLAsText(path) || !ed.IsReadOnly() {
+		t.Fatalf("fallback editor should be read-only text")
+	}
+	if err := doc.DeleteLines(2, 2); !errors.Is(err, editor.ErrReadOnly) {
+		t.Fatalf("read-only editor should refuse edits, got %v", err)
+	}
+	if _, err := ws.Reload(""); err == nil {
+		t.Fatalf("reload should fail while the file is still broken")
+	}
+
+	ed.SetReadOnly(false)
+	if err := doc.Replace(2, 1, len(`<a id="a">`), `<a id="a"/>`); err != nil {
+		t.Fatalf("fix failed: %v", err)
+	}
+	if _, err := ws.Reload(""); err == nil {
+		t.Fatalf("reload should refuse unsaved changes")
+	}
+	if err := ws.Save(""); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	reloaded, err := ws.Reload("")
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if reloaded.Type() != editor.TypeXML || ws.IsXMLAsText(path) {
+		t.Fatalf("reload should switch to the XML editor")
+	}
+	if active, _ := ws.ActiveEditor(); active != reloaded {
+		t.Fatalf("reloaded editor should stay active")
+	}
+}
+
+func TestWorkspaceCleanXMLSkipsTextFallback(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	path := filepath.Join(dir, "ok.xml")
+	if err := os.WriteFile(path, []byte(`<root id="root"/>`), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	ed, err := ws.Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if ed.Type() != editor.TypeXML || ws.IsXMLAsText(path) {
+		t.Fatalf("clean XML should open in the XML editor")
+	}
+}
+
+func TestWorkspaceSaveResolvesOpenEditors(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), nil)
+	if _, err := ws.Init("text", "notes/report.txt", false); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	var notOpen *workspace.NotOpenError
+	if err := ws.Save("report.txt"); !errors.As(err, &notOpen) || strings.Join(notOpen.Suggestions, ",") != filepath.Join("notes", "report.txt") {
+		t.Fatalf("a bare name should only suggest the open file of that name, got %v", err)
+	}
+	if err := ws.Save("notes/report.txt"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "notes"), filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("symlink failed: %v", err)
+	}
+	if err := ws.Save("link/report.txt"); err != nil {
+		t.Fatalf("another spelling of the same file should resolve: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "other.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "report.txt"), []byte("unrelated"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := ws.Close("report.txt"); !errors.As(err, &notOpen) || !notOpen.OnDisk || len(notOpen.Suggestions) != 1 {
+		t.Fatalf("an unrelated file of the same name should not resolve, got %v", err)
+	}
+	if len(ws.List()) != 1 {
+		t.Fatalf("the open notes/report.txt should stay open")
+	}
+	if err := ws.Save("other.txt"); !errors.As(err, &notOpen) || !notOpen.OnDisk || !strings.Contains(err.Error(), "load") {
+		t.Fatalf("file on disk should suggest load, got %v", err)
+	}
+	if err := ws.Save("reprot.txt"); !errors.As(err, &notOpen) || notOpen.OnDisk || strings.Join(notOpen.Suggestions, ",") != "report.txt" {
+		t.Fatalf("typo should suggest open names, got %v", err)
+	}
+	if err := ws.Save("zzz.md"); !errors.As(err, &notOpen) || len(notOpen.Suggestions) != 0 {
+		t.Fatalf("unrelated name should have no suggestions, got %v", err)
+	}
+}
+
+func TestWorkspacePromptTimeoutSetting(t *testing.T) {
+	dir := t.TempDir()
+	in, writer := io.Pipe()
+	defer writer.Close()
+	console := cli.NewConsole(in, bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), console)
+	for name, value := range map[string]string{"prompt-timeout": "1", "prompt-default": "yes"} {
+		if err := ws.Settings().Set(name, value); err != nil {
+			t.Fatalf("set %s failed: %v", name, err)
+		}
+	}
+	file := filepath.Join(dir, "draft.txt")
+	if _, err := ws.Load(file); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, err := ws.Close(""); err != nil {
+		t.Fatalf("close should fall back to the default answer: %v", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("default answer yes should save: %v", err)
+	}
+}
+
+func TestWorkspaceConfirmOffAnswersWithoutDecider(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), failingDecider{t})
+	if _, preset := ws.PresetAnswer(); preset {
+		t.Fatalf("save prompts should be asked by default")
+	}
+	for _, kv := range [][2]string{{"confirm", "off"}, {"prompt-default", "yes"}} {
+		if err := ws.Settings().Set(kv[0], kv[1]); err != nil {
+			t.Fatalf("set %s failed: %v", kv[0], err)
+		}
+	}
+	if answer, preset := ws.PresetAnswer(); !preset || !answer {
+		t.Fatalf("confirm off should preset prompt-default: %v %v", answer, preset)
+	}
+	file := filepath.Join(dir, "a.txt")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("draft"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if _, err := ws.Close(file); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "draft" {
+		t.Fatalf("the preset answer should save: %q", data)
+	}
+}
+
+// presetDecider knows its answer, so it must never be asked.
+type presetDecider struct {
+	failingDecider
+	answer bool
+}
+
+func (d presetDecider) PresetSave() (bool, bool) {
+	return d.answer, true
+}
+
+func TestWorkspacePresetDeciderSkipsPrompt(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), presetDecider{failingDecider{t}, false})
+	if answer, preset := ws.PresetAnswer(); !preset || answer {
+		t.Fatalf("the decider's preset answer should be used: %v %v", answer, preset)
+	}
+	file := filepath.Join(dir, "a.txt")
+	ed, err := ws.Load(file)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := ed.(editor.TextDocument).Append("draft"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if _, err := ws.Close(file); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("the preset answer no should discard: %v", err)
+	}
+}
+
+// cancellingDecider cancels closing one file and saves the rest.
+type cancellingDecider struct {
+	cancel string
+}
+
+func (d cancellingDecider) ConfirmSave(path string) (bool, error) {
+	if filepath.Base(path) == d.cancel {
+		return false, workspace.ErrCloseCancelled
+	}
+	return true, nil
+}
+
+func TestWorkspaceCloseAllKeepsCancelledFiles(t *testing.T) {
+	dir := t.TempDir()
+	ws := workspace.NewWorkspace(dir, events.NewBus(), workspace.NewStateKeeper(dir), logging.NewManager(), cancellingDecider{"b.txt"})
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		ed, err := ws.Load(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if err := ed.(editor.TextDocument).Append(name); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	results, err := ws.CloseAll(workspace.CloseAsk, "c.txt")
+	if err != nil {
+		t.Fatalf("close all failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("a.txt and d.txt should close: %+v", results)
+	}
+	var open []string
+	for _, info := range ws.List() {
+		open = append(open, filepath.Base(info.Path))
+	}
+	sort.Strings(open)
+	if strings.Join(open, ",") != "b.txt,c.txt" {
+		t.Fatalf("cancelled and excepted files should stay open: %v", open)
+	}
+	if active, err := ws.ActiveEditor(); err != nil || active.Name() != "c.txt" {
+		t.Fatalf("the active file should not change: %v %v", active, err)
+	}
+	if strings.Join(ws.History(), ",") != filepath.Join(dir, "c.txt")+","+filepath.Join(dir, "b.txt") {
+		t.Fatalf("history should only hold open files: %v", ws.History())
+	}
+	if _, err := ws.CloseAll(workspace.CloseAsk, "missing.txt"); err == nil {
+		t.Fatalf("an exception that is not open should fail")
+	}
+}